@@ -1,21 +1,33 @@
 package blobscache
 
 import (
+	"math"
 	"net/http"
+	"sync"
+	"time"
 
-	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/golang-lru/simplelru"
 	json "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
+
+	"github.com/castai/kvisor/metrics"
 )
 
 type ServerConfig struct {
+	// MaxSizeBytes is max total size of cached blobs. Least recently used blobs are evicted once it's exceeded.
+	MaxSizeBytes int64
+	// TTL is time after which cached blob expires. Blobs don't expire if zero.
+	TTL time.Duration
 }
 
 func NewServer(log logrus.FieldLogger, cfg ServerConfig) *Server {
+	if cfg.MaxSizeBytes == 0 {
+		cfg.MaxSizeBytes = defaultMaxSizeBytes
+	}
 	return &Server{
 		log:        log.WithField("component", "blobscache"),
 		cfg:        cfg,
-		blobsCache: newMemoryBlobsCacheStore(log),
+		blobsCache: newMemoryBlobsCacheStore(log, cfg.MaxSizeBytes, cfg.TTL),
 	}
 }
 
@@ -69,32 +81,115 @@ type blobsCacheStore interface {
 	getBlob(key string) ([]byte, bool)
 }
 
-func newMemoryBlobsCacheStore(log logrus.FieldLogger) blobsCacheStore {
-	// One large blob json size is around 16KB, so we should use max 32MB of extra memory.
-	cache, _ := lru.New(2000)
-	return &memoryBlobsCacheStore{
-		log:   log,
-		cache: cache,
+// One large blob json size is around 16KB, so by default we keep around 2000 blobs.
+const defaultMaxSizeBytes = 32 << 20
+
+// expiredSweepInterval limits how often expired blobs are removed on put.
+const expiredSweepInterval = time.Minute
+
+func newMemoryBlobsCacheStore(log logrus.FieldLogger, maxSizeBytes int64, ttl time.Duration) *memoryBlobsCacheStore {
+	c := &memoryBlobsCacheStore{
+		log:          log,
+		maxSizeBytes: maxSizeBytes,
+		ttl:          ttl,
+		now:          time.Now,
 	}
+	// Cache is bounded by total blobs size, so entries count is not limited.
+	c.cache, _ = simplelru.NewLRU(math.MaxInt32, func(key interface{}, value interface{}) {
+		c.sizeBytes -= int64(len(value.(*blobsCacheEntry).blob))
+	})
+	return c
+}
+
+type blobsCacheEntry struct {
+	blob    []byte
+	addedAt time.Time
 }
 
 type memoryBlobsCacheStore struct {
-	log   logrus.FieldLogger
-	cache *lru.Cache
+	log          logrus.FieldLogger
+	maxSizeBytes int64
+	ttl          time.Duration
+	now          func() time.Time
+
+	mu          sync.Mutex
+	cache       *simplelru.LRU
+	sizeBytes   int64
+	lastSweepAt time.Time
 }
 
 func (c *memoryBlobsCacheStore) putBlob(key string, blob []byte) {
-	c.log.Debugf("adding image blob to cache, current cache size=%d", c.cache.Len())
-	evicted := c.cache.Add(key, blob)
-	if evicted {
-		c.log.Info("evicted old image blob cache entry")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() {
+		metrics.SetBlobsCacheSizeBytes(c.sizeBytes)
+	}()
+
+	if int64(len(blob)) > c.maxSizeBytes {
+		c.log.Warnf("skipping image blob larger than cache max size, size=%d, max_size=%d", len(blob), c.maxSizeBytes)
+		return
+	}
+
+	now := c.now()
+	c.removeExpired(now)
+
+	// Replaced blob is removed first so cache size is updated by evict callback.
+	c.cache.Remove(key)
+	c.cache.Add(key, &blobsCacheEntry{blob: blob, addedAt: now})
+	c.sizeBytes += int64(len(blob))
+
+	var evicted int
+	for c.sizeBytes > c.maxSizeBytes {
+		if _, _, ok := c.cache.RemoveOldest(); !ok {
+			break
+		}
+		evicted++
+	}
+	if evicted > 0 {
+		metrics.AddBlobsCacheEvictions(metrics.BlobsCacheEvictionSize, evicted)
+		c.log.Infof("evicted %d old image blob cache entries, current cache size=%d", evicted, c.sizeBytes)
 	}
+	c.log.Debugf("added image blob to cache, current cache size=%d", c.sizeBytes)
 }
 
 func (c *memoryBlobsCacheStore) getBlob(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	val, ok := c.cache.Get(key)
 	if !ok {
 		return nil, false
 	}
-	return val.([]byte), true
+	entry := val.(*blobsCacheEntry)
+	if c.isExpired(entry, c.now()) {
+		c.cache.Remove(key)
+		metrics.AddBlobsCacheEvictions(metrics.BlobsCacheEvictionExpired, 1)
+		metrics.SetBlobsCacheSizeBytes(c.sizeBytes)
+		return nil, false
+	}
+	return entry.blob, true
+}
+
+// removeExpired removes expired blobs so blobs of deleted images are not kept until they are evicted by size.
+func (c *memoryBlobsCacheStore) removeExpired(now time.Time) {
+	if c.ttl == 0 || now.Sub(c.lastSweepAt) < expiredSweepInterval {
+		return
+	}
+	c.lastSweepAt = now
+
+	var expired int
+	for _, key := range c.cache.Keys() {
+		val, ok := c.cache.Peek(key)
+		if ok && c.isExpired(val.(*blobsCacheEntry), now) {
+			c.cache.Remove(key)
+			expired++
+		}
+	}
+	if expired > 0 {
+		metrics.AddBlobsCacheEvictions(metrics.BlobsCacheEvictionExpired, expired)
+	}
+}
+
+func (c *memoryBlobsCacheStore) isExpired(entry *blobsCacheEntry, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(entry.addedAt) > c.ttl
 }
@@ -43,3 +43,59 @@ func TestBlobsCacheServer(t *testing.T) {
 	r.NoError(err)
 	r.Equal(blob, addedBlob)
 }
+
+func TestMemoryBlobsCacheStore(t *testing.T) {
+	log := logrus.New()
+
+	t.Run("evict least recently used blobs when max size is exceeded", func(t *testing.T) {
+		r := require.New(t)
+		store := newMemoryBlobsCacheStore(log, 10, 0)
+
+		store.putBlob("b1", []byte("1111"))
+		store.putBlob("b2", []byte("2222"))
+		// Access b1 so b2 becomes least recently used.
+		_, found := store.getBlob("b1")
+		r.True(found)
+		store.putBlob("b3", []byte("3333"))
+
+		_, found = store.getBlob("b2")
+		r.False(found)
+		_, found = store.getBlob("b1")
+		r.True(found)
+		_, found = store.getBlob("b3")
+		r.True(found)
+		r.Equal(int64(8), store.sizeBytes)
+
+		// Replaced blob size is accounted once.
+		store.putBlob("b3", []byte("33"))
+		r.Equal(int64(6), store.sizeBytes)
+
+		// Blob larger than cache is not added.
+		store.putBlob("b4", []byte("44444444444"))
+		_, found = store.getBlob("b4")
+		r.False(found)
+		r.Equal(int64(6), store.sizeBytes)
+	})
+
+	t.Run("expire blobs after ttl", func(t *testing.T) {
+		r := require.New(t)
+		store := newMemoryBlobsCacheStore(log, 100, time.Hour)
+		now := time.Now()
+		store.now = func() time.Time { return now }
+
+		store.putBlob("b1", []byte("1111"))
+		store.putBlob("b2", []byte("2222"))
+		_, found := store.getBlob("b1")
+		r.True(found)
+
+		now = now.Add(time.Hour + time.Second)
+		_, found = store.getBlob("b1")
+		r.False(found)
+		r.Equal(int64(4), store.sizeBytes)
+
+		// Expired blobs which are never read are removed on put.
+		store.putBlob("b3", []byte("3333"))
+		r.Equal(1, store.cache.Len())
+		r.Equal(int64(4), store.sizeBytes)
+	})
+}
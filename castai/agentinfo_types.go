@@ -0,0 +1,9 @@
+package castai
+
+type AgentInfo struct {
+	Version         string   `json:"version"`
+	GitCommit       string   `json:"gitCommit"`
+	Provider        string   `json:"provider"`
+	K8sVersion      string   `json:"k8sVersion"`
+	EnabledFeatures []string `json:"enabledFeatures"`
+}
@@ -1,13 +1,27 @@
 package castai
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/castai/kvisor/config"
 )
@@ -25,7 +39,7 @@ func TestClient_SendCISReport(t *testing.T) {
 
 	cl := NewClient(apiURL, apiKey, nil, clusterID, false, "castai-kvisor", config.SecurityAgentVersion{
 		Version: "69",
-	})
+	}, 1, config.DeadLetter{})
 
 	report, err := readReport()
 	r.NoError(err)
@@ -34,6 +48,401 @@ func TestClient_SendCISReport(t *testing.T) {
 	r.NoError(err)
 }
 
+func TestClient_Tracing(t *testing.T) {
+	r := require.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	var traceParent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceParent = req.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{})
+	_, err := cl.GetSyncState(context.Background(), &SyncStateFilter{})
+	r.NoError(err)
+
+	spans := exporter.GetSpans()
+	r.Len(spans, 1)
+	r.Equal("castai.GetSyncState", spans[0].Name)
+	r.Contains(traceParent, spans[0].SpanContext.TraceID().String())
+}
+
+func TestClient_RequestID(t *testing.T) {
+	r := require.New(t)
+
+	var mu sync.Mutex
+	var requestIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requestIDs = append(requestIDs, req.Header.Get(headerRequestID))
+		mu.Unlock()
+		// Rejected reports are not retried, so each call sends single request.
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{})
+	ctx := context.Background()
+	_, telemetryErr := cl.PostTelemetry(ctx, false)
+	_, syncStateErr := cl.GetSyncState(ctx, &SyncStateFilter{})
+	errs := []error{
+		telemetryErr,
+		syncStateErr,
+		cl.SendDeltaReport(ctx, &Delta{}),
+		cl.SendLogs(ctx, &LogEvent{Message: "failed"}),
+	}
+
+	r.Len(requestIDs, len(errs))
+	for i, err := range errs {
+		r.NotEmpty(requestIDs[i])
+		r.Error(err)
+		r.Contains(err.Error(), "request_id="+requestIDs[i])
+	}
+	r.Len(lo.Uniq(requestIDs), len(requestIDs))
+}
+
+func TestClient_DeadLetter(t *testing.T) {
+	t.Run("write failed report to dead-letter dir", func(t *testing.T) {
+		r := require.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		})
+		checks := []LinterCheck{{ResourceID: "r1"}}
+		r.Error(cl.SendLinterChecks(context.Background(), checks))
+
+		files, err := filepath.Glob(filepath.Join(dir, "*-linter-checks.json.gz"))
+		r.NoError(err)
+		r.Len(files, 1)
+		f, err := os.Open(files[0])
+		r.NoError(err)
+		defer f.Close()
+		gzipReader, err := gzip.NewReader(f)
+		r.NoError(err)
+		var actual []LinterCheck
+		r.NoError(json.NewDecoder(gzipReader).Decode(&actual))
+		r.Equal(checks, actual)
+	})
+
+	t.Run("do not write failed delta report to dead-letter dir", func(t *testing.T) {
+		r := require.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		})
+		r.Error(cl.SendDeltaReport(context.Background(), &Delta{}))
+
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+	})
+
+	t.Run("retry report before writing it to dead-letter dir", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		})
+		r.NoError(cl.SendLinterChecks(context.Background(), []LinterCheck{{ResourceID: "r1"}}))
+		r.Equal(int32(2), calls.Load())
+
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+	})
+
+	t.Run("do not write rejected or cancelled reports to dead-letter dir", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		})
+		r.Error(cl.SendLinterChecks(context.Background(), []LinterCheck{{ResourceID: "r1"}}))
+		// Rejected reports are not retried.
+		r.Equal(int32(1), calls.Load())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r.ErrorIs(cl.SendLinterChecks(ctx, []LinterCheck{{ResourceID: "r1"}}), context.Canceled)
+
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+	})
+
+	t.Run("remove oldest reports when max size is exceeded", func(t *testing.T) {
+		r := require.New(t)
+
+		dir := t.TempDir()
+		// Random payload is not compressed, so each report takes more than 1KB.
+		sink := newDeadLetterSink(config.DeadLetter{Dir: dir, MaxSizeBytes: 2500})
+		for _, reportType := range []string{"first", "second", "third"} {
+			r.NoError(sink.write(reportType, func(w io.Writer) error {
+				_, err := io.CopyN(w, rand.Reader, 1024)
+				return err
+			}))
+		}
+
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Len(files, 2)
+		r.Contains(files[0].Name(), "second")
+		r.Contains(files[1].Name(), "third")
+	})
+}
+
+func TestClient_ReplayDeadLetters(t *testing.T) {
+	t.Run("replay reports once backend accepts reports again", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			mu       sync.Mutex
+			failing  = true
+			received [][]LinterCheck
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failing {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			gzipReader, err := gzip.NewReader(req.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var checks []LinterCheck
+			if err := json.NewDecoder(gzipReader).Decode(&checks); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, checks)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		})
+		ctx := context.Background()
+		failedChecks := []LinterCheck{{ResourceID: "failed"}}
+		r.Error(cl.SendLinterChecks(ctx, failedChecks))
+
+		// Reports are not replayed while backend is failing.
+		r.NoError(cl.ReplayDeadLetters(ctx))
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Len(files, 1)
+
+		mu.Lock()
+		failing = false
+		mu.Unlock()
+		recoveredChecks := []LinterCheck{{ResourceID: "recovered"}}
+		r.NoError(cl.SendLinterChecks(ctx, recoveredChecks))
+
+		r.NoError(cl.ReplayDeadLetters(ctx))
+		files, err = os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+		mu.Lock()
+		defer mu.Unlock()
+		r.Equal([][]LinterCheck{recoveredChecks, failedChecks}, received)
+	})
+
+	t.Run("drop rejected report at the head of the queue", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			mu       sync.Mutex
+			received []string
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			gzipReader, err := gzip.NewReader(req.Body)
+			r.NoError(err)
+			var checks []LinterCheck
+			r.NoError(json.NewDecoder(gzipReader).Decode(&checks))
+			if checks[0].ResourceID == "poison" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, checks[0].ResourceID)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		}).(*client)
+		for _, id := range []string{"poison", "r1"} {
+			writeDeadLetterChecks(t, cl, []LinterCheck{{ResourceID: id}})
+		}
+		ctx := context.Background()
+		r.NoError(cl.SendLinterChecks(ctx, []LinterCheck{{ResourceID: "recovered"}}))
+
+		r.NoError(cl.ReplayDeadLetters(ctx))
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+		mu.Lock()
+		defer mu.Unlock()
+		r.Equal([]string{"recovered", "r1"}, received)
+	})
+
+	t.Run("keep reports and health when replay fails", func(t *testing.T) {
+		r := require.New(t)
+
+		var failing atomic.Bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		}).(*client)
+		writeDeadLetterChecks(t, cl, []LinterCheck{{ResourceID: "r1"}})
+		ctx := context.Background()
+		r.NoError(cl.SendLinterChecks(ctx, []LinterCheck{{ResourceID: "recovered"}}))
+
+		failing.Store(true)
+		r.Error(cl.ReplayDeadLetters(ctx))
+		r.True(cl.healthy.Load())
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Len(files, 1)
+	})
+
+	t.Run("drop state reports superseded by newer report", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			mu       sync.Mutex
+			received []string
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, path.Base(req.URL.Path))
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		}).(*client)
+		r.NoError(cl.deadLetter.write(ReportTypeAgentInfo, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(&AgentInfo{})
+		}))
+		writeDeadLetterChecks(t, cl, []LinterCheck{{ResourceID: "r1"}})
+		ctx := context.Background()
+		r.NoError(cl.SendAgentInfo(ctx, &AgentInfo{}))
+
+		r.NoError(cl.ReplayDeadLetters(ctx))
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+		mu.Lock()
+		defer mu.Unlock()
+		r.Equal([]string{ReportTypeAgentInfo, ReportTypeLinter}, received)
+	})
+
+	t.Run("drop delta reports instead of replaying them", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			mu       sync.Mutex
+			received []string
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, path.Base(req.URL.Path))
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		cl := NewClient(srv.URL, "key", logrus.New(), "c1", false, "castai-kvisor", config.SecurityAgentVersion{}, 1, config.DeadLetter{
+			Dir:          dir,
+			MaxSizeBytes: 1 << 20,
+		}).(*client)
+		r.NoError(cl.deadLetter.write(ReportTypeDelta, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(&Delta{})
+		}))
+		writeDeadLetterChecks(t, cl, []LinterCheck{{ResourceID: "r1"}})
+		ctx := context.Background()
+		r.NoError(cl.SendLinterChecks(ctx, []LinterCheck{{ResourceID: "recovered"}}))
+
+		r.NoError(cl.ReplayDeadLetters(ctx))
+		files, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(files)
+		mu.Lock()
+		defer mu.Unlock()
+		r.Equal([]string{ReportTypeLinter, ReportTypeLinter}, received)
+	})
+}
+
+func writeDeadLetterChecks(t *testing.T, cl *client, checks []LinterCheck) {
+	t.Helper()
+	require.NoError(t, cl.deadLetter.write(ReportTypeLinter, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(checks)
+	}))
+}
+
 func readReport() (*KubeBenchReport, error) {
 	file, err := os.OpenFile("./kube-bench-gke.json", os.O_RDONLY, 0666)
 	if err != nil {
@@ -6,19 +6,27 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
 	json "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/tracing"
 )
 
 const (
@@ -26,6 +34,9 @@ const (
 	headerUserAgent       = "User-Agent"
 	headerContentType     = "Content-Type"
 	headerContentEncoding = "Content-Encoding"
+	// headerRequestID correlates agent requests with backend logs. Each call gets new ID which is
+	// logged and included in returned errors.
+	headerRequestID       = "X-Request-ID"
 	totalSendDeltaTimeout = 2 * time.Minute
 
 	ReportTypeImagesResourcesChange = "images-resources-change"
@@ -34,6 +45,9 @@ const (
 	ReportTypeLinter                = "linter-checks"
 	ReportTypeImageMeta             = "image-metadata"
 	ReportTypeCloudScan             = "cloud-scan"
+	ReportTypeNodeImages            = "node-images"
+	ReportTypeNodeInventory         = "node-inventory"
+	ReportTypeAgentInfo             = "agent-info"
 )
 
 type Client interface {
@@ -44,8 +58,12 @@ type Client interface {
 	SendLinterChecks(ctx context.Context, checks []LinterCheck) error
 	SendImageMetadata(ctx context.Context, meta *ImageMetadata) error
 	SendCISCloudScanReport(ctx context.Context, report *CloudScanReport) error
+	SendNodeImagesInventory(ctx context.Context, report *NodeImagesInventory) error
+	SendNodeInventory(ctx context.Context, report *NodeInventory) error
+	SendAgentInfo(ctx context.Context, info *AgentInfo) error
 	PostTelemetry(ctx context.Context, initial bool) (*TelemetryResponse, error)
 	GetSyncState(ctx context.Context, filter *SyncStateFilter) (*SyncStateResponse, error)
+	ReplayDeadLetters(ctx context.Context) error
 }
 
 func NewClient(
@@ -55,6 +73,8 @@ func NewClient(
 	policyEnforcement bool,
 	binName string,
 	binVersion config.SecurityAgentVersion,
+	deltaSerializationWorkers int,
+	deadLetter config.DeadLetter,
 ) Client {
 	httpClient := newDefaultDeltaHTTPClient()
 	restClient := resty.NewWithClient(httpClient)
@@ -74,6 +94,10 @@ func NewClient(
 		clusterID:         clusterID,
 		policyEnforcement: policyEnforcement,
 		binVersion:        binVersion,
+
+		deltaSerializationWorkers: deltaSerializationWorkers,
+		deadLetter:                newDeadLetterSink(deadLetter),
+		stateReportsSentAt:        map[string]time.Time{},
 	}
 }
 
@@ -107,6 +131,26 @@ type client struct {
 	clusterID         string
 	policyEnforcement bool
 	binVersion        config.SecurityAgentVersion
+
+	// deltaSerializationWorkers enables parallel encoding of delta items if greater than 1.
+	deltaSerializationWorkers int
+	// deadLetter stores reports which failed to upload. Nil if disabled.
+	deadLetter *deadLetterSink
+	// healthy is set when the last report was accepted or rejected by backend, ie. backend is reachable.
+	healthy atomic.Bool
+
+	stateReportsMu sync.Mutex
+	// stateReportsSentAt is time of the last sent report of each state report type.
+	stateReportsSentAt map[string]time.Time
+}
+
+// stateReportTypes are report types which replace previously sent state of the same type. Dead-lettered
+// report of such type is stale once newer report of the same type is sent. Delta reports are not state reports
+// even if they contain full snapshot, incremental delta is not superseded by the next one.
+var stateReportTypes = map[string]struct{}{
+	ReportTypeNodeImages:    {},
+	ReportTypeNodeInventory: {},
+	ReportTypeAgentInfo:     {},
 }
 
 func (c *client) PostTelemetry(ctx context.Context, initial bool) (*TelemetryResponse, error) {
@@ -122,12 +166,18 @@ func (c *client) PostTelemetry(ctx context.Context, initial bool) (*TelemetryRes
 	}
 	req.SetBody(body)
 
+	requestID := uuid.NewString()
+	req.SetHeader(headerRequestID, requestID)
+	c.log.Debugf("sending telemetry, request_id=%s", requestID)
+
 	resp, err := req.Post(fmt.Sprintf("/v1/security/insights/%s/telemetry", c.clusterID))
 	if err != nil {
-		return nil, fmt.Errorf("sending telemetry: %w", err)
+		c.log.Debugf("sending telemetry failed, request_id=%s: %v", requestID, err)
+		return nil, fmt.Errorf("sending telemetry request_id=%s: %w", requestID, err)
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("sending telemetry: request error status_code=%d body=%s", resp.StatusCode(), resp.Body())
+		c.log.Debugf("sending telemetry failed, request_id=%s status_code=%d", requestID, resp.StatusCode())
+		return nil, fmt.Errorf("sending telemetry: request error status_code=%d body=%s request_id=%s", resp.StatusCode(), resp.Body(), requestID)
 	}
 
 	var response TelemetryResponse
@@ -139,16 +189,22 @@ func (c *client) PostTelemetry(ctx context.Context, initial bool) (*TelemetryRes
 }
 
 func (c *client) SendLogs(ctx context.Context, req *LogEvent) error {
+	requestID := uuid.NewString()
+	c.log.Debugf("sending logs, request_id=%s", requestID)
+
 	resp, err := c.restClient.R().
 		SetBody(req).
 		SetContext(ctx).
+		SetHeader(headerRequestID, requestID).
 		Post(fmt.Sprintf("/v1/security/insights/%s/log", c.clusterID))
 
 	if err != nil {
-		return fmt.Errorf("sending logs: %w", err)
+		c.log.Debugf("sending logs failed, request_id=%s: %v", requestID, err)
+		return fmt.Errorf("sending logs request_id=%s: %w", requestID, err)
 	}
 	if resp.IsError() {
-		return fmt.Errorf("sending logs: request error status_code=%d body=%s", resp.StatusCode(), resp.Body())
+		c.log.Debugf("sending logs failed, request_id=%s status_code=%d", requestID, resp.StatusCode())
+		return fmt.Errorf("sending logs: request error status_code=%d body=%s request_id=%s", resp.StatusCode(), resp.Body(), requestID)
 	}
 
 	return nil
@@ -178,12 +234,79 @@ func (c *client) SendCISCloudScanReport(ctx context.Context, report *CloudScanRe
 	return c.sendReport(ctx, report, ReportTypeCloudScan)
 }
 
-func (c *client) sendReport(ctx context.Context, report any, reportType string) error {
-	uri, err := url.Parse(fmt.Sprintf("%s/v1/security/insights/agent/%s/%s", c.apiURL, c.clusterID, reportType))
-	if err != nil {
-		return fmt.Errorf("invalid url: %w", err)
+func (c *client) SendNodeImagesInventory(ctx context.Context, report *NodeImagesInventory) error {
+	return c.sendReport(ctx, report, ReportTypeNodeImages)
+}
+
+func (c *client) SendNodeInventory(ctx context.Context, report *NodeInventory) error {
+	return c.sendReport(ctx, report, ReportTypeNodeInventory)
+}
+
+func (c *client) SendAgentInfo(ctx context.Context, info *AgentInfo) error {
+	return c.sendReport(ctx, info, ReportTypeAgentInfo)
+}
+
+func (c *client) sendReport(ctx context.Context, report any, reportType string) (rerr error) {
+	ctx, span := tracing.Start(ctx, "castai.sendReport", attribute.String("report_type", reportType))
+	defer func() { tracing.End(span, rerr) }()
+
+	sentAt := time.Now()
+	defer func() {
+		if errors.Is(rerr, context.Canceled) {
+			return
+		}
+		c.healthy.Store(!isRetryableReportError(rerr))
+		if rerr == nil {
+			c.setStateReportSent(reportType, sentAt)
+		}
+	}()
+
+	// Delta items are kept by delta controller until they are sent, so failed delta is not dead-lettered.
+	if c.deadLetter != nil && reportType != ReportTypeDelta {
+		defer func() {
+			// Rejected reports would be rejected on replay too, so only reports which failed due to
+			// network or backend errors are dead-lettered.
+			if rerr == nil || !isRetryableReportError(rerr) {
+				return
+			}
+			if err := c.deadLetter.write(reportType, func(w io.Writer) error {
+				return c.encodeReport(w, report)
+			}); err != nil {
+				c.log.Errorf("writing %s report to dead-letter dir: %v", reportType, err)
+			}
+		}()
+	}
+
+	backoff := wait.Backoff{
+		Duration: 10 * time.Millisecond,
+		Factor:   1.5,
+		Jitter:   0.2,
+		Steps:    3,
+	}
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		// Body is streamed, so it's encoded again for each attempt.
+		body := c.newReportBody(report)
+		lastErr = c.postReport(ctx, reportType, body)
+		_ = body.Close()
+		if lastErr == nil {
+			return true, nil
+		}
+		if !isRetryableReportError(lastErr) {
+			return false, lastErr
+		}
+		c.log.Warnf("failed sending %s report: %v", reportType, lastErr)
+		return false, nil
+	})
+	if err != nil && lastErr != nil && ctx.Err() == nil {
+		// Retries are exhausted.
+		return lastErr
 	}
+	return err
+}
 
+// newReportBody returns gzip compressed json report which is encoded while it's read.
+func (c *client) newReportBody(report any) io.ReadCloser {
 	pipeReader, pipeWriter := io.Pipe()
 
 	go func() {
@@ -200,15 +323,25 @@ func (c *client) sendReport(ctx context.Context, report any, reportType string)
 			}
 		}()
 
-		if err := json.NewEncoder(gzipWriter).Encode(report); err != nil {
+		if err := c.encodeReport(gzipWriter, report); err != nil {
 			c.log.Errorf("compressing json: %v", err)
 		}
 	}()
 
+	return pipeReader
+}
+
+// postReport sends gzip compressed json report body.
+func (c *client) postReport(ctx context.Context, reportType string, body io.Reader) error {
+	uri, err := url.Parse(fmt.Sprintf("%s/v1/security/insights/agent/%s/%s", c.apiURL, c.clusterID, reportType))
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, totalSendDeltaTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri.String(), pipeReader)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri.String(), body)
 	if err != nil {
 		return fmt.Errorf("creating request for report type %s: %w", reportType, err)
 	}
@@ -217,25 +350,14 @@ func (c *client) sendReport(ctx context.Context, report any, reportType string)
 	req.Header.Set(headerContentEncoding, "gzip")
 	req.Header.Set(headerAPIKey, c.apiKey)
 	req.Header.Set(headerUserAgent, "castai-kvisor/"+c.binVersion.Version)
+	requestID := uuid.NewString()
+	req.Header.Set(headerRequestID, requestID)
+	tracing.InjectHeaders(ctx, req.Header)
+	c.log.Debugf("sending %s report, request_id=%s", reportType, requestID)
 
-	var resp *http.Response
-
-	backoff := wait.Backoff{
-		Duration: 10 * time.Millisecond,
-		Factor:   1.5,
-		Jitter:   0.2,
-		Steps:    3,
-	}
-	err = wait.ExponentialBackoffWithContext(ctx, backoff, func(context.Context) (done bool, err error) {
-		resp, err = c.httpClient.Do(req) //nolint:bodyclose
-		if err != nil {
-			c.log.Warnf("failed sending request for report %s: %v", reportType, err)
-			return false, fmt.Errorf("sending request %s: %w", reportType, err)
-		}
-		return true, nil
-	})
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("sending request %s request_id=%s: %w", reportType, requestID, err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -248,21 +370,145 @@ func (c *client) sendReport(ctx context.Context, report any, reportType string)
 		if _, err := buf.ReadFrom(resp.Body); err != nil {
 			c.log.Errorf("failed reading error response body: %v", err)
 		}
-		return fmt.Errorf("%s request error status_code=%d body=%s url=%s", reportType, resp.StatusCode, buf.String(), uri.String())
+		c.log.Debugf("sending %s report failed, request_id=%s status_code=%d", reportType, requestID, resp.StatusCode)
+		return &reportStatusError{
+			statusCode: resp.StatusCode,
+			msg:        fmt.Sprintf("%s request error status_code=%d body=%s url=%s request_id=%s", reportType, resp.StatusCode, buf.String(), uri.String(), requestID),
+		}
+	}
+
+	return nil
+}
+
+// reportStatusError is returned when backend responds to report with error status code.
+type reportStatusError struct {
+	statusCode int
+	msg        string
+}
+
+func (e *reportStatusError) Error() string {
+	return e.msg
+}
+
+// isRetryableReportError returns true if report failed due to network or backend error, so it may succeed later.
+// Reports rejected by backend with 4xx status code and cancelled reports are not retried.
+func isRetryableReportError(err error) bool {
+	var statusErr *reportStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ReplayDeadLetters resends dead-lettered reports, oldest first, once backend accepts reports again.
+// Replayed reports are removed together with reports rejected by backend, stale state reports and delta reports
+// written by previous versions.
+// Replay stops on first retryable failure and is retried on the next call.
+func (c *client) ReplayDeadLetters(ctx context.Context) error {
+	if c.deadLetter == nil || !c.healthy.Load() {
+		return nil
 	}
 
+	reports, err := c.deadLetter.list()
+	if err != nil {
+		return err
+	}
+	var replayed, dropped int
+	defer func() {
+		if replayed > 0 || dropped > 0 {
+			c.log.Infof("replayed dead-lettered reports: %d, dropped: %d", replayed, dropped)
+		}
+	}()
+	for _, report := range reports {
+		// Delta reports are no longer dead-lettered, but may be left by previous versions. Failed delta is already
+		// included in the next one, so replaying it would apply older changes on top of newer state.
+		if report.reportType == ReportTypeDelta || c.isStateReportStale(report) {
+			if err := c.deadLetter.remove(report.path); err != nil {
+				return err
+			}
+			dropped++
+			continue
+		}
+		if err := c.replayReport(ctx, report); err != nil {
+			if isRetryableReportError(err) || errors.Is(err, context.Canceled) {
+				return err
+			}
+			// Rejected report would block all following reports, so it's dropped.
+			c.log.Warnf("dropping dead-lettered %s report: %v", report.reportType, err)
+			if err := c.deadLetter.remove(report.path); err != nil {
+				return err
+			}
+			dropped++
+			continue
+		}
+		replayed++
+	}
 	return nil
 }
 
-func (c *client) GetSyncState(ctx context.Context, filter *SyncStateFilter) (*SyncStateResponse, error) {
+func (c *client) replayReport(ctx context.Context, report deadLetterReport) error {
+	f, err := os.Open(report.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Report was removed by rotation.
+			return nil
+		}
+		return fmt.Errorf("opening dead-lettered report: %w", err)
+	}
+	defer f.Close()
+
+	if err := c.postReport(ctx, report.reportType, f); err != nil {
+		return fmt.Errorf("replaying dead-lettered report: %w", err)
+	}
+	return c.deadLetter.remove(report.path)
+}
+
+func (c *client) setStateReportSent(reportType string, sentAt time.Time) {
+	if _, found := stateReportTypes[reportType]; !found {
+		return
+	}
+	c.stateReportsMu.Lock()
+	defer c.stateReportsMu.Unlock()
+	c.stateReportsSentAt[reportType] = sentAt
+}
+
+// isStateReportStale returns true if newer report of the same state report type was sent after report was dead-lettered.
+func (c *client) isStateReportStale(report deadLetterReport) bool {
+	c.stateReportsMu.Lock()
+	defer c.stateReportsMu.Unlock()
+	sentAt, found := c.stateReportsSentAt[report.reportType]
+	return found && sentAt.After(report.writtenAt)
+}
+
+func (c *client) encodeReport(w io.Writer, report any) error {
+	if delta, ok := report.(*Delta); ok && c.deltaSerializationWorkers > 1 && len(delta.Items) > 0 {
+		return encodeDeltaParallel(w, delta, c.deltaSerializationWorkers)
+	}
+	return json.NewEncoder(w).Encode(report)
+}
+
+func (c *client) GetSyncState(ctx context.Context, filter *SyncStateFilter) (_ *SyncStateResponse, rerr error) {
+	ctx, span := tracing.Start(ctx, "castai.GetSyncState")
+	defer func() { tracing.End(span, rerr) }()
+
+	requestID := uuid.NewString()
 	req := c.restClient.R().SetContext(ctx)
+	req.SetHeader(headerRequestID, requestID)
+	tracing.InjectHeaders(ctx, req.Header)
 	req.SetBody(filter)
+	c.log.Debugf("calling sync state, request_id=%s", requestID)
 	resp, err := req.Post(fmt.Sprintf("/v1/security/insights/%s/sync-state", c.clusterID))
 	if err != nil {
-		return nil, fmt.Errorf("calling sync state: %w", err)
+		c.log.Debugf("calling sync state failed, request_id=%s: %v", requestID, err)
+		return nil, fmt.Errorf("calling sync state request_id=%s: %w", requestID, err)
 	}
 	if resp.IsError() {
-		return nil, fmt.Errorf("calling sync state: request error status_code=%d body=%s", resp.StatusCode(), resp.Body())
+		c.log.Debugf("calling sync state failed, request_id=%s status_code=%d", requestID, resp.StatusCode())
+		return nil, fmt.Errorf("calling sync state: request error status_code=%d body=%s request_id=%s", resp.StatusCode(), resp.Body(), requestID)
 	}
 	var response SyncStateResponse
 	if err := json.Unmarshal(resp.Body(), &response); err != nil {
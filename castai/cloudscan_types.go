@@ -7,8 +7,10 @@ type CloudScanReport struct {
 }
 
 type CloudScanCheck struct {
-	ID        string          `json:"id"`
-	Automated bool            `json:"automated,omitempty"`
-	Passed    bool            `json:"passed,omitempty"`
-	Context   json.RawMessage `json:"context,omitempty"`
+	ID            string          `json:"id"`
+	Automated     bool            `json:"automated,omitempty"`
+	Passed        bool            `json:"passed,omitempty"`
+	NotApplicable bool            `json:"notApplicable,omitempty"`
+	Errored       bool            `json:"errored,omitempty"`
+	Context       json.RawMessage `json:"context,omitempty"`
 }
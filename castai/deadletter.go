@@ -0,0 +1,211 @@
+package castai
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/castai/kvisor/config"
+)
+
+const deadLetterFileExt = ".json.gz"
+
+// newDeadLetterSink returns sink for reports which failed to upload. Nil is returned if dead-letter dir is not configured.
+func newDeadLetterSink(cfg config.DeadLetter) *deadLetterSink {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &deadLetterSink{
+		dir:     cfg.Dir,
+		maxSize: cfg.MaxSizeBytes,
+	}
+}
+
+// deadLetterSink writes failed report payloads to local directory so they can be replayed manually.
+// Files are named by write time, so the oldest reports are removed first once directory size exceeds max size.
+type deadLetterSink struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+}
+
+func (s *deadLetterSink) write(reportType string, encode func(w io.Writer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return fmt.Errorf("creating dead-letter dir: %w", err)
+	}
+
+	name := fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), reportType, deadLetterFileExt)
+	// Report is written to temp file first so partially written reports are never replayed.
+	tmpPath := filepath.Join(s.dir, "."+name)
+	if err := writeGzipFile(tmpPath, encode); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing dead-letter report: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("renaming dead-letter report: %w", err)
+	}
+
+	return s.rotate()
+}
+
+type deadLetterReport struct {
+	path       string
+	reportType string
+	writtenAt  time.Time
+}
+
+// list returns stored reports sorted from the oldest.
+func (s *deadLetterSink) list() ([]deadLetterReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading dead-letter dir: %w", err)
+	}
+
+	var reports []deadLetterReport
+	for _, entry := range entries {
+		if !isDeadLetterReport(entry) {
+			continue
+		}
+		writtenAt, reportType, found := strings.Cut(strings.TrimSuffix(entry.Name(), deadLetterFileExt), "-")
+		if !found {
+			continue
+		}
+		writtenAtNano, err := strconv.ParseInt(writtenAt, 10, 64)
+		if err != nil {
+			continue
+		}
+		reports = append(reports, deadLetterReport{
+			path:       filepath.Join(s.dir, entry.Name()),
+			reportType: reportType,
+			writtenAt:  time.Unix(0, writtenAtNano),
+		})
+	}
+	return reports, nil
+}
+
+func (s *deadLetterSink) remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing dead-letter report: %w", err)
+	}
+	return nil
+}
+
+// rotate removes the oldest reports until total size fits max size.
+func (s *deadLetterSink) rotate() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("reading dead-letter dir: %w", err)
+	}
+
+	type report struct {
+		path string
+		size int64
+	}
+	var reports []report
+	var total int64
+	// Entries are sorted by file name which starts with write timestamp.
+	for _, entry := range entries {
+		if !isDeadLetterReport(entry) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		reports = append(reports, report{path: filepath.Join(s.dir, entry.Name()), size: info.Size()})
+		total += info.Size()
+	}
+
+	for _, r := range reports {
+		if total <= s.maxSize {
+			break
+		}
+		if err := os.Remove(r.path); err != nil {
+			return fmt.Errorf("removing dead-letter report: %w", err)
+		}
+		total -= r.size
+	}
+	return nil
+}
+
+// isDeadLetterReport returns false for temp files of reports which are still being written.
+func isDeadLetterReport(entry fs.DirEntry) bool {
+	return !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && strings.HasSuffix(entry.Name(), deadLetterFileExt)
+}
+
+func writeGzipFile(path string, encode func(w io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzipWriter := gzip.NewWriter(f)
+	if err := encode(gzipWriter); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func NewDeadLetterReplayer(log logrus.FieldLogger, client Client, interval time.Duration) *DeadLetterReplayer {
+	return &DeadLetterReplayer{
+		log:      log.WithField("component", "dead_letter_replayer"),
+		client:   client,
+		interval: interval,
+	}
+}
+
+// DeadLetterReplayer periodically resends dead-lettered reports.
+type DeadLetterReplayer struct {
+	log      logrus.FieldLogger
+	client   Client
+	interval time.Duration
+}
+
+// NeedLeaderElection returns true since only leader sends reports, replayed reports must not race with them.
+func (r *DeadLetterReplayer) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *DeadLetterReplayer) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.client.ReplayDeadLetters(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				r.log.Warnf("replaying dead-lettered reports: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package castai
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	json "github.com/json-iterator/go"
+	"golang.org/x/sync/errgroup"
+)
+
+// encodeDeltaParallel encodes delta items in batches on multiple goroutines and concatenates them.
+// Output is equal to encoding delta with json.Encoder.
+func encodeDeltaParallel(w io.Writer, delta *Delta, workers int) error {
+	batchSize := (len(delta.Items) + workers - 1) / workers
+	var batches [][]DeltaItem
+	for start := 0; start < len(delta.Items); start += batchSize {
+		end := min(start+batchSize, len(delta.Items))
+		batches = append(batches, delta.Items[start:end])
+	}
+
+	encoded := make([][]byte, len(batches))
+	var g errgroup.Group
+	for i, batch := range batches {
+		i, batch := i, batch
+		g.Go(func() error {
+			b, err := json.Marshal(batch)
+			if err != nil {
+				return fmt.Errorf("encoding delta items: %w", err)
+			}
+			// Strip array brackets so batches can be joined.
+			encoded[i] = b[1 : len(b)-1]
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if delta.FullSnapshot {
+		buf.WriteString(`"full_snapshot":true,`)
+	}
+	buf.WriteString(`"items":`)
+	if delta.Items == nil {
+		buf.WriteString("null")
+	} else {
+		buf.WriteByte('[')
+		buf.Write(bytes.Join(encoded, []byte{','}))
+		buf.WriteByte(']')
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
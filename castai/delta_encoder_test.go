@@ -0,0 +1,79 @@
+package castai
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDeltaParallel(t *testing.T) {
+	for _, delta := range []*Delta{
+		newTestDelta(0),
+		{Items: []DeltaItem{}},
+		newTestDelta(1),
+		newTestDelta(7),
+		{FullSnapshot: true, Items: newTestDelta(100).Items},
+	} {
+		t.Run(fmt.Sprintf("items %d", len(delta.Items)), func(t *testing.T) {
+			r := require.New(t)
+
+			var expected bytes.Buffer
+			r.NoError(json.NewEncoder(&expected).Encode(delta))
+
+			var actual bytes.Buffer
+			r.NoError(encodeDeltaParallel(&actual, delta, 4))
+			r.Equal(expected.String(), actual.String())
+		})
+	}
+}
+
+func BenchmarkEncodeDelta(b *testing.B) {
+	delta := newTestDelta(10000)
+
+	b.Run("single", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			if err := json.NewEncoder(&buf).Encode(delta); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("parallel %d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var buf bytes.Buffer
+				if err := encodeDeltaParallel(&buf, delta, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func newTestDelta(items int) *Delta {
+	if items == 0 {
+		return &Delta{}
+	}
+	delta := &Delta{}
+	for i := 0; i < items; i++ {
+		delta.Items = append(delta.Items, DeltaItem{
+			Event:            EventAdd,
+			ObjectUID:        strconv.Itoa(i),
+			ObjectName:       "nginx-" + strconv.Itoa(i),
+			ObjectNamespace:  "default",
+			ObjectKind:       "Deployment",
+			ObjectAPIVersion: "apps/v1",
+			ObjectCreatedAt:  time.Date(2023, 11, 3, 12, 0, 0, 0, time.UTC),
+			ObjectLabels:     map[string]string{"app": "nginx"},
+			ObjectContainers: []Container{{Name: "nginx", ImageName: "nginx:1.25"}},
+			ObjectSpec:       json.RawMessage(`{"replicas":3}`),
+		})
+	}
+	return delta
+}
@@ -10,6 +10,7 @@ type ImageMetadata struct {
 	ImageID      string           `json:"imageID,omitempty"`
 	ImageDigest  string           `json:"imageDigest,omitempty"`
 	ResourceIDs  []string         `json:"resourceIDs,omitempty"`
+	NodeName     string           `json:"nodeName,omitempty"`
 	Architecture string           `json:"architecture,omitempty"`
 	BlobsInfo    []types.BlobInfo `json:"blobsInfo,omitempty"`
 	ConfigFile   *v1.ConfigFile   `json:"configFile,omitempty"`
@@ -18,6 +19,47 @@ type ImageMetadata struct {
 	// Index specification can be found here: https://github.com/opencontainers/image-spec/blob/main/image-index.md
 	Index  *v1.IndexManifest `json:"index,omitempty"`
 	OsInfo *OsInfo           `json:"osInfo,omitempty"`
+	// BuildMetadata links image to the source it was built from. Provided by users via workload annotations.
+	BuildMetadata *BuildMetadata `json:"buildMetadata,omitempty"`
+	// Findings are security issues detected from image metadata, e.g. image config.
+	Findings []ImageFinding `json:"findings,omitempty"`
+	// ResolvedFindings are findings reported for previous scan of the same image which are no longer present.
+	ResolvedFindings []ImageFinding `json:"resolvedFindings,omitempty"`
+	// Vulnerabilities are matched by external trivy server if scan job is configured to use it.
+	Vulnerabilities []ImageVulnerability `json:"vulnerabilities,omitempty"`
+	// ResolvedVulnerabilities are vulnerabilities reported for previous scan of the same image which are no longer
+	// present. They are set only if vulnerabilities of both scans were matched by external trivy server.
+	ResolvedVulnerabilities []ImageVulnerability `json:"resolvedVulnerabilities,omitempty"`
+}
+
+// ImageVulnerability is vulnerability matched from image metadata by external trivy server.
+type ImageVulnerability struct {
+	ID               string `json:"id"`
+	PkgName          string `json:"pkgName"`
+	InstalledVersion string `json:"installedVersion"`
+	FixedVersion     string `json:"fixedVersion,omitempty"`
+	// Severity is one of Severity* values.
+	Severity   string `json:"severity"`
+	Title      string `json:"title,omitempty"`
+	PrimaryURL string `json:"primaryUrl,omitempty"`
+}
+
+const (
+	// ImageFindingRunsAsRoot is reported for images which run as root user by default.
+	ImageFindingRunsAsRoot = "image-runs-as-root"
+	// ImageFindingManifestSchema1 is reported for images using deprecated Docker manifest schema v1.
+	ImageFindingManifestSchema1 = "image-manifest-schema-v1"
+)
+
+type ImageFinding struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+type BuildMetadata struct {
+	Repository string `json:"repository,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	BuildURL   string `json:"buildURL,omitempty"`
 }
 
 // nolint:musttag
@@ -29,13 +71,67 @@ type OsInfo struct {
 const (
 	ImageScanStatusPending ImageScanStatus = "pending"
 	ImageScanStatusError   ImageScanStatus = "error"
+	// ImageScanStatusOOMKilled and ImageScanStatusEvicted are reported when scan job pod was killed by kubernetes.
+	ImageScanStatusOOMKilled ImageScanStatus = "oom_killed"
+	ImageScanStatusEvicted   ImageScanStatus = "evicted"
+	// ImageScanStatusPullError is reported for images which pods fail to pull. Such images are not scanned.
+	ImageScanStatusPullError ImageScanStatus = "pull_error"
 )
 
 type ImageScanStatus string
 
+const (
+	// PrivateImageReasonUnauthorized is reported when registry requires credentials.
+	PrivateImageReasonUnauthorized PrivateImageReason = "unauthorized"
+	// PrivateImageReasonNotFound is reported when registry does not know image manifest, eg. image name is wrong.
+	PrivateImageReasonNotFound PrivateImageReason = "not_found"
+	// PrivateImageReasonDenied is reported when credentials are valid but have no access to the image.
+	PrivateImageReasonDenied PrivateImageReason = "denied"
+	// PrivateImageReasonUnreachable is reported when registry refuses connections, eg. for localhost images.
+	PrivateImageReasonUnreachable PrivateImageReason = "unreachable"
+)
+
+type PrivateImageReason string
+
 type UpdateImagesStatusRequest struct {
 	FullSnapshot bool    `json:"full_snapshot,omitempty"`
 	Images       []Image `json:"images"`
+	// Workloads are severity rollups of workloads owning changed images.
+	Workloads []WorkloadSeverity `json:"workloads,omitempty"`
+}
+
+// WorkloadSeverity is the highest vulnerability severity across all scanned images of a workload.
+type WorkloadSeverity struct {
+	ResourceID string   `json:"resourceID"`
+	Severity   string   `json:"severity"`
+	ImageIDs   []string `json:"imageIDs"`
+}
+
+const (
+	// SeverityNone is reported for scanned images without vulnerabilities.
+	SeverityNone     = "NONE"
+	SeverityUnknown  = "UNKNOWN"
+	SeverityLow      = "LOW"
+	SeverityMedium   = "MEDIUM"
+	SeverityHigh     = "HIGH"
+	SeverityCritical = "CRITICAL"
+)
+
+var severityRanks = map[string]int{
+	SeverityNone:     1,
+	SeverityUnknown:  2,
+	SeverityLow:      3,
+	SeverityMedium:   4,
+	SeverityHigh:     5,
+	SeverityCritical: 6,
+}
+
+// MaxSeverity returns the higher of two severities. Empty and not known severities rank the lowest.
+func MaxSeverity(a, b string) string {
+	if severityRanks[b] > severityRanks[a] {
+		return b
+	}
+	return a
 }
 
 type Image struct {
@@ -45,6 +141,18 @@ type Image struct {
 	ResourcesChange ResourcesChange `json:"resourcesChange"`
 	Status          ImageScanStatus `json:"status,omitempty"`
 	ErrorMsg        string          `json:"errorMsg,omitempty"`
+	// Remediation is human readable hint how to fix scan error.
+	Remediation string `json:"remediation,omitempty"`
+	// PrivateReason is one of PrivateImageReason* reasons if image could not be scanned because registry refused it.
+	PrivateReason PrivateImageReason `json:"privateReason,omitempty"`
+	// Owners contains configured labels and annotations of image owners.
+	Owners []ImageOwner `json:"owners,omitempty"`
+}
+
+type ImageOwner struct {
+	ResourceID  string            `json:"resourceID"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type ResourcesChange struct {
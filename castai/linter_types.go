@@ -1,6 +1,10 @@
 package castai
 
-import "fmt"
+import (
+	"fmt"
+
+	json "github.com/json-iterator/go"
+)
 
 type LinterRule int
 type LinterRuleSet LinterRule
@@ -48,6 +52,18 @@ const (
 	NetworkPolicyPerNamespace
 	ContainerdSock
 	AdditionalCapabilities
+	RBACWildcardPermissions
+	RBACClusterAdminWideSubjects
+	PodPrivileged
+	PodHostNamespaces
+	PodHostPathMount
+	PodAddedCapabilities
+	DeprecatedAPIVersion
+	RBACOrphanedBinding
+	PodPlaintextSecretEnv
+	NamespaceNoNetworkPolicy
+	NetworkPolicyDuplicate
+	NetworkPolicyConflict
 )
 
 var LinterRuleMap = map[string]LinterRule{
@@ -95,6 +111,22 @@ var LinterRuleMap = map[string]LinterRule{
 	"additional-capabilities":          AdditionalCapabilities,
 }
 
+// AnalyzerRuleMap contains rules evaluated by kvisor analyzers outside of kube-linter.
+var AnalyzerRuleMap = map[string]LinterRule{
+	"rbac-wildcard-permissions":        RBACWildcardPermissions,
+	"rbac-cluster-admin-wide-subjects": RBACClusterAdminWideSubjects,
+	"pod-privileged":                   PodPrivileged,
+	"pod-host-namespaces":              PodHostNamespaces,
+	"pod-host-path-mount":              PodHostPathMount,
+	"pod-added-capabilities":           PodAddedCapabilities,
+	"deprecated-api-version":           DeprecatedAPIVersion,
+	"rbac-orphaned-binding":            RBACOrphanedBinding,
+	"pod-plaintext-secret-env":         PodPlaintextSecretEnv,
+	"namespace-no-network-policy":      NamespaceNoNetworkPolicy,
+	"network-policy-duplicate":         NetworkPolicyDuplicate,
+	"network-policy-conflict":          NetworkPolicyConflict,
+}
+
 var HostIsolationBundle = map[string]LinterRule{
 	"drop-net-raw-capability":        DropNetRawCapability,
 	"host-ipc":                       HostIPC,
@@ -156,9 +188,63 @@ var RBACBundle = map[string]LinterRule{
 }
 
 type LinterCheck struct {
-	ResourceID string         `json:"resourceID"`
-	Passed     *LinterRuleSet `json:"passed"`
-	Failed     *LinterRuleSet `json:"failed"`
+	ResourceID string `json:"resourceID"`
+	// Resource identifies linted workload by its kind, namespace and name.
+	Resource *Resource      `json:"resource,omitempty"`
+	Passed   *LinterRuleSet `json:"passed"`
+	Failed   *LinterRuleSet `json:"failed"`
+	// Findings describe failed rules with their severity and diagnostic message.
+	Findings []LinterFinding `json:"findings,omitempty"`
+}
+
+type LinterFinding struct {
+	Rule     string         `json:"rule"`
+	Severity LinterSeverity `json:"severity"`
+	Message  string         `json:"message"`
+}
+
+type LinterSeverity string
+
+const (
+	LinterSeverityLow    LinterSeverity = "low"
+	LinterSeverityMedium LinterSeverity = "medium"
+	LinterSeverityHigh   LinterSeverity = "high"
+)
+
+var linterRuleSeverities = map[string]LinterSeverity{
+	"privileged-container":             LinterSeverityHigh,
+	"privilege-escalation-container":   LinterSeverityHigh,
+	"host-ipc":                         LinterSeverityHigh,
+	"host-network":                     LinterSeverityHigh,
+	"host-pid":                         LinterSeverityHigh,
+	"docker-sock":                      LinterSeverityHigh,
+	"containerd-sock":                  LinterSeverityHigh,
+	"sensitive-host-mounts":            LinterSeverityHigh,
+	"writable-host-mount":              LinterSeverityHigh,
+	"unsafe-proc-mount":                LinterSeverityHigh,
+	"cluster-admin-role-binding":       LinterSeverityHigh,
+	"access-to-secrets":                LinterSeverityHigh,
+	"access-to-create-pods":            LinterSeverityHigh,
+	"wildcard-in-rules":                LinterSeverityHigh,
+	"no-liveness-probe":                LinterSeverityMedium,
+	"no-readiness-probe":               LinterSeverityLow,
+	"no-anti-affinity":                 LinterSeverityLow,
+	"no-rolling-update-strategy":       LinterSeverityLow,
+	"use-namespace":                    LinterSeverityLow,
+	"mismatching-selector":             LinterSeverityLow,
+	"dangling-service":                 LinterSeverityLow,
+	"dangling-networkpolicy":           LinterSeverityLow,
+	"dangling-horizontalpodautoscaler": LinterSeverityLow,
+	"dangling-ingress":                 LinterSeverityLow,
+	"deprecated-service-account-field": LinterSeverityLow,
+}
+
+// LinterRuleSeverity returns severity of failed linter rule. Rules without explicit severity are medium.
+func LinterRuleSeverity(rule string) LinterSeverity {
+	if v, ok := linterRuleSeverities[rule]; ok {
+		return v
+	}
+	return LinterSeverityMedium
 }
 
 func (s *LinterRuleSet) Add(i LinterRule) {
@@ -174,9 +260,11 @@ func (s *LinterRuleSet) Has(i LinterRule) bool {
 
 func (s *LinterRuleSet) Rules() []string {
 	result := make([]string, 0)
-	for name, mask := range LinterRuleMap {
-		if LinterRule(*s)&mask != 0 {
-			result = append(result, name)
+	for _, ruleMap := range []map[string]LinterRule{LinterRuleMap, AnalyzerRuleMap} {
+		for name, mask := range ruleMap {
+			if LinterRule(*s)&mask != 0 {
+				result = append(result, name)
+			}
 		}
 	}
 
@@ -207,3 +295,35 @@ func (r Resource) ObjectKey() string {
 		r.ObjectMeta.Name,
 	)
 }
+
+// SplitLinterChecks splits checks into batches which JSON encoded size does not exceed maxPayloadSize bytes.
+// Check which alone exceeds the limit is sent in its own batch.
+func SplitLinterChecks(checks []LinterCheck, maxPayloadSize int) ([][]LinterCheck, error) {
+	if maxPayloadSize <= 0 {
+		return [][]LinterCheck{checks}, nil
+	}
+
+	var batches [][]LinterCheck
+	var batch []LinterCheck
+	// Array brackets.
+	batchSize := 2
+	for _, check := range checks {
+		b, err := json.Marshal(check)
+		if err != nil {
+			return nil, fmt.Errorf("encoding linter check: %w", err)
+		}
+		// Encoded check with separating comma.
+		checkSize := len(b) + 1
+		if len(batch) > 0 && batchSize+checkSize > maxPayloadSize {
+			batches = append(batches, batch)
+			batch = nil
+			batchSize = 2
+		}
+		batch = append(batch, check)
+		batchSize += checkSize
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
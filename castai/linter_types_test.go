@@ -1,8 +1,10 @@
 package castai
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,4 +21,65 @@ func TestLinterRuleSet(t *testing.T) {
 	r.Contains(set.Rules(), "latest-tag")
 	r.Contains(set.Rules(), "writable-host-mount")
 	r.Contains(set.Rules(), "run-as-non-root")
+	set.Add(RBACWildcardPermissions)
+	r.Contains(set.Rules(), "rbac-wildcard-permissions")
+}
+
+func TestLinterRuleSeverity(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(LinterSeverityHigh, LinterRuleSeverity("privileged-container"))
+	r.Equal(LinterSeverityMedium, LinterRuleSeverity("no-liveness-probe"))
+	r.Equal(LinterSeverityLow, LinterRuleSeverity("no-readiness-probe"))
+	r.Equal(LinterSeverityMedium, LinterRuleSeverity("unknown-rule"))
+}
+
+func TestSplitLinterChecks(t *testing.T) {
+	t.Run("split oversized batch", func(t *testing.T) {
+		r := require.New(t)
+
+		var checks []LinterCheck
+		for i := 0; i < 100; i++ {
+			failed := new(LinterRuleSet)
+			failed.Add(LatestTag)
+			checks = append(checks, LinterCheck{
+				ResourceID: uuid.NewString(),
+				Failed:     failed,
+			})
+		}
+		encoded, err := json.Marshal(checks)
+		r.NoError(err)
+		maxPayloadSize := len(encoded) / 4
+
+		batches, err := SplitLinterChecks(checks, maxPayloadSize)
+		r.NoError(err)
+		r.GreaterOrEqual(len(batches), 4)
+
+		var result []LinterCheck
+		for _, batch := range batches {
+			b, err := json.Marshal(batch)
+			r.NoError(err)
+			r.LessOrEqual(len(b), maxPayloadSize)
+			result = append(result, batch...)
+		}
+		r.Equal(checks, result)
+	})
+
+	t.Run("keep batch within limit", func(t *testing.T) {
+		r := require.New(t)
+
+		checks := []LinterCheck{{ResourceID: "r1"}, {ResourceID: "r2"}}
+		batches, err := SplitLinterChecks(checks, 1024)
+		r.NoError(err)
+		r.Equal([][]LinterCheck{checks}, batches)
+	})
+
+	t.Run("send oversized check alone", func(t *testing.T) {
+		r := require.New(t)
+
+		checks := []LinterCheck{{ResourceID: "r1"}, {ResourceID: "r2"}}
+		batches, err := SplitLinterChecks(checks, 10)
+		r.NoError(err)
+		r.Len(batches, 2)
+	})
 }
@@ -66,6 +66,20 @@ func (mr *MockClientMockRecorder) PostTelemetry(ctx, initial interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostTelemetry", reflect.TypeOf((*MockClient)(nil).PostTelemetry), ctx, initial)
 }
 
+// ReplayDeadLetters mocks base method.
+func (m *MockClient) ReplayDeadLetters(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplayDeadLetters", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplayDeadLetters indicates an expected call of ReplayDeadLetters.
+func (mr *MockClientMockRecorder) ReplayDeadLetters(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplayDeadLetters", reflect.TypeOf((*MockClient)(nil).ReplayDeadLetters), ctx)
+}
+
 // SendCISCloudScanReport mocks base method.
 func (m *MockClient) SendCISCloudScanReport(ctx context.Context, report *castai.CloudScanReport) error {
 	m.ctrl.T.Helper()
@@ -80,6 +94,48 @@ func (mr *MockClientMockRecorder) SendCISCloudScanReport(ctx, report interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCISCloudScanReport", reflect.TypeOf((*MockClient)(nil).SendCISCloudScanReport), ctx, report)
 }
 
+// SendNodeImagesInventory mocks base method.
+func (m *MockClient) SendNodeImagesInventory(ctx context.Context, report *castai.NodeImagesInventory) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendNodeImagesInventory", ctx, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendNodeImagesInventory indicates an expected call of SendNodeImagesInventory.
+func (mr *MockClientMockRecorder) SendNodeImagesInventory(ctx, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendNodeImagesInventory", reflect.TypeOf((*MockClient)(nil).SendNodeImagesInventory), ctx, report)
+}
+
+// SendNodeInventory mocks base method.
+func (m *MockClient) SendNodeInventory(ctx context.Context, report *castai.NodeInventory) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendNodeInventory", ctx, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendNodeInventory indicates an expected call of SendNodeInventory.
+func (mr *MockClientMockRecorder) SendNodeInventory(ctx, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendNodeInventory", reflect.TypeOf((*MockClient)(nil).SendNodeInventory), ctx, report)
+}
+
+// SendAgentInfo mocks base method.
+func (m *MockClient) SendAgentInfo(ctx context.Context, info *castai.AgentInfo) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendAgentInfo", ctx, info)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendAgentInfo indicates an expected call of SendAgentInfo.
+func (mr *MockClientMockRecorder) SendAgentInfo(ctx, info interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendAgentInfo", reflect.TypeOf((*MockClient)(nil).SendAgentInfo), ctx, info)
+}
+
 // SendCISReport mocks base method.
 func (m *MockClient) SendCISReport(ctx context.Context, report *castai.KubeBenchReport) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,16 @@
+package castai
+
+type NodeImagesInventory struct {
+	Nodes []NodeImages `json:"nodes"`
+}
+
+type NodeImages struct {
+	NodeName string      `json:"nodeName"`
+	NodeID   string      `json:"nodeID"`
+	Images   []NodeImage `json:"images"`
+}
+
+type NodeImage struct {
+	Names     []string `json:"names"`
+	SizeBytes int64    `json:"sizeBytes,omitempty"`
+}
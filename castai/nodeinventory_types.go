@@ -0,0 +1,16 @@
+package castai
+
+type NodeInventory struct {
+	Nodes []NodeInfo `json:"nodes"`
+}
+
+type NodeInfo struct {
+	NodeName                string `json:"nodeName"`
+	NodeID                  string `json:"nodeID"`
+	OSImage                 string `json:"osImage"`
+	OperatingSystem         string `json:"operatingSystem"`
+	Architecture            string `json:"architecture"`
+	KernelVersion           string `json:"kernelVersion"`
+	KubeletVersion          string `json:"kubeletVersion"`
+	ContainerRuntimeVersion string `json:"containerRuntimeVersion"`
+}
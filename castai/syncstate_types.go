@@ -17,4 +17,6 @@ type ScannedImage struct {
 	ID           string   `json:"id"`
 	Architecture string   `json:"architecture"`
 	ResourceIDs  []string `json:"resourceIds"`
+	// Severity is the highest vulnerability severity found in image, one of Severity* values.
+	Severity string `json:"severity,omitempty"`
 }
@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+)
+
+// NewAgentInfo describes agent version and features enabled by given config.
+func NewAgentInfo(cfg config.Config, binVersion config.SecurityAgentVersion, k8sVersion string) *castai.AgentInfo {
+	features := []string{"delta", "pod-security", "deprecated-api"}
+	if cfg.Linter.Enabled {
+		features = append(features, string(linter))
+	}
+	if cfg.KubeBench.Enabled {
+		features = append(features, string(kubeBench))
+	}
+	if cfg.ImageScan.Enabled {
+		features = append(features, string(imageScan))
+	}
+	if cfg.CloudScan.Enabled {
+		features = append(features, "cloudscan")
+	}
+	if cfg.NodeImages.Enabled {
+		features = append(features, "node-images")
+	}
+	if cfg.NodeInventory.Enabled {
+		features = append(features, "node-inventory")
+	}
+	if cfg.RBACAnalyzer.Enabled {
+		features = append(features, "rbac-analyzer")
+	}
+	if cfg.PolicyEnforcement.Enabled {
+		features = append(features, "policy-enforcement")
+	}
+
+	return &castai.AgentInfo{
+		Version:         binVersion.Version,
+		GitCommit:       binVersion.GitCommit,
+		Provider:        cfg.Provider,
+		K8sVersion:      k8sVersion,
+		EnabledFeatures: features,
+	}
+}
+
+// SendAgentInfo reports agent info once on startup.
+func SendAgentInfo(ctx context.Context, client castai.Client, info *castai.AgentInfo) error {
+	if err := client.SendAgentInfo(ctx, info); err != nil {
+		return fmt.Errorf("sending agent info: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
+)
+
+func TestSendAgentInfo(t *testing.T) {
+	r := require.New(t)
+	ctrl := gomock.NewController(t)
+	client := mock_castai.NewMockClient(ctrl)
+
+	cfg := config.Config{
+		Provider: "gke",
+		ImageScan: config.ImageScan{
+			Enabled: true,
+		},
+		Linter: config.Linter{
+			Enabled: true,
+		},
+		RBACAnalyzer: config.RBACAnalyzer{
+			Enabled: true,
+		},
+	}
+	binVersion := config.SecurityAgentVersion{
+		GitCommit: "abc",
+		Version:   "v1.2.3",
+	}
+
+	client.EXPECT().SendAgentInfo(gomock.Any(), &castai.AgentInfo{
+		Version:         "v1.2.3",
+		GitCommit:       "abc",
+		Provider:        "gke",
+		K8sVersion:      "1.27",
+		EnabledFeatures: []string{"delta", "pod-security", "deprecated-api", "linter", "imagescan", "rbac-analyzer"},
+	}).Return(nil)
+
+	r.NoError(SendAgentInfo(context.Background(), client, NewAgentInfo(cfg, binVersion, "1.27")))
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/metrics"
 )
 
 type Observer func(response *castai.TelemetryResponse)
@@ -57,3 +58,14 @@ func (s *Manager) Start(ctx context.Context) error {
 func (s *Manager) postTelemetry(ctx context.Context) (*castai.TelemetryResponse, error) {
 	return s.client.PostTelemetry(ctx, false)
 }
+
+// PostInitialTelemetry posts initial telemetry bounded by timeout so slow backend does not block agent startup.
+func PostInitialTelemetry(ctx context.Context, client castai.Client, timeout time.Duration) (*castai.TelemetryResponse, error) {
+	start := time.Now()
+	defer metrics.ObserveInitialTelemetryDuration(start)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return client.PostTelemetry(ctx, true)
+}
@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+)
+
+func TestPostInitialTelemetry(t *testing.T) {
+	t.Run("proceed when initial telemetry times out", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(ctrl)
+
+		client.EXPECT().PostTelemetry(gomock.Any(), true).DoAndReturn(func(ctx context.Context, _ bool) (*castai.TelemetryResponse, error) {
+			// Simulate slow backend.
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		start := time.Now()
+		resp, err := PostInitialTelemetry(context.Background(), client, 10*time.Millisecond)
+		r.ErrorIs(err, context.DeadlineExceeded)
+		r.Nil(resp)
+		r.Less(time.Since(start), time.Second)
+	})
+
+	t.Run("return initial telemetry response", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(ctrl)
+
+		client.EXPECT().PostTelemetry(gomock.Any(), true).Return(&castai.TelemetryResponse{NodeIDs: []string{"n1"}}, nil)
+
+		resp, err := PostInitialTelemetry(context.Background(), client, time.Second)
+		r.NoError(err)
+		r.Equal([]string{"n1"}, resp.NodeIDs)
+	})
+}
@@ -5,4 +5,6 @@ type TelemetryResponse struct {
 	FullResync       bool     `json:"fullResync"`
 	NodeIDs          []string `json:"nodeIds"`
 	EnforcedRules    []string `json:"enforcedRules"`
+	// ImageScanExcludedNamespaces are namespace patterns excluded from image scanning in addition to configured ones.
+	ImageScanExcludedNamespaces []string `json:"imageScanExcludedNamespaces,omitempty"`
 }
@@ -0,0 +1,209 @@
+package aks
+
+import (
+	"errors"
+)
+
+// azurePolicyAddon is name of Azure Policy add-on profile which enforces pod security policies on the cluster.
+const azurePolicyAddon = "azurepolicy"
+
+type check struct {
+	id          string
+	description string
+	automated   bool
+	context     any
+	passed      bool
+	// minK8sMinor is the minimal kubernetes minor version for which check is applicable.
+	minK8sMinor   int
+	notApplicable bool
+	// err is set when data source needed for check validation could not be fetched.
+	err      error
+	errored  bool
+	validate func(c *check)
+}
+
+// dependsOn marks check as errored if any of its data sources failed to load.
+func dependsOn(c check, errs ...error) check {
+	c.err = errors.Join(errs...)
+	return c
+}
+
+func check421MinimizeTheAdmissionOfPrivilegedContainers(cluster *ManagedCluster) check {
+	return check{
+		id:          "4.2.1",
+		description: "4.2.1 - Minimize the admission of privileged containers",
+		automated:   true,
+		validate: func(c *check) {
+			addon, found := cluster.Properties.AddonProfiles[azurePolicyAddon]
+			c.passed = found && addon != nil && addon.Enabled
+		},
+	}
+}
+
+func check511EnsureImageVulnerabilityScanningUsingMicrosoftDefenderOrThirdPartyProvider(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.1.1",
+		description: "5.1.1 - Ensure Image Vulnerability Scanning using Microsoft Defender for Cloud image scanning or a third party provider",
+		validate: func(c *check) {
+			// Third party providers can't be detected, so check is automated only if Microsoft Defender is enabled.
+			profile := cluster.Properties.SecurityProfile
+			if profile == nil || profile.AzureDefender == nil {
+				return
+			}
+			if profile.AzureDefender.Enabled {
+				c.automated = true
+				c.passed = true
+			}
+		},
+	}
+}
+
+func check512MinimizeUserAccessToAzureContainerRegistry() check {
+	return check{
+		id:          "5.1.2",
+		description: "5.1.2 - Minimize user access to Azure Container Registry (ACR)",
+	}
+}
+
+func check513MinimizeClusterAccessToReadOnlyForAzureContainerRegistry() check {
+	return check{
+		id:          "5.1.3",
+		description: "5.1.3 - Minimize cluster access to read-only for Azure Container Registry (ACR)",
+	}
+}
+
+func check514MinimizeContainerRegistriesToOnlyThoseApproved() check {
+	return check{
+		id:          "5.1.4",
+		description: "5.1.4 - Minimize Container Registries to only those approved",
+	}
+}
+
+func check521PreferUsingManagedIdentities(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.2.1",
+		description: "5.2.1 - Prefer using dedicated AKS Service Accounts and managed identities",
+		automated:   true,
+		validate: func(c *check) {
+			if cluster.Identity == nil {
+				return
+			}
+			c.passed = cluster.Identity.Type == "SystemAssigned" || cluster.Identity.Type == "UserAssigned"
+		},
+	}
+}
+
+func check531EnsureKubernetesSecretsAreEncrypted() check {
+	return check{
+		id:          "5.3.1",
+		description: "5.3.1 - Ensure Kubernetes Secrets are encrypted",
+	}
+}
+
+func check532EnsureNodeDisksAreEncryptedWithCustomerManagedKeys(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.3.2",
+		description: "5.3.2 - Ensure node OS and data disks are encrypted using customer-managed keys",
+		automated:   true,
+		validate: func(c *check) {
+			c.passed = cluster.Properties.DiskEncryptionSetID != ""
+		},
+	}
+}
+
+func check541RestrictAccessToTheControlPlaneEndpoint(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.4.1",
+		description: "5.4.1 - Restrict Access to the Control Plane Endpoint",
+		automated:   true,
+		validate: func(c *check) {
+			profile := cluster.Properties.APIServerAccessProfile
+			if profile == nil {
+				return
+			}
+			c.passed = profile.EnablePrivateCluster || len(profile.AuthorizedIPRanges) > 0
+		},
+	}
+}
+
+func check542EnsureClustersAreCreatedWithPrivateEndpointEnabledAndPublicAccessDisabled(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.4.2",
+		description: "5.4.2 - Ensure clusters are created with Private Endpoint Enabled and Public Access Disabled",
+		automated:   true,
+		validate: func(c *check) {
+			profile := cluster.Properties.APIServerAccessProfile
+			if profile == nil {
+				return
+			}
+			c.passed = profile.EnablePrivateCluster && !profile.EnablePrivateClusterPublicFQDN
+		},
+	}
+}
+
+func check543EnsureClustersAreCreatedWithPrivateNodes() check {
+	return check{
+		id:          "5.4.3",
+		description: "5.4.3 - Ensure clusters are created with Private Nodes",
+	}
+}
+
+func check544EnsureNetworkPolicyIsEnabledAndSetAsAppropriate(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.4.4",
+		description: "5.4.4 - Ensure Network Policy is Enabled and set as appropriate",
+		automated:   true,
+		validate: func(c *check) {
+			profile := cluster.Properties.NetworkProfile
+			if profile == nil {
+				return
+			}
+			c.passed = profile.NetworkPolicy != ""
+		},
+	}
+}
+
+func check545EncryptTrafficToHTTPSLoadBalancersWithTLSCertificates() check {
+	return check{
+		id:          "5.4.5",
+		description: "5.4.5 - Encrypt traffic to HTTPS load balancers with TLS certificates",
+	}
+}
+
+func check551ManageKubernetesRBACUsersWithAzureAD(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.5.1",
+		description: "5.5.1 - Manage Kubernetes RBAC users with Azure AD",
+		automated:   true,
+		validate: func(c *check) {
+			profile := cluster.Properties.AADProfile
+			c.passed = profile != nil && profile.Managed
+		},
+	}
+}
+
+func check552UseAzureRBACForKubernetesAuthorization(cluster *ManagedCluster) check {
+	return check{
+		id:          "5.5.2",
+		description: "5.5.2 - Use Azure RBAC for Kubernetes Authorization",
+		automated:   true,
+		validate: func(c *check) {
+			profile := cluster.Properties.AADProfile
+			c.passed = profile != nil && profile.EnableAzureRBAC
+		},
+	}
+}
+
+func check561RestrictUntrustedWorkloads() check {
+	return check{
+		id:          "5.6.1",
+		description: "5.6.1 - Restrict untrusted workloads",
+	}
+}
+
+func check562HostileMultiTenantWorkloads() check {
+	return check{
+		id:          "5.6.2",
+		description: "5.6.2 - Hostile multi-tenant workloads",
+	}
+}
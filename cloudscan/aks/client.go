@@ -0,0 +1,122 @@
+package aks
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+)
+
+// managedClustersAPIVersion is Azure Resource Manager API version of managed clusters requests.
+const managedClustersAPIVersion = "2022-03-01"
+
+// ManagedCluster is subset of AKS managed cluster resource used by checks.
+type ManagedCluster struct {
+	Identity   *ManagedClusterIdentity   `json:"identity,omitempty"`
+	Properties *ManagedClusterProperties `json:"properties,omitempty"`
+}
+
+type ManagedClusterIdentity struct {
+	// Type is SystemAssigned, UserAssigned or None if cluster uses service principal.
+	Type string `json:"type,omitempty"`
+}
+
+type ManagedClusterProperties struct {
+	AddonProfiles          map[string]*AddonProfile `json:"addonProfiles,omitempty"`
+	APIServerAccessProfile *APIServerAccessProfile  `json:"APIServerAccessProfile,omitempty"`
+	NetworkProfile         *NetworkProfile          `json:"NetworkProfile,omitempty"`
+	AADProfile             *AADProfile              `json:"AADProfile,omitempty"`
+	SecurityProfile        *SecurityProfile         `json:"SecurityProfile,omitempty"`
+	DiskEncryptionSetID    string                   `json:"diskEncryptionSetID,omitempty"`
+}
+
+type AddonProfile struct {
+	Enabled bool `json:"enabled"`
+}
+
+type APIServerAccessProfile struct {
+	AuthorizedIPRanges             []string `json:"authorizedIPRanges,omitempty"`
+	EnablePrivateCluster           bool     `json:"enablePrivateCluster,omitempty"`
+	EnablePrivateClusterPublicFQDN bool     `json:"enablePrivateClusterPublicFQDN,omitempty"`
+}
+
+type NetworkProfile struct {
+	NetworkPlugin string `json:"networkPlugin,omitempty"`
+	// NetworkPolicy is azure or calico. Empty if network policies are not enforced.
+	NetworkPolicy string `json:"networkPolicy,omitempty"`
+}
+
+type AADProfile struct {
+	Managed         bool `json:"managed,omitempty"`
+	EnableAzureRBAC bool `json:"enableAzureRBAC,omitempty"`
+}
+
+type SecurityProfile struct {
+	AzureDefender *AzureDefender `json:"AzureDefender,omitempty"`
+}
+
+type AzureDefender struct {
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// NewManagedClustersClientFromEnvironment creates AKS managed clusters client authorized with credentials from
+// environment, eg. AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, or with managed identity.
+func NewManagedClustersClientFromEnvironment(subscriptionID string) (*ManagedClustersClient, error) {
+	authorizer, err := auth.NewAuthorizerFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	client := autorest.NewClientWithUserAgent("castai-kvisor")
+	client.Authorizer = authorizer
+	return &ManagedClustersClient{
+		client:         client,
+		baseURI:        azure.PublicCloud.ResourceManagerEndpoint,
+		subscriptionID: subscriptionID,
+	}, nil
+}
+
+// ManagedClustersClient gets AKS managed clusters from Azure Resource Manager API.
+type ManagedClustersClient struct {
+	client         autorest.Client
+	baseURI        string
+	subscriptionID string
+}
+
+// Get returns managed cluster with given name.
+func (c *ManagedClustersClient) Get(ctx context.Context, resourceGroupName, resourceName string) (*ManagedCluster, error) {
+	pathParameters := map[string]interface{}{
+		"resourceGroupName": autorest.Encode("path", resourceGroupName),
+		"resourceName":      autorest.Encode("path", resourceName),
+		"subscriptionId":    autorest.Encode("path", c.subscriptionID),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": managedClustersAPIVersion,
+	}
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(c.baseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.ContainerService/managedClusters/{resourceName}", pathParameters),
+		autorest.WithQueryParameters(queryParameters),
+	)
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "aks.ManagedClustersClient", "Get", nil, "Failure preparing request")
+	}
+
+	resp, err := autorest.SendWithSender(c.client, req, azure.DoRetryWithRegistration(c.client))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "aks.ManagedClustersClient", "Get", resp, "Failure sending request")
+	}
+
+	var result ManagedCluster
+	err = autorest.Respond(resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing(),
+	)
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "aks.ManagedClustersClient", "Get", resp, "Failure responding to request")
+	}
+	return &result, nil
+}
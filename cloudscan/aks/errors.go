@@ -0,0 +1,38 @@
+package aks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// isThrottled returns whether Azure API call failed due to rate limiting. Azure Resource Manager responds
+// with 429 status code and Retry-After header when subscription or tenant request limits are exceeded.
+func isThrottled(err error) (bool, time.Duration) {
+	var detailedErr autorest.DetailedError
+	if !errors.As(err, &detailedErr) {
+		return false, 0
+	}
+	statusCode, _ := detailedErr.StatusCode.(int)
+	if detailedErr.Response != nil {
+		statusCode = detailedErr.Response.StatusCode
+	}
+	if statusCode != http.StatusTooManyRequests {
+		return false, 0
+	}
+	if detailedErr.Response != nil {
+		return true, parseRetryAfter(detailedErr.Response.Header.Get("Retry-After"))
+	}
+	return true, 0
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
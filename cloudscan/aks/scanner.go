@@ -0,0 +1,144 @@
+package aks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/cloudscan/throttle"
+	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/tracing"
+	"github.com/castai/kvisor/version"
+)
+
+type Scanner struct {
+	cfg             *config.CloudScan
+	log             logrus.FieldLogger
+	aksClient       aksClient
+	castaiClient    castaiClient
+	k8sVersionMinor int
+	throttler       *throttle.Throttler
+}
+
+type aksClient interface {
+	Get(ctx context.Context, resourceGroupName, resourceName string) (*ManagedCluster, error)
+}
+
+type castaiClient interface {
+	SendCISCloudScanReport(ctx context.Context, report *castai.CloudScanReport) error
+}
+
+func NewScanner(log logrus.FieldLogger, cfg config.CloudScan, aksClient aksClient, client castaiClient, k8sVersionMinor int) *Scanner {
+	return &Scanner{
+		cfg:             &cfg,
+		log:             log,
+		aksClient:       aksClient,
+		castaiClient:    client,
+		k8sVersionMinor: k8sVersionMinor,
+		throttler:       throttle.New(log, cfg.Throttle, isThrottled),
+	}
+}
+
+func (s *Scanner) Start(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(s.cfg.InitDelay):
+	}
+
+	for {
+		s.log.Info("scanning cloud")
+		if err := s.scan(ctx); err != nil {
+			s.log.Errorf("azure cloud scan failed: %v", err)
+		} else {
+			s.log.Info("azure cloud scan finished")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.cfg.ScanInterval):
+		}
+	}
+}
+
+func (s *Scanner) scan(ctx context.Context) (rerr error) {
+	ctx, span := tracing.Start(ctx, "cloudscan.aks.scan")
+	defer func() { tracing.End(span, rerr) }()
+
+	// Checks which depend on managed cluster are reported as errored if it can't be fetched.
+	cluster, clusterErr := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*ManagedCluster, error) {
+		return s.aksClient.Get(ctx, s.cfg.AKS.ResourceGroup, s.cfg.AKS.ClusterName)
+	})
+	if clusterErr == nil && cluster.Properties == nil {
+		clusterErr = fmt.Errorf("managed cluster %q has no properties", s.cfg.AKS.ClusterName)
+	}
+	if clusterErr != nil {
+		clusterErr = fmt.Errorf("get managed cluster: %w", clusterErr)
+		s.log.Warn(clusterErr.Error())
+	}
+
+	checks := []check{
+		dependsOn(check421MinimizeTheAdmissionOfPrivilegedContainers(cluster), clusterErr),
+		dependsOn(check511EnsureImageVulnerabilityScanningUsingMicrosoftDefenderOrThirdPartyProvider(cluster), clusterErr),
+		check512MinimizeUserAccessToAzureContainerRegistry(),
+		check513MinimizeClusterAccessToReadOnlyForAzureContainerRegistry(),
+		check514MinimizeContainerRegistriesToOnlyThoseApproved(),
+		dependsOn(check521PreferUsingManagedIdentities(cluster), clusterErr),
+		check531EnsureKubernetesSecretsAreEncrypted(),
+		dependsOn(check532EnsureNodeDisksAreEncryptedWithCustomerManagedKeys(cluster), clusterErr),
+		dependsOn(check541RestrictAccessToTheControlPlaneEndpoint(cluster), clusterErr),
+		dependsOn(check542EnsureClustersAreCreatedWithPrivateEndpointEnabledAndPublicAccessDisabled(cluster), clusterErr),
+		check543EnsureClustersAreCreatedWithPrivateNodes(),
+		dependsOn(check544EnsureNetworkPolicyIsEnabledAndSetAsAppropriate(cluster), clusterErr),
+		check545EncryptTrafficToHTTPSLoadBalancersWithTLSCertificates(),
+		dependsOn(check551ManageKubernetesRBACUsersWithAzureAD(cluster), clusterErr),
+		dependsOn(check552UseAzureRBACForKubernetesAuthorization(cluster), clusterErr),
+		check561RestrictUntrustedWorkloads(),
+		check562HostileMultiTenantWorkloads(),
+	}
+
+	report := &castai.CloudScanReport{
+		Checks: make([]castai.CloudScanCheck, 0, len(checks)),
+	}
+
+	for _, c := range checks {
+		c := c
+		if !s.cfg.IsCheckReported(c.id) {
+			continue
+		}
+		if !version.AtLeastMinor(s.k8sVersionMinor, c.minK8sMinor) {
+			c.notApplicable = true
+		} else if c.err != nil {
+			c.errored = true
+		} else if c.validate != nil {
+			c.validate(&c)
+		}
+		var err error
+		var contextBytes json.RawMessage
+		if c.context != nil {
+			contextBytes, err = json.Marshal(c.context)
+			if err != nil {
+				return err
+			}
+		}
+		report.Checks = append(report.Checks, castai.CloudScanCheck{
+			ID:            c.id,
+			Automated:     c.automated,
+			Passed:        c.passed,
+			NotApplicable: c.notApplicable,
+			Errored:       c.errored,
+			Context:       contextBytes,
+		})
+	}
+
+	if err := s.castaiClient.SendCISCloudScanReport(ctx, report); err != nil {
+		return err
+	}
+
+	return nil
+}
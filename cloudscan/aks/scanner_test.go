@@ -0,0 +1,205 @@
+package aks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+)
+
+func TestScanner(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	aksClient := &mockCloudClient{
+		response: &ManagedCluster{
+			Properties: &ManagedClusterProperties{},
+		},
+	}
+	castaiClient := &mockCastaiClient{}
+
+	s := Scanner{
+		log: log,
+		cfg: &config.CloudScan{
+			Enabled:      true,
+			ScanInterval: 1 * time.Millisecond,
+			AKS: &config.CloudScanAKS{
+				SubscriptionID: "sub",
+				ResourceGroup:  "rg",
+				ClusterName:    "test-cluster",
+			},
+		},
+		aksClient:    aksClient,
+		castaiClient: castaiClient,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	s.Start(ctx)
+
+	r.NotNil(castaiClient.sentReport)
+	r.Equal("rg", aksClient.resourceGroup)
+	r.Equal("test-cluster", aksClient.name)
+
+	failedCount := lo.CountBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return !v.Passed })
+	r.Equal(17, failedCount)
+	manualCount := lo.CountBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return !v.Automated })
+	r.Equal(9, manualCount)
+	check := castaiClient.sentReport.Checks[0]
+	r.Equal(castai.CloudScanCheck{ID: "4.2.1", Automated: true}, check)
+}
+
+func TestScannerChecks(t *testing.T) {
+	r := require.New(t)
+	castaiClient := &mockCastaiClient{}
+	s := NewScanner(logrus.New(), config.CloudScan{
+		AKS: &config.CloudScanAKS{ResourceGroup: "rg", ClusterName: "test-cluster"},
+	}, &mockCloudClient{
+		response: &ManagedCluster{
+			Identity: &ManagedClusterIdentity{Type: "SystemAssigned"},
+			Properties: &ManagedClusterProperties{
+				AddonProfiles: map[string]*AddonProfile{
+					azurePolicyAddon: {Enabled: true},
+				},
+				APIServerAccessProfile: &APIServerAccessProfile{EnablePrivateCluster: true},
+				NetworkProfile:         &NetworkProfile{NetworkPlugin: "azure", NetworkPolicy: "calico"},
+				AADProfile:             &AADProfile{Managed: true, EnableAzureRBAC: true},
+				SecurityProfile:        &SecurityProfile{AzureDefender: &AzureDefender{Enabled: true}},
+				DiskEncryptionSetID:    "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/diskEncryptionSets/des",
+			},
+		},
+	}, castaiClient, 27)
+
+	r.NoError(s.scan(context.Background()))
+	passed := lo.FilterMap(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck, _ int) (string, bool) {
+		return v.ID, v.Passed
+	})
+	r.Equal([]string{"4.2.1", "5.1.1", "5.2.1", "5.3.2", "5.4.1", "5.4.2", "5.4.4", "5.5.1", "5.5.2"}, passed)
+	manual := lo.FilterMap(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck, _ int) (string, bool) {
+		return v.ID, !v.Automated
+	})
+	r.Equal([]string{"5.1.2", "5.1.3", "5.1.4", "5.3.1", "5.4.3", "5.4.5", "5.6.1", "5.6.2"}, manual)
+}
+
+func TestScannerThrottling(t *testing.T) {
+	newScanner := func(aksClient *mockCloudClient, castaiClient *mockCastaiClient) *Scanner {
+		return NewScanner(logrus.New(), config.CloudScan{
+			AKS: &config.CloudScanAKS{ResourceGroup: "rg", ClusterName: "test-cluster"},
+			Throttle: config.CloudScanThrottle{
+				MaxRetries: 3,
+				MinBackoff: 10 * time.Millisecond,
+				MaxBackoff: 50 * time.Millisecond,
+			},
+		}, aksClient, castaiClient, 0)
+	}
+	throttledErr := autorest.NewErrorWithError(nil, "aks.ManagedClustersClient", "Get", &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{},
+	}, "Failure responding to request")
+
+	t.Run("back off and resume on throttled responses", func(t *testing.T) {
+		r := require.New(t)
+		castaiClient := &mockCastaiClient{}
+		aksClient := &mockCloudClient{
+			response: &ManagedCluster{Properties: &ManagedClusterProperties{}},
+			errs:     []error{throttledErr, throttledErr},
+		}
+		s := newScanner(aksClient, castaiClient)
+
+		r.NoError(s.scan(context.Background()))
+		r.Equal(3, aksClient.calls)
+		r.False(lo.SomeBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return v.Errored }))
+	})
+
+	t.Run("report checks as errored once retries are exhausted", func(t *testing.T) {
+		r := require.New(t)
+		castaiClient := &mockCastaiClient{}
+		aksClient := &mockCloudClient{
+			errs: []error{throttledErr, throttledErr, throttledErr, throttledErr},
+		}
+		s := newScanner(aksClient, castaiClient)
+
+		r.NoError(s.scan(context.Background()))
+		r.Equal(4, aksClient.calls)
+		check, found := lo.Find(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return v.ID == "5.4.2" })
+		r.True(found)
+		r.True(check.Errored)
+		// Manual checks don't depend on managed cluster.
+		check, found = lo.Find(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return v.ID == "5.4.3" })
+		r.True(found)
+		r.False(check.Errored)
+	})
+}
+
+func TestManagedClustersClient(t *testing.T) {
+	r := require.New(t)
+
+	var requestedURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestedURL = req.URL.String()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"identity": {"type": "UserAssigned"},
+			"properties": {
+				"addonProfiles": {"azurepolicy": {"enabled": true}},
+				"apiServerAccessProfile": {"enablePrivateCluster": true},
+				"networkProfile": {"networkPolicy": "azure"}
+			}
+		}`))
+	}))
+	defer srv.Close()
+
+	client := &ManagedClustersClient{
+		client:         autorest.NewClientWithUserAgent("test"),
+		baseURI:        srv.URL,
+		subscriptionID: "sub",
+	}
+	cluster, err := client.Get(context.Background(), "rg", "test-cluster")
+	r.NoError(err)
+	r.Equal("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerService/managedClusters/test-cluster?api-version=2022-03-01", requestedURL)
+	r.Equal("UserAssigned", cluster.Identity.Type)
+	r.True(cluster.Properties.AddonProfiles[azurePolicyAddon].Enabled)
+	r.True(cluster.Properties.APIServerAccessProfile.EnablePrivateCluster)
+	r.Equal("azure", cluster.Properties.NetworkProfile.NetworkPolicy)
+}
+
+type mockCastaiClient struct {
+	sentReport *castai.CloudScanReport
+}
+
+func (m *mockCastaiClient) SendCISCloudScanReport(ctx context.Context, report *castai.CloudScanReport) error {
+	m.sentReport = report
+	return nil
+}
+
+type mockCloudClient struct {
+	response *ManagedCluster
+	// errs are returned by the first calls before response.
+	errs          []error
+	calls         int
+	resourceGroup string
+	name          string
+}
+
+func (m *mockCloudClient) Get(_ context.Context, resourceGroupName, resourceName string) (*ManagedCluster, error) {
+	m.calls++
+	m.resourceGroup = resourceGroupName
+	m.name = resourceName
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	return m.response, nil
+}
@@ -1,8 +1,15 @@
 package eks
 
 import (
+	"errors"
+	"fmt"
+
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
 	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
 )
 
 type check struct {
@@ -11,20 +18,54 @@ type check struct {
 	automated   bool
 	context     any
 	passed      bool
-	validate    func(c *check)
+	// minK8sMinor is the minimal kubernetes minor version for which check is applicable.
+	minK8sMinor   int
+	notApplicable bool
+	// err is set when data source needed for check validation could not be fetched.
+	err      error
+	errored  bool
+	validate func(c *check)
+}
+
+// dependsOn marks check as errored if any of its data sources failed to load.
+func dependsOn(c check, errs ...error) check {
+	c.err = errors.Join(errs...)
+	return c
 }
 
-func check431EnsureCNISupportsNetworkPolicies() check {
+func check431EnsureCNISupportsNetworkPolicies(cniAddon *types.Addon) check {
 	return check{
 		id:          "4.3.1",
 		description: "4.3.1 - Ensure that the CNI in use supports Network Policies",
+		validate: func(c *check) {
+			// Clusters without vpc-cni addon use self managed CNI which is validated manually.
+			if cniAddon == nil {
+				return
+			}
+			c.context = checkContext{AddonVersion: lo.FromPtr(cniAddon.AddonVersion)}
+			c.passed = isNetworkPolicyEnabled(cniAddon)
+		},
 	}
 }
 
-func check511EnsureImageVulnerabilityScanningUsingAmazonECRImageScanningOrThirdPartyProvider() check {
+func check511EnsureImageVulnerabilityScanningUsingAmazonECRImageScanningOrThirdPartyProvider(repositories []ecrtypes.Repository) check {
 	return check{
 		id:          "5.1.1",
 		description: "5.1.1 - Ensure Image Vulnerability Scanning using Amazon ECR image scanning or a third party provider",
+		automated:   true,
+		validate: func(c *check) {
+			var notScanned []string
+			for _, repo := range repositories {
+				if repo.ImageScanningConfiguration == nil || !repo.ImageScanningConfiguration.ScanOnPush {
+					notScanned = append(notScanned, lo.FromPtr(repo.RepositoryName))
+				}
+			}
+			if len(notScanned) > 0 {
+				c.context = checkContext{Repositories: notScanned}
+				return
+			}
+			c.passed = true
+		},
 	}
 }
 
@@ -60,6 +101,9 @@ func check531EnsureKubernetesSecretsAreEncryptedUsingCustomerMasterKeysCMKsManag
 	return check{
 		id:          "5.3.1",
 		description: "5.3.1 - Ensure Kubernetes Secrets are encrypted using Customer Master Keys (CMKs) managed in AWS KMS",
+		// Envelope encryption of secrets is supported for EKS clusters running kubernetes 1.13 and later,
+		// see https://aws.amazon.com/about-aws/whats-new/2020/03/amazon-eks-adds-envelope-encryption-for-secrets-with-aws-kms/.
+		minK8sMinor: 13,
 		automated:   true,
 		validate: func(c *check) {
 			for _, config := range cluster.Cluster.EncryptionConfig {
@@ -72,10 +116,21 @@ func check531EnsureKubernetesSecretsAreEncryptedUsingCustomerMasterKeysCMKsManag
 	}
 }
 
-func check541RestrictAccessToTheControlPlaneEndpoint() check {
+func check541RestrictAccessToTheControlPlaneEndpoint(cluster *eks.DescribeClusterOutput) check {
 	return check{
 		id:          "5.4.1",
 		description: "5.4.1 - Restrict Access to the Control Plane Endpoint",
+		automated:   true,
+		validate: func(c *check) {
+			vpcConfig := cluster.Cluster.ResourcesVpcConfig
+			if vpcConfig == nil || !vpcConfig.EndpointPublicAccess {
+				c.passed = true
+				return
+			}
+			c.context = checkContext{PublicAccessCIDRs: vpcConfig.PublicAccessCidrs}
+			// Public endpoint is open to any address if CIDRs are not restricted.
+			c.passed = len(vpcConfig.PublicAccessCidrs) > 0 && !lo.Contains(vpcConfig.PublicAccessCidrs, "0.0.0.0/0")
+		},
 	}
 }
 
@@ -96,16 +151,43 @@ func check542EnsureClustersAreCreatedWithPrivateEndpointEnabledAndPublicAccessDi
 	}
 }
 
-func check543EnsureClustersAreCreatedWithPrivateNodes() check {
+func check543EnsureClustersAreCreatedWithPrivateNodes(nodegroups []types.Nodegroup, subnets []ec2types.Subnet) check {
 	return check{
 		id:          "5.4.3",
 		description: "5.4.3 - Ensure clusters are created with Private Nodes",
+		validate: func(c *check) {
+			// Fargate and self managed nodes are validated manually.
+			if len(nodegroups) == 0 {
+				return
+			}
+
+			c.automated = true
+			var publicSubnets []string
+			for _, subnet := range subnets {
+				if lo.FromPtr(subnet.MapPublicIpOnLaunch) {
+					publicSubnets = append(publicSubnets, lo.FromPtr(subnet.SubnetId))
+				}
+			}
+			if len(publicSubnets) > 0 {
+				c.context = checkContext{Subnets: publicSubnets}
+				return
+			}
+			c.passed = true
+		},
 	}
 }
-func check544EnsureNetworkPolicyIsEnabledAndSetAsAppropriate() check {
+
+func check544EnsureNetworkPolicyIsEnabledAndSetAsAppropriate(cniAddon *types.Addon) check {
 	return check{
 		id:          "5.4.4",
 		description: "5.4.4 - Ensure Network Policy is Enabled and set as appropriate",
+		validate: func(c *check) {
+			if cniAddon == nil {
+				return
+			}
+			c.context = checkContext{AddonVersion: lo.FromPtr(cniAddon.AddonVersion)}
+			c.passed = isNetworkPolicyEnabled(cniAddon)
+		},
 	}
 }
 
@@ -116,10 +198,19 @@ func check545EncryptTrafficToHTTPSLoadBalancersWithTLSCertificates() check {
 	}
 }
 
-func check551ManageKubernetesRBACUsersWithAWSIAMAuthenticatorForKubernetes() check {
+func check551ManageKubernetesRBACUsersWithAWSIAMAuthenticatorForKubernetes(cluster *eks.DescribeClusterOutput, accessEntries []string) check {
 	return check{
 		id:          "5.5.1",
 		description: "5.5.1 - Manage Kubernetes RBAC users with AWS IAM Authenticator for Kubernetes",
+		validate: func(c *check) {
+			if cluster.Cluster.AccessConfig == nil {
+				return
+			}
+			c.context = checkContext{
+				AuthenticationMode: string(cluster.Cluster.AccessConfig.AuthenticationMode),
+				AccessEntries:      accessEntries,
+			}
+		},
 	}
 }
 
@@ -129,3 +220,26 @@ func check561ConsiderFargateForRunningUntrustedWorkloads() check {
 		description: "5.6.1 - Consider Fargate for running untrusted workloads",
 	}
 }
+
+// isNetworkPolicyEnabled returns whether vpc-cni addon enforces network policies. Support is enabled
+// with enableNetworkPolicy addon configuration value.
+func isNetworkPolicyEnabled(cniAddon *types.Addon) bool {
+	if cniAddon.ConfigurationValues == nil {
+		return false
+	}
+	// Configuration values are JSON or YAML encoded.
+	var values map[string]any
+	if err := yaml.Unmarshal([]byte(*cniAddon.ConfigurationValues), &values); err != nil {
+		return false
+	}
+	return fmt.Sprint(values["enableNetworkPolicy"]) == "true"
+}
+
+type checkContext struct {
+	Repositories       []string `json:"repositories,omitempty"`
+	PublicAccessCIDRs  []string `json:"publicAccessCidrs,omitempty"`
+	Subnets            []string `json:"subnets,omitempty"`
+	AddonVersion       string   `json:"addonVersion,omitempty"`
+	AuthenticationMode string   `json:"authenticationMode,omitempty"`
+	AccessEntries      []string `json:"accessEntries,omitempty"`
+}
@@ -0,0 +1,52 @@
+package eks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/samber/lo"
+)
+
+// throttleErrorCodes are AWS API error codes returned when request rate or quota is exceeded.
+var throttleErrorCodes = []string{
+	"Throttling",
+	"ThrottlingException",
+	"ThrottledException",
+	"RequestThrottledException",
+	"TooManyRequestsException",
+	"RequestLimitExceeded",
+	"LimitExceededException",
+	"RequestThrottled",
+	"SlowDown",
+}
+
+// isThrottled returns whether AWS API call failed due to rate limiting or exceeded quota.
+func isThrottled(err error) (bool, time.Duration) {
+	var respErr *smithyhttp.ResponseError
+	hasResp := errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.Response != nil
+
+	var apiErr smithy.APIError
+	throttled := errors.As(err, &apiErr) && lo.Contains(throttleErrorCodes, apiErr.ErrorCode())
+	if hasResp && respErr.HTTPStatusCode() == http.StatusTooManyRequests {
+		throttled = true
+	}
+	if !throttled {
+		return false, 0
+	}
+	if hasResp {
+		return true, parseRetryAfter(respErr.Response.Header.Get("Retry-After"))
+	}
+	return true, 0
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -2,43 +2,78 @@ package eks
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
 	json "github.com/json-iterator/go"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 
 	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/cloudscan/throttle"
 	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/tracing"
+	"github.com/castai/kvisor/version"
 )
 
 type Scanner struct {
-	cfg          *config.CloudScan
-	log          logrus.FieldLogger
-	eksClient    eksClient
-	castaiClient castaiClient
+	cfg             *config.CloudScan
+	log             logrus.FieldLogger
+	eksClient       eksClient
+	ecrClient       ecrClient
+	ec2Client       ec2Client
+	castaiClient    castaiClient
+	k8sVersionMinor int
+	throttler       *throttle.Throttler
 }
 
 type eksClient interface {
 	DescribeCluster(context.Context, *eks.DescribeClusterInput, ...func(*eks.Options)) (*eks.DescribeClusterOutput, error)
+	DescribeAddon(context.Context, *eks.DescribeAddonInput, ...func(*eks.Options)) (*eks.DescribeAddonOutput, error)
+	ListNodegroups(context.Context, *eks.ListNodegroupsInput, ...func(*eks.Options)) (*eks.ListNodegroupsOutput, error)
+	DescribeNodegroup(context.Context, *eks.DescribeNodegroupInput, ...func(*eks.Options)) (*eks.DescribeNodegroupOutput, error)
+	ListAccessEntries(context.Context, *eks.ListAccessEntriesInput, ...func(*eks.Options)) (*eks.ListAccessEntriesOutput, error)
+}
+
+type ecrClient interface {
+	DescribeRepositories(context.Context, *ecr.DescribeRepositoriesInput, ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error)
+}
+
+type ec2Client interface {
+	DescribeSubnets(context.Context, *ec2.DescribeSubnetsInput, ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
 }
 
 type castaiClient interface {
 	SendCISCloudScanReport(ctx context.Context, report *castai.CloudScanReport) error
 }
 
-func NewScanner(log logrus.FieldLogger, cfg config.CloudScan, eksClient eksClient, client castaiClient) *Scanner {
+func NewScanner(log logrus.FieldLogger, cfg config.CloudScan, eksClient eksClient, ecrClient ecrClient, ec2Client ec2Client, client castaiClient, k8sVersionMinor int) *Scanner {
 	return &Scanner{
-		cfg:          &cfg,
-		log:          log,
-		eksClient:    eksClient,
-		castaiClient: client,
+		cfg:             &cfg,
+		log:             log,
+		eksClient:       eksClient,
+		ecrClient:       ecrClient,
+		ec2Client:       ec2Client,
+		castaiClient:    client,
+		k8sVersionMinor: k8sVersionMinor,
+		throttler:       throttle.New(log, cfg.Throttle, isThrottled),
 	}
 }
 
 func (s *Scanner) Start(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(s.cfg.InitDelay):
+	}
+
 	for {
 		s.log.Info("scanning cloud")
 		if err := s.scan(ctx); err != nil {
@@ -55,26 +90,70 @@ func (s *Scanner) Start(ctx context.Context) {
 	}
 }
 
-func (s *Scanner) scan(ctx context.Context) error {
-	cluster, err := s.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: lo.ToPtr(s.cfg.EKS.ClusterName)})
-	if err != nil {
-		return fmt.Errorf("describe cluster: %w", err)
+func (s *Scanner) scan(ctx context.Context) (rerr error) {
+	ctx, span := tracing.Start(ctx, "cloudscan.eks.scan")
+	defer func() { tracing.End(span, rerr) }()
+
+	// Data sources are fetched independently. Checks which depend on failed data source are reported as errored.
+	cluster, clusterErr := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*eks.DescribeClusterOutput, error) {
+		return s.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: lo.ToPtr(s.cfg.EKS.ClusterName)})
+	})
+	if clusterErr != nil {
+		clusterErr = fmt.Errorf("describe cluster: %w", clusterErr)
+		s.log.Warn(clusterErr.Error())
+	}
+
+	cniAddon, cniAddonErr := s.getAddon(ctx, "vpc-cni")
+	if cniAddonErr != nil {
+		cniAddonErr = fmt.Errorf("describe vpc-cni addon: %w", cniAddonErr)
+		s.log.Warn(cniAddonErr.Error())
+	}
+
+	nodegroups, nodegroupsErr := s.getNodegroups(ctx)
+	if nodegroupsErr != nil {
+		s.log.Warn(nodegroupsErr.Error())
+	}
+
+	var subnets []ec2types.Subnet
+	var subnetsErr error
+	if nodegroupsErr == nil {
+		subnets, subnetsErr = s.getNodegroupsSubnets(ctx, nodegroups)
+		if subnetsErr != nil {
+			subnetsErr = fmt.Errorf("describe nodegroups subnets: %w", subnetsErr)
+			s.log.Warn(subnetsErr.Error())
+		}
+	}
+
+	var accessEntries []string
+	var accessEntriesErr error
+	if clusterErr == nil {
+		accessEntries, accessEntriesErr = s.getAccessEntries(ctx, cluster)
+		if accessEntriesErr != nil {
+			accessEntriesErr = fmt.Errorf("list access entries: %w", accessEntriesErr)
+			s.log.Warn(accessEntriesErr.Error())
+		}
+	}
+
+	repositories, repositoriesErr := s.getRepositories(ctx)
+	if repositoriesErr != nil {
+		repositoriesErr = fmt.Errorf("describe ecr repositories: %w", repositoriesErr)
+		s.log.Warn(repositoriesErr.Error())
 	}
 
 	checks := []check{
-		check431EnsureCNISupportsNetworkPolicies(),
-		check511EnsureImageVulnerabilityScanningUsingAmazonECRImageScanningOrThirdPartyProvider(),
+		dependsOn(check431EnsureCNISupportsNetworkPolicies(cniAddon), cniAddonErr),
+		dependsOn(check511EnsureImageVulnerabilityScanningUsingAmazonECRImageScanningOrThirdPartyProvider(repositories), repositoriesErr),
 		check512MinimizeUserAccessToAmazonECR(),
 		check513MinimizeClusterAccessToReadOnlyForAmazonECR(),
 		check514MinimizeContainerRegistriesToOnlyThoseApproved(),
 		check521PreferUsingManagedIdentitiesForWorkloads(),
-		check531EnsureKubernetesSecretsAreEncryptedUsingCustomerMasterKeysCMKsManagedInAWSKMS(cluster),
-		check541RestrictAccessToTheControlPlaneEndpoint(),
-		check542EnsureClustersAreCreatedWithPrivateEndpointEnabledAndPublicAccessDisabled(cluster),
-		check543EnsureClustersAreCreatedWithPrivateNodes(),
-		check544EnsureNetworkPolicyIsEnabledAndSetAsAppropriate(),
+		dependsOn(check531EnsureKubernetesSecretsAreEncryptedUsingCustomerMasterKeysCMKsManagedInAWSKMS(cluster), clusterErr),
+		dependsOn(check541RestrictAccessToTheControlPlaneEndpoint(cluster), clusterErr),
+		dependsOn(check542EnsureClustersAreCreatedWithPrivateEndpointEnabledAndPublicAccessDisabled(cluster), clusterErr),
+		dependsOn(check543EnsureClustersAreCreatedWithPrivateNodes(nodegroups, subnets), nodegroupsErr, subnetsErr),
+		dependsOn(check544EnsureNetworkPolicyIsEnabledAndSetAsAppropriate(cniAddon), cniAddonErr),
 		check545EncryptTrafficToHTTPSLoadBalancersWithTLSCertificates(),
-		check551ManageKubernetesRBACUsersWithAWSIAMAuthenticatorForKubernetes(),
+		dependsOn(check551ManageKubernetesRBACUsersWithAWSIAMAuthenticatorForKubernetes(cluster, accessEntries), clusterErr, accessEntriesErr),
 		check561ConsiderFargateForRunningUntrustedWorkloads(),
 	}
 
@@ -84,7 +163,14 @@ func (s *Scanner) scan(ctx context.Context) error {
 
 	for _, c := range checks {
 		c := c
-		if c.validate != nil {
+		if !s.cfg.IsCheckReported(c.id) {
+			continue
+		}
+		if !version.AtLeastMinor(s.k8sVersionMinor, c.minK8sMinor) {
+			c.notApplicable = true
+		} else if c.err != nil {
+			c.errored = true
+		} else if c.validate != nil {
 			c.validate(&c)
 		}
 		var err error
@@ -96,10 +182,12 @@ func (s *Scanner) scan(ctx context.Context) error {
 			}
 		}
 		report.Checks = append(report.Checks, castai.CloudScanCheck{
-			ID:        c.id,
-			Automated: c.automated,
-			Passed:    c.passed,
-			Context:   contextBytes,
+			ID:            c.id,
+			Automated:     c.automated,
+			Passed:        c.passed,
+			NotApplicable: c.notApplicable,
+			Errored:       c.errored,
+			Context:       contextBytes,
 		})
 	}
 
@@ -109,3 +197,105 @@ func (s *Scanner) scan(ctx context.Context) error {
 
 	return nil
 }
+
+// getAddon returns nil if addon is not installed.
+func (s *Scanner) getAddon(ctx context.Context, name string) (*types.Addon, error) {
+	out, err := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*eks.DescribeAddonOutput, error) {
+		return s.eksClient.DescribeAddon(ctx, &eks.DescribeAddonInput{
+			ClusterName: lo.ToPtr(s.cfg.EKS.ClusterName),
+			AddonName:   lo.ToPtr(name),
+		})
+	})
+	if err != nil {
+		var notFoundErr *types.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out.Addon, nil
+}
+
+func (s *Scanner) getNodegroups(ctx context.Context) ([]types.Nodegroup, error) {
+	var nodegroups []types.Nodegroup
+	paginator := eks.NewListNodegroupsPaginator(s.eksClient, &eks.ListNodegroupsInput{
+		ClusterName: lo.ToPtr(s.cfg.EKS.ClusterName),
+	})
+	for paginator.HasMorePages() {
+		page, err := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*eks.ListNodegroupsOutput, error) {
+			return paginator.NextPage(ctx)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list nodegroups: %w", err)
+		}
+		for _, name := range page.Nodegroups {
+			name := name
+			out, err := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*eks.DescribeNodegroupOutput, error) {
+				return s.eksClient.DescribeNodegroup(ctx, &eks.DescribeNodegroupInput{
+					ClusterName:   lo.ToPtr(s.cfg.EKS.ClusterName),
+					NodegroupName: lo.ToPtr(name),
+				})
+			})
+			if err != nil {
+				return nil, fmt.Errorf("describe nodegroup %q: %w", name, err)
+			}
+			nodegroups = append(nodegroups, *out.Nodegroup)
+		}
+	}
+	return nodegroups, nil
+}
+
+func (s *Scanner) getNodegroupsSubnets(ctx context.Context, nodegroups []types.Nodegroup) ([]ec2types.Subnet, error) {
+	subnetIDs := lo.Uniq(lo.FlatMap(nodegroups, func(ng types.Nodegroup, _ int) []string {
+		return ng.Subnets
+	}))
+	if len(subnetIDs) == 0 {
+		return nil, nil
+	}
+	out, err := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*ec2.DescribeSubnetsOutput, error) {
+		return s.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{SubnetIds: subnetIDs})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Subnets, nil
+}
+
+// getAccessEntries returns principal ARNs of cluster access entries. Access entries are not available
+// on clusters which authenticate only with aws-auth ConfigMap.
+func (s *Scanner) getAccessEntries(ctx context.Context, cluster *eks.DescribeClusterOutput) ([]string, error) {
+	accessConfig := cluster.Cluster.AccessConfig
+	if accessConfig == nil || accessConfig.AuthenticationMode == types.AuthenticationModeConfigMap {
+		return nil, nil
+	}
+
+	var entries []string
+	paginator := eks.NewListAccessEntriesPaginator(s.eksClient, &eks.ListAccessEntriesInput{
+		ClusterName: lo.ToPtr(s.cfg.EKS.ClusterName),
+	})
+	for paginator.HasMorePages() {
+		page, err := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*eks.ListAccessEntriesOutput, error) {
+			return paginator.NextPage(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.AccessEntries...)
+	}
+	return entries, nil
+}
+
+func (s *Scanner) getRepositories(ctx context.Context) ([]ecrtypes.Repository, error) {
+	var repositories []ecrtypes.Repository
+	paginator := ecr.NewDescribeRepositoriesPaginator(s.ecrClient, &ecr.DescribeRepositoriesInput{})
+	for paginator.HasMorePages() {
+		page, err := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*ecr.DescribeRepositoriesOutput, error) {
+			return paginator.NextPage(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, page.Repositories...)
+	}
+	return repositories, nil
+}
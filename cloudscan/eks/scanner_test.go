@@ -5,8 +5,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
 	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
@@ -44,6 +49,8 @@ func TestScanner(t *testing.T) {
 			},
 		},
 		eksClient:    eksClient,
+		ecrClient:    &mockECRClient{},
+		ec2Client:    &mockEC2Client{},
 		castaiClient: castaiClient,
 	}
 
@@ -54,13 +61,213 @@ func TestScanner(t *testing.T) {
 	r.NotNil(castaiClient.sentReport)
 
 	failedCount := lo.CountBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return !v.Passed })
-	r.Equal(14, failedCount)
+	r.Equal(12, failedCount)
 	manualCount := lo.CountBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return !v.Automated })
-	r.Equal(12, manualCount)
+	r.Equal(10, manualCount)
 	check := castaiClient.sentReport.Checks[0]
 	r.Equal(castai.CloudScanCheck{ID: "4.3.1"}, check)
 }
 
+func TestScannerAutomatedChecks(t *testing.T) {
+	r := require.New(t)
+
+	eksClient := &mockCloudClient{
+		response: &eks.DescribeClusterOutput{
+			Cluster: &types.Cluster{
+				ResourcesVpcConfig: &types.VpcConfigResponse{
+					EndpointPublicAccess: true,
+					PublicAccessCidrs:    []string{"0.0.0.0/0"},
+				},
+				AccessConfig: &types.AccessConfigResponse{
+					AuthenticationMode: types.AuthenticationModeApiAndConfigMap,
+				},
+			},
+		},
+		addon: &types.Addon{
+			AddonVersion:        lo.ToPtr("v1.16.0-eksbuild.1"),
+			ConfigurationValues: lo.ToPtr(`{"enableNetworkPolicy": "true"}`),
+		},
+		nodegroups: []types.Nodegroup{
+			{NodegroupName: lo.ToPtr("ng1"), Subnets: []string{"subnet-a", "subnet-b"}},
+			{NodegroupName: lo.ToPtr("ng2"), Subnets: []string{"subnet-a"}},
+		},
+		accessEntries: []string{"arn:aws:iam::123456789012:role/admin"},
+	}
+	ecrClient := &mockECRClient{
+		repositories: []ecrtypes.Repository{
+			{RepositoryName: lo.ToPtr("scanned"), ImageScanningConfiguration: &ecrtypes.ImageScanningConfiguration{ScanOnPush: true}},
+			{RepositoryName: lo.ToPtr("not-scanned"), ImageScanningConfiguration: &ecrtypes.ImageScanningConfiguration{}},
+		},
+	}
+	ec2Client := &mockEC2Client{
+		subnets: []ec2types.Subnet{
+			{SubnetId: lo.ToPtr("subnet-a"), MapPublicIpOnLaunch: lo.ToPtr(false)},
+			{SubnetId: lo.ToPtr("subnet-b"), MapPublicIpOnLaunch: lo.ToPtr(true)},
+		},
+	}
+	castaiClient := &mockCastaiClient{}
+	s := NewScanner(logrus.New(), config.CloudScan{
+		EKS: &config.CloudScanEKS{ClusterName: "test-cluster"},
+	}, eksClient, ecrClient, ec2Client, castaiClient, 0)
+
+	r.NoError(s.scan(context.Background()))
+	r.Equal([]string{"subnet-a", "subnet-b"}, ec2Client.requestedSubnets)
+
+	checks := lo.SliceToMap(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) (string, castai.CloudScanCheck) {
+		return v.ID, v
+	})
+	r.Equal(castai.CloudScanCheck{ID: "5.1.1", Automated: true, Context: []byte(`{"repositories":["not-scanned"]}`)}, checks["5.1.1"])
+	r.Equal(castai.CloudScanCheck{ID: "5.4.1", Automated: true, Context: []byte(`{"publicAccessCidrs":["0.0.0.0/0"]}`)}, checks["5.4.1"])
+	r.Equal(castai.CloudScanCheck{ID: "5.4.3", Automated: true, Context: []byte(`{"subnets":["subnet-b"]}`)}, checks["5.4.3"])
+	r.Equal(castai.CloudScanCheck{ID: "4.3.1", Passed: true, Context: []byte(`{"addonVersion":"v1.16.0-eksbuild.1"}`)}, checks["4.3.1"])
+	r.Equal(castai.CloudScanCheck{ID: "5.4.4", Passed: true, Context: []byte(`{"addonVersion":"v1.16.0-eksbuild.1"}`)}, checks["5.4.4"])
+	r.Equal(castai.CloudScanCheck{
+		ID:      "5.5.1",
+		Context: []byte(`{"authenticationMode":"API_AND_CONFIG_MAP","accessEntries":["arn:aws:iam::123456789012:role/admin"]}`),
+	}, checks["5.5.1"])
+
+	// Restricted public endpoint and nodes in private subnets pass checks.
+	eksClient.response.Cluster.ResourcesVpcConfig.PublicAccessCidrs = []string{"203.0.113.0/24"}
+	ec2Client.subnets[1].MapPublicIpOnLaunch = lo.ToPtr(false)
+	r.NoError(s.scan(context.Background()))
+	checks = lo.SliceToMap(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) (string, castai.CloudScanCheck) {
+		return v.ID, v
+	})
+	r.True(checks["5.4.1"].Passed)
+	r.True(checks["5.4.3"].Passed)
+}
+
+func TestScannerK8sVersionGate(t *testing.T) {
+	scan := func(t *testing.T, k8sVersionMinor int) castai.CloudScanCheck {
+		r := require.New(t)
+		castaiClient := &mockCastaiClient{}
+		s := NewScanner(logrus.New(), config.CloudScan{
+			EKS: &config.CloudScanEKS{
+				ClusterName: "test-cluster",
+			},
+		}, &mockCloudClient{
+			response: &eks.DescribeClusterOutput{
+				Cluster: &types.Cluster{
+					ResourcesVpcConfig: &types.VpcConfigResponse{},
+					EncryptionConfig: []types.EncryptionConfig{
+						{Resources: []string{"secrets"}},
+					},
+				},
+			},
+		}, &mockECRClient{}, &mockEC2Client{}, castaiClient, k8sVersionMinor)
+
+		r.NoError(s.scan(context.Background()))
+		check, found := lo.Find(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool {
+			return v.ID == "5.3.1"
+		})
+		r.True(found)
+		return check
+	}
+
+	t.Run("skip check as not applicable on old cluster version", func(t *testing.T) {
+		r := require.New(t)
+		check := scan(t, 12)
+		r.True(check.NotApplicable)
+		r.False(check.Passed)
+	})
+
+	t.Run("validate check on new cluster version", func(t *testing.T) {
+		r := require.New(t)
+		check := scan(t, 27)
+		r.False(check.NotApplicable)
+		r.True(check.Passed)
+	})
+}
+
+func TestScannerCheckFilters(t *testing.T) {
+	scan := func(t *testing.T, cfg config.CloudScan) []string {
+		r := require.New(t)
+		castaiClient := &mockCastaiClient{}
+		cfg.EKS = &config.CloudScanEKS{ClusterName: "test-cluster"}
+		s := NewScanner(logrus.New(), cfg, &mockCloudClient{
+			response: &eks.DescribeClusterOutput{
+				Cluster: &types.Cluster{
+					ResourcesVpcConfig: &types.VpcConfigResponse{},
+				},
+			},
+		}, &mockECRClient{}, &mockEC2Client{}, castaiClient, 0)
+
+		r.NoError(s.scan(context.Background()))
+		return lo.Map(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck, _ int) string {
+			return v.ID
+		})
+	}
+
+	t.Run("exclude checks from report", func(t *testing.T) {
+		r := require.New(t)
+		ids := scan(t, config.CloudScan{ExcludeChecks: []string{"5.3.1", "5.4.2"}})
+		r.Len(ids, 12)
+		r.NotContains(ids, "5.3.1")
+		r.NotContains(ids, "5.4.2")
+	})
+
+	t.Run("include only listed checks", func(t *testing.T) {
+		r := require.New(t)
+		ids := scan(t, config.CloudScan{
+			IncludeChecks: []string{"4.3.1", "5.3.1", "5.4.2"},
+			ExcludeChecks: []string{"5.4.2"},
+		})
+		r.Equal([]string{"4.3.1", "5.3.1"}, ids)
+	})
+}
+
+func TestScannerThrottling(t *testing.T) {
+	newScanner := func(eksClient *mockCloudClient, castaiClient *mockCastaiClient) *Scanner {
+		return NewScanner(logrus.New(), config.CloudScan{
+			EKS: &config.CloudScanEKS{ClusterName: "test-cluster"},
+			Throttle: config.CloudScanThrottle{
+				MaxRetries: 3,
+				MinBackoff: 10 * time.Millisecond,
+				MaxBackoff: 50 * time.Millisecond,
+			},
+		}, eksClient, &mockECRClient{}, &mockEC2Client{}, castaiClient, 0)
+	}
+	throttledErr := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+
+	t.Run("back off and resume on throttled responses", func(t *testing.T) {
+		r := require.New(t)
+		castaiClient := &mockCastaiClient{}
+		eksClient := &mockCloudClient{
+			response: &eks.DescribeClusterOutput{
+				Cluster: &types.Cluster{ResourcesVpcConfig: &types.VpcConfigResponse{}},
+			},
+			errs: []error{throttledErr, throttledErr},
+		}
+		s := newScanner(eksClient, castaiClient)
+
+		start := time.Now()
+		r.NoError(s.scan(context.Background()))
+		r.Equal(3, eksClient.calls)
+		// Delay is doubled after each throttled response.
+		r.GreaterOrEqual(time.Since(start), 30*time.Millisecond)
+		// Successful calls halve delay until it drops below min backoff.
+		r.Zero(s.throttler.Delay())
+		r.False(lo.SomeBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return v.Errored }))
+	})
+
+	t.Run("report checks as errored once retries are exhausted", func(t *testing.T) {
+		r := require.New(t)
+		castaiClient := &mockCastaiClient{}
+		eksClient := &mockCloudClient{
+			errs: []error{throttledErr, throttledErr, throttledErr, throttledErr},
+		}
+		s := newScanner(eksClient, castaiClient)
+
+		r.NoError(s.scan(context.Background()))
+		r.Equal(4, eksClient.calls)
+		// Other data sources are still fetched once cluster description fails.
+		r.Zero(s.throttler.Delay())
+		check, found := lo.Find(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return v.ID == "5.3.1" })
+		r.True(found)
+		r.True(check.Errored)
+	})
+}
+
 type mockCastaiClient struct {
 	sentReport *castai.CloudScanReport
 }
@@ -71,9 +278,66 @@ func (m *mockCastaiClient) SendCISCloudScanReport(ctx context.Context, report *c
 }
 
 type mockCloudClient struct {
-	response *eks.DescribeClusterOutput
+	response      *eks.DescribeClusterOutput
+	addon         *types.Addon
+	nodegroups    []types.Nodegroup
+	accessEntries []string
+	// errs are returned by the first calls before response.
+	errs  []error
+	calls int
 }
 
 func (m *mockCloudClient) DescribeCluster(context.Context, *eks.DescribeClusterInput, ...func(*eks.Options)) (*eks.DescribeClusterOutput, error) {
+	m.calls++
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
 	return m.response, nil
 }
+
+func (m *mockCloudClient) DescribeAddon(context.Context, *eks.DescribeAddonInput, ...func(*eks.Options)) (*eks.DescribeAddonOutput, error) {
+	if m.addon == nil {
+		return nil, &types.ResourceNotFoundException{Message: lo.ToPtr("addon not found")}
+	}
+	return &eks.DescribeAddonOutput{Addon: m.addon}, nil
+}
+
+func (m *mockCloudClient) ListNodegroups(context.Context, *eks.ListNodegroupsInput, ...func(*eks.Options)) (*eks.ListNodegroupsOutput, error) {
+	return &eks.ListNodegroupsOutput{
+		Nodegroups: lo.Map(m.nodegroups, func(ng types.Nodegroup, _ int) string { return *ng.NodegroupName }),
+	}, nil
+}
+
+func (m *mockCloudClient) DescribeNodegroup(_ context.Context, input *eks.DescribeNodegroupInput, _ ...func(*eks.Options)) (*eks.DescribeNodegroupOutput, error) {
+	ng, found := lo.Find(m.nodegroups, func(ng types.Nodegroup) bool { return *ng.NodegroupName == *input.NodegroupName })
+	if !found {
+		return nil, &types.ResourceNotFoundException{Message: lo.ToPtr("nodegroup not found")}
+	}
+	return &eks.DescribeNodegroupOutput{Nodegroup: &ng}, nil
+}
+
+func (m *mockCloudClient) ListAccessEntries(context.Context, *eks.ListAccessEntriesInput, ...func(*eks.Options)) (*eks.ListAccessEntriesOutput, error) {
+	return &eks.ListAccessEntriesOutput{AccessEntries: m.accessEntries}, nil
+}
+
+type mockECRClient struct {
+	repositories []ecrtypes.Repository
+}
+
+func (m *mockECRClient) DescribeRepositories(context.Context, *ecr.DescribeRepositoriesInput, ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	return &ecr.DescribeRepositoriesOutput{Repositories: m.repositories}, nil
+}
+
+type mockEC2Client struct {
+	subnets          []ec2types.Subnet
+	requestedSubnets []string
+}
+
+func (m *mockEC2Client) DescribeSubnets(_ context.Context, input *ec2.DescribeSubnetsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	m.requestedSubnets = input.SubnetIds
+	return &ec2.DescribeSubnetsOutput{
+		Subnets: lo.Filter(m.subnets, func(v ec2types.Subnet, _ int) bool { return lo.Contains(input.SubnetIds, *v.SubnetId) }),
+	}, nil
+}
@@ -69,6 +69,9 @@ func check522PreferusingdedicatedGCPServiceAccountsandWorkloadIdentity(cl *conta
 	return check{
 		id:          "5.2.2",
 		description: "5.2.2 - Prefer using dedicated GCP Service Accounts and Workload Identity",
+		// Workload Identity and GKE metadata server require GKE 1.12 or later,
+		// see https://cloud.google.com/kubernetes-engine/docs/how-to/workload-identity.
+		minK8sMinor: 12,
 		validate: func(c *check) {
 			c.passed = !(cl.WorkloadIdentityConfig == nil || cl.WorkloadIdentityConfig.WorkloadPool == "" || !strings.HasSuffix(cl.WorkloadIdentityConfig.WorkloadPool, "svc.id.goog"))
 		},
@@ -108,6 +111,9 @@ func check542EnsuretheGKEMetadataServerisEnabled(cl *containerpb.Cluster) check
 	return check{
 		id:          "5.4.2",
 		description: "5.4.2 - Ensure the GKE Metadata Server is Enabled",
+		// Workload Identity and GKE metadata server require GKE 1.12 or later,
+		// see https://cloud.google.com/kubernetes-engine/docs/how-to/workload-identity.
+		minK8sMinor: 12,
 		automated:   true,
 		validate: func(c *check) {
 			var failedPools []string
@@ -202,6 +208,9 @@ func check555EnsureShieldedGKENodesareEnabled(cl *containerpb.Cluster) check {
 	return check{
 		id:          "5.5.5",
 		description: "5.5.5 - Ensure Shielded GKE Nodes are Enabled",
+		// Shielded GKE Nodes require GKE 1.13.6 or later,
+		// see https://cloud.google.com/kubernetes-engine/docs/how-to/shielded-gke-nodes.
+		minK8sMinor: 13,
 		validate: func(c *check) {
 			c.passed = !(cl.ShieldedNodes == nil || !cl.ShieldedNodes.Enabled)
 		},
@@ -211,6 +220,9 @@ func check556EnsureIntegrityMonitoringforShieldedGKENodesisEnabled(cl *container
 	return check{
 		id:          "5.5.6",
 		description: "5.5.6 - Ensure Integrity Monitoring for Shielded GKE Nodes is Enabled",
+		// Shielded GKE Nodes require GKE 1.13.6 or later,
+		// see https://cloud.google.com/kubernetes-engine/docs/how-to/shielded-gke-nodes.
+		minK8sMinor: 13,
 		automated:   true,
 		validate: func(c *check) {
 			var failedPools []string
@@ -231,6 +243,9 @@ func check557EnsureSecureBootforShieldedGKENodesisEnabled(cl *containerpb.Cluste
 	return check{
 		id:          "5.5.7",
 		description: "5.5.7 - Ensure Secure Boot for Shielded GKE Nodes is Enabled",
+		// Shielded GKE Nodes require GKE 1.13.6 or later,
+		// see https://cloud.google.com/kubernetes-engine/docs/how-to/shielded-gke-nodes.
+		minK8sMinor: 13,
 		automated:   true,
 		validate: func(c *check) {
 			var failedPools []string
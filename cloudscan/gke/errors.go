@@ -3,8 +3,12 @@ package gke
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/googleapis/gax-go/v2/apierror"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
 )
 
 func IsNotFound(err error) bool {
@@ -19,3 +23,30 @@ func isError(err error, expectedCode int) bool {
 
 	return false
 }
+
+// isThrottled returns whether GCP API call failed due to rate limiting or exhausted quota.
+func isThrottled(err error) (bool, time.Duration) {
+	apiErr, ok := apierror.FromError(err)
+	if !ok {
+		return false, 0
+	}
+	if apiErr.HTTPCode() != http.StatusTooManyRequests && apiErr.GRPCStatus().Code() != codes.ResourceExhausted {
+		return false, 0
+	}
+	if retryInfo := apiErr.Details().RetryInfo; retryInfo != nil {
+		return true, retryInfo.GetRetryDelay().AsDuration()
+	}
+	var httpErr *googleapi.Error
+	if errors.As(err, &httpErr) {
+		return true, parseRetryAfter(httpErr.Header.Get("Retry-After"))
+	}
+	return true, 0
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -2,6 +2,7 @@ package gke
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -20,8 +21,11 @@ import (
 	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
 
 	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/cloudscan/throttle"
 	"github.com/castai/kvisor/config"
 	"github.com/castai/kvisor/metrics"
+	"github.com/castai/kvisor/tracing"
+	"github.com/castai/kvisor/version"
 )
 
 type clusterClient interface {
@@ -40,7 +44,7 @@ type castaiClient interface {
 	SendCISCloudScanReport(ctx context.Context, report *castai.CloudScanReport) error
 }
 
-func NewScanner(log logrus.FieldLogger, cfg config.CloudScan, imgScanEnabled bool, client castaiClient) (*Scanner, error) {
+func NewScanner(log logrus.FieldLogger, cfg config.CloudScan, imgScanEnabled bool, client castaiClient, k8sVersionMinor int) (*Scanner, error) {
 	project, location := parseInfoFromClusterName(cfg.GKE.ClusterName)
 	if project == "" || location == "" {
 		return nil, fmt.Errorf("could not parse project and location from cluster name, expected format is `projects/*/locations/*/clusters/*`, actual %q", cfg.GKE.ClusterName)
@@ -78,6 +82,8 @@ func NewScanner(log logrus.FieldLogger, cfg config.CloudScan, imgScanEnabled boo
 		clusterClient:      clusterClient,
 		serviceUsageClient: serviceUsageClient,
 		binauthzClient:     binauthzClient,
+		k8sVersionMinor:    k8sVersionMinor,
+		throttler:          throttle.New(log, cfg.Throttle, isThrottled),
 	}, nil
 }
 
@@ -87,7 +93,19 @@ type check struct {
 	automated   bool
 	context     any
 	passed      bool
-	validate    func(c *check)
+	// minK8sMinor is the minimal kubernetes minor version for which check is applicable.
+	minK8sMinor   int
+	notApplicable bool
+	// err is set when data source needed for check validation could not be fetched.
+	err      error
+	errored  bool
+	validate func(c *check)
+}
+
+// dependsOn marks check as errored if any of its data sources failed to load.
+func dependsOn(c check, errs ...error) check {
+	c.err = errors.Join(errs...)
+	return c
 }
 
 type Scanner struct {
@@ -100,9 +118,23 @@ type Scanner struct {
 	clusterClient      clusterClient
 	serviceUsageClient serviceUsageClient
 	binauthzClient     binauthzClient
+	k8sVersionMinor    int
+	throttler          *throttle.Throttler
+
+	// cachedReport is the last report built from fully fetched data sources. It is resent
+	// while cluster etag is unchanged until full refresh is due.
+	cachedReport      *castai.CloudScanReport
+	cachedClusterEtag string
+	cachedScans       int
 }
 
 func (s *Scanner) Start(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(s.cfg.InitDelay):
+	}
+
 	for {
 		s.log.Info("scanning cloud")
 		if err := s.scan(ctx); err != nil {
@@ -126,75 +158,93 @@ func (s *Scanner) scan(ctx context.Context) (rerr error) {
 		metrics.ObserveScanDuration(metrics.ScanTypeCloud, start)
 	}()
 
-	cl, err := s.clusterClient.GetCluster(ctx, &containerpb.GetClusterRequest{
-		Name: s.cfg.GKE.ClusterName,
+	ctx, span := tracing.Start(ctx, "cloudscan.gke.scan")
+	defer func() { tracing.End(span, rerr) }()
+
+	// Data sources are fetched independently. If some of them fail, dependent checks
+	// are reported as errored while the rest of the checks are still evaluated.
+	cl, clErr := throttle.Do(ctx, s.throttler, func(ctx context.Context) (*containerpb.Cluster, error) {
+		return s.clusterClient.GetCluster(ctx, &containerpb.GetClusterRequest{
+			Name: s.cfg.GKE.ClusterName,
+		})
 	})
-	if err != nil {
-		return fmt.Errorf("getting cluster: %w", err)
+	if clErr != nil {
+		clErr = fmt.Errorf("getting cluster: %w", clErr)
+		s.log.Warn(clErr.Error())
 	}
 
-	containerUsageService, err := s.serviceUsageClient.GetService(ctx, &serviceusagepb.GetServiceRequest{
-		Name: fmt.Sprintf("projects/%s/services/containerscanning.googleapis.com", s.project),
-	})
-	if err != nil {
-		return fmt.Errorf("getting container scan service usage: %w", err)
+	if report, ok := s.getCachedReport(cl); ok {
+		metrics.IncCloudScanCacheLookups(true)
+		s.log.Debug("gke cluster is unchanged, sending cached cloud scan report")
+		return s.castaiClient.SendCISCloudScanReport(ctx, report)
 	}
+	metrics.IncCloudScanCacheLookups(false)
 
-	binaryAuthService, err := s.serviceUsageClient.GetService(ctx, &serviceusagepb.GetServiceRequest{
-		Name: fmt.Sprintf("projects/%s/services/binaryauthorization.googleapis.com", s.project),
-	})
-	if err != nil {
-		return fmt.Errorf("getting binary auth service usage: %w", err)
+	containerUsageService, containerUsageErr := s.getService(ctx, "containerscanning.googleapis.com")
+	if containerUsageErr != nil {
+		containerUsageErr = fmt.Errorf("getting container scan service usage: %w", containerUsageErr)
+		s.log.Warn(containerUsageErr.Error())
+	}
+
+	binaryAuthService, binaryAuthErr := s.getService(ctx, "binaryauthorization.googleapis.com")
+	if binaryAuthErr != nil {
+		binaryAuthErr = fmt.Errorf("getting binary auth service usage: %w", binaryAuthErr)
+		s.log.Warn(binaryAuthErr.Error())
 	}
 
 	var binaryauthPolicy *binaryauthorizationpb.Policy
-	if binaryAuthService.State == serviceusagepb.State_ENABLED {
-		binaryauthPolicy, err = s.binauthzClient.GetPolicy(ctx, &binaryauthorizationpb.GetPolicyRequest{
-			Name: fmt.Sprintf("projects/%s/policy", s.project),
+	var binaryauthPolicyErr error
+	if binaryAuthErr == nil && binaryAuthService.State == serviceusagepb.State_ENABLED {
+		var err error
+		binaryauthPolicy, err = throttle.Do(ctx, s.throttler, func(ctx context.Context) (*binaryauthorizationpb.Policy, error) {
+			return s.binauthzClient.GetPolicy(ctx, &binaryauthorizationpb.GetPolicyRequest{
+				Name: fmt.Sprintf("projects/%s/policy", s.project),
+			})
 		})
 		if err != nil && !IsNotFound(err) {
-			s.log.Warnf("getting binary auth policy: %w", err)
+			binaryauthPolicyErr = err
+			s.log.Warnf("getting binary auth policy: %v", err)
 		}
 	}
 
 	checks := []check{
-		check431EnsureCNISupportsNetworkPolicies(cl),
-		check511EnsureImageVulnerabilityScanningusingGCRContainerAnalysisorathirdpartyprovider(containerUsageService, s.imgScanEnabled),
+		dependsOn(check431EnsureCNISupportsNetworkPolicies(cl), clErr),
+		dependsOn(check511EnsureImageVulnerabilityScanningusingGCRContainerAnalysisorathirdpartyprovider(containerUsageService, s.imgScanEnabled), containerUsageErr),
 		check512MinimizeuseraccesstoGCR(),
 		check513MinimizeclusteraccesstoreadonlyforGCR(),
 		check514MinimizeContainerRegistriestoonlythoseapproved(),
-		check521EnsureGKEclustersarenotrunningusingtheComputeEnginedefaultserviceaccount(cl),
-		check522PreferusingdedicatedGCPServiceAccountsandWorkloadIdentity(cl),
-		check531EnsureKubernetesSecretsareencryptedusingkeysmanagedinCloudKMS(cl),
-		check541EnsurelegacyComputeEngineinstancemetadataAPIsareDisabled(cl),
-		check542EnsuretheGKEMetadataServerisEnabled(cl),
-		check551EnsureContainerOptimizedOSCOSisusedforGKEnodeimages(cl),
-		check552EnsureNodeAutoRepairisenabledforGKEnodes(cl),
-		check553EnsureNodeAutoUpgradeisenabledforGKEnodes(cl),
-		check554WhencreatingNewClustersAutomateGKEversionmanagementusingReleaseChannels(cl),
-		check555EnsureShieldedGKENodesareEnabled(cl),
-		check556EnsureIntegrityMonitoringforShieldedGKENodesisEnabled(cl),
-		check557EnsureSecureBootforShieldedGKENodesisEnabled(cl),
-		check561EnableVPCFlowLogsandIntranodeVisibility(cl),
-		check562EnsureuseofVPCnativeclusters(cl),
-		check563EnsureMasterAuthorizedNetworksisEnabled(cl),
-		check564EnsureclustersarecreatedwithPrivateEndpointEnabledandPublicAccessDisabled(cl),
-		check565EnsureclustersarecreatedwithPrivateNodes(cl),
+		dependsOn(check521EnsureGKEclustersarenotrunningusingtheComputeEnginedefaultserviceaccount(cl), clErr),
+		dependsOn(check522PreferusingdedicatedGCPServiceAccountsandWorkloadIdentity(cl), clErr),
+		dependsOn(check531EnsureKubernetesSecretsareencryptedusingkeysmanagedinCloudKMS(cl), clErr),
+		dependsOn(check541EnsurelegacyComputeEngineinstancemetadataAPIsareDisabled(cl), clErr),
+		dependsOn(check542EnsuretheGKEMetadataServerisEnabled(cl), clErr),
+		dependsOn(check551EnsureContainerOptimizedOSCOSisusedforGKEnodeimages(cl), clErr),
+		dependsOn(check552EnsureNodeAutoRepairisenabledforGKEnodes(cl), clErr),
+		dependsOn(check553EnsureNodeAutoUpgradeisenabledforGKEnodes(cl), clErr),
+		dependsOn(check554WhencreatingNewClustersAutomateGKEversionmanagementusingReleaseChannels(cl), clErr),
+		dependsOn(check555EnsureShieldedGKENodesareEnabled(cl), clErr),
+		dependsOn(check556EnsureIntegrityMonitoringforShieldedGKENodesisEnabled(cl), clErr),
+		dependsOn(check557EnsureSecureBootforShieldedGKENodesisEnabled(cl), clErr),
+		dependsOn(check561EnableVPCFlowLogsandIntranodeVisibility(cl), clErr),
+		dependsOn(check562EnsureuseofVPCnativeclusters(cl), clErr),
+		dependsOn(check563EnsureMasterAuthorizedNetworksisEnabled(cl), clErr),
+		dependsOn(check564EnsureclustersarecreatedwithPrivateEndpointEnabledandPublicAccessDisabled(cl), clErr),
+		dependsOn(check565EnsureclustersarecreatedwithPrivateNodes(cl), clErr),
 		check566ConsiderfirewallingGKEworkernodes(),
-		check567EnsureNetworkPolicyisEnabledandsetasappropriate(cl),
+		dependsOn(check567EnsureNetworkPolicyisEnabledandsetasappropriate(cl), clErr),
 		check568EnsureuseofGooglemanagedSSLCertificates(),
-		check571EnsureStackdriverKubernetesLoggingandMonitoringisEnabled(cl),
+		dependsOn(check571EnsureStackdriverKubernetesLoggingandMonitoringisEnabled(cl), clErr),
 		check572EnableLinuxauditdlogging(),
-		check581EnsureBasicAuthenticationusingstaticpasswordsisDisabled(cl),
-		check582EnsureauthenticationusingClientCertificatesisDisabled(cl),
-		check583ManageKubernetesRBACuserswithGoogleGroupsforGKE(cl),
-		check584EnsureLegacyAuthorizationABACisDisabled(cl),
+		dependsOn(check581EnsureBasicAuthenticationusingstaticpasswordsisDisabled(cl), clErr),
+		dependsOn(check582EnsureauthenticationusingClientCertificatesisDisabled(cl), clErr),
+		dependsOn(check583ManageKubernetesRBACuserswithGoogleGroupsforGKE(cl), clErr),
+		dependsOn(check584EnsureLegacyAuthorizationABACisDisabled(cl), clErr),
 		check591EnableCustomerManagedEncryptionKeysCMEKforGKEPersistentDisksPD(),
-		check5101EnsureKubernetesWebUIisDisabled(cl),
-		check5102EnsurethatAlphaclustersarenotusedforproductionworkloads(cl),
+		dependsOn(check5101EnsureKubernetesWebUIisDisabled(cl), clErr),
+		dependsOn(check5102EnsurethatAlphaclustersarenotusedforproductionworkloads(cl), clErr),
 		check5103EnsurePodSecurityPolicyisEnabledandsetasappropriate(),
-		check5104ConsiderGKESandboxforrunninguntrustedworkloads(cl),
-		check5105EnsureuseofBinaryAuthorization(cl, binaryAuthService, binaryauthPolicy),
+		dependsOn(check5104ConsiderGKESandboxforrunninguntrustedworkloads(cl), clErr),
+		dependsOn(check5105EnsureuseofBinaryAuthorization(cl, binaryAuthService, binaryauthPolicy), clErr, binaryAuthErr),
 		check5106EnableCloudSecurityCommandCenterCloudSCC(),
 	}
 
@@ -203,21 +253,31 @@ func (s *Scanner) scan(ctx context.Context) (rerr error) {
 	}
 	for _, c := range checks {
 		c := c
-		if c.validate != nil {
+		if !s.cfg.IsCheckReported(c.id) {
+			continue
+		}
+		if !version.AtLeastMinor(s.k8sVersionMinor, c.minK8sMinor) {
+			c.notApplicable = true
+		} else if c.err != nil {
+			c.errored = true
+		} else if c.validate != nil {
 			c.validate(&c)
 		}
 		var contextBytes json.RawMessage
 		if c.context != nil {
+			var err error
 			contextBytes, err = json.Marshal(c.context)
 			if err != nil {
 				return err
 			}
 		}
 		report.Checks = append(report.Checks, castai.CloudScanCheck{
-			ID:        c.id,
-			Automated: c.automated,
-			Passed:    c.passed,
-			Context:   contextBytes,
+			ID:            c.id,
+			Automated:     c.automated,
+			Passed:        c.passed,
+			NotApplicable: c.notApplicable,
+			Errored:       c.errored,
+			Context:       contextBytes,
 		})
 	}
 
@@ -225,9 +285,38 @@ func (s *Scanner) scan(ctx context.Context) (rerr error) {
 		return err
 	}
 
+	// Only reports without failed data sources are cached so that errored checks are retried on the next scan.
+	s.cachedReport = nil
+	if errors.Join(clErr, containerUsageErr, binaryAuthErr, binaryauthPolicyErr) == nil {
+		s.cachedReport = report
+		s.cachedClusterEtag = cl.Etag
+		s.cachedScans = 0
+	}
+
 	return nil
 }
 
+// getCachedReport returns previous report if cluster etag did not change since the last full scan. Service usage
+// and binary authorization policy are not covered by cluster etag, so full scan is forced every FullRefreshScans.
+func (s *Scanner) getCachedReport(cl *containerpb.Cluster) (*castai.CloudScanReport, bool) {
+	if s.cachedReport == nil || cl == nil || cl.Etag == "" || cl.Etag != s.cachedClusterEtag {
+		return nil, false
+	}
+	if s.cachedScans+1 >= s.cfg.GKE.FullRefreshScans {
+		return nil, false
+	}
+	s.cachedScans++
+	return s.cachedReport, true
+}
+
+func (s *Scanner) getService(ctx context.Context, service string) (*serviceusagepb.Service, error) {
+	return throttle.Do(ctx, s.throttler, func(ctx context.Context) (*serviceusagepb.Service, error) {
+		return s.serviceUsageClient.GetService(ctx, &serviceusagepb.GetServiceRequest{
+			Name: fmt.Sprintf("projects/%s/services/%s", s.project, service),
+		})
+	})
+}
+
 func parseInfoFromClusterName(clusterName string) (project, location string) {
 	parts := strings.Split(clusterName, "/")
 	if len(parts) != 6 {
@@ -237,6 +237,130 @@ func TestScannerPassAutomatedChecks(t *testing.T) {
 	r.Empty(failedAutomatedChecks)
 }
 
+func TestScannerPartialResultsOnDataSourceFailure(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	clusterName := "projects/my-project/locations/eu-central-1/clusters/test-cluster"
+
+	clusterClient := &mockClusterClient{
+		clusters: map[string]*containerpb.Cluster{
+			clusterName: {
+				Name:          "test-cluster",
+				NetworkPolicy: &containerpb.NetworkPolicy{Enabled: true},
+			},
+		},
+	}
+	// Binary authorization service is missing which results in service usage API error.
+	serviceUsageClient := &mockServiceUsageClient{
+		services: map[string]*serviceusagepb.Service{
+			"projects/test/services/containerscanning.googleapis.com": {
+				State: serviceusagepb.State_ENABLED,
+			},
+		},
+	}
+	castaiClient := &mockCastaiClient{}
+
+	s := Scanner{
+		log: log,
+		cfg: config.CloudScan{
+			GKE: &config.CloudScanGKE{
+				ClusterName: clusterName,
+			},
+		},
+		project:            "test",
+		clusterClient:      clusterClient,
+		castaiClient:       castaiClient,
+		serviceUsageClient: serviceUsageClient,
+		binauthzClient:     &mockBinauthClient{},
+	}
+
+	r.NoError(s.scan(ctx))
+	r.NotNil(castaiClient.sentReport)
+	r.Len(castaiClient.sentReport.Checks, 38)
+
+	checks := lo.SliceToMap(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) (string, castai.CloudScanCheck) {
+		return v.ID, v
+	})
+	r.Equal(castai.CloudScanCheck{ID: "5.10.5", Automated: true, Errored: true}, checks["5.10.5"])
+	r.Equal(castai.CloudScanCheck{ID: "4.3.1", Passed: true}, checks["4.3.1"])
+	r.True(checks["5.1.1"].Passed)
+	erroredCount := lo.CountBy(castaiClient.sentReport.Checks, func(v castai.CloudScanCheck) bool { return v.Errored })
+	r.Equal(1, erroredCount)
+}
+
+func TestScannerCachedReport(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	clusterName := "projects/my-project/locations/eu-central-1/clusters/test-cluster"
+
+	cluster := &containerpb.Cluster{
+		Name:          "test-cluster",
+		Etag:          "etag-1",
+		NetworkPolicy: &containerpb.NetworkPolicy{Enabled: true},
+	}
+	clusterClient := &mockClusterClient{
+		clusters: map[string]*containerpb.Cluster{
+			clusterName: cluster,
+		},
+	}
+	serviceUsageClient := &mockServiceUsageClient{
+		services: map[string]*serviceusagepb.Service{
+			"projects/test/services/containerscanning.googleapis.com": {
+				State: serviceusagepb.State_ENABLED,
+			},
+			"projects/test/services/binaryauthorization.googleapis.com": {
+				State: serviceusagepb.State_DISABLED,
+			},
+		},
+	}
+	castaiClient := &mockCastaiClient{}
+
+	s := Scanner{
+		log: log,
+		cfg: config.CloudScan{
+			GKE: &config.CloudScanGKE{
+				ClusterName:      clusterName,
+				FullRefreshScans: 3,
+			},
+		},
+		project:            "test",
+		clusterClient:      clusterClient,
+		castaiClient:       castaiClient,
+		serviceUsageClient: serviceUsageClient,
+		binauthzClient:     &mockBinauthClient{},
+	}
+
+	r.NoError(s.scan(ctx))
+	firstReport := castaiClient.sentReport
+	r.Equal(2, serviceUsageClient.calls)
+
+	// Cluster is unchanged, previous report is resent without querying other APIs.
+	for i := 0; i < 2; i++ {
+		r.NoError(s.scan(ctx))
+		r.Same(firstReport, castaiClient.sentReport)
+		r.Equal(2, serviceUsageClient.calls)
+	}
+
+	// Full refresh is forced after every third scan.
+	r.NoError(s.scan(ctx))
+	r.NotSame(firstReport, castaiClient.sentReport)
+	r.Equal(4, serviceUsageClient.calls)
+
+	// Changed cluster etag invalidates cache.
+	cluster.Etag = "etag-2"
+	r.NoError(s.scan(ctx))
+	r.Equal(6, serviceUsageClient.calls)
+
+	r.NoError(s.scan(ctx))
+	r.Equal(6, serviceUsageClient.calls)
+}
+
 func TestParseInfoFromCluster(t *testing.T) {
 	r := require.New(t)
 
@@ -267,7 +391,7 @@ func TestScannerLocal(t *testing.T) {
 			ClusterName:     clusterName,
 			CredentialsFile: credentialsFile,
 		},
-	}, false, castaiClient)
+	}, false, castaiClient, 0)
 	r.NoError(err)
 
 	r.NoError(s.scan(ctx))
@@ -297,9 +421,11 @@ func (m *mockCastaiClient) SendCISCloudScanReport(ctx context.Context, report *c
 
 type mockServiceUsageClient struct {
 	services map[string]*serviceusagepb.Service
+	calls    int
 }
 
 func (m *mockServiceUsageClient) GetService(ctx context.Context, req *serviceusagepb.GetServiceRequest, opts ...gax.CallOption) (*serviceusagepb.Service, error) {
+	m.calls++
 	v, ok := m.services[req.Name]
 	if ok {
 		return v, nil
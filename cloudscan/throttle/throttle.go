@@ -0,0 +1,114 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/castai/kvisor/config"
+)
+
+// ClassifyFunc returns whether error is a throttling or quota error of cloud provider API. Retry after
+// is the delay requested by provider, eg. from Retry-After header, or zero if provider did not request any.
+type ClassifyFunc func(err error) (throttled bool, retryAfter time.Duration)
+
+func New(log logrus.FieldLogger, cfg config.CloudScanThrottle, classify ClassifyFunc) *Throttler {
+	return &Throttler{
+		log:      log,
+		cfg:      cfg,
+		classify: classify,
+	}
+}
+
+// Throttler adapts rate of cloud API calls to provider throttling. Delay between calls is increased on
+// throttled responses and decreased on successful calls, so scans slow down instead of failing and
+// resume full speed once provider stops throttling. Delay is shared by all calls of the throttler.
+type Throttler struct {
+	log      logrus.FieldLogger
+	cfg      config.CloudScanThrottle
+	classify ClassifyFunc
+
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+// Do calls fn and retries it while provider throttles the call. Nil throttler calls fn once.
+func Do[T any](ctx context.Context, t *Throttler, fn func(ctx context.Context) (T, error)) (T, error) {
+	if t == nil {
+		return fn(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := sleep(ctx, t.Delay()); err != nil {
+			var empty T
+			return empty, err
+		}
+
+		res, err := fn(ctx)
+		throttled, retryAfter := false, time.Duration(0)
+		if err != nil {
+			throttled, retryAfter = t.classify(err)
+		}
+		if !throttled {
+			t.decrease()
+			return res, err
+		}
+
+		delay := t.increase(retryAfter)
+		if attempt >= t.cfg.MaxRetries {
+			return res, fmt.Errorf("cloud api call throttled after %d retries: %w", attempt, err)
+		}
+		t.log.Warnf("cloud api call throttled, retrying in %s: %v", delay, err)
+	}
+}
+
+// Delay returns current delay between cloud API calls.
+func (t *Throttler) Delay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.delay
+}
+
+func (t *Throttler) increase(retryAfter time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.delay *= 2
+	if t.delay < t.cfg.MinBackoff {
+		t.delay = t.cfg.MinBackoff
+	}
+	if t.delay < retryAfter {
+		t.delay = retryAfter
+	}
+	if t.delay > t.cfg.MaxBackoff {
+		t.delay = t.cfg.MaxBackoff
+	}
+	return t.delay
+}
+
+func (t *Throttler) decrease() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.delay /= 2
+	if t.delay < t.cfg.MinBackoff {
+		t.delay = 0
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -9,14 +9,19 @@ import (
 	"net/http/pprof"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	awsec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	awsecr "github.com/aws/aws-sdk-go-v2/service/ecr"
 	awseks "github.com/aws/aws-sdk-go-v2/service/eks"
 	"github.com/bombsimon/logrusr/v4"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/containerd/containerd/pkg/atomic"
 	"github.com/open-policy-agent/cert-controller/pkg/rotator"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
@@ -26,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -44,17 +50,26 @@ import (
 	"github.com/castai/kvisor/blobscache"
 	"github.com/castai/kvisor/castai"
 	"github.com/castai/kvisor/castai/telemetry"
+	"github.com/castai/kvisor/cloudscan/aks"
 	"github.com/castai/kvisor/cloudscan/eks"
 	"github.com/castai/kvisor/cloudscan/gke"
 	"github.com/castai/kvisor/config"
 	"github.com/castai/kvisor/delta"
 	"github.com/castai/kvisor/imagescan"
+	"github.com/castai/kvisor/joblimiter"
 	"github.com/castai/kvisor/jobsgc"
 	"github.com/castai/kvisor/kube"
+	"github.com/castai/kvisor/linters/deprecatedapi"
 	"github.com/castai/kvisor/linters/kubebench"
 	"github.com/castai/kvisor/linters/kubelinter"
+	"github.com/castai/kvisor/linters/networkpolicy"
+	"github.com/castai/kvisor/linters/podsecurity"
+	"github.com/castai/kvisor/linters/rbac"
 	agentlog "github.com/castai/kvisor/log"
+	"github.com/castai/kvisor/nodeimages"
+	"github.com/castai/kvisor/nodeinventory"
 	"github.com/castai/kvisor/policy"
+	"github.com/castai/kvisor/tracing"
 	"github.com/castai/kvisor/version"
 )
 
@@ -87,6 +102,8 @@ func NewCommand(version, gitCommit, gitRef string) *cobra.Command {
 				cfg.PolicyEnforcement.Enabled,
 				"castai-kvisor",
 				binVersion,
+				cfg.DeltaSerializationWorkers,
+				cfg.DeadLetter,
 			)
 
 			log := logrus.WithFields(logrus.Fields{})
@@ -146,10 +163,7 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 		return err
 	}
 
-	k8sVersion, err := version.Get(clientSet)
-	if err != nil {
-		return fmt.Errorf("getting kubernetes version: %w", err)
-	}
+	k8sVersion := version.GetWithFallback(ctx, logger, clientSet, cfg.KubeClient.VersionRetryTimeout)
 
 	log := logger.WithFields(logrus.Fields{
 		"version":     binVersion.Version,
@@ -158,15 +172,29 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 
 	log.Infof("running castai-kvisor version %v", binVersion)
 
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing, binVersion)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Warnf("tracing shutdown: %v", err)
+		}
+	}()
+
 	snapshotProvider := delta.NewSnapshotProvider()
 
 	informersFactory := informers.NewSharedInformerFactory(clientSet, 0)
-	kubeCtrl := kube.NewController(log, informersFactory, k8sVersion, cfg.PodNamespace)
+	kubeCtrl := kube.NewController(log, informersFactory, clientSet, k8sVersion, cfg.PodNamespace, cfg.KubeClient.InformerSyncTimeout, cfg.KubeClient.SubscriberRestartBackoff)
 
 	deltaCtrl := delta.NewController(
 		log,
 		log.Level,
-		delta.Config{DeltaSyncInterval: cfg.DeltaSyncInterval},
+		delta.Config{
+			DeltaSyncInterval: cfg.DeltaSyncInterval,
+			MaxObjectSize:     cfg.DeltaMaxObjectSize,
+			MinSendInterval:   cfg.DeltaMinSendInterval,
+		},
 		castaiClient,
 		snapshotProvider,
 		k8sVersion.MinorInt,
@@ -177,24 +205,45 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 	telemetryManager := telemetry.NewManager(log, castaiClient, cfg.Telemetry.Interval)
 
 	var scannedNodes []string
-	telemetryResponse, err := castaiClient.PostTelemetry(ctx, true)
+	telemetryResponse, err := telemetry.PostInitialTelemetry(ctx, castaiClient, cfg.Telemetry.InitialTimeout)
 	if err != nil {
-		log.Warnf("initial telemetry: %v", err)
+		log.Warnf("initial telemetry, proceeding with local config: %v", err)
 	} else {
 		cfg = telemetry.ModifyConfig(cfg, telemetryResponse)
 		scannedNodes = telemetryResponse.NodeIDs
 	}
 
+	if err := telemetry.SendAgentInfo(ctx, castaiClient, telemetry.NewAgentInfo(cfg, binVersion, k8sVersion.Full)); err != nil {
+		log.Warnf("agent info: %v", err)
+	}
+
+	eventRecorder := kube.NewEventRecorder(ctx, clientSet, cfg.Events.Enabled)
+
 	linter, err := kubelinter.New(lo.Keys(castai.LinterRuleMap))
 	if err != nil {
 		return fmt.Errorf("setting up linter: %w", err)
 	}
 
 	if cfg.Linter.Enabled {
-		log.Info("linter enabled")
+		log.Infof("linter enabled, rules: %s", strings.Join(linter.Rules(), ", "))
 		linterCtrl := kubelinter.NewController(log, cfg.Linter, castaiClient, linter)
 		kubeCtrl.AddSubscribers(linterCtrl)
 	}
+	kubeCtrl.AddSubscribers(podsecurity.NewController(log, podsecurity.Config{}, castaiClient, k8sVersion.MinorInt))
+	if cfg.RBACAnalyzer.Enabled {
+		log.Info("rbac analyzer enabled")
+		kubeCtrl.AddSubscribers(rbac.NewController(log, cfg.RBACAnalyzer, castaiClient))
+	}
+	if cfg.DeprecatedAPI.Enabled {
+		log.Info("deprecated api analyzer enabled")
+		kubeCtrl.AddSubscribers(deprecatedapi.NewController(log, cfg.DeprecatedAPI, castaiClient, k8sVersion.MinorInt))
+	}
+	if cfg.NetworkPolicy.Enabled {
+		log.Info("network policy analyzer enabled")
+		kubeCtrl.AddSubscribers(networkpolicy.NewController(log, cfg.NetworkPolicy, castaiClient))
+	}
+	// Image scan and kube-bench jobs share common budget.
+	jobLimiter := joblimiter.New(cfg.MaxConcurrentJobs)
 	if cfg.KubeBench.Enabled {
 		log.Info("kubebench enabled")
 		if cfg.KubeBench.Force {
@@ -212,19 +261,46 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 			podLogReader,
 			kubeCtrl,
 			scannedNodes,
+			eventRecorder,
+			jobLimiter,
+			k8sVersion.MinorInt,
 		)
 		kubeCtrl.AddSubscribers(kubeBenchCtrl)
 	}
+	if cfg.NodeImages.Enabled {
+		log.Info("node images inventory enabled")
+		kubeCtrl.AddSubscribers(nodeimages.NewController(log, cfg.NodeImages, castaiClient))
+	}
+	if cfg.NodeInventory.Enabled {
+		log.Info("node inventory enabled")
+		kubeCtrl.AddSubscribers(nodeinventory.NewController(log, cfg.NodeInventory, castaiClient))
+	}
+	if scanJitter := cfg.InitialScanDelayJitter(); scanJitter > 0 {
+		log.Infof("delaying initial scans by %v jitter", scanJitter)
+		cfg.ImageScan.InitDelay += scanJitter
+		cfg.CloudScan.InitDelay += scanJitter
+	}
 	var imgScanCtrl *imagescan.Controller
 	if cfg.ImageScan.Enabled {
 		log.Info("imagescan enabled")
+		var reportWriter *imagescan.VulnerabilityReportWriter
+		if cfg.ImageScan.VulnerabilityReports {
+			dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+			if err != nil {
+				return err
+			}
+			reportWriter = imagescan.NewVulnerabilityReportWriter(log, dynamicClient, clientSet.Discovery())
+			log.Info("image vulnerability reports enabled")
+		}
 		imgScanCtrl = imagescan.NewController(
 			log,
 			cfg.ImageScan,
-			imagescan.NewImageScanner(clientSet, cfg),
+			imagescan.NewImageScanner(clientSet, cfg, jobLimiter),
 			castaiClient,
 			k8sVersion.MinorInt,
 			kubeCtrl,
+			eventRecorder,
+			reportWriter,
 		)
 		kubeCtrl.AddSubscribers(imgScanCtrl)
 	}
@@ -232,7 +308,7 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 	if cfg.CloudScan.Enabled {
 		switch cfg.Provider {
 		case "gke":
-			gkeCloudScanner, err := gke.NewScanner(log, cfg.CloudScan, cfg.ImageScan.Enabled, castaiClient)
+			gkeCloudScanner, err := gke.NewScanner(log, cfg.CloudScan, cfg.ImageScan.Enabled, castaiClient, k8sVersion.MinorInt)
 			if err != nil {
 				return err
 			}
@@ -243,7 +319,25 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 				return err
 			}
 
-			go eks.NewScanner(log, cfg.CloudScan, awseks.NewFromConfig(awscfg), castaiClient).Start(ctx)
+			go eks.NewScanner(
+				log,
+				cfg.CloudScan,
+				awseks.NewFromConfig(awscfg),
+				awsecr.NewFromConfig(awscfg),
+				awsec2.NewFromConfig(awscfg),
+				castaiClient,
+				k8sVersion.MinorInt,
+			).Start(ctx)
+		case "aks":
+			if cfg.CloudScan.AKS == nil {
+				return errors.New("aks cloud scan config is required")
+			}
+			aksClient, err := aks.NewManagedClustersClientFromEnvironment(cfg.CloudScan.AKS.SubscriptionID)
+			if err != nil {
+				return fmt.Errorf("creating aks client: %w", err)
+			}
+
+			go aks.NewScanner(log, cfg.CloudScan, aksClient, castaiClient, k8sVersion.MinorInt).Start(ctx)
 		}
 	}
 
@@ -251,6 +345,9 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 	telemetryManager.AddObservers(resyncObserver)
 	featureObserver, _ := telemetry.ObserveDisabledFeatures(ctx, cfg, log)
 	telemetryManager.AddObservers(featureObserver)
+	if imgScanCtrl != nil {
+		telemetryManager.AddObservers(imgScanCtrl.TelemetryObserver())
+	}
 
 	scheme := runtime.NewScheme()
 	_ = clientgoscheme.AddToScheme(scheme)
@@ -285,10 +382,27 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 		return fmt.Errorf("add readyz check: %w", err)
 	}
 
+	var webhooks []rotator.WebhookInfo
+	webhookHandlers := map[string]admission.Handler{}
 	if cfg.PolicyEnforcement.Enabled {
-		policyEnforcer := policy.NewEnforcer(linter, cfg.PolicyEnforcement)
+		policyEnforcer := policy.NewEnforcer(linter, cfg.PolicyEnforcement, eventRecorder)
 		telemetryManager.AddObservers(policyEnforcer.TelemetryObserver())
+		webhooks = append(webhooks, rotator.WebhookInfo{
+			Name: cfg.PolicyEnforcement.WebhookName,
+			Type: rotator.Validating,
+		})
+		webhookHandlers["/validate"] = policyEnforcer
+	}
+	if cfg.ImageScan.Enabled && cfg.ImageScan.Admission.Enabled {
+		log.Info("image scan on admission enabled")
+		webhooks = append(webhooks, rotator.WebhookInfo{
+			Name: cfg.ImageScan.Admission.WebhookName,
+			Type: rotator.Validating,
+		})
+		webhookHandlers["/scan-images"] = imagescan.NewAdmissionHandler(log, cfg.ImageScan.Admission, imgScanCtrl)
+	}
 
+	if len(webhooks) > 0 {
 		rotatorReady := make(chan struct{})
 		err = rotator.AddRotator(mngr, &rotator.CertRotator{
 			SecretKey: types.NamespacedName{
@@ -300,12 +414,7 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 			CAOrganization: "cast.ai",
 			DNSName:        fmt.Sprintf("%s.%s.svc", cfg.ServiceName, cfg.PodNamespace),
 			IsReady:        rotatorReady,
-			Webhooks: []rotator.WebhookInfo{
-				{
-					Name: cfg.PolicyEnforcement.WebhookName,
-					Type: rotator.Validating,
-				},
-			},
+			Webhooks:       webhooks,
 		})
 		if err != nil {
 			return fmt.Errorf("setting up cert rotation: %w", err)
@@ -323,9 +432,11 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 
 		go func() {
 			<-rotatorReady
-			mngr.GetWebhookServer().Register("/validate", &admission.Webhook{
-				Handler: policyEnforcer,
-			})
+			for path, handler := range webhookHandlers {
+				mngr.GetWebhookServer().Register(path, &admission.Webhook{
+					Handler: handler,
+				})
+			}
 			ready.Set()
 		}()
 	}
@@ -336,17 +447,32 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 	httpMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	httpMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	httpMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-	httpMux.Handle("/metrics", promhttp.Handler())
+	httpMux.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))
 	if cfg.ImageScan.Enabled {
 		scanHandler := imagescan.NewHttpHandlers(log, castaiClient, imgScanCtrl)
 		httpMux.HandleFunc("/v1/image-scan/report", scanHandler.HandleImageMetadata)
 		httpMux.HandleFunc("/debug/images", scanHandler.HandleDebugGetImages)
 		httpMux.HandleFunc("/debug/images/details", scanHandler.HandleDebugGetImage)
-		blobsCache := blobscache.NewServer(log, blobscache.ServerConfig{})
+		httpMux.HandleFunc("/v1/image-scan/state", scanHandler.HandleDebugGetImagesState)
+		blobsCache := blobscache.NewServer(log, blobscache.ServerConfig{
+			MaxSizeBytes: cfg.ImageScan.BlobsCacheMaxSizeBytes,
+			TTL:          cfg.ImageScan.BlobsCacheTTL,
+		})
 		blobsCache.RegisterHandlers(httpMux)
 	}
+	if cfg.Linter.Enabled {
+		linterHandler := kubelinter.NewHTTPHandler(log, linter)
+		httpMux.HandleFunc("/debug/linter-rules", linterHandler.HandleDebugGetRules)
+	}
 
-	if err := mngr.Add(telemetryManager); err != nil {
+	// Manager stops runnables without waiting for them when leader election is lost.
+	// Runnables are wrapped so process waits for them to return before it exits.
+	graceful := newGracefulRunnables(log, cfg.LeaderLossGracePeriod)
+
+	if err := mngr.Add(graceful.wrap(telemetryManager)); err != nil {
 		return fmt.Errorf("add telemetry manager: %w", err)
 	}
 
@@ -356,24 +482,123 @@ func run(ctx context.Context, logger logrus.FieldLogger, castaiClient castai.Cli
 		Namespace:       cfg.PodNamespace,
 	})
 
-	if err := mngr.Add(gc); err != nil {
+	if err := mngr.Add(graceful.wrap(gc)); err != nil {
 		return fmt.Errorf("add jobs gc: %w", err)
 	}
 
-	if err := mngr.Add(kubeCtrl); err != nil {
+	if err := mngr.Add(graceful.wrap(kubeCtrl)); err != nil {
 		return fmt.Errorf("add kube controller: %w", err)
 	}
 
+	if cfg.DeadLetter.Dir != "" {
+		if err := mngr.Add(graceful.wrap(castai.NewDeadLetterReplayer(log, castaiClient, cfg.DeadLetter.ReplayInterval))); err != nil {
+			return fmt.Errorf("add dead-letter replayer: %w", err)
+		}
+	}
+
 	errg, ctx := errgroup.WithContext(ctx)
 	errg.Go(func() error {
 		return runHTTPServer(ctx, log, httpMux, cfg)
 	})
 	errg.Go(func() error {
-		return mngr.Start(ctx)
+		err := mngr.Start(ctx)
+		graceful.wait()
+		return err
 	})
 	return errg.Wait()
 }
 
+func newGracefulRunnables(log logrus.FieldLogger, gracePeriod time.Duration) *gracefulRunnables {
+	return &gracefulRunnables{
+		log:         log,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// gracefulRunnables waits up to grace period for runnables to return after manager stops them. Runnables context
+// is cancelled immediately, so runnables stop starting new work as soon as leadership is lost.
+type gracefulRunnables struct {
+	log         logrus.FieldLogger
+	gracePeriod time.Duration
+	wg          sync.WaitGroup
+	runnables   []*gracefulRunnable
+}
+
+// wrap must be called before manager is started. Runnables are counted when they are wrapped, so wait can't miss
+// runnable which manager is about to start.
+func (g *gracefulRunnables) wrap(r manager.Runnable) manager.Runnable {
+	g.wg.Add(1)
+	gr := &gracefulRunnable{runnable: r, parent: g}
+	g.runnables = append(g.runnables, gr)
+	return gr
+}
+
+// wait blocks until all started runnables are finished. It is bounded by grace period once runnables are stopped.
+// It must be called after manager is stopped. Runnables which were never started, eg. leader was never elected,
+// are not waited for and will not start anymore.
+func (g *gracefulRunnables) wait() {
+	for _, r := range g.runnables {
+		r.skipIfNotStarted()
+	}
+	g.wg.Wait()
+}
+
+type gracefulRunnable struct {
+	runnable manager.Runnable
+	parent   *gracefulRunnables
+
+	mu      sync.Mutex
+	started bool
+	skipped bool
+}
+
+func (r *gracefulRunnable) skipIfNotStarted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started && !r.skipped {
+		r.skipped = true
+		r.parent.wg.Done()
+	}
+}
+
+func (r *gracefulRunnable) Start(ctx context.Context) error {
+	r.mu.Lock()
+	if r.started || r.skipped {
+		r.mu.Unlock()
+		return nil
+	}
+	r.started = true
+	r.mu.Unlock()
+	defer r.parent.wg.Done()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.runnable.Start(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	r.parent.log.Infof("stopping, waiting up to %s for in-flight work to finish", r.parent.gracePeriod)
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(r.parent.gracePeriod):
+		r.parent.log.Warnf("in-flight work not finished within %s", r.parent.gracePeriod)
+		return nil
+	}
+}
+
+// NeedLeaderElection keeps wrapped runnable leader election setting. Manager requires leader election by default.
+func (r *gracefulRunnable) NeedLeaderElection() bool {
+	if v, ok := r.runnable.(manager.LeaderElectionRunnable); ok {
+		return v.NeedLeaderElection()
+	}
+	return true
+}
+
 func runHTTPServer(ctx context.Context, log *logrus.Entry, httpMux *http.ServeMux, cfg config.Config) error {
 	// Start http server for scan job, metrics and pprof handlers.
 	httpAddr := fmt.Sprintf(":%d", cfg.HTTPPort)
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"sync/atomic"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 func TestKubeRetryTransport(t *testing.T) {
@@ -51,6 +53,144 @@ func TestKubeRetryTransport(t *testing.T) {
 	})
 }
 
+func TestGracefulRunnables(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	t.Run("cancel runnable immediately and wait for it to return", func(t *testing.T) {
+		r := require.New(t)
+
+		graceful := newGracefulRunnables(log, time.Minute)
+		cancelled := make(chan time.Time, 1)
+		runnable := graceful.wrap(manager.RunnableFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			cancelled <- time.Now()
+			// Simulate in-flight work cleanup after cancellation.
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.NoError(runnable.Start(ctx))
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		start := time.Now()
+		cancel()
+		r.Less((<-cancelled).Sub(start), 50*time.Millisecond)
+		<-done
+		graceful.wait()
+		r.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("stop waiting for runnable once grace period elapses", func(t *testing.T) {
+		r := require.New(t)
+
+		graceful := newGracefulRunnables(log, 50*time.Millisecond)
+		release := make(chan struct{})
+		defer close(release)
+		runnable := graceful.wrap(manager.RunnableFunc(func(ctx context.Context) error {
+			// Simulate runnable which doesn't respect context cancellation.
+			<-release
+			return nil
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.NoError(runnable.Start(ctx))
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		start := time.Now()
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for runnable to stop")
+		}
+		graceful.wait()
+		r.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("do not wait grace period when runnable is finished", func(t *testing.T) {
+		r := require.New(t)
+
+		graceful := newGracefulRunnables(log, time.Minute)
+		release := make(chan struct{})
+		runnable := graceful.wrap(manager.RunnableFunc(func(ctx context.Context) error {
+			// Simulate in-flight work which is not interrupted by the stop.
+			<-release
+			return nil
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.NoError(runnable.Start(ctx))
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		cancel()
+		close(release)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for runnable to stop")
+		}
+		graceful.wait()
+	})
+
+	t.Run("do not wait for runnable which was never started", func(t *testing.T) {
+		r := require.New(t)
+
+		graceful := newGracefulRunnables(log, time.Minute)
+		started := false
+		runnable := graceful.wrap(manager.RunnableFunc(func(ctx context.Context) error {
+			started = true
+			return nil
+		}))
+
+		waited := make(chan struct{})
+		go func() {
+			defer close(waited)
+			graceful.wait()
+		}()
+		select {
+		case <-waited:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for graceful runnables")
+		}
+
+		// Runnable is not started once wait returned.
+		r.NoError(runnable.Start(context.Background()))
+		r.False(started)
+	})
+
+	t.Run("keep leader election setting", func(t *testing.T) {
+		r := require.New(t)
+
+		graceful := newGracefulRunnables(log, time.Second)
+		r.True(graceful.wrap(manager.RunnableFunc(nil)).(manager.LeaderElectionRunnable).NeedLeaderElection())
+		r.False(graceful.wrap(&mockLeaderElectionRunnable{}).(manager.LeaderElectionRunnable).NeedLeaderElection())
+	})
+}
+
+type mockLeaderElectionRunnable struct{}
+
+func (m *mockLeaderElectionRunnable) Start(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockLeaderElectionRunnable) NeedLeaderElection() bool {
+	return false
+}
+
 type mockRoundTripper struct {
 	err   error
 	calls int32
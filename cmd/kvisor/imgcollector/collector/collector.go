@@ -16,6 +16,8 @@ import (
 	"github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
@@ -48,6 +50,13 @@ type ImageInfo struct {
 }
 
 func (c *Collector) Collect(ctx context.Context) error {
+	if c.cfg.TrivyServerAddr != "" {
+		// Fail fast with distinct error so that unreachable server is not reported as image scan failure.
+		if err := c.checkTrivyServer(ctx); err != nil {
+			return err
+		}
+	}
+
 	img, cleanup, err := c.getImage(ctx)
 	if err != nil {
 		return fmt.Errorf("getting image: %w", err)
@@ -89,6 +98,7 @@ func (c *Collector) Collect(ctx context.Context) error {
 		Architecture: c.cfg.ImageArchitecture,
 		ImageDigest:  digest.String(),
 		ResourceIDs:  strings.Split(c.cfg.ResourceIDs, ","),
+		NodeName:     c.cfg.NodeName,
 		BlobsInfo:    arRef.BlobsInfo,
 		ConfigFile:   arRef.ConfigFile,
 		Manifest:     manifest,
@@ -102,17 +112,52 @@ func (c *Collector) Collect(ctx context.Context) error {
 		metadata.Index = index
 	}
 
-	if err := backoff.RetryNotify(func() error {
-		return c.sendResult(ctx, metadata)
-	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second), 3), func(err error, duration time.Duration) {
+	metadata.Findings = imageFindings(arRef.ConfigFile, manifest)
+
+	if c.cfg.TrivyServerAddr != "" {
+		artifactID, err := img.ConfigName()
 		if err != nil {
-			c.log.Errorf("sending result: %v", err)
+			return fmt.Errorf("extract config digest: %w", err)
 		}
-	}); err != nil {
-		return err
+		vulns, err := newTrivyClient(c.cfg.TrivyServerAddr, c.cfg.TrivyServerToken).scan(ctx, c.cfg.ImageName, artifactID.String(), arRef.ArtifactInfo, arRef.BlobsInfo)
+		if err != nil {
+			return fmt.Errorf("scanning with trivy server: %w", err)
+		}
+		metadata.Vulnerabilities = vulns
+	} else if c.cfg.MatchVulnerabilities {
+		vulns, err := matchLocalVulnerabilities(ctx, c.cfg, c.cfg.ImageName, arRef.BlobsInfo)
+		if err != nil {
+			return fmt.Errorf("matching vulnerabilities with trivy database: %w", err)
+		}
+		metadata.Vulnerabilities = vulns
 	}
 
-	return nil
+	if c.cfg.BuildRepository != "" || c.cfg.BuildCommit != "" || c.cfg.BuildURL != "" {
+		metadata.BuildMetadata = &castai.BuildMetadata{
+			Repository: c.cfg.BuildRepository,
+			Commit:     c.cfg.BuildCommit,
+			BuildURL:   c.cfg.BuildURL,
+		}
+	}
+
+	return c.sendResultWithRetry(ctx, metadata)
+}
+
+// sendResultWithRetry retries sending result with exponential backoff since kvisor
+// report handler can be temporary unavailable, e.g. during leader transition.
+func (c *Collector) sendResultWithRetry(ctx context.Context, metadata *castai.ImageMetadata) error {
+	b := backoff.NewExponentialBackOff()
+	if c.cfg.SendRetryInitialInterval > 0 {
+		b.InitialInterval = c.cfg.SendRetryInitialInterval
+	}
+	if c.cfg.SendRetryMaxElapsedTime > 0 {
+		b.MaxElapsedTime = c.cfg.SendRetryMaxElapsedTime
+	}
+	return backoff.RetryNotify(func() error {
+		return c.sendResult(ctx, metadata)
+	}, backoff.WithContext(b, ctx), func(err error, duration time.Duration) {
+		c.log.Errorf("sending result, retrying in %s: %v", duration, err)
+	})
 }
 
 func (c *Collector) getImage(ctx context.Context) (image.ImageWithIndex, func(), error) {
@@ -193,11 +238,19 @@ func (c *Collector) sendResult(ctx context.Context, report *castai.ImageMetadata
 	defer resp.Body.Close()
 	if st := resp.StatusCode; st != http.StatusOK {
 		errMsg, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("expected status %d, got %d, url=%s: %v", http.StatusOK, st, req.URL.String(), string(errMsg))
+		err := fmt.Errorf("expected status %d, got %d, url=%s: %v", http.StatusOK, st, req.URL.String(), string(errMsg))
+		if !isRetryableStatus(st) {
+			return backoff.Permanent(err)
+		}
+		return err
 	}
 	return nil
 }
 
+func isRetryableStatus(st int) bool {
+	return st >= http.StatusInternalServerError || st == http.StatusTooManyRequests
+}
+
 func findRegistryAuth(cfg image.DockerConfig, imgRef name.Reference) (string, image.RegistryAuth, bool) {
 	imageRepo := fmt.Sprintf("%s/%s", imgRef.Context().RegistryStr(), imgRef.Context().RepositoryStr())
 
@@ -214,3 +267,57 @@ func findRegistryAuth(cfg image.DockerConfig, imgRef name.Reference) (string, im
 	}
 	return "", image.RegistryAuth{}, false
 }
+
+// imageFindings detects security issues from image config and manifest. Pod spec may override image user,
+// but images running as root by default are reported regardless.
+func imageFindings(cfg *v1.ConfigFile, manifest *v1.Manifest) []castai.ImageFinding {
+	var findings []castai.ImageFinding
+	if cfg != nil && runsAsRoot(cfg.Config.User) {
+		findings = append(findings, castai.ImageFinding{
+			ID:      castai.ImageFindingRunsAsRoot,
+			Message: "image runs as root user, set non-root USER in image or runAsNonRoot in pod security context",
+		})
+	}
+	if manifest != nil && isManifestSchema1(manifest) {
+		findings = append(findings, castai.ImageFinding{
+			ID:      castai.ImageFindingManifestSchema1,
+			Message: "image uses deprecated Docker manifest schema v1, rebuild and push image with manifest schema v2 or OCI",
+		})
+	}
+	return findings
+}
+
+// isManifestSchema1 returns whether manifest is legacy Docker schema v1. Such manifests have no content addressable
+// config, so image ID digest doesn't identify image reliably.
+func isManifestSchema1(manifest *v1.Manifest) bool {
+	return manifest.SchemaVersion == 1 ||
+		manifest.MediaType == types.DockerManifestSchema1 ||
+		manifest.MediaType == types.DockerManifestSchema1Signed
+}
+
+// runsAsRoot returns whether image config user is root. User can be given as name or UID with optional group.
+func runsAsRoot(user string) bool {
+	user, _, _ = strings.Cut(user, ":")
+	return user == "" || user == "root" || user == "0"
+}
+
+// checkTrivyServer verifies that configured trivy server is healthy.
+func (c *Collector) checkTrivyServer(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.TrivyServerAddr, "/")+"/healthz", nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errTrivyServerUnreachable, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errTrivyServerUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: health check returned status %d", errTrivyServerUnreachable, resp.StatusCode)
+	}
+	return nil
+}
@@ -14,10 +14,15 @@ import (
 	"testing"
 	"time"
 
+	rpccache "github.com/aquasecurity/trivy/rpc/cache"
+	rpccommon "github.com/aquasecurity/trivy/rpc/common"
+	rpcscanner "github.com/aquasecurity/trivy/rpc/scanner"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/castai/image-analyzer/image"
 	"github.com/castai/image-analyzer/image/hostfs"
@@ -58,6 +63,7 @@ func TestCollector(t *testing.T) {
 			Runtime:           config.RuntimeContainerd,
 			ImageArchitecture: "amd64",
 			ImageOS:           "linux",
+			NodeName:          "node1",
 		}, mockCache, &hostfs.ContainerdHostFSConfig{
 			Platform: v1.Platform{
 				Architecture: "amd64",
@@ -74,9 +80,11 @@ func TestCollector(t *testing.T) {
 		r.NoError(err)
 		r.NoError(json.Unmarshal(b, &expected))
 		expected.Architecture = "amd64"
+		expected.NodeName = "node1"
 
 		var receivedMeta castai.ImageMetadata
 		r.NoError(json.Unmarshal(receivedMetaBytes, &receivedMeta))
+		r.Equal("node1", receivedMeta.NodeName)
 		r.Equal(expected, receivedMeta)
 	})
 }
@@ -149,6 +157,260 @@ func writeMemProfile(name string) {
 	}
 }
 
+func TestCollectorSendResultRetry(t *testing.T) {
+	t.Run("retry while kvisor is unavailable", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}))
+		defer srv.Close()
+
+		c := New(logrus.New(), config.Config{
+			ApiURL:                   srv.URL,
+			SendRetryInitialInterval: time.Millisecond,
+			SendRetryMaxElapsedTime:  time.Second,
+		}, nil, nil)
+		r.NoError(c.sendResultWithRetry(context.Background(), &castai.ImageMetadata{}))
+		r.Equal(3, calls)
+	})
+
+	t.Run("do not retry client errors", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		c := New(logrus.New(), config.Config{
+			ApiURL:                   srv.URL,
+			SendRetryInitialInterval: time.Millisecond,
+			SendRetryMaxElapsedTime:  time.Second,
+		}, nil, nil)
+		r.Error(c.sendResultWithRetry(context.Background(), &castai.ImageMetadata{}))
+		r.Equal(1, calls)
+	})
+}
+
+func TestCollectorTrivyServer(t *testing.T) {
+	t.Run("match vulnerabilities with trivy server", func(t *testing.T) {
+		r := require.New(t)
+
+		trivy := &fakeTrivyServer{}
+		cacheSrv := rpccache.NewCacheServer(trivy)
+		scannerSrv := rpcscanner.NewScannerServer(trivy)
+		mux := http.NewServeMux()
+		mux.Handle(cacheSrv.PathPrefix(), cacheSrv)
+		mux.Handle(scannerSrv.PathPrefix(), scannerSrv)
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {})
+
+		var calls []string
+		trivySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls = append(calls, req.URL.Path)
+			if req.URL.Path != "/healthz" {
+				r.Equal("trivy-token", req.Header.Get("Trivy-Token"))
+			}
+			mux.ServeHTTP(w, req)
+		}))
+		defer trivySrv.Close()
+
+		var receivedMeta castai.ImageMetadata
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.NoError(json.NewDecoder(req.Body).Decode(&receivedMeta))
+		}))
+		defer apiSrv.Close()
+
+		cwd, _ := os.Getwd()
+		c := New(logrus.New(), config.Config{
+			ApiURL:            apiSrv.URL,
+			ImageID:           "gke.gcr.io/phpmyadmin@sha256:b0d9c54760b35edd1854e5710c1a62a28ad2d2b070c801da3e30a3e59c19e7e3",
+			ImageName:         "notused",
+			Mode:              config.ModeHostFS,
+			Runtime:           config.RuntimeContainerd,
+			ImageArchitecture: "amd64",
+			ImageOS:           "linux",
+			TrivyServerAddr:   trivySrv.URL,
+			TrivyServerToken:  "trivy-token",
+		}, mock_blobcache.MockClient{}, &hostfs.ContainerdHostFSConfig{
+			Platform: v1.Platform{
+				Architecture: "amd64",
+				OS:           "linux",
+			},
+			ContentDir: path.Join(cwd, "testdata/amd64-linux/io.containerd.content.v1.content"),
+		})
+
+		r.NoError(c.Collect(context.Background()))
+
+		r.Equal("/healthz", calls[0])
+		r.Equal(cacheSrv.PathPrefix()+"PutArtifact", calls[1])
+		r.Equal(scannerSrv.PathPrefix()+"Scan", calls[len(calls)-1])
+		r.Equal("amd64", trivy.artifact.ArtifactInfo.Architecture)
+		r.NotEmpty(trivy.blobIDs)
+		r.Equal(trivy.blobIDs, trivy.scanReq.BlobIds)
+		r.Equal("notused", trivy.scanReq.Target)
+		r.Equal(trivy.artifact.ArtifactId, trivy.scanReq.ArtifactId)
+		r.NotEmpty(trivy.scanReq.ArtifactId)
+		r.Equal([]string{"vuln"}, trivy.scanReq.Options.SecurityChecks)
+		r.Equal([]castai.ImageVulnerability{
+			{
+				ID:               "CVE-2023-1",
+				PkgName:          "openssl",
+				InstalledVersion: "1.1.1",
+				FixedVersion:     "1.1.2",
+				Severity:         castai.SeverityHigh,
+			},
+		}, receivedMeta.Vulnerabilities)
+	})
+
+	t.Run("fail when trivy server scan fails", func(t *testing.T) {
+		r := require.New(t)
+
+		trivySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/healthz" {
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":"internal","msg":"failed to detect vulnerabilities"}`))
+		}))
+		defer trivySrv.Close()
+
+		cwd, _ := os.Getwd()
+		c := New(logrus.New(), config.Config{
+			ImageID:           "gke.gcr.io/phpmyadmin@sha256:b0d9c54760b35edd1854e5710c1a62a28ad2d2b070c801da3e30a3e59c19e7e3",
+			ImageName:         "notused",
+			Mode:              config.ModeHostFS,
+			Runtime:           config.RuntimeContainerd,
+			ImageArchitecture: "amd64",
+			ImageOS:           "linux",
+			TrivyServerAddr:   trivySrv.URL,
+		}, mock_blobcache.MockClient{}, &hostfs.ContainerdHostFSConfig{
+			Platform: v1.Platform{
+				Architecture: "amd64",
+				OS:           "linux",
+			},
+			ContentDir: path.Join(cwd, "testdata/amd64-linux/io.containerd.content.v1.content"),
+		})
+
+		err := c.Collect(context.Background())
+		r.ErrorContains(err, "failed to detect vulnerabilities")
+		r.Empty(ErrorCode(err))
+	})
+
+	t.Run("fail with trivy server error code when server drops scan requests", func(t *testing.T) {
+		r := require.New(t)
+
+		trivySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/healthz" {
+				return
+			}
+			conn, _, err := w.(http.Hijacker).Hijack()
+			r.NoError(err)
+			_ = conn.Close()
+		}))
+		defer trivySrv.Close()
+
+		cwd, _ := os.Getwd()
+		c := New(logrus.New(), config.Config{
+			ImageID:           "gke.gcr.io/phpmyadmin@sha256:b0d9c54760b35edd1854e5710c1a62a28ad2d2b070c801da3e30a3e59c19e7e3",
+			ImageName:         "notused",
+			Mode:              config.ModeHostFS,
+			Runtime:           config.RuntimeContainerd,
+			ImageArchitecture: "amd64",
+			ImageOS:           "linux",
+			TrivyServerAddr:   trivySrv.URL,
+		}, mock_blobcache.MockClient{}, &hostfs.ContainerdHostFSConfig{
+			Platform: v1.Platform{
+				Architecture: "amd64",
+				OS:           "linux",
+			},
+			ContentDir: path.Join(cwd, "testdata/amd64-linux/io.containerd.content.v1.content"),
+		})
+
+		err := c.Collect(context.Background())
+		r.Error(err)
+		r.Equal(config.ErrorCodeTrivyServerUnreachable, ErrorCode(err))
+	})
+
+	t.Run("fail with trivy server error code when server is unhealthy", func(t *testing.T) {
+		r := require.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.Equal("/healthz", req.URL.Path)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		c := New(logrus.New(), config.Config{TrivyServerAddr: srv.URL + "/"}, nil, nil)
+		err := c.Collect(context.Background())
+		r.Error(err)
+		r.Equal(config.ErrorCodeTrivyServerUnreachable, ErrorCode(err))
+	})
+
+	t.Run("fail with trivy server error code when server is down", func(t *testing.T) {
+		r := require.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+		srv.Close()
+
+		c := New(logrus.New(), config.Config{TrivyServerAddr: srv.URL}, nil, nil)
+		err := c.Collect(context.Background())
+		r.Error(err)
+		r.Equal(config.ErrorCodeTrivyServerUnreachable, ErrorCode(err))
+	})
+}
+
+type fakeTrivyServer struct {
+	artifact *rpccache.PutArtifactRequest
+	blobIDs  []string
+	scanReq  *rpcscanner.ScanRequest
+}
+
+func (f *fakeTrivyServer) PutArtifact(ctx context.Context, req *rpccache.PutArtifactRequest) (*emptypb.Empty, error) {
+	f.artifact = req
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeTrivyServer) PutBlob(ctx context.Context, req *rpccache.PutBlobRequest) (*emptypb.Empty, error) {
+	f.blobIDs = append(f.blobIDs, req.DiffId)
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeTrivyServer) MissingBlobs(ctx context.Context, req *rpccache.MissingBlobsRequest) (*rpccache.MissingBlobsResponse, error) {
+	return &rpccache.MissingBlobsResponse{}, nil
+}
+
+func (f *fakeTrivyServer) DeleteBlobs(ctx context.Context, req *rpccache.DeleteBlobsRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeTrivyServer) Scan(ctx context.Context, req *rpcscanner.ScanRequest) (*rpcscanner.ScanResponse, error) {
+	f.scanReq = req
+	return &rpcscanner.ScanResponse{
+		Results: []*rpcscanner.Result{
+			{
+				Target: req.Target,
+				Vulnerabilities: []*rpccommon.Vulnerability{
+					{
+						VulnerabilityId:  "CVE-2023-1",
+						PkgName:          "openssl",
+						InstalledVersion: "1.1.1",
+						FixedVersion:     "1.1.2",
+						Severity:         rpccommon.Severity_HIGH,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
 func TestFindRegistryAuth(t *testing.T) {
 	registryAuth := image.RegistryAuth{Username: "u", Password: "p", Token: "t"}
 
@@ -231,3 +493,48 @@ func TestFindRegistryAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestImageFindings(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		runsAsRoot bool
+	}{
+		{name: "empty user", user: "", runsAsRoot: true},
+		{name: "root user", user: "root", runsAsRoot: true},
+		{name: "root uid with group", user: "0:0", runsAsRoot: true},
+		{name: "non-root uid", user: "1001", runsAsRoot: false},
+		{name: "non-root user with group", user: "nginx:nginx", runsAsRoot: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			findings := imageFindings(&v1.ConfigFile{Config: v1.Config{User: test.user}}, nil)
+			if test.runsAsRoot {
+				r.Len(findings, 1)
+				r.Equal(castai.ImageFindingRunsAsRoot, findings[0].ID)
+			} else {
+				r.Empty(findings)
+			}
+		})
+	}
+
+	t.Run("no config file", func(t *testing.T) {
+		require.Empty(t, imageFindings(nil, nil))
+	})
+
+	t.Run("manifest schema v1", func(t *testing.T) {
+		r := require.New(t)
+		b, err := os.ReadFile("./testdata/manifest_schema1.json")
+		r.NoError(err)
+		var manifest v1.Manifest
+		r.NoError(json.Unmarshal(b, &manifest))
+
+		findings := imageFindings(nil, &manifest)
+		r.Len(findings, 1)
+		r.Equal(castai.ImageFindingManifestSchema1, findings[0].ID)
+
+		r.Empty(imageFindings(nil, &v1.Manifest{SchemaVersion: 2, MediaType: types.DockerManifestSchema2}))
+	})
+}
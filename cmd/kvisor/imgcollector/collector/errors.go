@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"syscall"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
+)
+
+// registryErrorCodes maps registry error codes to scan job error codes.
+var registryErrorCodes = map[transport.ErrorCode]config.ErrorCode{
+	transport.UnauthorizedErrorCode:    config.ErrorCodeUnauthorized,
+	transport.ManifestUnknownErrorCode: config.ErrorCodeManifestUnknown,
+	transport.DeniedErrorCode:          config.ErrorCodeDenied,
+}
+
+// errTrivyServerUnreachable is returned when configured trivy server doesn't respond to health check or scan requests.
+var errTrivyServerUnreachable = errors.New("trivy server unreachable")
+
+// ErrorCode classifies collection error. Empty code is returned for unknown errors.
+func ErrorCode(err error) config.ErrorCode {
+	// Checked first as trivy server errors can wrap network errors, eg. timeouts.
+	if errors.Is(err, errTrivyServerUnreachable) {
+		return config.ErrorCodeTrivyServerUnreachable
+	}
+	var registryErr *transport.Error
+	if errors.As(err, &registryErr) {
+		for _, diagnostic := range registryErr.Errors {
+			if code, found := registryErrorCodes[diagnostic.Code]; found {
+				return code
+			}
+		}
+		// Some registries respond without error details.
+		switch registryErr.StatusCode {
+		case http.StatusUnauthorized:
+			return config.ErrorCodeUnauthorized
+		case http.StatusForbidden:
+			return config.ErrorCodeDenied
+		case http.StatusNotFound:
+			return config.ErrorCodeManifestUnknown
+		}
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return config.ErrorCodeConnectionRefused
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return config.ErrorCodeTimeout
+	}
+	// Image layers can be garbage collected from node while image is read in hostfs mode.
+	if errors.Is(err, fs.ErrNotExist) {
+		return config.ErrorCodeLayerNotFound
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected config.ErrorCode
+	}{
+		{
+			name:     "unauthorized",
+			err:      &transport.Error{Errors: []transport.Diagnostic{{Code: transport.UnauthorizedErrorCode}}, StatusCode: http.StatusUnauthorized},
+			expected: config.ErrorCodeUnauthorized,
+		},
+		{
+			name:     "manifest unknown",
+			err:      fmt.Errorf("getting image: %w", &transport.Error{Errors: []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}}}),
+			expected: config.ErrorCodeManifestUnknown,
+		},
+		{
+			name:     "denied",
+			err:      &transport.Error{Errors: []transport.Diagnostic{{Code: transport.DeniedErrorCode}}},
+			expected: config.ErrorCodeDenied,
+		},
+		{
+			name:     "forbidden without details",
+			err:      &transport.Error{StatusCode: http.StatusForbidden},
+			expected: config.ErrorCodeDenied,
+		},
+		{
+			name:     "connection refused",
+			err:      fmt.Errorf("getting image: %w", &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}),
+			expected: config.ErrorCodeConnectionRefused,
+		},
+		{
+			name:     "timeout",
+			err:      fmt.Errorf("inspect: %w", context.DeadlineExceeded),
+			expected: config.ErrorCodeTimeout,
+		},
+		{
+			name:     "layer not found",
+			err:      fmt.Errorf("reading layer: %w", &os.PathError{Op: "open", Path: "/var/lib/containerd/blob", Err: os.ErrNotExist}),
+			expected: config.ErrorCodeLayerNotFound,
+		},
+		{
+			name:     "trivy server unreachable",
+			err:      fmt.Errorf("%w: %w", errTrivyServerUnreachable, context.DeadlineExceeded),
+			expected: config.ErrorCodeTrivyServerUnreachable,
+		},
+		{
+			name:     "unknown",
+			err:      errors.New("ups"),
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(test.expected, ErrorCode(test.err))
+		})
+	}
+}
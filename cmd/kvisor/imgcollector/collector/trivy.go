@@ -0,0 +1,189 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/trivy/pkg/fanal/types"
+	rpccache "github.com/aquasecurity/trivy/rpc/cache"
+	rpccommon "github.com/aquasecurity/trivy/rpc/common"
+	rpcscanner "github.com/aquasecurity/trivy/rpc/scanner"
+	"github.com/twitchtv/twirp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/castai/kvisor/castai"
+)
+
+// trivyTokenHeader is default header which trivy server started with --token expects the token in.
+const trivyTokenHeader = "Trivy-Token"
+
+func newTrivyClient(addr, token string) *trivyClient {
+	addr = strings.TrimSuffix(addr, "/")
+	httpClient := &http.Client{
+		Timeout: 2 * time.Minute,
+	}
+	return &trivyClient{
+		token:   token,
+		cache:   rpccache.NewCacheJSONClient(addr, httpClient),
+		scanner: rpcscanner.NewScannerJSONClient(addr, httpClient),
+	}
+}
+
+// trivyClient matches vulnerabilities of analyzed image with external trivy server. Artifact and blobs are put
+// to server cache the same way trivy client does in client/server mode, so scan job doesn't need trivy database.
+type trivyClient struct {
+	token   string
+	cache   rpccache.Cache
+	scanner rpcscanner.Scanner
+}
+
+func (t *trivyClient) scan(ctx context.Context, target, artifactID string, artifact *types.ArtifactInfo, blobs []types.BlobInfo) ([]castai.ImageVulnerability, error) {
+	if t.token != "" {
+		headers := http.Header{}
+		headers.Set(trivyTokenHeader, t.token)
+		var err error
+		ctx, err = twirp.WithHTTPRequestHeaders(ctx, headers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if artifact == nil {
+		artifact = &types.ArtifactInfo{}
+	}
+	if _, err := t.cache.PutArtifact(ctx, &rpccache.PutArtifactRequest{
+		ArtifactId:   artifactID,
+		ArtifactInfo: toTrivyArtifactInfo(artifact),
+	}); err != nil {
+		return nil, fmt.Errorf("putting artifact: %w", trivyServerError(err))
+	}
+
+	blobIDs := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		if _, err := t.cache.PutBlob(ctx, &rpccache.PutBlobRequest{
+			DiffId:   blob.DiffID,
+			BlobInfo: toTrivyBlobInfo(blob),
+		}); err != nil {
+			return nil, fmt.Errorf("putting blob %s: %w", blob.DiffID, trivyServerError(err))
+		}
+		blobIDs = append(blobIDs, blob.DiffID)
+	}
+
+	resp, err := t.scanner.Scan(ctx, &rpcscanner.ScanRequest{
+		Target:     target,
+		ArtifactId: artifactID,
+		BlobIds:    blobIDs,
+		Options: &rpcscanner.ScanOptions{
+			VulnType:       []string{"os", "library"},
+			SecurityChecks: []string{"vuln"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning: %w", trivyServerError(err))
+	}
+
+	var vulns []castai.ImageVulnerability
+	for _, res := range resp.Results {
+		for _, v := range res.Vulnerabilities {
+			vulns = append(vulns, castai.ImageVulnerability{
+				ID:               v.VulnerabilityId,
+				PkgName:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				// Protobuf enum names match castai.Severity* values.
+				Severity:   v.Severity.String(),
+				Title:      v.Title,
+				PrimaryURL: v.PrimaryUrl,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// trivyServerError marks transport errors as unreachable server, so they are not reported as image scan failures.
+func trivyServerError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%w: %w", errTrivyServerUnreachable, err)
+	}
+	return err
+}
+
+func toTrivyArtifactInfo(info *types.ArtifactInfo) *rpccache.ArtifactInfo {
+	res := &rpccache.ArtifactInfo{
+		SchemaVersion:   int32(info.SchemaVersion),
+		Architecture:    info.Architecture,
+		DockerVersion:   info.DockerVersion,
+		Os:              info.OS,
+		HistoryPackages: toTrivyPackages(info.HistoryPackages),
+	}
+	if !info.Created.IsZero() {
+		res.Created = timestamppb.New(info.Created)
+	}
+	return res
+}
+
+func toTrivyBlobInfo(blob types.BlobInfo) *rpccache.BlobInfo {
+	res := &rpccache.BlobInfo{
+		SchemaVersion: int32(blob.SchemaVersion),
+		OpaqueDirs:    blob.OpaqueDirs,
+		WhiteoutFiles: blob.WhiteoutFiles,
+		Digest:        blob.Digest,
+		DiffId:        blob.DiffID,
+	}
+	if os := blob.OS; os != nil {
+		res.Os = &rpccommon.OS{Family: os.Family, Name: os.Name, Eosl: os.Eosl}
+	}
+	if repo := blob.Repository; repo != nil {
+		res.Repository = &rpccommon.Repository{Family: repo.Family, Release: repo.Release}
+	}
+	for _, pkgInfo := range blob.PackageInfos {
+		res.PackageInfos = append(res.PackageInfos, &rpccommon.PackageInfo{
+			FilePath: pkgInfo.FilePath,
+			Packages: toTrivyPackages(pkgInfo.Packages),
+		})
+	}
+	for _, app := range blob.Applications {
+		res.Applications = append(res.Applications, &rpccommon.Application{
+			Type:      app.Type,
+			FilePath:  app.FilePath,
+			Libraries: toTrivyPackages(app.Libraries),
+		})
+	}
+	return res
+}
+
+func toTrivyPackages(pkgs []types.Package) []*rpccommon.Package {
+	if len(pkgs) == 0 {
+		return nil
+	}
+	res := make([]*rpccommon.Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		res = append(res, &rpccommon.Package{
+			Id:         pkg.ID,
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			Release:    pkg.Release,
+			Epoch:      int32(pkg.Epoch),
+			Arch:       pkg.Arch,
+			SrcName:    pkg.SrcName,
+			SrcVersion: pkg.SrcVersion,
+			SrcRelease: pkg.SrcRelease,
+			SrcEpoch:   int32(pkg.SrcEpoch),
+			Licenses:   pkg.Licenses,
+			Layer: &rpccommon.Layer{
+				Digest:    pkg.Layer.Digest,
+				DiffId:    pkg.Layer.DiffID,
+				CreatedBy: pkg.Layer.CreatedBy,
+			},
+			FilePath:  pkg.FilePath,
+			DependsOn: pkg.DependsOn,
+		})
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aquasecurity/trivy-db/pkg/db"
+	trivydb "github.com/aquasecurity/trivy/pkg/db"
+	"github.com/aquasecurity/trivy/pkg/detector/ospkg"
+	"github.com/aquasecurity/trivy/pkg/fanal/analyzer"
+	"github.com/aquasecurity/trivy/pkg/fanal/applier"
+	"github.com/aquasecurity/trivy/pkg/fanal/types"
+	"github.com/aquasecurity/trivy/pkg/scanner/local"
+	trivytypes "github.com/aquasecurity/trivy/pkg/types"
+	"github.com/aquasecurity/trivy/pkg/vulnerability"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
+)
+
+// matchLocalVulnerabilities matches vulnerabilities of analyzed image with local trivy database the same way trivy
+// does in standalone mode. Database is downloaded to cache dir unless update is skipped, eg. database is mounted
+// from volume.
+func matchLocalVulnerabilities(ctx context.Context, cfg config.Config, target string, blobs []types.BlobInfo) ([]castai.ImageVulnerability, error) {
+	var opts []trivydb.Option
+	if cfg.TrivyDBRepository != "" {
+		opts = append(opts, trivydb.WithDBRepository(cfg.TrivyDBRepository))
+	}
+	client := trivydb.NewClient(cfg.TrivyCacheDir, true, false, opts...)
+	needsUpdate, err := client.NeedsUpdate("", cfg.TrivySkipDBUpdate)
+	if err != nil {
+		return nil, fmt.Errorf("checking database: %w", err)
+	}
+	if needsUpdate {
+		if err := client.Download(ctx, cfg.TrivyCacheDir); err != nil {
+			return nil, fmt.Errorf("downloading database: %w", err)
+		}
+	}
+
+	if err := db.Init(cfg.TrivyCacheDir); err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
+
+	scanner := local.NewScanner(blobsApplier(blobs), ospkg.Detector{}, vulnerability.NewClient(db.Config{}))
+	results, _, err := scanner.Scan(ctx, target, "", nil, trivytypes.ScanOptions{
+		VulnType:       []string{"os", "library"},
+		SecurityChecks: []string{"vuln"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var vulns []castai.ImageVulnerability
+	for _, res := range results {
+		for _, v := range res.Vulnerabilities {
+			vulns = append(vulns, castai.ImageVulnerability{
+				ID:               v.VulnerabilityID,
+				PkgName:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				// Trivy severity names match castai.Severity* values.
+				Severity:   v.Severity,
+				Title:      v.Title,
+				PrimaryURL: v.PrimaryURL,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// blobsApplier merges analyzed image layers. Blobs are already in memory, so artifact cache used by trivy
+// is not needed.
+type blobsApplier []types.BlobInfo
+
+func (b blobsApplier) ApplyLayers(_ string, _ []string) (types.ArtifactDetail, error) {
+	detail := applier.ApplyLayers(b)
+	// Scanner expects the same errors as returned by trivy cache applier.
+	if detail.OS == nil {
+		return detail, analyzer.ErrUnknownOS
+	}
+	if detail.Packages == nil {
+		return detail, analyzer.ErrNoPkgsDetected
+	}
+	return detail, nil
+}
@@ -27,7 +27,29 @@ const (
 
 const (
 	ContainerdContentDir = "/var/lib/containerd/io.containerd.content.v1.content"
+	ContainerdSocketPath = "/run/containerd/containerd.sock"
+	DockerSocketPath     = "/var/run/docker.sock"
 	SecretMountPath      = "/secret"
+	TrivyCacheDir        = "/trivy-cache"
+	// TerminationMessagePath is default kubernetes container termination message path. Scan job writes ErrorCode
+	// to it on failure.
+	TerminationMessagePath = "/dev/termination-log"
+)
+
+// ErrorCode classifies scan job failure, so controller doesn't need to parse job logs.
+type ErrorCode string
+
+const (
+	ErrorCodeUnauthorized    ErrorCode = "unauthorized"
+	ErrorCodeManifestUnknown ErrorCode = "manifest_unknown"
+	ErrorCodeDenied          ErrorCode = "denied"
+	// ErrorCodeConnectionRefused is returned when image registry refuses connection, eg. localhost registry.
+	ErrorCodeConnectionRefused ErrorCode = "connection_refused"
+	ErrorCodeLayerNotFound     ErrorCode = "layer_not_found"
+	ErrorCodeTimeout           ErrorCode = "timeout"
+	// ErrorCodeTrivyServerUnreachable is returned when scan job is configured to use external trivy server which
+	// can't be reached.
+	ErrorCodeTrivyServerUnreachable ErrorCode = "trivy_server_unreachable"
 )
 
 type Config struct {
@@ -44,6 +66,26 @@ type Config struct {
 	DockerOptionPath  string        `envconfig:"COLLECTOR_DOCKER_OPTION_PATH" default:""`
 	PprofAddr         string        `envconfig:"COLLECTOR_PPROF_ADDR" default:""`
 	SlowMode          bool          `envconfig:"SLOW_MODE" default:"true"`
+	// Retry configuration for sending results to kvisor.
+	SendRetryInitialInterval time.Duration `envconfig:"COLLECTOR_SEND_RETRY_INITIAL_INTERVAL" default:"1s"`
+	SendRetryMaxElapsedTime  time.Duration `envconfig:"COLLECTOR_SEND_RETRY_MAX_ELAPSED_TIME" default:"2m"`
+	// Optional build metadata linking image to its source.
+	BuildRepository string `envconfig:"COLLECTOR_BUILD_REPOSITORY" default:""`
+	BuildCommit     string `envconfig:"COLLECTOR_BUILD_COMMIT" default:""`
+	BuildURL        string `envconfig:"COLLECTOR_BUILD_URL" default:""`
+	// NodeName is node which scan job runs on.
+	NodeName string `envconfig:"COLLECTOR_NODE_NAME" default:""`
+	// TrivyServerAddr is address of external trivy server. If set, vulnerabilities are matched by the server and
+	// trivy database is not used by scan job.
+	TrivyServerAddr string `envconfig:"COLLECTOR_TRIVY_SERVER_ADDR" default:""`
+	// TrivyServerToken is sent to trivy server started with --token.
+	TrivyServerToken string `envconfig:"COLLECTOR_TRIVY_SERVER_TOKEN" default:""`
+	// MatchVulnerabilities enables matching vulnerabilities with local trivy database if trivy server is not used.
+	MatchVulnerabilities bool `envconfig:"COLLECTOR_MATCH_VULNERABILITIES" default:"false"`
+	// Local trivy database is configured with standard trivy environment variables.
+	TrivyCacheDir     string `envconfig:"TRIVY_CACHE_DIR" default:"/tmp/trivy-cache"`
+	TrivyDBRepository string `envconfig:"TRIVY_DB_REPOSITORY" default:""`
+	TrivySkipDBUpdate bool   `envconfig:"TRIVY_SKIP_DB_UPDATE" default:"false"`
 	// ImageLocalTarPath is used only with ModeTarArchive for local dev.
 	ImageLocalTarPath string
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/pprof"
+	"os"
 	"runtime"
 
 	"github.com/castai/image-analyzer/image/hostfs"
@@ -68,6 +69,12 @@ func run(ctx context.Context, version string, commit string) {
 	log.Infof("collecting artifacts for image '%s(%s)', mode=%s", cfg.ImageName, cfg.ImageID, cfg.Mode)
 	err = c.Collect(ctx)
 	if err != nil {
+		if code := collector.ErrorCode(err); code != "" {
+			// Termination message is read by controller to classify scan failure.
+			if err := os.WriteFile(config.TerminationMessagePath, []byte(code), 0o600); err != nil {
+				log.Warnf("writing termination message: %v", err)
+			}
+		}
 		log.Fatalf("image artifacts collection failed: %v", err)
 		return
 	}
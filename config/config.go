@@ -1,12 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
@@ -32,6 +36,44 @@ type Config struct {
 	KubeBench         KubeBench         `envconfig:"KUBE_BENCH" yaml:"kubeBench"`
 	CloudScan         CloudScan         `envconfig:"CLOUD_SCAN" yaml:"cloudScan"`
 	Telemetry         Telemetry         `envconfig:"TELEMETRY" yaml:"telemetry"`
+	Tracing           Tracing           `envconfig:"TRACING" yaml:"tracing"`
+	NodeImages        NodeImages        `envconfig:"NODE_IMAGES" yaml:"nodeImages"`
+	RBACAnalyzer      RBACAnalyzer      `envconfig:"RBAC_ANALYZER" yaml:"rbacAnalyzer"`
+	DeprecatedAPI     DeprecatedAPI     `envconfig:"DEPRECATED_API" yaml:"deprecatedAPI"`
+	NetworkPolicy     NetworkPolicy     `envconfig:"NETWORK_POLICY" yaml:"networkPolicy"`
+	Events            Events            `envconfig:"EVENTS" yaml:"events"`
+	DeadLetter        DeadLetter        `envconfig:"DEAD_LETTER" yaml:"deadLetter"`
+	NodeInventory     NodeInventory     `envconfig:"NODE_INVENTORY" yaml:"nodeInventory"`
+	// DeltaSerializationWorkers enables parallel encoding of large deltas. Deltas are encoded on a single goroutine by default.
+	DeltaSerializationWorkers int `envconfig:"DELTA_SERIALIZATION_WORKERS" yaml:"deltaSerializationWorkers"`
+	// DeltaMaxObjectSize is max approximate size of single object in delta in bytes. Larger objects, eg. huge
+	// custom resources or annotations, are sent without payload so they do not inflate delta payloads.
+	DeltaMaxObjectSize int `envconfig:"DELTA_MAX_OBJECT_SIZE" yaml:"deltaMaxObjectSize"`
+	// LeaderLossGracePeriod is max time agent waits for in-flight work to finish after leader election is lost or agent
+	// is stopped. Work is cancelled immediately, the grace period only bounds waiting for it to return.
+	LeaderLossGracePeriod time.Duration `envconfig:"LEADER_LOSS_GRACE_PERIOD" yaml:"leaderLossGracePeriod"`
+	// InitialScanJitter is max delay added to image scan and cloud scan start. Jitter is derived from cluster and pod ID
+	// so agents restarted at the same time do not start scanning at once. Disabled if zero.
+	InitialScanJitter time.Duration `envconfig:"INITIAL_SCAN_JITTER" yaml:"initialScanJitter"`
+	// MaxConcurrentJobs limits image scan and kube-bench jobs running at the same time combined, in addition to
+	// limits of each job type. Disabled if zero.
+	MaxConcurrentJobs int `envconfig:"MAX_CONCURRENT_JOBS" yaml:"maxConcurrentJobs"`
+	// DeltaMinSendInterval is min time between sent deltas, protecting backend from too frequent deltas. Disabled if zero.
+	DeltaMinSendInterval time.Duration `envconfig:"DELTA_MIN_SEND_INTERVAL" yaml:"deltaMinSendInterval"`
+}
+
+// InitialScanDelayJitter returns stable per agent delay in [0, InitialScanJitter) range.
+func (c Config) InitialScanDelayJitter() time.Duration {
+	return jitter(c.API.ClusterID+"/"+c.PodIP, c.InitialScanJitter)
+}
+
+func jitter(id string, maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(id))
+	return time.Duration(h.Sum64() % uint64(maxJitter))
 }
 
 type PolicyEnforcement struct {
@@ -53,18 +95,54 @@ type CloudScan struct {
 	ScanInterval time.Duration `envconfig:"CLOUD_SCAN_SCAN_INTERVAL" yaml:"scanInterval"`
 	GKE          *CloudScanGKE `envconfig:"CLOUD_SCAN_GKE" yaml:"gke"`
 	EKS          *CloudScanEKS `envconfig:"CLOUD_SCAN_EKS" yaml:"eks"`
+	AKS          *CloudScanAKS `envconfig:"CLOUD_SCAN_AKS" yaml:"aks"`
+	// IncludeChecks limits reported checks to given IDs. All checks are reported if empty.
+	IncludeChecks []string `envconfig:"CLOUD_SCAN_INCLUDE_CHECKS" yaml:"includeChecks"`
+	// ExcludeChecks removes given check IDs from the report.
+	ExcludeChecks []string `envconfig:"CLOUD_SCAN_EXCLUDE_CHECKS" yaml:"excludeChecks"`
+	// InitDelay postpones the first cloud scan after agent start.
+	InitDelay time.Duration `envconfig:"CLOUD_SCAN_INIT_DELAY" yaml:"initDelay"`
+	// Throttle controls backoff of cloud API calls when provider responds with throttling or quota errors.
+	Throttle CloudScanThrottle `envconfig:"CLOUD_SCAN_THROTTLE" yaml:"throttle"`
+}
+
+type CloudScanThrottle struct {
+	// MaxRetries of throttled cloud API call before error is returned.
+	MaxRetries int `envconfig:"CLOUD_SCAN_THROTTLE_MAX_RETRIES" yaml:"maxRetries"`
+	// MinBackoff is delay between calls after the first throttled response. Delay is doubled on each
+	// subsequent throttled response up to MaxBackoff and halved on each successful call.
+	MinBackoff time.Duration `envconfig:"CLOUD_SCAN_THROTTLE_MIN_BACKOFF" yaml:"minBackoff"`
+	MaxBackoff time.Duration `envconfig:"CLOUD_SCAN_THROTTLE_MAX_BACKOFF" yaml:"maxBackoff"`
+}
+
+// IsCheckReported returns whether check with given ID should be included in the cloud scan report.
+func (c CloudScan) IsCheckReported(id string) bool {
+	if len(c.IncludeChecks) > 0 && !lo.Contains(c.IncludeChecks, id) {
+		return false
+	}
+	return !lo.Contains(c.ExcludeChecks, id)
 }
 
 type CloudScanGKE struct {
 	ClusterName        string `envconfig:"CLOUD_SCAN_GKE_CLUSTER_NAME" yaml:"clusterName"`
 	CredentialsFile    string `envconfig:"CLOUD_SCAN_GKE_CREDENTIALS_FILE" yaml:"credentialsFile"`
 	ServiceAccountName string `envconfig:"CLOUD_SCAN_GKE_SERVICE_ACCOUNT_NAME" yaml:"serviceAccountName"`
+	// FullRefreshScans forces full scan every N scans. Between full scans previous report is resent while cluster
+	// etag is unchanged, skipping service usage and binary authorization API calls. Caching is disabled if set to 1.
+	FullRefreshScans int `envconfig:"CLOUD_SCAN_GKE_FULL_REFRESH_SCANS" yaml:"fullRefreshScans"`
 }
 
 type CloudScanEKS struct {
 	ClusterName string `envconfig:"CLOUD_SCAN_EKS_CLUSTER_NAME" yaml:"clusterName"`
 }
 
+// CloudScanAKS identifies AKS managed cluster. Azure credentials are read from environment, eg. AZURE_CLIENT_ID.
+type CloudScanAKS struct {
+	SubscriptionID string `envconfig:"CLOUD_SCAN_AKS_SUBSCRIPTION_ID" yaml:"subscriptionID"`
+	ResourceGroup  string `envconfig:"CLOUD_SCAN_AKS_RESOURCE_GROUP" yaml:"resourceGroup"`
+	ClusterName    string `envconfig:"CLOUD_SCAN_AKS_CLUSTER_NAME" yaml:"clusterName"`
+}
+
 type ImageScan struct {
 	Enabled            bool           `envconfig:"IMAGE_SCAN_ENABLED" yaml:"enabled"`
 	ScanInterval       time.Duration  `envconfig:"IMAGE_SCAN_SCAN_INTERVAL" yaml:"scanInterval"`
@@ -83,15 +161,238 @@ type ImageScan struct {
 	PullSecret         string         `envconfig:"IMAGE_SCAN_PULL_SECRET" yaml:"pullSecret"`
 	InitDelay          time.Duration  `envconfig:"IMAGE_SCAN_INIT_DELAY" yaml:"initDelay"`
 	ServiceAccountName string         `envconfig:"IMAGE_SCAN_SERVICE_ACCOUNT_NAME" yaml:"serviceAccountName"`
+	// StatusCoalesceWindow batches image owner changes within the window into a single status update.
+	StatusCoalesceWindow time.Duration `envconfig:"IMAGE_SCAN_STATUS_COALESCE_WINDOW" yaml:"statusCoalesceWindow"`
+	// NodeSelector limits nodes which can be picked for image scan jobs to nodes with given labels.
+	NodeSelector map[string]string `envconfig:"IMAGE_SCAN_NODE_SELECTOR" yaml:"nodeSelector"`
+	// NodePool pins image scan jobs to a dedicated node pool.
+	NodePool ImageScanNodePool `envconfig:"IMAGE_SCAN_NODE_POOL" yaml:"nodePool"`
+	// RegistryModes overrides scan mode for images from given registry hosts, eg. docker.io: hostfs.
+	RegistryModes map[string]string `envconfig:"IMAGE_SCAN_REGISTRY_MODES" yaml:"registryModes"`
+	// MaxConcurrentRemoteScans limits concurrent remote mode scans while MaxConcurrentScans limits hostfs scans.
+	// All scans share MaxConcurrentScans limit if zero.
+	MaxConcurrentRemoteScans int64 `envconfig:"IMAGE_SCAN_MAX_CONCURRENT_REMOTE_SCANS" yaml:"maxConcurrentRemoteScans"`
+	// MaxScanAge forces image rescan when image was scanned longer than max age ago, even if remote state
+	// reports image as scanned. Disabled if zero.
+	MaxScanAge time.Duration `envconfig:"IMAGE_SCAN_MAX_SCAN_AGE" yaml:"maxScanAge"`
+	// RescanInterval requeues scanned images once their last scan is older than interval to pick up newly
+	// disclosed vulnerabilities. Images scanned within the interval are not scanned again. Disabled if zero.
+	RescanInterval time.Duration `envconfig:"IMAGE_SCAN_RESCAN_INTERVAL" yaml:"rescanInterval"`
+	// OwnerLabels and OwnerAnnotations are workload labels and annotations reported with image owners, eg. app.kubernetes.io/name.
+	OwnerLabels      []string `envconfig:"IMAGE_SCAN_OWNER_LABELS" yaml:"ownerLabels"`
+	OwnerAnnotations []string `envconfig:"IMAGE_SCAN_OWNER_ANNOTATIONS" yaml:"ownerAnnotations"`
+	// NodeSelectionStrategy controls which node is picked for scan job when image can be scanned on multiple nodes.
+	NodeSelectionStrategy string `envconfig:"IMAGE_SCAN_NODE_SELECTION_STRATEGY" yaml:"nodeSelectionStrategy"`
+	// ImageRetention removes images which are not used by any pod for longer than retention. Disabled if zero.
+	ImageRetention time.Duration `envconfig:"IMAGE_SCAN_IMAGE_RETENTION" yaml:"imageRetention"`
+	// Sampling limits scans to the highest priority images on very large clusters. All images are scanned if disabled.
+	Sampling ImageScanSampling `envconfig:"IMAGE_SCAN_SAMPLING" yaml:"sampling"`
+	// HostFSDisableCooldown is how long image is scanned remotely after hostfs scan failed due to missing image layers.
+	// Hostfs scan is retried after cooldown. Defaults to 1h if zero.
+	HostFSDisableCooldown time.Duration `envconfig:"IMAGE_SCAN_HOSTFS_DISABLE_COOLDOWN" yaml:"hostFSDisableCooldown"`
+	// SyncStateBatchSize limits image IDs sent in a single remote sync state request.
+	SyncStateBatchSize int `envconfig:"IMAGE_SCAN_SYNC_STATE_BATCH_SIZE" yaml:"syncStateBatchSize"`
+	// SyncStateConcurrency limits concurrent remote sync state requests.
+	SyncStateConcurrency int `envconfig:"IMAGE_SCAN_SYNC_STATE_CONCURRENCY" yaml:"syncStateConcurrency"`
+	// SyncStateInterval is minimal time between remote state syncs of the same not scanned image.
+	SyncStateInterval time.Duration `envconfig:"IMAGE_SCAN_SYNC_STATE_INTERVAL" yaml:"syncStateInterval"`
+	// AlwaysScanImages are scanned in remote mode even if they are not used by any pod, eg. golden base images.
+	AlwaysScanImages []string `envconfig:"IMAGE_SCAN_ALWAYS_SCAN_IMAGES" yaml:"alwaysScanImages"`
+	// SkipCrashLoopPods disables scans of images used only by pods which are not running due to crash looping containers.
+	SkipCrashLoopPods bool `envconfig:"IMAGE_SCAN_SKIP_CRASH_LOOP_PODS" yaml:"skipCrashLoopPods"`
+	// Admission scans not yet scanned images of new pods before pods are admitted.
+	Admission ImageScanAdmission `envconfig:"IMAGE_SCAN_ADMISSION" yaml:"admission"`
+	// TrivyDB overrides trivy database source of scan jobs, eg. in air-gapped clusters.
+	TrivyDB ImageScanTrivyDB `envconfig:"IMAGE_SCAN_TRIVY_DB" yaml:"trivyDB"`
+	// TrivyServerAddr is address of external trivy server, eg. http://trivy.trivy-system:4954. Scan jobs use the server
+	// instead of downloading trivy database and are not pinned to image nodes, so scans always run in remote mode.
+	TrivyServerAddr string `envconfig:"IMAGE_SCAN_TRIVY_SERVER_ADDR" yaml:"trivyServerAddr"`
+	// TrivyServerToken is token of trivy server started with --token. Optional. Scan jobs read it from job secret.
+	TrivyServerToken string `envconfig:"IMAGE_SCAN_TRIVY_SERVER_TOKEN" yaml:"trivyServerToken"`
+	// MaxIdleScanInterval is max scan interval while scan cycles find no pending images. Interval doubles after each
+	// idle cycle and is reset to ScanInterval once new images are found. Scans run every ScanInterval if zero.
+	MaxIdleScanInterval time.Duration `envconfig:"IMAGE_SCAN_MAX_IDLE_SCAN_INTERVAL" yaml:"maxIdleScanInterval"`
+	// ExcludedImages are image name patterns which are not scanned. Patterns match trailing path components of image name
+	// without tag, eg. pause matches registry.k8s.io/pause:3.9. Known infra images are excluded too.
+	ExcludedImages []string `envconfig:"IMAGE_SCAN_EXCLUDED_IMAGES" yaml:"excludedImages"`
+	// ScanInfraImages disables default exclusion of known infra images, eg. pause containers and CNI helpers.
+	ScanInfraImages bool `envconfig:"IMAGE_SCAN_SCAN_INFRA_IMAGES" yaml:"scanInfraImages"`
+	// PerRegistryMaxConcurrentScans limits concurrent scans of images from the same registry host to avoid hitting
+	// registry rate limits. Images from different registries are limited only by global limits. Disabled if zero.
+	PerRegistryMaxConcurrentScans int64 `envconfig:"IMAGE_SCAN_PER_REGISTRY_MAX_CONCURRENT_SCANS" yaml:"perRegistryMaxConcurrentScans"`
+	// DeltaWorkers is number of goroutines applying informer events to images state. Events are sharded by object,
+	// so events of the same object are applied in order.
+	DeltaWorkers int `envconfig:"IMAGE_SCAN_DELTA_WORKERS" yaml:"deltaWorkers"`
+	// ExcludedNamespaces are namespace patterns, eg. vendor-*, which pods images are not scanned.
+	ExcludedNamespaces []string `envconfig:"IMAGE_SCAN_EXCLUDED_NAMESPACES" yaml:"excludedNamespaces"`
+	// IncludedNamespaces limits scanned images to pods in namespaces matching patterns. All namespaces are scanned if empty.
+	IncludedNamespaces []string `envconfig:"IMAGE_SCAN_INCLUDED_NAMESPACES" yaml:"includedNamespaces"`
+	// Runtime overrides container runtime host paths mounted to scan jobs, eg. on k3s or microk8s nodes.
+	Runtime ImageScanRuntime `envconfig:"IMAGE_SCAN_RUNTIME" yaml:"runtime"`
+	// WorkloadPullSecrets enables remote scans of private images with image pull secrets of pods using them.
+	// Secrets are copied to scan job namespace, so kvisor needs access to read secrets in workload namespaces.
+	WorkloadPullSecrets bool `envconfig:"IMAGE_SCAN_WORKLOAD_PULL_SECRETS" yaml:"workloadPullSecrets"`
+	// WorkloadPullSecretsNamespaces are namespaces which workload image pull secrets are read from. Required if
+	// WorkloadPullSecrets is enabled, secrets of workloads in other namespaces are never copied.
+	WorkloadPullSecretsNamespaces []string `envconfig:"IMAGE_SCAN_WORKLOAD_PULL_SECRETS_NAMESPACES" yaml:"workloadPullSecretsNamespaces"`
+	// ScanWorkloadTemplates enables remote scans of images from pod templates of workloads without running pods,
+	// eg. CronJobs which haven't run yet or Deployments scaled to zero.
+	ScanWorkloadTemplates bool `envconfig:"IMAGE_SCAN_SCAN_WORKLOAD_TEMPLATES" yaml:"scanWorkloadTemplates"`
+	// BlobsCacheMaxSizeBytes is max total size of image layer blobs cached for scan jobs.
+	BlobsCacheMaxSizeBytes int64 `envconfig:"IMAGE_SCAN_BLOBS_CACHE_MAX_SIZE_BYTES" yaml:"blobsCacheMaxSizeBytes"`
+	// BlobsCacheTTL is time after which cached blobs expire, so blobs of deleted images are not kept.
+	BlobsCacheTTL time.Duration `envconfig:"IMAGE_SCAN_BLOBS_CACHE_TTL" yaml:"blobsCacheTTL"`
+	// DefaultPlatform is os/arch platform, eg. linux/arm64, used when node architecture is not known. Defaults to linux/amd64.
+	DefaultPlatform string `envconfig:"IMAGE_SCAN_DEFAULT_PLATFORM" yaml:"defaultPlatform"`
+	// VulnerabilityReports enables export of image vulnerabilities matched by scan jobs as trivy-operator
+	// VulnerabilityReport objects of workload containers. Without TrivyServerAddr scan jobs match vulnerabilities
+	// with trivy database from TrivyDB source. Reports are written only if VulnerabilityReport CRD is installed.
+	VulnerabilityReports bool `envconfig:"IMAGE_SCAN_VULNERABILITY_REPORTS" yaml:"vulnerabilityReports"`
+}
+
+type ImageScanRuntime struct {
+	// ContainerdContentDir is host directory of containerd content store used by hostfs scans.
+	ContainerdContentDir string `envconfig:"IMAGE_SCAN_RUNTIME_CONTAINERD_CONTENT_DIR" yaml:"containerdContentDir"`
+	// ContainerdSocketPath is host path of containerd socket used by daemon scans.
+	ContainerdSocketPath string `envconfig:"IMAGE_SCAN_RUNTIME_CONTAINERD_SOCKET_PATH" yaml:"containerdSocketPath"`
+	// DockerSocketPath is host path of docker socket used by daemon scans.
+	DockerSocketPath string `envconfig:"IMAGE_SCAN_RUNTIME_DOCKER_SOCKET_PATH" yaml:"dockerSocketPath"`
+}
+
+type ImageScanTrivyDB struct {
+	// Repository is OCI repository of trivy database, eg. registry.local/aquasecurity/trivy-db.
+	Repository string `envconfig:"IMAGE_SCAN_TRIVY_DB_REPOSITORY" yaml:"repository"`
+	// ClaimName is persistent volume claim with pre-downloaded trivy database cache. Database is not updated if set.
+	ClaimName string `envconfig:"IMAGE_SCAN_TRIVY_DB_CLAIM_NAME" yaml:"claimName"`
+}
+
+type ImageScanAdmission struct {
+	Enabled bool `envconfig:"IMAGE_SCAN_ADMISSION_ENABLED" yaml:"enabled"`
+	// WebhookName is name of validating webhook configuration which certificates are managed by kvisor.
+	WebhookName string `envconfig:"IMAGE_SCAN_ADMISSION_WEBHOOK_NAME" yaml:"webhookName"`
+	// Timeout is time budget for synchronous scans. Once it elapses pod is admitted and scans continue asynchronously.
+	Timeout time.Duration `envconfig:"IMAGE_SCAN_ADMISSION_TIMEOUT" yaml:"timeout"`
+	// FailurePolicy is action taken when synchronous scan fails, either warn or deny.
+	FailurePolicy string `envconfig:"IMAGE_SCAN_ADMISSION_FAILURE_POLICY" yaml:"failurePolicy"`
+	// Severity is the lowest image vulnerability severity which violates admission policy, eg. CRITICAL.
+	// Scan results are not checked if empty.
+	Severity string `envconfig:"IMAGE_SCAN_ADMISSION_SEVERITY" yaml:"severity"`
+	// SeverityPolicy is action taken when image has vulnerabilities of at least Severity, either warn or deny.
+	SeverityPolicy string `envconfig:"IMAGE_SCAN_ADMISSION_SEVERITY_POLICY" yaml:"severityPolicy"`
+}
+
+const (
+	// AdmissionPolicyWarn admits pod with warning.
+	AdmissionPolicyWarn = "warn"
+	// AdmissionPolicyDeny denies pod.
+	AdmissionPolicyDeny = "deny"
+)
+
+// admissionSeverities are image severities which can be used as admission policy threshold.
+var admissionSeverities = []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+type ImageScanSampling struct {
+	// Percent of images which are scanned. Ignored if zero.
+	Percent int `envconfig:"IMAGE_SCAN_SAMPLING_PERCENT" yaml:"percent"`
+	// MaxImages limits scans to N highest priority images. Ignored if zero.
+	MaxImages int `envconfig:"IMAGE_SCAN_SAMPLING_MAX_IMAGES" yaml:"maxImages"`
+}
+
+func (s ImageScanSampling) Enabled() bool {
+	return s.Percent > 0 || s.MaxImages > 0
+}
+
+const (
+	// NodeSelectionLeastLoaded spreads scan jobs by picking node with the most available CPU and memory relative to job requests.
+	NodeSelectionLeastLoaded = "least-loaded"
+	// NodeSelectionMostLoaded bin-packs scan jobs by picking node with the least available CPU which still fits the job.
+	NodeSelectionMostLoaded = "most-loaded"
+	// NodeSelectionRoundRobin rotates scan jobs across nodes.
+	NodeSelectionRoundRobin = "round-robin"
+)
+
+type ImageScanNodePool struct {
+	// NodeSelector matches dedicated pool nodes. Best fit node selection is used only if pool has no capacity.
+	NodeSelector map[string]string `envconfig:"IMAGE_SCAN_NODE_POOL_NODE_SELECTOR" yaml:"nodeSelector"`
+	// TaintKey is tolerated by scan jobs so they can be scheduled on tainted pool nodes.
+	TaintKey string `envconfig:"IMAGE_SCAN_NODE_POOL_TAINT_KEY" yaml:"taintKey"`
+}
+
+func (p ImageScanNodePool) Enabled() bool {
+	return len(p.NodeSelector) > 0
 }
 
 type ImageScanImage struct {
 	PullPolicy string `envconfig:"IMAGE_SCAN_IMAGE_PULL_POLICY" yaml:"pullPolicy"`
 }
 
+// RBACAnalyzer configures reporting of dangerous RBAC permissions.
+type RBACAnalyzer struct {
+	Enabled      bool          `envconfig:"RBAC_ANALYZER_ENABLED" yaml:"enabled"`
+	ScanInterval time.Duration `envconfig:"RBAC_ANALYZER_SCAN_INTERVAL" yaml:"scanInterval"`
+}
+
+// DeprecatedAPI configures reporting of objects using api versions deprecated in the cluster version.
+type DeprecatedAPI struct {
+	Enabled      bool          `envconfig:"DEPRECATED_API_ENABLED" yaml:"enabled"`
+	ScanInterval time.Duration `envconfig:"DEPRECATED_API_SCAN_INTERVAL" yaml:"scanInterval"`
+}
+
+// NetworkPolicy configures reporting of namespaces without network policies and duplicate or conflicting policies.
+type NetworkPolicy struct {
+	Enabled      bool          `envconfig:"NETWORK_POLICY_ENABLED" yaml:"enabled"`
+	ScanInterval time.Duration `envconfig:"NETWORK_POLICY_SCAN_INTERVAL" yaml:"scanInterval"`
+}
+
+// Events configures publishing of scan and enforcement actions to kubernetes event stream.
+type Events struct {
+	Enabled bool `envconfig:"EVENTS_ENABLED" yaml:"enabled"`
+}
+
+// DeadLetter configures local directory where reports which failed to upload are written for manual replay.
+type DeadLetter struct {
+	// Dir is dead-letter directory. Failed reports are dropped if empty.
+	Dir string `envconfig:"DEAD_LETTER_DIR" yaml:"dir"`
+	// MaxSizeBytes caps total size of the directory. Oldest reports are removed when cap is exceeded.
+	MaxSizeBytes int64 `envconfig:"DEAD_LETTER_MAX_SIZE_BYTES" yaml:"maxSizeBytes"`
+	// ReplayInterval is how often dead-lettered reports are resent once backend accepts reports again.
+	ReplayInterval time.Duration `envconfig:"DEAD_LETTER_REPLAY_INTERVAL" yaml:"replayInterval"`
+}
+
+// NodeImages configures reporting of all images present on nodes.
+type NodeImages struct {
+	Enabled      bool          `envconfig:"NODE_IMAGES_ENABLED" yaml:"enabled"`
+	SendInterval time.Duration `envconfig:"NODE_IMAGES_SEND_INTERVAL" yaml:"sendInterval"`
+}
+
+// NodeInventory configures reporting of nodes OS, kernel and runtime versions.
+type NodeInventory struct {
+	Enabled      bool          `envconfig:"NODE_INVENTORY_ENABLED" yaml:"enabled"`
+	SendInterval time.Duration `envconfig:"NODE_INVENTORY_SEND_INTERVAL" yaml:"sendInterval"`
+}
+
 type Linter struct {
 	Enabled      bool          `envconfig:"LINTER_ENABLED" yaml:"enabled"`
 	ScanInterval time.Duration `envconfig:"LINTER_SCAN_INTERVAL" yaml:"scanInterval"`
+	// ExcludedNamespaces objects are not linted. Defaults to kubernetes and cloud provider managed namespaces.
+	ExcludedNamespaces []string `envconfig:"LINTER_EXCLUDED_NAMESPACES" yaml:"excludedNamespaces"`
+	// MaxPayloadSize limits size of single linter checks request in bytes. Larger batches are split.
+	MaxPayloadSize int `envconfig:"LINTER_MAX_PAYLOAD_SIZE" yaml:"maxPayloadSize"`
+}
+
+// DefaultLinterExcludedNamespaces are kubernetes and cloud provider managed namespaces.
+var DefaultLinterExcludedNamespaces = []string{
+	"kube-system",
+	"kube-public",
+	"kube-node-lease",
+	"gke-system",
+	"gke-managed-system",
+	"gke-gmp-system",
+	"gmp-system",
+	"gmp-public",
+	"amazon-cloudwatch",
+	"calico-system",
+	"tigera-operator",
 }
 
 type KubeBench struct {
@@ -99,6 +400,11 @@ type KubeBench struct {
 	Force        bool           `envconfig:"KUBE_BENCH_FORCE" yaml:"force"`
 	ScanInterval time.Duration  `envconfig:"KUBE_BENCH_SCAN_INTERVAL" yaml:"scanInterval"`
 	Image        KubeBenchImage `envconfig:"KUBE_BENCH_IMAGE" yaml:"image"`
+	// MaxConcurrentJobs limits number of nodes which are benchmarked with kube-bench jobs in parallel.
+	MaxConcurrentJobs int `envconfig:"KUBE_BENCH_MAX_CONCURRENT_JOBS" yaml:"maxConcurrentJobs"`
+	// MaxConcurrentReports limits reports which are parsed from finished jobs and uploaded in parallel. Reports
+	// reused from similar nodes don't need jobs, so they are limited only by this limit.
+	MaxConcurrentReports int `envconfig:"KUBE_BENCH_MAX_CONCURRENT_REPORTS" yaml:"maxConcurrentReports"`
 }
 
 type KubeBenchImage struct {
@@ -115,6 +421,15 @@ type KubeClient struct {
 	// Custom kubeconfig path.
 	KubeConfigPath string `envconfig:"KUBE_CLIENT_KUBECONFIG" yaml:"kubeconfig"`
 	UseProtobuf    bool   `envconfig:"KUBE_CLIENT_USE_PROTOBUF" yaml:"useProtobuf"`
+	// InformerSyncTimeout is max time subscriber waits for each of its informers to sync. Subscriber is started
+	// after timeout even if some informers are still syncing. Subscribers wait for informers sync if zero.
+	InformerSyncTimeout time.Duration `envconfig:"KUBE_CLIENT_INFORMER_SYNC_TIMEOUT" yaml:"informerSyncTimeout"`
+	// SubscriberRestartBackoff is initial delay before subscriber which panicked is restarted. Delay doubles
+	// on consecutive panics.
+	SubscriberRestartBackoff time.Duration `envconfig:"KUBE_CLIENT_SUBSCRIBER_RESTART_BACKOFF" yaml:"subscriberRestartBackoff"`
+	// VersionRetryTimeout is max time spent retrying kubernetes version requests during startup. Minimal supported
+	// kubernetes version is assumed after timeout.
+	VersionRetryTimeout time.Duration `envconfig:"KUBE_CLIENT_VERSION_RETRY_TIMEOUT" yaml:"versionRetryTimeout"`
 }
 
 type Log struct {
@@ -129,6 +444,14 @@ type API struct {
 
 type Telemetry struct {
 	Interval time.Duration `envconfig:"TELEMETRY_INTERVAL" yaml:"interval"`
+	// InitialTimeout bounds initial telemetry call on startup. Agent starts with local config if it times out.
+	InitialTimeout time.Duration `envconfig:"TELEMETRY_INITIAL_TIMEOUT" yaml:"initialTimeout"`
+}
+
+type Tracing struct {
+	// OTLPEndpoint is OpenTelemetry collector gRPC endpoint. Tracing is disabled if empty.
+	OTLPEndpoint string `envconfig:"TRACING_OTLP_ENDPOINT" yaml:"otlpEndpoint"`
+	Insecure     bool   `envconfig:"TRACING_INSECURE" yaml:"insecure"`
 }
 
 func Load(configPath string) (Config, error) {
@@ -164,6 +487,12 @@ func Load(configPath string) (Config, error) {
 	if cfg.KubeClient.Burst == 0 {
 		cfg.KubeClient.Burst = 150
 	}
+	if cfg.KubeClient.SubscriberRestartBackoff == 0 {
+		cfg.KubeClient.SubscriberRestartBackoff = time.Second
+	}
+	if cfg.KubeClient.VersionRetryTimeout == 0 {
+		cfg.KubeClient.VersionRetryTimeout = time.Minute
+	}
 	if cfg.Log.Level == "" {
 		cfg.Log.Level = logrus.DebugLevel.String()
 	} else {
@@ -184,6 +513,9 @@ func Load(configPath string) (Config, error) {
 		if cfg.ImageScan.ScanTimeout == 0 {
 			cfg.ImageScan.ScanTimeout = 10 * time.Minute
 		}
+		if cfg.ImageScan.MaxIdleScanInterval != 0 && cfg.ImageScan.MaxIdleScanInterval < cfg.ImageScan.ScanInterval {
+			return Config{}, fmt.Errorf("image scan max idle scan interval %s is lower than scan interval %s", cfg.ImageScan.MaxIdleScanInterval, cfg.ImageScan.ScanInterval)
+		}
 		if cfg.ImageScan.CPULimit == "" {
 			cfg.ImageScan.CPULimit = "4"
 		}
@@ -199,6 +531,92 @@ func Load(configPath string) (Config, error) {
 		if cfg.ImageScan.APIUrl == "" {
 			cfg.ImageScan.APIUrl = "http://kvisor.castai-agent.svc.cluster.local.:6060"
 		}
+		switch cfg.ImageScan.NodeSelectionStrategy {
+		case "":
+			cfg.ImageScan.NodeSelectionStrategy = NodeSelectionLeastLoaded
+		case NodeSelectionLeastLoaded, NodeSelectionMostLoaded, NodeSelectionRoundRobin:
+		default:
+			return Config{}, fmt.Errorf("invalid image scan node selection strategy %q", cfg.ImageScan.NodeSelectionStrategy)
+		}
+		if cfg.ImageScan.Sampling.Percent < 0 || cfg.ImageScan.Sampling.Percent > 100 {
+			return Config{}, fmt.Errorf("invalid image scan sampling percent %d", cfg.ImageScan.Sampling.Percent)
+		}
+		if cfg.ImageScan.SyncStateBatchSize == 0 {
+			cfg.ImageScan.SyncStateBatchSize = 1000
+		}
+		if cfg.ImageScan.SyncStateConcurrency == 0 {
+			cfg.ImageScan.SyncStateConcurrency = 1
+		}
+		if cfg.ImageScan.SyncStateInterval == 0 {
+			cfg.ImageScan.SyncStateInterval = 10 * time.Minute
+		}
+		if cfg.ImageScan.DeltaWorkers == 0 {
+			cfg.ImageScan.DeltaWorkers = 1
+		}
+		if cfg.ImageScan.DeltaWorkers < 0 {
+			return Config{}, fmt.Errorf("invalid image scan delta workers %d", cfg.ImageScan.DeltaWorkers)
+		}
+		if cfg.ImageScan.DefaultPlatform != "" {
+			platformOS, platformArch, found := strings.Cut(cfg.ImageScan.DefaultPlatform, "/")
+			if !found || platformOS == "" || platformArch == "" {
+				return Config{}, fmt.Errorf("invalid image scan default platform %q, expected os/arch", cfg.ImageScan.DefaultPlatform)
+			}
+		}
+		if addr := cfg.ImageScan.TrivyServerAddr; addr != "" {
+			if u, err := url.Parse(addr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return Config{}, fmt.Errorf("invalid image scan trivy server address %q", addr)
+			}
+		}
+		if cfg.ImageScan.WorkloadPullSecrets && len(cfg.ImageScan.WorkloadPullSecretsNamespaces) == 0 {
+			return Config{}, errors.New("image scan workload pull secrets require allowed namespaces")
+		}
+		if cfg.ImageScan.BlobsCacheMaxSizeBytes == 0 {
+			cfg.ImageScan.BlobsCacheMaxSizeBytes = 32 << 20
+		}
+		if cfg.ImageScan.BlobsCacheTTL == 0 {
+			cfg.ImageScan.BlobsCacheTTL = 24 * time.Hour
+		}
+		if cfg.ImageScan.Runtime.ContainerdContentDir == "" {
+			cfg.ImageScan.Runtime.ContainerdContentDir = "/var/lib/containerd/io.containerd.content.v1.content"
+		}
+		if cfg.ImageScan.Runtime.ContainerdSocketPath == "" {
+			cfg.ImageScan.Runtime.ContainerdSocketPath = "/run/containerd/containerd.sock"
+		}
+		if cfg.ImageScan.Runtime.DockerSocketPath == "" {
+			cfg.ImageScan.Runtime.DockerSocketPath = "/var/run/docker.sock"
+		}
+		if cfg.ImageScan.Admission.Enabled {
+			if cfg.ImageScan.Admission.WebhookName == "" {
+				cfg.ImageScan.Admission.WebhookName = "kvisor-image-scan.cast.ai"
+			}
+			if cfg.ImageScan.Admission.Timeout == 0 {
+				cfg.ImageScan.Admission.Timeout = 10 * time.Second
+			}
+			switch cfg.ImageScan.Admission.FailurePolicy {
+			case "":
+				cfg.ImageScan.Admission.FailurePolicy = AdmissionPolicyWarn
+			case AdmissionPolicyWarn, AdmissionPolicyDeny:
+			default:
+				return Config{}, fmt.Errorf("invalid image scan admission failure policy %q", cfg.ImageScan.Admission.FailurePolicy)
+			}
+			cfg.ImageScan.Admission.Severity = strings.ToUpper(cfg.ImageScan.Admission.Severity)
+			if cfg.ImageScan.Admission.Severity != "" && !lo.Contains(admissionSeverities, cfg.ImageScan.Admission.Severity) {
+				return Config{}, fmt.Errorf("invalid image scan admission severity %q", cfg.ImageScan.Admission.Severity)
+			}
+			switch cfg.ImageScan.Admission.SeverityPolicy {
+			case "":
+				cfg.ImageScan.Admission.SeverityPolicy = AdmissionPolicyWarn
+			case AdmissionPolicyWarn, AdmissionPolicyDeny:
+			default:
+				return Config{}, fmt.Errorf("invalid image scan admission severity policy %q", cfg.ImageScan.Admission.SeverityPolicy)
+			}
+		}
+		if cfg.ImageScan.HostFSDisableCooldown < 0 {
+			return Config{}, errors.New("image scan hostfs disable cooldown must not be negative")
+		}
+		if cfg.ImageScan.HostFSDisableCooldown == 0 {
+			cfg.ImageScan.HostFSDisableCooldown = time.Hour
+		}
 		if cfg.ImageScan.InitDelay == 0 {
 			cfg.ImageScan.InitDelay = 60 * time.Second
 		}
@@ -211,6 +629,48 @@ func Load(configPath string) (Config, error) {
 		if cfg.CloudScan.ScanInterval == 0 {
 			cfg.CloudScan.ScanInterval = 1 * time.Hour
 		}
+		if cfg.CloudScan.Throttle.MaxRetries == 0 {
+			cfg.CloudScan.Throttle.MaxRetries = 5
+		}
+		if cfg.CloudScan.Throttle.MinBackoff == 0 {
+			cfg.CloudScan.Throttle.MinBackoff = 1 * time.Second
+		}
+		if cfg.CloudScan.Throttle.MaxBackoff == 0 {
+			cfg.CloudScan.Throttle.MaxBackoff = 1 * time.Minute
+		}
+		if cfg.CloudScan.GKE != nil {
+			if cfg.CloudScan.GKE.FullRefreshScans == 0 {
+				cfg.CloudScan.GKE.FullRefreshScans = 24
+			}
+			if cfg.CloudScan.GKE.FullRefreshScans < 0 {
+				return Config{}, fmt.Errorf("invalid gke cloud scan full refresh scans %d", cfg.CloudScan.GKE.FullRefreshScans)
+			}
+		}
+	}
+	if cfg.RBACAnalyzer.Enabled {
+		if cfg.RBACAnalyzer.ScanInterval == 0 {
+			cfg.RBACAnalyzer.ScanInterval = 30 * time.Second
+		}
+	}
+	if cfg.DeprecatedAPI.Enabled {
+		if cfg.DeprecatedAPI.ScanInterval == 0 {
+			cfg.DeprecatedAPI.ScanInterval = 30 * time.Second
+		}
+	}
+	if cfg.NetworkPolicy.Enabled {
+		if cfg.NetworkPolicy.ScanInterval == 0 {
+			cfg.NetworkPolicy.ScanInterval = 30 * time.Second
+		}
+	}
+	if cfg.NodeImages.Enabled {
+		if cfg.NodeImages.SendInterval == 0 {
+			cfg.NodeImages.SendInterval = 15 * time.Minute
+		}
+	}
+	if cfg.NodeInventory.Enabled {
+		if cfg.NodeInventory.SendInterval == 0 {
+			cfg.NodeInventory.SendInterval = 15 * time.Minute
+		}
 	}
 	if cfg.KubeBench.Enabled {
 		if cfg.KubeBench.ScanInterval == 0 {
@@ -219,11 +679,23 @@ func Load(configPath string) (Config, error) {
 		if cfg.KubeBench.Image.PullPolicy == "" {
 			cfg.KubeBench.Image.PullPolicy = "IfNotPresent"
 		}
+		if cfg.KubeBench.MaxConcurrentJobs == 0 {
+			cfg.KubeBench.MaxConcurrentJobs = 1
+		}
+		if cfg.KubeBench.MaxConcurrentReports == 0 {
+			cfg.KubeBench.MaxConcurrentReports = 3
+		}
 	}
 	if cfg.Linter.Enabled {
 		if cfg.Linter.ScanInterval == 0 {
 			cfg.Linter.ScanInterval = 30 * time.Second
 		}
+		if cfg.Linter.ExcludedNamespaces == nil {
+			cfg.Linter.ExcludedNamespaces = DefaultLinterExcludedNamespaces
+		}
+		if cfg.Linter.MaxPayloadSize == 0 {
+			cfg.Linter.MaxPayloadSize = 5 << 20
+		}
 	}
 
 	if cfg.HTTPPort == 0 {
@@ -235,12 +707,29 @@ func Load(configPath string) (Config, error) {
 	if cfg.DeltaSyncInterval == 0 {
 		cfg.DeltaSyncInterval = 15 * time.Second
 	}
+	if cfg.DeltaMaxObjectSize == 0 {
+		cfg.DeltaMaxObjectSize = 1 << 20
+	}
+	if cfg.LeaderLossGracePeriod == 0 {
+		cfg.LeaderLossGracePeriod = 10 * time.Second
+	}
 	if cfg.StatusPort == 0 {
 		cfg.StatusPort = 7071
 	}
 	if cfg.Telemetry.Interval == 0 {
 		cfg.Telemetry.Interval = 1 * time.Minute
 	}
+	if cfg.Telemetry.InitialTimeout == 0 {
+		cfg.Telemetry.InitialTimeout = 10 * time.Second
+	}
+	if cfg.DeadLetter.Dir != "" {
+		if cfg.DeadLetter.MaxSizeBytes == 0 {
+			cfg.DeadLetter.MaxSizeBytes = 100 << 20
+		}
+		if cfg.DeadLetter.ReplayInterval == 0 {
+			cfg.DeadLetter.ReplayInterval = 5 * time.Minute
+		}
+	}
 
 	return cfg, nil
 }
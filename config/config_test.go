@@ -44,6 +44,86 @@ func TestConfig(t *testing.T) {
 		r.NoError(err)
 		r.Equal(expectedCfg, actualCfg)
 	})
+
+	t.Run("invalid image scan default platform", func(t *testing.T) {
+		r := require.New(t)
+		cfg := newTestConfig()
+		cfg.ImageScan.DefaultPlatform = "arm64"
+
+		cfgBytes, err := yaml.Marshal(cfg)
+		r.NoError(err)
+		cfgFilePath := filepath.Join(t.TempDir(), "config.yaml")
+		r.NoError(os.WriteFile(cfgFilePath, cfgBytes, 0600))
+
+		_, err = Load(cfgFilePath)
+		r.ErrorContains(err, "invalid image scan default platform")
+	})
+
+	t.Run("vulnerability reports without trivy server", func(t *testing.T) {
+		r := require.New(t)
+		cfg := newTestConfig()
+		cfg.ImageScan.TrivyServerAddr = ""
+		cfg.ImageScan.VulnerabilityReports = true
+
+		cfgBytes, err := yaml.Marshal(cfg)
+		r.NoError(err)
+		cfgFilePath := filepath.Join(t.TempDir(), "config.yaml")
+		r.NoError(os.WriteFile(cfgFilePath, cfgBytes, 0600))
+
+		// Scan jobs match vulnerabilities with trivy database.
+		loaded, err := Load(cfgFilePath)
+		r.NoError(err)
+		r.True(loaded.ImageScan.VulnerabilityReports)
+	})
+
+	t.Run("workload pull secrets without allowed namespaces", func(t *testing.T) {
+		r := require.New(t)
+		cfg := newTestConfig()
+		cfg.ImageScan.WorkloadPullSecrets = true
+		cfg.ImageScan.WorkloadPullSecretsNamespaces = nil
+
+		cfgBytes, err := yaml.Marshal(cfg)
+		r.NoError(err)
+		cfgFilePath := filepath.Join(t.TempDir(), "config.yaml")
+		r.NoError(os.WriteFile(cfgFilePath, cfgBytes, 0600))
+
+		_, err = Load(cfgFilePath)
+		r.ErrorContains(err, "image scan workload pull secrets require allowed namespaces")
+	})
+
+	t.Run("negative hostfs disable cooldown", func(t *testing.T) {
+		r := require.New(t)
+		cfg := newTestConfig()
+		cfg.ImageScan.HostFSDisableCooldown = -time.Minute
+
+		cfgBytes, err := yaml.Marshal(cfg)
+		r.NoError(err)
+		cfgFilePath := filepath.Join(t.TempDir(), "config.yaml")
+		r.NoError(os.WriteFile(cfgFilePath, cfgBytes, 0600))
+
+		_, err = Load(cfgFilePath)
+		r.ErrorContains(err, "image scan hostfs disable cooldown must not be negative")
+	})
+
+	t.Run("initial scan delay jitter", func(t *testing.T) {
+		r := require.New(t)
+		cfg := newTestConfig()
+		cfg.InitialScanJitter = time.Minute
+
+		delays := map[time.Duration]struct{}{}
+		for _, podIP := range []string{"10.10.1.1", "10.10.1.2", "10.10.1.3", "10.10.1.4"} {
+			cfg.PodIP = podIP
+			delay := cfg.InitialScanDelayJitter()
+			r.GreaterOrEqual(delay, time.Duration(0))
+			r.Less(delay, cfg.InitialScanJitter)
+			r.Equal(delay, cfg.InitialScanDelayJitter())
+			delays[delay] = struct{}{}
+		}
+		r.Len(delays, 4)
+
+		cfg.InitialScanJitter = 0
+		r.Zero(cfg.InitialScanDelayJitter())
+	})
 }
 
 func newTestConfig() Config {
@@ -54,40 +134,107 @@ func newTestConfig() Config {
 	return Config{
 		PodIP: "10.10.1.123",
 		KubeClient: KubeClient{
-			QPS:            1,
-			Burst:          5,
-			KubeConfigPath: kubeconfig,
+			QPS:                      1,
+			Burst:                    5,
+			KubeConfigPath:           kubeconfig,
+			InformerSyncTimeout:      5 * time.Minute,
+			SubscriberRestartBackoff: 2 * time.Second,
+			VersionRetryTimeout:      30 * time.Second,
 		},
-		Log:               Log{Level: "info"},
-		API:               API{URL: "https://api-test.cast.ai", Key: "key", ClusterID: "c1"},
-		HTTPPort:          6090,
-		StatusPort:        7071,
-		Provider:          "gke",
-		DeltaSyncInterval: 15 * time.Second,
+		Log:                   Log{Level: "info"},
+		API:                   API{URL: "https://api-test.cast.ai", Key: "key", ClusterID: "c1"},
+		HTTPPort:              6090,
+		StatusPort:            7071,
+		Provider:              "gke",
+		DeltaSyncInterval:     15 * time.Second,
+		DeltaMaxObjectSize:    512 << 10,
+		LeaderLossGracePeriod: 10 * time.Second,
+		InitialScanJitter:     30 * time.Second,
+		MaxConcurrentJobs:     5,
+		DeltaMinSendInterval:  5 * time.Second,
 		PolicyEnforcement: PolicyEnforcement{
 			Bundles: Bundles{},
 		},
 		ImageScan: ImageScan{
-			Enabled:            true,
-			ScanInterval:       20 * time.Second,
-			ScanTimeout:        5 * time.Minute,
-			MaxConcurrentScans: 3,
-			InitDelay:          60 * time.Second,
+			Enabled:                  true,
+			ScanInterval:             20 * time.Second,
+			ScanTimeout:              5 * time.Minute,
+			MaxConcurrentScans:       3,
+			MaxConcurrentRemoteScans: 10,
+			InitDelay:                60 * time.Second,
 			Image: ImageScanImage{
 				PullPolicy: "IfNotPresent",
 			},
-			Mode:               "mode",
-			DockerOptionsPath:  "/etc/config/docker-config.json",
-			CPURequest:         "100m",
-			CPULimit:           "2",
-			MemoryRequest:      "100Mi",
-			MemoryLimit:        "2Gi",
-			APIUrl:             "http://kvisor.castai-agent.svc.cluster.local.:6060",
-			ServiceAccountName: "castai-kvisor-image-scan",
+			Mode:                  "mode",
+			DockerOptionsPath:     "/etc/config/docker-config.json",
+			CPURequest:            "100m",
+			CPULimit:              "2",
+			MemoryRequest:         "100Mi",
+			MemoryLimit:           "2Gi",
+			APIUrl:                "http://kvisor.castai-agent.svc.cluster.local.:6060",
+			ServiceAccountName:    "castai-kvisor-image-scan",
+			StatusCoalesceWindow:  30 * time.Second,
+			ImageRetention:        24 * time.Hour,
+			MaxScanAge:            7 * 24 * time.Hour,
+			RescanInterval:        72 * time.Hour,
+			OwnerLabels:           []string{"app.kubernetes.io/name", "team"},
+			OwnerAnnotations:      []string{"owner"},
+			NodeSelectionStrategy: NodeSelectionMostLoaded,
+			RegistryModes:         map[string]string{"gcr.io": "hostfs"},
+			NodeSelector:          map[string]string{"scan.cast.ai/allowed": "true"},
+			NodePool: ImageScanNodePool{
+				NodeSelector: map[string]string{"scan.cast.ai/pool": "scanners"},
+				TaintKey:     "scan.cast.ai/pool",
+			},
+			Sampling: ImageScanSampling{
+				Percent:   10,
+				MaxImages: 1000,
+			},
+			HostFSDisableCooldown: 30 * time.Minute,
+			SyncStateBatchSize:    500,
+			SyncStateConcurrency:  2,
+			SyncStateInterval:     30 * time.Minute,
+			AlwaysScanImages:      []string{"ghcr.io/team/base:1.0"},
+			SkipCrashLoopPods:     true,
+			Admission: ImageScanAdmission{
+				Enabled:        true,
+				WebhookName:    "kvisor-image-scan.cast.ai",
+				Timeout:        5 * time.Second,
+				FailurePolicy:  AdmissionPolicyDeny,
+				Severity:       "CRITICAL",
+				SeverityPolicy: AdmissionPolicyDeny,
+			},
+			TrivyDB: ImageScanTrivyDB{
+				Repository: "registry.local/aquasecurity/trivy-db",
+				ClaimName:  "trivy-db",
+			},
+			TrivyServerAddr:               "http://trivy.trivy-system:4954",
+			TrivyServerToken:              "trivy-token",
+			MaxIdleScanInterval:           5 * time.Minute,
+			ExcludedImages:                []string{"registry.local/infra/*"},
+			ScanInfraImages:               true,
+			PerRegistryMaxConcurrentScans: 2,
+			DeltaWorkers:                  4,
+			ExcludedNamespaces:            []string{"vendor-*"},
+			IncludedNamespaces:            []string{"team-*"},
+			Runtime: ImageScanRuntime{
+				ContainerdContentDir: "/var/lib/rancher/k3s/agent/containerd/io.containerd.content.v1.content",
+				ContainerdSocketPath: "/run/k3s/containerd/containerd.sock",
+				DockerSocketPath:     "/var/run/docker.sock",
+			},
+			WorkloadPullSecrets:           true,
+			WorkloadPullSecretsNamespaces: []string{"team-a", "team-b"},
+			ScanWorkloadTemplates:         true,
+			BlobsCacheMaxSizeBytes:        64 << 20,
+			BlobsCacheTTL:                 12 * time.Hour,
+			DefaultPlatform:               "linux/arm64",
+			VulnerabilityReports:          true,
 		},
 		Linter: Linter{
-			Enabled:      true,
-			ScanInterval: 15 * time.Second,
+			Enabled:            true,
+			ScanInterval:       15 * time.Second,
+			ExcludedNamespaces: []string{"kube-system"},
+			MaxPayloadSize:     1 << 20,
 		},
 		KubeBench: KubeBench{
 			Enabled:      true,
@@ -95,20 +242,65 @@ func newTestConfig() Config {
 			Image: KubeBenchImage{
 				PullPolicy: "IfNotPresent",
 			},
+			MaxConcurrentJobs:    1,
+			MaxConcurrentReports: 3,
 		},
 		CloudScan: CloudScan{
 			Enabled:      true,
 			ScanInterval: 1 * time.Hour,
 			GKE: &CloudScanGKE{
-				ClusterName:     "",
-				CredentialsFile: "",
+				ClusterName:      "",
+				CredentialsFile:  "",
+				FullRefreshScans: 6,
 			},
 			EKS: &CloudScanEKS{
 				ClusterName: "",
 			},
+			AKS: &CloudScanAKS{
+				SubscriptionID: "sub",
+				ResourceGroup:  "rg",
+				ClusterName:    "aks",
+			},
+			IncludeChecks: []string{"5.1.1"},
+			ExcludeChecks: []string{"5.10.5"},
+			InitDelay:     5 * time.Second,
+			Throttle: CloudScanThrottle{
+				MaxRetries: 3,
+				MinBackoff: 2 * time.Second,
+				MaxBackoff: 30 * time.Second,
+			},
 		},
 		Telemetry: Telemetry{
-			Interval: 1 * time.Minute,
+			Interval:       1 * time.Minute,
+			InitialTimeout: 5 * time.Second,
+		},
+		NodeImages: NodeImages{
+			Enabled:      true,
+			SendInterval: 15 * time.Minute,
+		},
+		NodeInventory: NodeInventory{
+			Enabled:      true,
+			SendInterval: time.Hour,
+		},
+		RBACAnalyzer: RBACAnalyzer{
+			Enabled:      true,
+			ScanInterval: 30 * time.Second,
+		},
+		DeprecatedAPI: DeprecatedAPI{
+			Enabled:      true,
+			ScanInterval: time.Minute,
+		},
+		NetworkPolicy: NetworkPolicy{
+			Enabled:      true,
+			ScanInterval: 2 * time.Minute,
+		},
+		Events: Events{
+			Enabled: true,
+		},
+		DeadLetter: DeadLetter{
+			Dir:            "/var/lib/kvisor/dead-letter",
+			MaxSizeBytes:   10 << 20,
+			ReplayInterval: time.Minute,
 		},
 	}
 }
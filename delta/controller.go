@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -21,6 +22,7 @@ import (
 	"github.com/castai/kvisor/castai"
 	"github.com/castai/kvisor/kube"
 	"github.com/castai/kvisor/metrics"
+	"github.com/castai/kvisor/tracing"
 )
 
 var scheme = runtime.NewScheme()
@@ -43,6 +45,10 @@ type castaiClient interface {
 
 type Config struct {
 	DeltaSyncInterval time.Duration
+	// MaxObjectSize is max approximate size of single object in delta in bytes. Larger objects are sent without payload.
+	MaxObjectSize int
+	// MinSendInterval is min time between sent deltas regardless of send triggers. Disabled if zero.
+	MinSendInterval time.Duration
 }
 
 func NewController(
@@ -62,7 +68,7 @@ func NewController(
 		k8sVersionMinor: k8sVersionMinor,
 		log:             log.WithField("component", "delta"),
 		client:          client,
-		delta:           newDelta(log, podOwnerGetter, logLevel, stateProvider),
+		delta:           newDelta(log, podOwnerGetter, logLevel, stateProvider, cfg.MaxObjectSize),
 		initialDelay:    60 * time.Second,
 	}
 }
@@ -78,6 +84,9 @@ type Controller struct {
 	mu              sync.RWMutex
 	initialized     bool
 	initialDelay    time.Duration
+
+	// lastSentAt is time of the last delta send attempt. Used to enforce MinSendInterval.
+	lastSentAt time.Time
 }
 
 func (s *Controller) RequiredInformers() []reflect.Type {
@@ -119,13 +128,34 @@ func (s *Controller) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-time.After(s.cfg.DeltaSyncInterval):
-			if err := s.sendDelta(ctx); err != nil && !errors.Is(err, context.Canceled) {
-				s.log.Errorf("sending delta: %v", err)
-			}
+		}
+
+		if err := s.waitMinSendInterval(ctx); err != nil {
+			return err
+		}
+		if err := s.sendDelta(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			s.log.Errorf("sending delta: %v", err)
 		}
 	}
 }
 
+// waitMinSendInterval delays send until MinSendInterval passed since the last send to protect backend during churn.
+func (s *Controller) waitMinSendInterval(ctx context.Context) error {
+	if s.cfg.MinSendInterval == 0 || s.lastSentAt.IsZero() {
+		return nil
+	}
+	wait := time.Until(s.lastSentAt.Add(s.cfg.MinSendInterval))
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
 func (s *Controller) OnAdd(obj kube.Object) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -162,12 +192,18 @@ func (s *Controller) sendDelta(ctx context.Context) (rerr error) {
 		return nil
 	}
 
+	ctx, span := tracing.Start(ctx, "delta.sendDelta", attribute.Int("items", len(deltaReq.Items)))
+	defer func() { tracing.End(span, rerr) }()
+
 	s.log.Debugf("sending delta with items[%d]", len(deltaReq.Items))
+	s.lastSentAt = time.Now()
 	if err := s.client.SendDeltaReport(ctx, deltaReq); err != nil {
 		return err
 	}
 	metrics.IncDeltasSentTotal()
 	s.log.Infof("delta with items[%d] sent", len(deltaReq.Items))
+	s.mu.Lock()
 	s.delta.clear()
+	s.mu.Unlock()
 	return nil
 }
@@ -2,6 +2,7 @@ package delta
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -135,6 +136,37 @@ func TestSubscriber(t *testing.T) {
 		assertDelta(t, client.deltas[0], castai.EventDelete, true)
 	})
 
+	t.Run("send oversized objects without payload", func(t *testing.T) {
+		r := require.New(t)
+		sub := newTestController(log)
+		sub.delta.maxObjectSize = 1000
+
+		large := pod1.DeepCopy()
+		large.UID = "large"
+		sub.OnAdd(pod1)
+		sub.OnAdd(large)
+
+		// Object grows past the limit, its update replaces previous state without payload.
+		large = large.DeepCopy()
+		large.Labels = map[string]string{"payload": strings.Repeat("x", 2000)}
+		sub.OnUpdate(large)
+		items := sub.delta.toCASTAIRequest().Items
+		r.Len(items, 2)
+		updated, _ := lo.Find(items, func(item castai.DeltaItem) bool { return item.ObjectUID == "large" })
+		r.Equal(castai.EventUpdate, updated.Event)
+		r.Equal(large.Name, updated.ObjectName)
+		r.Empty(updated.ObjectLabels)
+		r.Empty(updated.ObjectStatus)
+
+		sub.OnDelete(large)
+		items = sub.delta.toCASTAIRequest().Items
+		r.Len(items, 2)
+		deleted, _ := lo.Find(items, func(item castai.DeltaItem) bool { return item.ObjectUID == "large" })
+		r.Equal(castai.EventDelete, deleted.Event)
+		r.Empty(deleted.ObjectLabels)
+		r.Empty(deleted.ObjectSpec)
+	})
+
 	t.Run("second event does not set full snapshot flag", func(t *testing.T) {
 		client := &mockCastaiClient{}
 		sub := newTestController(log)
@@ -154,6 +186,33 @@ func TestSubscriber(t *testing.T) {
 		r.Len(client.deltas, 2)
 		assertDelta(t, client.deltas[1], castai.EventAdd, false)
 	})
+	t.Run("limit delta send frequency below sync interval", func(t *testing.T) {
+		r := require.New(t)
+		client := &mockCastaiClient{}
+		sub := newTestController(log)
+		sub.initialDelay = 1 * time.Millisecond
+		sub.cfg.DeltaSyncInterval = 1 * time.Millisecond
+		sub.cfg.MinSendInterval = 40 * time.Millisecond
+		sub.client = client
+
+		ctx, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+		defer cancel()
+		go func() {
+			for ctx.Err() == nil {
+				sub.OnUpdate(pod1)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+		err := sub.Run(ctx)
+		r.ErrorIs(err, context.DeadlineExceeded)
+
+		r.GreaterOrEqual(len(client.sentAt), 2)
+		r.LessOrEqual(len(client.sentAt), 4)
+		for i := 1; i < len(client.sentAt); i++ {
+			r.GreaterOrEqual(client.sentAt[i].Sub(client.sentAt[i-1]), 40*time.Millisecond)
+		}
+	})
+
 	t.Run("send update ingress event", func(t *testing.T) {
 		ingress1 := &networkingv1.Ingress{
 			TypeMeta: metav1.TypeMeta{Kind: "Ingress", APIVersion: "v1"},
@@ -218,10 +277,12 @@ func (m *mockPodOwnerGetter) GetPodOwnerID(pod *corev1.Pod) string {
 
 type mockCastaiClient struct {
 	deltas []*castai.Delta
+	sentAt []time.Time
 }
 
 func (m *mockCastaiClient) SendDeltaReport(ctx context.Context, report *castai.Delta) error {
 	m.deltas = append(m.deltas, report)
+	m.sentAt = append(m.sentAt, time.Now())
 	return nil
 }
 
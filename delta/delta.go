@@ -13,6 +13,7 @@ import (
 
 	"github.com/castai/kvisor/castai"
 	"github.com/castai/kvisor/kube"
+	"github.com/castai/kvisor/metrics"
 )
 
 type podOwnerGetter interface {
@@ -21,7 +22,7 @@ type podOwnerGetter interface {
 
 // newDelta initializes the delta struct which is used to collect cluster deltas, debounce them and map to CAST AI
 // requests.
-func newDelta(log logrus.FieldLogger, podOwnerGetter podOwnerGetter, logLevel logrus.Level, provider SnapshotProvider) *delta {
+func newDelta(log logrus.FieldLogger, podOwnerGetter podOwnerGetter, logLevel logrus.Level, provider SnapshotProvider, maxObjectSize int) *delta {
 	return &delta{
 		log:            log,
 		logLevel:       logLevel,
@@ -29,6 +30,7 @@ func newDelta(log logrus.FieldLogger, podOwnerGetter podOwnerGetter, logLevel lo
 		cache:          map[string]castai.DeltaItem{},
 		skippers:       []skipper{},
 		podOwnerGetter: podOwnerGetter,
+		maxObjectSize:  maxObjectSize,
 	}
 }
 
@@ -51,6 +53,8 @@ type delta struct {
 	cache          map[string]castai.DeltaItem
 	skippers       []skipper
 	podOwnerGetter podOwnerGetter
+	// maxObjectSize limits approximate size of single delta item in bytes. Disabled if zero.
+	maxObjectSize int
 }
 
 // add will add an item to the delta cache. It will debounce the objects.
@@ -96,10 +100,39 @@ func (d *delta) add(event kube.Event, obj object) {
 		deltaItem.ObjectSpec = spec
 	}
 
+	if size := deltaItemSize(deltaItem); d.maxObjectSize > 0 && size > d.maxObjectSize {
+		metrics.IncDeltaOversizedObjects(gvr.Kind)
+		if event != kube.EventDelete {
+			d.log.Warnf("sending oversized object %s %s/%s without payload, size=%d, max_size=%d", gvr.Kind, obj.GetNamespace(), obj.GetName(), size, d.maxObjectSize)
+		}
+		// Oversized objects are sent without payload, so remote never keeps stale state of objects which grew
+		// past the limit or were removed.
+		deltaItem.ObjectSpec = nil
+		deltaItem.ObjectStatus = nil
+		deltaItem.ObjectLabels = nil
+		deltaItem.ObjectAnnotations = nil
+		deltaItem.ObjectContainers = nil
+	}
+
 	d.cache[key] = deltaItem
 	d.snapshot.append(deltaItem)
 }
 
+// deltaItemSize returns approximate encoded size of delta item payload.
+func deltaItemSize(item castai.DeltaItem) int {
+	size := len(item.ObjectSpec) + len(item.ObjectStatus)
+	for k, v := range item.ObjectLabels {
+		size += len(k) + len(v)
+	}
+	for k, v := range item.ObjectAnnotations {
+		size += len(k) + len(v)
+	}
+	for _, c := range item.ObjectContainers {
+		size += len(c.Name) + len(c.ImageName)
+	}
+	return size
+}
+
 func getAnnotations(obj object) map[string]string {
 	switch v := obj.(type) {
 	case *corev1.Service, *networkingv1.Ingress:
@@ -0,0 +1,252 @@
+package imagescan
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	json "github.com/json-iterator/go"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+)
+
+const (
+	// admissionSeverityTimeout limits how long severity of admission scan is awaited from remote state.
+	admissionSeverityTimeout      = time.Minute
+	admissionSeverityPollInterval = 2 * time.Second
+)
+
+func NewAdmissionHandler(log logrus.FieldLogger, cfg config.ImageScanAdmission, ctrl *Controller) *AdmissionHandler {
+	scans, _ := lru.New(10000)
+	return &AdmissionHandler{
+		log:   log.WithField("component", "imagescan_admission"),
+		cfg:   cfg,
+		ctrl:  ctrl,
+		scans: scans,
+	}
+}
+
+// AdmissionHandler scans not yet scanned images of new pods before pods are admitted. Images are scanned remotely
+// since they are not pulled to any node yet. If scans don't finish within time budget, pod is admitted and scans
+// continue asynchronously. Pods with images which severity violates configured policy are denied or admitted with warning.
+type AdmissionHandler struct {
+	log  logrus.FieldLogger
+	cfg  config.ImageScanAdmission
+	ctrl *Controller
+
+	mu sync.Mutex
+	// scans are running and succeeded admission scans by image scan name. Failed scans are removed,
+	// so they are retried on the next admission.
+	scans *lru.Cache
+}
+
+type admissionScan struct {
+	done chan struct{}
+	// severity is the highest vulnerability severity of scanned image. Empty if it's not known.
+	severity string
+	err      error
+}
+
+func (h *AdmissionHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Kind.Kind != "Pod" {
+		return admission.Allowed(fmt.Sprintf("kind %q not scanned", req.Kind.Kind))
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	scans := map[string]*admissionScan{}
+	severities := map[string]string{}
+	for _, cont := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		ref := parseImageReference(cont.Image)
+		if _, found := severities[ref.name]; found {
+			continue
+		}
+		if _, found := scans[ref.name]; found {
+			continue
+		}
+		if scanned, severity := h.ctrl.imageScanState(ref.name); scanned {
+			severities[ref.name] = severity
+			continue
+		}
+		scans[ref.name] = h.startScan(ref)
+	}
+
+	names := lo.Keys(scans)
+	sort.Strings(names)
+	timeout := time.NewTimer(h.cfg.Timeout)
+	defer timeout.Stop()
+
+	var failed []string
+	for i, name := range names {
+		select {
+		case <-scans[name].done:
+		case <-ctx.Done():
+			return allowAsync(names[i:])
+		case <-timeout.C:
+			return allowAsync(names[i:])
+		}
+		if err := scans[name].err; err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		severities[name] = scans[name].severity
+	}
+
+	var denied, warnings []string
+	addViolation := func(policy, msg string) {
+		if policy == config.AdmissionPolicyDeny {
+			denied = append(denied, msg)
+		} else {
+			warnings = append(warnings, msg)
+		}
+	}
+	if len(failed) > 0 {
+		addViolation(h.cfg.FailurePolicy, fmt.Sprintf("image scan failed: %s", strings.Join(failed, "; ")))
+	}
+	if violating := h.violatingImages(severities); len(violating) > 0 {
+		addViolation(h.cfg.SeverityPolicy, fmt.Sprintf("images have %s or higher severity vulnerabilities: %s", h.cfg.Severity, strings.Join(violating, ", ")))
+	}
+
+	if len(denied) > 0 {
+		return admission.Denied(strings.Join(denied, "; ")).WithWarnings(warnings...)
+	}
+	if len(warnings) > 0 {
+		return admission.Allowed("image scan policy violated").WithWarnings(warnings...)
+	}
+	return admission.Allowed("all images are scanned")
+}
+
+// violatingImages returns names of images which severity is at least configured policy severity.
+func (h *AdmissionHandler) violatingImages(severities map[string]string) []string {
+	if h.cfg.Severity == "" {
+		return nil
+	}
+	var res []string
+	for name, severity := range severities {
+		if severity != "" && castai.MaxSeverity(severity, h.cfg.Severity) == severity {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func allowAsync(pending []string) admission.Response {
+	return admission.Allowed("image scan time budget exceeded").
+		WithWarnings(fmt.Sprintf("images are scanned asynchronously: %s", strings.Join(pending, ", ")))
+}
+
+// startScan starts image scan or returns already running or succeeded scan of the same image.
+func (h *AdmissionHandler) startScan(ref imageReference) *admissionScan {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if v, found := h.scans.Get(ref.scanName); found {
+		return v.(*admissionScan)
+	}
+
+	scan := &admissionScan{done: make(chan struct{})}
+	h.scans.Add(ref.scanName, scan)
+	go func() {
+		defer close(scan.done)
+
+		// Scan is not bound to admission request so it continues after time budget is exceeded.
+		scan.severity, scan.err = h.ctrl.scanAdmittedImage(ref, h.cfg.Severity != "")
+		if scan.err != nil {
+			h.log.Warnf("admission image scan failed, image=%s: %v", ref.scanName, scan.err)
+			h.mu.Lock()
+			h.scans.Remove(ref.scanName)
+			h.mu.Unlock()
+		}
+	}()
+	return scan
+}
+
+// imageScanState returns true if image with given name is already scanned together with the highest severity
+// of its scanned images.
+func (s *Controller) imageScanState(name string) (bool, string) {
+	s.delta.mu.Lock()
+	defer s.delta.mu.Unlock()
+
+	var scanned bool
+	var severity string
+	for _, img := range s.delta.images.listByName(name) {
+		if img.scanned {
+			scanned = true
+			severity = castai.MaxSeverity(severity, img.severity)
+		}
+	}
+	return scanned, severity
+}
+
+// scanAdmittedImage scans image of pod which is not admitted yet. Scans share concurrency limit with scheduled
+// scans. Scanned image is stored in delta, so it's not scanned again once pod is running. If withSeverity is set,
+// severity of scanned image is awaited from remote state.
+func (s *Controller) scanAdmittedImage(ref imageReference, withSeverity bool) (string, error) {
+	img := newImage()
+	img.key = ref.scanName
+	img.id = ref.scanName
+	img.name = ref.name
+	img.scanName = ref.scanName
+	img.architecture = s.delta.defaultPlatform.architecture
+	img.os = s.delta.defaultPlatform.os
+	img.admissionScan = true
+
+	if err := s.scanSem.Acquire(s.ctx, 1); err != nil {
+		return "", err
+	}
+	err := s.scanImage(s.ctx, img)
+	s.scanSem.Release(1)
+	if err != nil {
+		return "", err
+	}
+
+	var severity string
+	if withSeverity {
+		severity = s.awaitImageSeverity(img)
+	}
+	s.delta.mu.Lock()
+	s.delta.setAdmissionImageScanned(ref, severity, s.timeGetter())
+	s.delta.mu.Unlock()
+	return severity, nil
+}
+
+// awaitImageSeverity polls remote state until severity of scanned image is known. Empty severity is returned
+// if remote doesn't process scan results in time.
+func (s *Controller) awaitImageSeverity(img *image) string {
+	ctx, cancel := context.WithTimeout(s.ctx, admissionSeverityTimeout)
+	defer cancel()
+	ticker := time.NewTicker(admissionSeverityPollInterval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := s.client.GetSyncState(ctx, &castai.SyncStateFilter{ImagesIds: []string{img.id}})
+		if err != nil {
+			s.log.Warnf("getting admission image sync state, image=%s: %v", img.scanName, err)
+		} else if resp.Images != nil {
+			for _, scanned := range resp.Images.ScannedImages {
+				if scanned.ID == img.id && scanned.Architecture == img.architecture && scanned.Severity != "" {
+					return scanned.Severity
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-ticker.C:
+		}
+	}
+}
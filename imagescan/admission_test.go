@@ -0,0 +1,233 @@
+package imagescan
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/castai/kvisor/castai"
+	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
+	"github.com/castai/kvisor/config"
+)
+
+func TestAdmissionHandler(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	newController := func(scanner imageScanner) *Controller {
+		ctrl := newTestController(log, config.ImageScan{
+			Mode:          string(imgcollectorconfig.ModeHostFS),
+			CPURequest:    "500m",
+			CPULimit:      "2",
+			MemoryRequest: "100Mi",
+			MemoryLimit:   "2Gi",
+		})
+		ctrl.imageScanner = scanner
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+		ctrl.delta.nodes["node1"] = &node{
+			name:           "node1",
+			allocatableMem: resMem.AsDec(),
+			allocatableCPU: resCpu.AsDec(),
+			pods:           map[types.UID]*pod{},
+			os:             defaultImageOs,
+			architecture:   defaultImageArch,
+		}
+		return ctrl
+	}
+
+	newRequest := func(t *testing.T, images ...string) admission.Request {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		}
+		for _, img := range images {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: img, Image: img})
+		}
+		raw, err := json.Marshal(pod)
+		require.NoError(t, err)
+		return admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:   metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Object: runtime.RawExtension{Raw: raw},
+			},
+		}
+	}
+
+	t.Run("scan new images before admitting pod", func(t *testing.T) {
+		r := require.New(t)
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		ctrl := newController(scanner)
+		ctrl.delta.images.set(&image{key: "scanned", name: "redis:7", scanned: true})
+		handler := NewAdmissionHandler(log, config.ImageScanAdmission{Timeout: time.Second}, ctrl)
+
+		resp := handler.Handle(context.Background(), newRequest(t, "nginx:1.25", "redis:7"))
+		r.True(resp.Allowed)
+		r.Empty(resp.Warnings)
+
+		imgs := scanner.getScanImageParams()
+		r.Len(imgs, 1)
+		r.Equal("nginx:1.25", imgs[0].ImageName)
+		r.Equal(string(imgcollectorconfig.ModeRemote), imgs[0].Mode)
+		r.Equal("node1", imgs[0].NodeName)
+		r.Zero(imgs[0].WaitDurationAfterCompletion)
+
+		// Succeeded scans are not repeated.
+		resp = handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.True(resp.Allowed)
+		r.Len(scanner.getScanImageParams(), 1)
+	})
+
+	t.Run("deny pod when image scan fails", func(t *testing.T) {
+		r := require.New(t)
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(errors.New("manifest unknown"))
+		ctrl := newController(scanner)
+		handler := NewAdmissionHandler(log, config.ImageScanAdmission{
+			Timeout:       time.Second,
+			FailurePolicy: config.AdmissionPolicyDeny,
+		}, ctrl)
+
+		resp := handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.False(resp.Allowed)
+		r.Contains(string(resp.Result.Reason), "nginx:1.25: manifest unknown")
+
+		// Failed scans are retried on next admission.
+		handler.cfg.FailurePolicy = config.AdmissionPolicyWarn
+		resp = handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.True(resp.Allowed)
+		r.Len(resp.Warnings, 1)
+		r.Len(scanner.getScanImageParams(), 2)
+	})
+
+	t.Run("deny pod with images violating severity policy", func(t *testing.T) {
+		r := require.New(t)
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		ctrl := newController(scanner)
+		ctrl.client = &mockCastaiClient{
+			syncState: &castai.SyncStateResponse{
+				Images: &castai.ImagesSyncState{
+					ScannedImages: []castai.ScannedImage{
+						{ID: "nginx:1.25", Architecture: defaultImageArch, Severity: castai.SeverityCritical},
+					},
+				},
+			},
+		}
+		ctrl.delta.images.set(&image{key: "scanned", name: "redis:7", scanned: true, severity: castai.SeverityHigh})
+		handler := NewAdmissionHandler(log, config.ImageScanAdmission{
+			Timeout:        time.Second,
+			Severity:       castai.SeverityCritical,
+			SeverityPolicy: config.AdmissionPolicyDeny,
+		}, ctrl)
+
+		resp := handler.Handle(context.Background(), newRequest(t, "nginx:1.25", "redis:7"))
+		r.False(resp.Allowed)
+		r.Equal("images have CRITICAL or higher severity vulnerabilities: nginx:1.25", string(resp.Result.Reason))
+
+		// Scanned image is stored in delta with its severity.
+		scanned, severity := ctrl.imageScanState("nginx:1.25")
+		r.True(scanned)
+		r.Equal(castai.SeverityCritical, severity)
+
+		// Already scanned images are checked without scanning.
+		handler.cfg.SeverityPolicy = config.AdmissionPolicyWarn
+		resp = handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.True(resp.Allowed)
+		r.Equal([]string{"images have CRITICAL or higher severity vulnerabilities: nginx:1.25"}, resp.Warnings)
+		r.Len(scanner.getScanImageParams(), 1)
+	})
+
+	t.Run("keep admission scan state once pod is running", func(t *testing.T) {
+		r := require.New(t)
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		ctrl := newController(scanner)
+		handler := NewAdmissionHandler(log, config.ImageScanAdmission{Timeout: time.Second}, ctrl)
+
+		resp := handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.True(resp.Allowed)
+
+		ctrl.delta.upsert(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "app"},
+			Spec: corev1.PodSpec{
+				NodeName:   "node1",
+				Containers: []corev1.Container{{Name: "app", Image: "nginx:1.25"}},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:    "app",
+					ImageID: "docker.io/library/nginx@sha256:abc",
+				}},
+			},
+		})
+
+		images := ctrl.delta.images.listByName("nginx:1.25")
+		r.Len(images, 1)
+		r.Equal("docker.io/library/nginx@sha256:abc", images[0].id)
+		r.True(images[0].scanned)
+		r.False(images[0].admissionScan)
+	})
+
+	t.Run("limit admission scans together with scheduled scans", func(t *testing.T) {
+		r := require.New(t)
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		ctrl := newController(scanner)
+		ctrl.scanSem = semaphore.NewWeighted(1)
+		handler := NewAdmissionHandler(log, config.ImageScanAdmission{Timeout: 10 * time.Millisecond}, ctrl)
+
+		// Scheduled scan holds the limit.
+		r.NoError(ctrl.scanSem.Acquire(context.Background(), 1))
+		resp := handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.True(resp.Allowed)
+		r.Equal([]string{"images are scanned asynchronously: nginx:1.25"}, resp.Warnings)
+		r.Empty(scanner.getScanImageParams())
+
+		ctrl.scanSem.Release(1)
+		v, found := handler.scans.Get("nginx:1.25")
+		r.True(found)
+		<-v.(*admissionScan).done
+		r.NoError(v.(*admissionScan).err)
+		r.Len(scanner.getScanImageParams(), 1)
+	})
+
+	t.Run("admit pod and continue scan asynchronously once time budget is exceeded", func(t *testing.T) {
+		r := require.New(t)
+		scanner := &blockingImageScanner{
+			started: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		ctrl := newController(scanner)
+		handler := NewAdmissionHandler(log, config.ImageScanAdmission{
+			Timeout:       10 * time.Millisecond,
+			FailurePolicy: config.AdmissionPolicyDeny,
+		}, ctrl)
+
+		resp := handler.Handle(context.Background(), newRequest(t, "nginx:1.25"))
+		r.True(resp.Allowed)
+		r.Equal([]string{"images are scanned asynchronously: nginx:1.25"}, resp.Warnings)
+
+		close(scanner.release)
+		v, found := handler.scans.Get("nginx:1.25")
+		r.True(found)
+		<-v.(*admissionScan).done
+		r.NoError(v.(*admissionScan).err)
+		r.Equal(1, scanner.getScansCount())
+	})
+}
@@ -4,21 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/castai/telemetry"
 	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
 	"github.com/castai/kvisor/config"
 	"github.com/castai/kvisor/kube"
 	"github.com/castai/kvisor/metrics"
+	"github.com/castai/kvisor/tracing"
 )
 
 type castaiClient interface {
@@ -34,24 +46,54 @@ func NewController(
 	client castaiClient,
 	k8sVersionMinor int,
 	kubeController kubeController,
+	eventRecorder record.EventRecorder,
+	reportWriter *VulnerabilityReportWriter,
 ) *Controller {
 	ctx, cancel := context.WithCancel(context.Background())
 	log = log.WithField("component", "imagescan")
+	delta := newDeltaState(kubeController, cfg.NodeSelector)
+	delta.log = log
+	if cfg.DeltaWorkers > 1 {
+		delta.queues = newDeltaQueues(cfg.DeltaWorkers)
+	}
+	delta.ownerLabels = cfg.OwnerLabels
+	delta.ownerAnnotations = cfg.OwnerAnnotations
+	delta.nodeSelectionStrategy = cfg.NodeSelectionStrategy
+	delta.hostFSDisableCooldown = cfg.HostFSDisableCooldown
+	delta.skipCrashLoopPods = cfg.SkipCrashLoopPods
+	delta.excludedImages = cfg.ExcludedImages
+	delta.excludedNamespaces = cfg.ExcludedNamespaces
+	delta.includedNamespaces = cfg.IncludedNamespaces
+	if !cfg.ScanInfraImages {
+		delta.excludedImages = append(append([]string{}, infraImages...), cfg.ExcludedImages...)
+	}
+	if cfg.DefaultPlatform != "" {
+		platformOS, platformArch, _ := strings.Cut(cfg.DefaultPlatform, "/")
+		delta.defaultPlatform = platform{architecture: platformArch, os: platformOS}
+	}
+	delta.addAlwaysScanImages(cfg.AlwaysScanImages)
 	return &Controller{
 		ctx:               ctx,
 		cancel:            cancel,
 		imageScanner:      imageScanner,
 		client:            client,
 		kubeController:    kubeController,
-		delta:             newDeltaState(kubeController),
+		eventRecorder:     eventRecorder,
+		reportWriter:      reportWriter,
+		scanSem:           semaphore.NewWeighted(max(cfg.MaxConcurrentScans+cfg.MaxConcurrentRemoteScans, 1)),
+		delta:             delta,
 		log:               log,
 		cfg:               cfg,
 		k8sVersionMinor:   k8sVersionMinor,
 		timeGetter:        timeGetter(),
 		initialScansDelay: cfg.InitDelay,
+		scanInterval:      cfg.ScanInterval,
 	}
 }
 
+// defaultSyncStateInterval is used when SyncStateInterval is not configured.
+const defaultSyncStateInterval = 10 * time.Minute
+
 func timeGetter() func() time.Time {
 	return func() time.Time {
 		return time.Now().UTC()
@@ -59,12 +101,18 @@ func timeGetter() func() time.Time {
 }
 
 type Controller struct {
-	ctx             context.Context
-	cancel          context.CancelFunc
-	delta           *deltaState
-	imageScanner    imageScanner
-	client          castaiClient
-	kubeController  kubeController
+	ctx            context.Context
+	cancel         context.CancelFunc
+	delta          *deltaState
+	imageScanner   imageScanner
+	client         castaiClient
+	kubeController kubeController
+	eventRecorder  record.EventRecorder
+	// reportWriter exports vulnerabilities as VulnerabilityReport objects. Nil if vulnerability reports are disabled.
+	reportWriter *VulnerabilityReportWriter
+	// scanSem limits concurrent scheduled and admission scans of this controller. Scan jobs are additionally
+	// limited by the cluster wide job limiter in scanner.
+	scanSem         *semaphore.Weighted
 	log             logrus.FieldLogger
 	cfg             config.ImageScan
 	k8sVersionMinor int
@@ -72,6 +120,14 @@ type Controller struct {
 
 	initialScansDelay time.Duration
 	fullSnapshotSent  bool
+	// remoteSeveritySupported is set once remote state returns severity of any scanned image. Scanned images are
+	// synced until their severity is known only if remote supports it.
+	remoteSeveritySupported bool
+	// scanInterval is current delay between scan cycles. It grows up to MaxIdleScanInterval while no images are pending.
+	scanInterval time.Duration
+
+	// ready is set while controller is running. Scan reports are accepted only when controller is ready.
+	ready atomic.Bool
 }
 
 func (s *Controller) RequiredInformers() []reflect.Type {
@@ -79,69 +135,139 @@ func (s *Controller) RequiredInformers() []reflect.Type {
 		reflect.TypeOf(&corev1.Pod{}),
 		reflect.TypeOf(&corev1.Node{}),
 	}
+	if s.cfg.ScanWorkloadTemplates {
+		rt = append(rt,
+			reflect.TypeOf(&appsv1.Deployment{}),
+			reflect.TypeOf(&appsv1.StatefulSet{}),
+			reflect.TypeOf(&appsv1.DaemonSet{}),
+		)
+		if s.k8sVersionMinor >= 21 {
+			rt = append(rt, reflect.TypeOf(&batchv1.CronJob{}))
+		} else {
+			rt = append(rt, reflect.TypeOf(&batchv1beta1.CronJob{}))
+		}
+	}
 	return rt
 }
 
 func (s *Controller) Run(ctx context.Context) error {
-	// Before starting normal scans and deltas processing
-	// we need to spend some time processing only deltas to make sure
-	// we have full images view.
-	if err := s.waitInitialDeltaQueueSync(ctx); err != nil {
-		return err
+	s.ready.Store(true)
+	defer s.ready.Store(false)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Deltas are consumed on separate goroutines so long scans never block informer events draining.
+	// Consumers are started before warm up, otherwise informer handlers block on full queues while delta is warming up.
+	s.startDeltaConsumers(ctx, &wg)
+
+	// Informers are synced before controller is started, but their events are delivered with delay.
+	// Populate delta from informers cache so first scans see all cluster images.
+	if err := s.warmUpDelta(); err != nil {
+		s.log.Warnf("warming up images delta: %v", err)
 	}
 
-	scanTicker := time.NewTicker(s.cfg.ScanInterval)
-	defer scanTicker.Stop()
+	// Before starting scans we need to spend some time processing
+	// only deltas to make sure we have full images view.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.initialScansDelay):
+	}
+
+	scanTimer := time.NewTimer(s.scanInterval)
+	defer scanTimer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case deltaItem := <-s.delta.queue:
-			s.handleDelta(deltaItem.event, deltaItem.obj)
-		case <-scanTicker.C:
+		case <-s.delta.newImages:
+			if s.scanInterval != s.cfg.ScanInterval {
+				s.scanInterval = s.cfg.ScanInterval
+				if !scanTimer.Stop() {
+					<-scanTimer.C
+				}
+				scanTimer.Reset(s.scanInterval)
+			}
+		case <-scanTimer.C:
 			if err := s.scheduleScans(ctx); err != nil {
 				s.log.Errorf("images scan failed: %v", err)
 			}
+			scanTimer.Reset(s.scanInterval)
 		}
 	}
 }
 
-func (s *Controller) waitInitialDeltaQueueSync(ctx context.Context) error {
-	waitTimeout := time.After(s.initialScansDelay)
+func (s *Controller) warmUpDelta() error {
+	// Nodes are applied first as images are added only for pods on known nodes.
+	for _, typ := range []reflect.Type{reflect.TypeOf(&corev1.Node{}), reflect.TypeOf(&corev1.Pod{})} {
+		objects, err := s.kubeController.ListObjects(typ)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			s.handleDelta(kube.EventAdd, obj)
+		}
+	}
+	return nil
+}
+
+func (s *Controller) startDeltaConsumers(ctx context.Context, wg *sync.WaitGroup) {
+	for _, queue := range s.delta.queues {
+		wg.Add(1)
+		go func(queue chan deltaQueueItem) {
+			defer wg.Done()
+			s.consumeDeltas(ctx, queue)
+		}(queue)
+	}
+}
+
+func (s *Controller) consumeDeltas(ctx context.Context, queue chan deltaQueueItem) {
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case deltaItem := <-s.delta.queue:
+			return
+		case deltaItem := <-queue:
 			s.handleDelta(deltaItem.event, deltaItem.obj)
-		case <-waitTimeout:
-			return nil
 		}
 	}
 }
 
-func (s *Controller) OnAdd(obj kube.Object) {
-	s.delta.queue <- deltaQueueItem{
-		event: kube.EventAdd,
-		obj:   obj,
+// TelemetryObserver excludes namespaces received from telemetry from image scanning in addition to configured ones.
+func (s *Controller) TelemetryObserver() telemetry.Observer {
+	return func(r *castai.TelemetryResponse) {
+		excluded := append(append([]string{}, s.cfg.ExcludedNamespaces...), r.ImageScanExcludedNamespaces...)
+		s.delta.mu.Lock()
+		removed := s.delta.setExcludedNamespaces(excluded)
+		s.delta.mu.Unlock()
+		if removed > 0 {
+			s.log.Infof("removed %d images of excluded namespaces", removed)
+		}
 	}
 }
 
+func (s *Controller) IsReady() bool {
+	return s.ready.Load()
+}
+
+func (s *Controller) OnAdd(obj kube.Object) {
+	s.delta.enqueue(kube.EventAdd, obj)
+}
+
 func (s *Controller) OnUpdate(obj kube.Object) {
-	s.delta.queue <- deltaQueueItem{
-		event: kube.EventUpdate,
-		obj:   obj,
-	}
+	s.delta.enqueue(kube.EventUpdate, obj)
 }
 
 func (s *Controller) OnDelete(obj kube.Object) {
-	s.delta.queue <- deltaQueueItem{
-		event: kube.EventDelete,
-		obj:   obj,
-	}
+	s.delta.enqueue(kube.EventDelete, obj)
 }
 
 func (s *Controller) handleDelta(event kube.Event, o kube.Object) {
+	s.delta.mu.Lock()
+	defer s.delta.mu.Unlock()
+
 	switch event {
 	case kube.EventAdd, kube.EventUpdate:
 		s.delta.upsert(o)
@@ -151,19 +277,26 @@ func (s *Controller) handleDelta(event kube.Event, o kube.Object) {
 }
 
 func (s *Controller) scheduleScans(ctx context.Context) (rerr error) {
+	s.sweepStaleImages()
+	s.rependExpiredScans()
 	s.syncFromRemoteState(ctx)
 
+	if err := s.writeVulnerabilityReports(ctx); err != nil {
+		s.log.Errorf("writing vulnerability reports: %v", err)
+	}
+
 	if err := s.updateImageStatuses(ctx); err != nil {
 		s.log.Errorf("sending images resources changes: %v", err)
 	}
 
+	if err := s.updateImagePullErrors(ctx); err != nil {
+		s.log.Errorf("sending image pull errors: %v", err)
+	}
+
 	// Scan pending images.
 	pendingImages := s.findPendingImages()
-	concurrentScans := s.concurrentScansNumber()
-	imagesForScan := pendingImages
-	if len(imagesForScan) > concurrentScans {
-		imagesForScan = imagesForScan[:concurrentScans]
-	}
+	s.updateScanInterval(len(pendingImages) == 0)
+	imagesForScan := s.selectImagesForScan(pendingImages)
 	if l := len(imagesForScan); l > 0 {
 		s.log.Infof("scheduling %d images scans", l)
 		if err := s.scanImages(ctx, imagesForScan); err != nil {
@@ -177,7 +310,51 @@ func (s *Controller) scheduleScans(ctx context.Context) (rerr error) {
 	return nil
 }
 
+// updateScanInterval doubles scan interval up to max idle interval after idle cycle and resets it once images are pending.
+func (s *Controller) updateScanInterval(idle bool) {
+	if !idle || s.cfg.MaxIdleScanInterval == 0 {
+		s.scanInterval = s.cfg.ScanInterval
+		return
+	}
+	s.scanInterval *= 2
+	if s.scanInterval > s.cfg.MaxIdleScanInterval {
+		s.scanInterval = s.cfg.MaxIdleScanInterval
+	}
+}
+
+func (s *Controller) sweepStaleImages() {
+	if s.cfg.ImageRetention == 0 {
+		return
+	}
+
+	s.delta.mu.Lock()
+	swept := s.delta.sweepStaleImages(s.timeGetter().Add(-s.cfg.ImageRetention))
+	s.delta.mu.Unlock()
+
+	if swept > 0 {
+		s.log.Infof("removed %d stale images", swept)
+		metrics.AddStaleImagesSwept(swept)
+	}
+}
+
+func (s *Controller) rependExpiredScans() {
+	if s.cfg.MaxScanAge == 0 {
+		return
+	}
+
+	s.delta.mu.Lock()
+	repended := s.delta.rependExpiredScans(s.timeGetter().Add(-s.cfg.MaxScanAge))
+	s.delta.mu.Unlock()
+
+	if repended > 0 {
+		s.log.Infof("scheduled rescan for %d images with expired scans", repended)
+	}
+}
+
 func (s *Controller) findPendingImages() []*image {
+	s.delta.mu.Lock()
+	defer s.delta.mu.Unlock()
+
 	images := s.delta.getImages()
 
 	now := s.timeGetter()
@@ -186,14 +363,31 @@ func (s *Controller) findPendingImages() []*image {
 		return isImagePrivate(v)
 	})
 	pendingImages := lo.Filter(images, func(v *image, _ int) bool {
-		return isImagePending(v, now)
+		return isImagePending(v, now, s.cfg.RescanInterval)
 	})
+	if s.cfg.Sampling.Enabled() {
+		sampled := sampleImages(s.cfg.Sampling, images)
+		pendingImages = lo.Filter(pendingImages, func(v *image, _ int) bool {
+			_, found := sampled[v.key]
+			return found
+		})
+		sampledCoverage := imageScanCoverage(lo.Values(sampled))
+		s.log.Infof("image scan sampling enabled, sampled %d of %d images, sampled coverage %.2f", len(sampled), len(images), sampledCoverage)
+		metrics.SetSampledImagesCount(len(sampled))
+		metrics.SetImageScanSampledCoverage(sampledCoverage)
+	}
 	sort.Slice(pendingImages, func(i, j int) bool {
 		return pendingImages[i].failures < pendingImages[j].failures
 	})
 	s.log.Infof("found %d images, pending images %d", len(images), len(pendingImages))
 	metrics.SetTotalImagesCount(len(images))
 	metrics.SetPendingImagesCount(len(pendingImages))
+	metrics.SetImageScanCoverage(imageScanCoverage(images))
+	notReadyImages, notReadyNodes := s.delta.imagesOnNotReadyNodes()
+	metrics.SetImagesOnNotReadyNodesCount(len(notReadyImages))
+	if len(notReadyImages) > 0 {
+		s.log.Warnf("%d images can't be scanned in hostfs mode, all nodes with these images are not ready: %s", len(notReadyImages), strings.Join(notReadyNodes, ", "))
+	}
 	if privateImagesCount > 0 {
 		s.log.Warnf("skipping %d private images", privateImagesCount)
 	}
@@ -214,23 +408,39 @@ func (s *Controller) scanImages(ctx context.Context, images []*image) error {
 			if ctx.Err() != nil {
 				return
 			}
+			// Scans are selected within concurrency limits, but admission scans can hold the limit.
+			if err := s.scanSem.Acquire(ctx, 1); err != nil {
+				return
+			}
+			defer s.scanSem.Release(1)
 
 			ctx, cancel := context.WithTimeout(ctx, s.cfg.ScanTimeout)
 			defer cancel()
 
 			log := s.log.WithField("image", img.name)
 			log.Info("scanning image")
+			s.recordImageEvent(img, corev1.EventTypeNormal, "ImageScanScheduled", fmt.Sprintf("Image %s scan scheduled", img.name))
 			if err := s.scanImage(ctx, img); err != nil {
 				log.Errorf("image scan failed: %v", err)
 				parsedErr := parseErrorFromLog(err)
-				s.delta.setImageScanError(img, parsedErr)
+				s.recordImageEvent(img, corev1.EventTypeWarning, "ImageScanFailed", fmt.Sprintf("Image %s scan failed: %v", img.name, parsedErr))
+				s.delta.mu.Lock()
+				s.delta.setImageScanError(img, parsedErr, s.timeGetter())
+				s.delta.mu.Unlock()
 				if err := s.updateImageStatusAsFailed(ctx, img, parsedErr); err != nil {
 					s.log.Errorf("sending images resources changes: %v", err)
 				}
 				return
 			}
 			log.Info("image scan finished")
-			s.delta.updateImage(img, func(i *image) { i.scanned = true })
+			s.delta.mu.Lock()
+			now := s.timeGetter()
+			s.delta.updateImage(img, func(i *image) {
+				i.markScanned(now)
+				i.lastScannedAt = now
+				i.resetRetryBackoff()
+			})
+			s.delta.mu.Unlock()
 		}(img)
 	}
 
@@ -248,13 +458,73 @@ func (s *Controller) scanImages(ctx context.Context, images []*image) error {
 	}
 }
 
-func (s *Controller) findBestNodeAndMode(img *image) (string, string, error) {
-	mode := s.cfg.Mode
-	if img.lastScanErr != nil && errors.Is(img.lastScanErr, errImageScanLayerNotFound) {
+// scanModeFallback is reason why image is scanned remotely instead of configured scan mode.
+type scanModeFallback string
+
+const (
+	scanModeFallbackLayerNotFound   scanModeFallback = "layer_not_found"
+	scanModeFallbackNoManagedNodes  scanModeFallback = "no_castai_managed_nodes"
+	scanModeFallbackNoCandidates    scanModeFallback = "no_candidates"
+	scanModeFallbackPoolMissesImage scanModeFallback = "pool_node_misses_image"
+)
+
+// configuredScanMode returns scan mode configured for image registry or global scan mode.
+func (s *Controller) configuredScanMode(img *image) string {
+	if registryMode, found := s.cfg.RegistryModes[imageRegistry(img.name)]; found {
+		return registryMode
+	}
+	return s.cfg.Mode
+}
+
+// preferredScanMode returns scan mode for image before node selection. Scan can still fallback to remote mode
+// if no suitable node is found for hostfs scan.
+func (s *Controller) preferredScanMode(img *image) string {
+	mode := s.configuredScanMode(img)
+	if s.cfg.TrivyServerAddr != "" {
+		// Scans with external trivy server don't need image layers from the node.
+		return string(imgcollectorconfig.ModeRemote)
+	}
+	if img.alwaysScan || img.admissionScan || img.templateImage {
+		// Configured images, images of not yet admitted pods and workload templates may not be present on any node.
+		return string(imgcollectorconfig.ModeRemote)
+	}
+	if s.isHostFSDisabled(img) {
 		// Fallback to remote if previously it failed due to missing layers.
 		s.log.Debugf("selecting remote mode because of lastScanErr")
 		mode = string(imgcollectorconfig.ModeRemote)
 	}
+	return mode
+}
+
+// isHostFSDisabled returns true if hostfs scan failed due to missing layers. Missing layers can be caused by
+// node garbage collecting image layers, so hostfs scan is re-enabled after cooldown.
+func (s *Controller) isHostFSDisabled(img *image) bool {
+	if classifyScanError(img.lastScanErr) != scanErrorLayerNotFound {
+		return false
+	}
+	return s.timeGetter().Before(img.hostFSDisabledUntil)
+}
+
+// recordImageEvent publishes event on the latest pod of each image owner.
+func (s *Controller) recordImageEvent(img *image, eventType, reason, message string) {
+	s.delta.mu.Lock()
+	pods := img.ownerPods()
+	s.delta.mu.Unlock()
+
+	for _, pod := range pods {
+		s.eventRecorder.Event(pod, eventType, reason, message)
+	}
+}
+
+// findBestNodeAndMode picks scan node and mode. Fallback to remote mode is recorded on image.
+func (s *Controller) findBestNodeAndMode(img *image) (string, string, error) {
+	img.scanModeFallback = ""
+	mode := s.preferredScanMode(img)
+	if imgcollectorconfig.Mode(mode) == imgcollectorconfig.ModeRemote &&
+		imgcollectorconfig.Mode(s.configuredScanMode(img)) != imgcollectorconfig.ModeRemote &&
+		s.isHostFSDisabled(img) {
+		img.scanModeFallback = scanModeFallbackLayerNotFound
+	}
 
 	var nodeNames []string
 	if imgcollectorconfig.Mode(mode) == imgcollectorconfig.ModeHostFS {
@@ -268,6 +538,7 @@ func (s *Controller) findBestNodeAndMode(img *image) (string, string, error) {
 		if len(nodeNames) == 0 {
 			// If image is not running on CAST AI managed nodes fallback to remote scan.
 			mode = string(imgcollectorconfig.ModeRemote)
+			img.scanModeFallback = scanModeFallbackNoManagedNodes
 			s.log.Debugf("selecting remote mode because no CAST AI managed nodes found")
 			nodeNames = lo.Keys(s.delta.nodes)
 		}
@@ -278,14 +549,35 @@ func (s *Controller) findBestNodeAndMode(img *image) (string, string, error) {
 	// skipping non-linux nodes as they are not supported as for today
 	nodeNames = s.filterWindowsNodes(nodeNames)
 
-	// Resolve best node.
 	memQty := resource.MustParse(s.cfg.MemoryRequest)
 	cpuQty := resource.MustParse(s.cfg.CPURequest)
+
+	if s.cfg.NodePool.Enabled() {
+		poolNodeNames := s.filterWindowsNodes(lo.Keys(s.delta.nodes))
+		poolNode, err := s.delta.findPoolNode(poolNodeNames, s.cfg.NodePool.NodeSelector, memQty.AsDec(), cpuQty.AsDec())
+		if err == nil {
+			if _, found := img.nodes[poolNode]; !found {
+				// Image is not present on the pool node, it can be scanned only remotely.
+				if imgcollectorconfig.Mode(mode) != imgcollectorconfig.ModeRemote {
+					mode = string(imgcollectorconfig.ModeRemote)
+					img.scanModeFallback = scanModeFallbackPoolMissesImage
+				}
+			}
+			return poolNode, mode, nil
+		}
+		if !errors.Is(err, errNoCandidates) {
+			return "", "", err
+		}
+		s.log.Debugf("scan node pool has no capacity, falling back to best node")
+	}
+
+	// Resolve best node.
 	resolvedNode, err := s.delta.findBestNode(nodeNames, memQty.AsDec(), cpuQty.AsDec())
 	if err != nil {
 		if errors.Is(err, errNoCandidates) && imgcollectorconfig.Mode(mode) == imgcollectorconfig.ModeHostFS {
 			// if mode was host fs fallback to remote scan and try picking node again.
 			mode = string(imgcollectorconfig.ModeRemote)
+			img.scanModeFallback = scanModeFallbackNoCandidates
 			s.log.Debugf("selecting a node in remote mode because of errNoCandidates")
 			nodeNames = lo.Keys(s.delta.nodes)
 			resolvedNode, err = s.delta.findBestNode(nodeNames, memQty.AsDec(), cpuQty.AsDec())
@@ -316,24 +608,60 @@ func (s *Controller) scanImage(ctx context.Context, img *image) (rerr error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
-	node, mode, err := s.findBestNodeAndMode(img)
+	ctx, span := tracing.Start(ctx, "imagescan.scanImage", attribute.String("image", img.name))
+	defer func() { tracing.End(span, rerr) }()
+
+	// Image and nodes are read under delta lock as deltas are applied concurrently.
+	s.delta.mu.Lock()
+	params, err := s.newScanImageParams(img)
+	modeFallback := img.scanModeFallback
+	s.delta.mu.Unlock()
 	if err != nil {
 		return err
 	}
+	if modeFallback != "" {
+		metrics.IncImageScanModeFallbacks(string(modeFallback))
+	}
 
 	start := time.Now()
 	defer func() {
 		metrics.IncScansTotal(metrics.ScanTypeImage, rerr)
-		metrics.ObserveScanDuration(metrics.ScanTypeImage, start)
+		metrics.IncImageScansTotal(string(scanMode(params)), rerr)
+		// Exemplar is omitted when tracing is disabled.
+		metrics.ObserveScanDurationWithExemplar(metrics.ScanTypeImage, start, tracing.TraceID(ctx))
 	}()
 
 	collectorImageDetails, found := s.kubeController.GetKvisorImageDetails()
 	if !found {
 		return errors.New("kvisor image details not found")
 	}
+	params.CollectorImageDetails = collectorImageDetails
+
+	return s.imageScanner.ScanImage(ctx, params)
+}
+
+func (s *Controller) newScanImageParams(img *image) (ScanImageParams, error) {
+	var node, mode string
+	if s.cfg.TrivyServerAddr != "" {
+		// Scan job doesn't need image layers or trivy database on the node, so scheduler picks any linux node.
+		img.scanModeFallback = ""
+		mode = s.preferredScanMode(img)
+	} else {
+		var err error
+		node, mode, err = s.findBestNodeAndMode(img)
+		if err != nil {
+			return ScanImageParams{}, err
+		}
+	}
 
-	return s.imageScanner.ScanImage(ctx, ScanImageParams{
-		ImageName:                   img.name,
+	waitAfterCompletion := 30 * time.Second
+	if img.admissionScan {
+		// Pod admission is waiting for the scan.
+		waitAfterCompletion = 0
+	}
+
+	return ScanImageParams{
+		ImageName:                   img.scanImageName(),
 		ImageID:                     img.id,
 		ContainerRuntime:            string(img.containerRuntime),
 		Mode:                        mode,
@@ -341,38 +669,110 @@ func (s *Controller) scanImage(ctx context.Context, img *image) (rerr error) {
 		NodeName:                    node,
 		DeleteFinishedJob:           true,
 		WaitForCompletion:           true,
-		WaitDurationAfterCompletion: 30 * time.Second,
+		WaitDurationAfterCompletion: waitAfterCompletion,
 		Architecture:                img.architecture,
 		Os:                          img.os,
-		CollectorImageDetails:       collectorImageDetails,
-	})
+		BuildMetadata:               img.buildMetadata,
+		TrivyDBRepository:           s.cfg.TrivyDB.Repository,
+		TrivyDBClaimName:            s.cfg.TrivyDB.ClaimName,
+		TrivyServerAddr:             s.cfg.TrivyServerAddr,
+		TrivyServerToken:            s.cfg.TrivyServerToken,
+		MatchVulnerabilities:        s.cfg.VulnerabilityReports,
+		PullSecrets:                 img.pullSecrets(),
+	}, nil
 }
 
-func (s *Controller) concurrentScansNumber() int {
+// selectImagesForScan picks pending images for the next scans batch. Remote and hostfs scans can have separate
+// concurrency limits as remote scans are network bound while hostfs scans consume node resources.
+// Scans of images from the same registry host can be limited further to avoid registry rate limits.
+func (s *Controller) selectImagesForScan(pendingImages []*image) []*image {
+	s.delta.mu.Lock()
+	defer s.delta.mu.Unlock()
+
 	if s.delta.nodeCount() == 1 {
-		return 1
+		return lo.Slice(pendingImages, 0, 1)
+	}
+
+	if s.cfg.MaxConcurrentRemoteScans == 0 && s.cfg.PerRegistryMaxConcurrentScans == 0 {
+		return lo.Slice(pendingImages, 0, int(s.cfg.MaxConcurrentScans))
 	}
 
-	return int(s.cfg.MaxConcurrentScans)
+	limits := map[imgcollectorconfig.Mode]int{
+		imgcollectorconfig.ModeHostFS: int(s.cfg.MaxConcurrentScans),
+		imgcollectorconfig.ModeRemote: int(s.cfg.MaxConcurrentRemoteScans),
+	}
+
+	scans := map[imgcollectorconfig.Mode]int{}
+	registryScans := map[string]int{}
+	var res []*image
+	for _, img := range pendingImages {
+		if s.cfg.MaxConcurrentRemoteScans == 0 && len(res) >= int(s.cfg.MaxConcurrentScans) {
+			break
+		}
+		registry := imageRegistry(img.name)
+		if s.cfg.PerRegistryMaxConcurrentScans > 0 && registryScans[registry] >= int(s.cfg.PerRegistryMaxConcurrentScans) {
+			continue
+		}
+		if s.cfg.MaxConcurrentRemoteScans > 0 {
+			mode := imgcollectorconfig.ModeRemote
+			if imgcollectorconfig.Mode(s.preferredScanMode(img)) == imgcollectorconfig.ModeHostFS {
+				mode = imgcollectorconfig.ModeHostFS
+			}
+			if scans[mode] >= limits[mode] {
+				continue
+			}
+			scans[mode]++
+		}
+		registryScans[registry]++
+		res = append(res, img)
+	}
+	return res
 }
 
 func (s *Controller) updateImageStatuses(ctx context.Context) error {
+	now := s.timeGetter()
+	images, imagesChanges, workloads := s.imageStatusChanges(now)
+	if len(images) == 0 {
+		return nil
+	}
+
+	s.log.Info("sending images resources changes")
+	report := &castai.UpdateImagesStatusRequest{
+		FullSnapshot: s.fullSnapshotSent,
+		Images:       imagesChanges,
+		Workloads:    workloads,
+	}
+	err := s.client.UpdateImageStatus(ctx, report)
+	if err != nil {
+		return err
+	}
+	s.delta.mu.Lock()
+	for _, img := range images {
+		img.resourcesUpdatedAt = now
+	}
+	s.delta.mu.Unlock()
+	s.fullSnapshotSent = true
+	return nil
+}
+
+func (s *Controller) imageStatusChanges(now time.Time) ([]*image, []castai.Image, []castai.WorkloadSeverity) {
+	s.delta.mu.Lock()
+	defer s.delta.mu.Unlock()
+
 	images := s.delta.getImages()
 	if s.fullSnapshotSent {
 		images = lo.Filter(images, func(item *image, index int) bool {
-			return item.ownerChangedAt.After(item.resourcesUpdatedAt)
+			// Owner changes are coalesced during configured window to avoid sending
+			// redundant updates when the same image churns during frequent redeploys.
+			return item.hasUnsyncedOwnerChanges() && !now.Before(item.ownerChangesSince.Add(s.cfg.StatusCoalesceWindow))
 		})
 	}
-	if len(images) == 0 {
-		return nil
-	}
-	now := s.timeGetter()
 	var imagesChanges []castai.Image
 	for _, img := range images {
 		resourceIds := lo.Keys(img.owners)
 
 		var updatedStatus castai.ImageScanStatus
-		if isImagePending(img, now) {
+		if isImagePending(img, now, s.cfg.RescanInterval) {
 			updatedStatus = castai.ImageScanStatusPending
 		}
 		imagesChanges = append(imagesChanges, castai.Image{
@@ -383,22 +783,53 @@ func (s *Controller) updateImageStatuses(ctx context.Context) error {
 			},
 			ImageName: img.name,
 			Status:    updatedStatus,
+			Owners:    img.ownersMetadata(),
 		})
 	}
+	// Workload rollups include all images of workloads, not only changed ones.
+	resourceIDs := lo.Uniq(lo.FlatMap(images, func(img *image, _ int) []string {
+		return lo.Keys(img.owners)
+	}))
+	return images, imagesChanges, s.delta.workloadSeverities(resourceIDs)
+}
 
-	s.log.Info("sending images resources changes")
+// updateImagePullErrors reports images which pods fail to pull. These are not scan failures as scan was never attempted.
+func (s *Controller) updateImagePullErrors(ctx context.Context) error {
+	s.delta.mu.Lock()
+	pullErrors := s.delta.getImagePullErrors()
+	metrics.SetImagePullErrorsCount(len(pullErrors))
+	pullErrors = lo.Filter(pullErrors, func(item *imagePullError, index int) bool {
+		return !item.reported
+	})
+	imagesChanges := lo.Map(pullErrors, func(item *imagePullError, index int) castai.Image {
+		return castai.Image{
+			ImageName:    item.name,
+			Architecture: item.architecture,
+			ResourcesChange: castai.ResourcesChange{
+				ResourceIDs: item.ownerIDs(),
+			},
+			Status:   castai.ImageScanStatusPullError,
+			ErrorMsg: fmt.Sprintf("%s: %s", item.reason, item.message),
+		}
+	})
+	s.delta.mu.Unlock()
+
+	if len(imagesChanges) == 0 {
+		return nil
+	}
+
+	s.log.Infof("sending %d image pull errors", len(imagesChanges))
 	report := &castai.UpdateImagesStatusRequest{
-		FullSnapshot: s.fullSnapshotSent,
-		Images:       imagesChanges,
+		Images: imagesChanges,
 	}
-	err := s.client.UpdateImageStatus(ctx, report)
-	if err != nil {
+	if err := s.client.UpdateImageStatus(ctx, report); err != nil {
 		return err
 	}
-	for _, img := range images {
-		img.resourcesUpdatedAt = now
+	s.delta.mu.Lock()
+	for _, pullErr := range pullErrors {
+		pullErr.reported = true
 	}
-	s.fullSnapshotSent = true
+	s.delta.mu.Unlock()
 	return nil
 }
 
@@ -411,13 +842,17 @@ func (s *Controller) updateImageStatusAsFailed(ctx context.Context, image *image
 		errorMsg = scanJobError.Error()
 	}
 
+	s.delta.mu.Lock()
 	updatedImage := castai.Image{
-		ID:           image.id,
-		ImageName:    image.name,
-		Architecture: image.architecture,
-		Status:       castai.ImageScanStatusError,
-		ErrorMsg:     errorMsg,
+		ID:            image.id,
+		ImageName:     image.name,
+		Architecture:  image.architecture,
+		Status:        imageScanErrorStatus(scanJobError),
+		ErrorMsg:      errorMsg,
+		Remediation:   imageScanErrorRemediation(scanJobError),
+		PrivateReason: privateImageReason(scanJobError),
 	}
+	s.delta.mu.Unlock()
 
 	s.log.Info("sending image failed status")
 	report := &castai.UpdateImagesStatusRequest{
@@ -428,52 +863,169 @@ func (s *Controller) updateImageStatusAsFailed(ctx context.Context, image *image
 }
 
 func (s *Controller) syncFromRemoteState(ctx context.Context) {
+	syncInterval := s.cfg.SyncStateInterval
+	if syncInterval <= 0 {
+		syncInterval = defaultSyncStateInterval
+	}
+
+	s.delta.mu.Lock()
 	images := s.delta.getImages()
 	now := s.timeGetter().UTC()
 	imagesWithNotSyncedState := lo.Filter(images, func(item *image, index int) bool {
-		return !item.scanned && item.lastRemoteSyncAt.Before(now.Add(-10*time.Minute))
+		// Severity of scanned images is known only after remote processes scan results.
+		notSynced := !item.scanned || (s.remoteSeveritySupported && item.severity == "")
+		return notSynced && item.lastRemoteSyncAt.Before(now.Add(-syncInterval))
+	})
+	imagesIds := lo.Map(imagesWithNotSyncedState, func(item *image, index int) string {
+		return item.id
 	})
+	s.delta.mu.Unlock()
 
 	if len(imagesWithNotSyncedState) == 0 {
 		return
 	}
 
-	imagesIds := lo.Map(imagesWithNotSyncedState, func(item *image, index int) string {
-		return item.id
-	})
-	s.log.Debugf("sync images state from remote")
-	resp, err := s.client.GetSyncState(ctx, &castai.SyncStateFilter{ImagesIds: imagesIds})
-	if err != nil {
-		s.log.Errorf("getting images sync state from remote: %v", err)
-		return
+	// Large clusters can have tens of thousands of not synced images, so state is requested in batches.
+	batchSize := s.cfg.SyncStateBatchSize
+	if batchSize <= 0 {
+		batchSize = len(imagesWithNotSyncedState)
 	}
-	if resp.Images == nil {
-		return
+	batches := lo.Chunk(imagesWithNotSyncedState, batchSize)
+	idsBatches := lo.Chunk(imagesIds, batchSize)
+	states := make([]*castai.ImagesSyncState, len(batches))
+
+	s.log.Debugf("sync images state from remote, batches=%d", len(batches))
+	var g errgroup.Group
+	g.SetLimit(max(s.cfg.SyncStateConcurrency, 1))
+	for i, ids := range idsBatches {
+		i, ids := i, ids
+		g.Go(func() error {
+			resp, err := s.client.GetSyncState(ctx, &castai.SyncStateFilter{ImagesIds: ids})
+			if err != nil {
+				s.log.Errorf("getting images sync state from remote: %v", err)
+				return nil
+			}
+			states[i] = resp.Images
+			return nil
+		})
 	}
+	_ = g.Wait()
 
-	// Set sync state for all these images to prevent constant api calls.
-	for _, img := range imagesWithNotSyncedState {
-		img.lastRemoteSyncAt = now
+	var synced, fullResourcesResyncRequired bool
+	var scannedImages int
+	s.delta.mu.Lock()
+	for i, batch := range batches {
+		state := states[i]
+		if state == nil {
+			continue
+		}
+		// Set sync state for all these images to prevent constant api calls.
+		for _, img := range batch {
+			img.lastRemoteSyncAt = now
+		}
+		// Set images as scanned from remote response.
+		for _, scannedImage := range state.ScannedImages {
+			s.delta.setImageScanned(scannedImage, now)
+		}
+		synced = true
+		if lo.SomeBy(state.ScannedImages, func(item castai.ScannedImage) bool { return item.Severity != "" }) {
+			s.remoteSeveritySupported = true
+		}
+		fullResourcesResyncRequired = fullResourcesResyncRequired || state.FullResourcesResyncRequired
+		scannedImages += len(state.ScannedImages)
 	}
-	// Set images as scanned from remote response.
-	for _, scannedImage := range resp.Images.ScannedImages {
-		s.delta.setImageScanned(scannedImage)
+	s.delta.mu.Unlock()
+
+	if !synced {
+		return
 	}
 
 	// If full resources resync is required it will be sent during next scheduled scan.
-	if resp.Images.FullResourcesResyncRequired {
+	if fullResourcesResyncRequired {
 		s.fullSnapshotSent = false
 	}
-	s.log.Infof("images updated from remote state, full_resync=%v, scanned_images=%d", resp.Images.FullResourcesResyncRequired, len(resp.Images.ScannedImages))
+	s.log.Infof("images updated from remote state, full_resync=%v, scanned_images=%d", fullResourcesResyncRequired, scannedImages)
+}
+
+func (s *Controller) writeVulnerabilityReports(ctx context.Context) error {
+	if s.reportWriter == nil {
+		return nil
+	}
+	s.delta.mu.Lock()
+	reports := s.delta.vulnerabilityReports()
+	s.delta.mu.Unlock()
+	return s.reportWriter.write(ctx, reports, s.timeGetter())
 }
 
-func isImagePending(v *image, now time.Time) bool {
-	return !v.scanned &&
-		len(v.owners) > 0 &&
+// isImagePending returns true if image should be scanned. When rescan interval is set, images are rescanned
+// once their last scan is older than the interval, while images scanned within the interval are skipped.
+func isImagePending(v *image, now time.Time, rescanInterval time.Duration) bool {
+	scanned := v.scanned
+	if rescanInterval > 0 {
+		lastScannedAt := v.lastScannedAt
+		if lastScannedAt.IsZero() {
+			// Image was marked as scanned from remote state.
+			lastScannedAt = v.scannedAt
+		}
+		if !lastScannedAt.IsZero() {
+			scanned = now.Sub(lastScannedAt) < rescanInterval
+		}
+	}
+	return !scanned &&
+		(len(v.owners) > 0 || v.alwaysScan) &&
 		!isImagePrivate(v) &&
 		(v.nextScan.IsZero() || v.nextScan.Before(now))
 }
 
+// imageScanCoverage returns fraction of images which are successfully scanned, computed as scanned/(scanned+pending+failed).
+// Not scanned images without owners are not counted as they will not be scanned.
+func imageScanCoverage(images []*image) float64 {
+	var scanned, pending, failed int
+	for _, img := range images {
+		switch {
+		case img.scanned:
+			scanned++
+		case len(img.owners) == 0 && !img.alwaysScan:
+		case img.failures > 0 || img.lastScanErr != nil:
+			failed++
+		default:
+			pending++
+		}
+	}
+	total := scanned + pending + failed
+	if total == 0 {
+		return 1
+	}
+	return float64(scanned) / float64(total)
+}
+
+// sampleImages selects the highest priority images which are scanned when sampling is enabled. Images used by more
+// workloads have higher priority. Sample size is the lower of configured percent of images and max images.
+// Images without owners and private images are not sampled as they are not scanned.
+func sampleImages(cfg config.ImageScanSampling, images []*image) map[string]*image {
+	candidates := lo.Filter(images, func(v *image, _ int) bool {
+		return len(v.owners) > 0 && !isImagePrivate(v)
+	})
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i].owners) != len(candidates[j].owners) {
+			return len(candidates[i].owners) > len(candidates[j].owners)
+		}
+		// Keep sample stable between scan cycles.
+		return candidates[i].key < candidates[j].key
+	})
+
+	size := len(candidates)
+	if cfg.Percent > 0 {
+		size = int(math.Ceil(float64(len(candidates)*cfg.Percent) / 100))
+	}
+	if cfg.MaxImages > 0 && cfg.MaxImages < size {
+		size = cfg.MaxImages
+	}
+	return lo.SliceToMap(candidates[:size], func(v *image) (string, *image) {
+		return v.key, v
+	})
+}
+
 func isImagePrivate(v *image) bool {
-	return errors.Is(v.lastScanErr, errPrivateImage)
+	return classifyScanError(v.lastScanErr) == scanErrorPrivate
 }
@@ -3,12 +3,16 @@ package imagescan
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -16,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/castai/kvisor/castai"
 	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
@@ -289,7 +294,7 @@ func TestSubscriber(t *testing.T) {
 			"r1": {},
 		}
 
-		delta.images[img.key] = img
+		delta.images.set(img)
 
 		resMem := resource.MustParse("500Mi")
 		resCpu := resource.MustParse("2")
@@ -320,9 +325,18 @@ func TestSubscriber(t *testing.T) {
 				return false
 			}
 
+			delta.mu.Lock()
+			img, _ = delta.images.get(img.key)
+			scanned, failures, nextScan := img.scanned, img.failures, img.nextScan
+			delta.mu.Unlock()
+			if !scanned {
+				return false
+			}
+
 			r.Len(imgs, 2)
-			img = delta.images[img.key]
-			r.False(img.nextScan.IsZero())
+			// Retry backoff is reset after successful scan.
+			r.Zero(failures)
+			r.True(nextScan.IsZero())
 
 			r.Len(client.getImagesResourcesChanges(), 2)
 			// first scan update is pending
@@ -340,6 +354,76 @@ func TestSubscriber(t *testing.T) {
 	t.Run("scan image with remote mode fallback", func(t *testing.T) {
 		r := require.New(t)
 
+		cfg := config.ImageScan{
+			ScanInterval:          1 * time.Millisecond,
+			ScanTimeout:           time.Minute,
+			MaxConcurrentScans:    5,
+			Mode:                  string(imgcollectorconfig.ModeHostFS),
+			CPURequest:            "500m",
+			CPULimit:              "2",
+			MemoryRequest:         "100Mi",
+			MemoryLimit:           "2Gi",
+			HostFSDisableCooldown: time.Hour,
+		}
+
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		sub := newTestController(log, cfg)
+		sub.imageScanner = scanner
+		sub.initialScansDelay = 1 * time.Millisecond
+		sub.timeGetter = func() time.Time {
+			return time.Now().UTC().Add(time.Hour)
+		}
+		delta := sub.delta
+		img := newImage()
+		img.name = "img"
+		img.id = "img1"
+		img.key = "img1amd64img"
+		img.architecture = "amd64"
+		img.containerRuntime = imgcollectorconfig.RuntimeContainerd
+		img.nodes = map[string]*imageNode{
+			"node1": {},
+		}
+		img.owners = map[string]*imageOwner{
+			"r1": {},
+		}
+		delta.images.set(img)
+		delta.setImageScanError(img, errImageScanLayerNotFound, sub.timeGetter())
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+		delta.nodes["node1"] = &node{
+			name:           "node1",
+			allocatableMem: resMem.AsDec(),
+			allocatableCPU: resCpu.AsDec(),
+			pods:           map[types.UID]*pod{},
+			os:             defaultImageOs,
+			architecture:   defaultImageArch,
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- sub.Run(ctx)
+		}()
+
+		assertLoop(errc, func() bool {
+			imgs := scanner.getScanImageParams()
+			if len(imgs) == 0 {
+				return false
+			}
+
+			r.Len(imgs, 1)
+			r.Equal(string(imgcollectorconfig.ModeRemote), imgs[0].Mode)
+			return true
+		})
+	})
+
+	t.Run("scan configured images without running pods", func(t *testing.T) {
+		r := require.New(t)
+
 		cfg := config.ImageScan{
 			ScanInterval:       1 * time.Millisecond,
 			ScanTimeout:        time.Minute,
@@ -349,6 +433,7 @@ func TestSubscriber(t *testing.T) {
 			CPULimit:           "2",
 			MemoryRequest:      "100Mi",
 			MemoryLimit:        "2Gi",
+			AlwaysScanImages:   []string{"ghcr.io/team/base:1.0"},
 		}
 
 		scanner := &mockImageScanner{}
@@ -359,6 +444,64 @@ func TestSubscriber(t *testing.T) {
 		sub.timeGetter = func() time.Time {
 			return time.Now().UTC().Add(time.Hour)
 		}
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+		sub.delta.nodes["node1"] = &node{
+			name:           "node1",
+			allocatableMem: resMem.AsDec(),
+			allocatableCPU: resCpu.AsDec(),
+			pods:           map[types.UID]*pod{},
+			os:             defaultImageOs,
+			architecture:   defaultImageArch,
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- sub.Run(ctx)
+		}()
+
+		assertLoop(errc, func() bool {
+			imgs := scanner.getScanImageParams()
+			if len(imgs) == 0 {
+				return false
+			}
+
+			r.Len(imgs, 1)
+			r.Equal("ghcr.io/team/base:1.0", imgs[0].ImageName)
+			r.Equal(string(imgcollectorconfig.ModeRemote), imgs[0].Mode)
+			r.Equal("node1", imgs[0].NodeName)
+			r.Empty(imgs[0].ResourceIDs)
+			return true
+		})
+	})
+
+	t.Run("select any node with remote scan mode", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg := config.ImageScan{
+			ScanInterval:       1 * time.Millisecond,
+			ScanTimeout:        time.Minute,
+			MaxConcurrentScans: 5,
+			Mode:               string(imgcollectorconfig.ModeRemote),
+			CPURequest:         "500m",
+			CPULimit:           "2",
+			MemoryRequest:      "100Mi",
+			MemoryLimit:        "2Gi",
+		}
+
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		client := &mockCastaiClient{}
+		podOwnerGetter := &mockKubeController{}
+		sub := NewController(log, cfg, scanner, client, 21, podOwnerGetter, &record.FakeRecorder{}, nil)
+		sub.initialScansDelay = 1 * time.Millisecond
+		sub.timeGetter = func() time.Time {
+			return time.Now().UTC().Add(time.Hour)
+		}
 		delta := sub.delta
 		img := newImage()
 		img.name = "img"
@@ -366,14 +509,10 @@ func TestSubscriber(t *testing.T) {
 		img.key = "img1amd64img"
 		img.architecture = "amd64"
 		img.containerRuntime = imgcollectorconfig.RuntimeContainerd
-		img.nodes = map[string]*imageNode{
-			"node1": {},
-		}
 		img.owners = map[string]*imageOwner{
 			"r1": {},
 		}
-		delta.images[img.key] = img
-		delta.setImageScanError(img, errImageScanLayerNotFound)
+		delta.images.set(img)
 
 		resMem := resource.MustParse("500Mi")
 		resCpu := resource.MustParse("2")
@@ -406,25 +545,27 @@ func TestSubscriber(t *testing.T) {
 		})
 	})
 
-	t.Run("select any node with remote scan mode", func(t *testing.T) {
+	t.Run("scan with trivy server on any node", func(t *testing.T) {
 		r := require.New(t)
 
 		cfg := config.ImageScan{
 			ScanInterval:       1 * time.Millisecond,
 			ScanTimeout:        time.Minute,
 			MaxConcurrentScans: 5,
-			Mode:               string(imgcollectorconfig.ModeRemote),
+			Mode:               string(imgcollectorconfig.ModeHostFS),
 			CPURequest:         "500m",
 			CPULimit:           "2",
 			MemoryRequest:      "100Mi",
 			MemoryLimit:        "2Gi",
+			TrivyServerAddr:    "http://trivy.trivy-system:4954",
+			TrivyServerToken:   "trivy-token",
 		}
 
 		scanner := &mockImageScanner{}
 		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
 		client := &mockCastaiClient{}
 		podOwnerGetter := &mockKubeController{}
-		sub := NewController(log, cfg, scanner, client, 21, podOwnerGetter)
+		sub := NewController(log, cfg, scanner, client, 21, podOwnerGetter, &record.FakeRecorder{}, nil)
 		sub.initialScansDelay = 1 * time.Millisecond
 		sub.timeGetter = func() time.Time {
 			return time.Now().UTC().Add(time.Hour)
@@ -439,10 +580,14 @@ func TestSubscriber(t *testing.T) {
 		img.owners = map[string]*imageOwner{
 			"r1": {},
 		}
-		delta.images[img.key] = img
+		// Image node has no capacity for scan job, so node selection would fail.
+		img.nodes = map[string]*imageNode{
+			"node1": {},
+		}
+		delta.images.set(img)
 
-		resMem := resource.MustParse("500Mi")
-		resCpu := resource.MustParse("2")
+		resMem := resource.MustParse("50Mi")
+		resCpu := resource.MustParse("100m")
 		delta.nodes["node1"] = &node{
 			name:           "node1",
 			allocatableMem: resMem.AsDec(),
@@ -468,6 +613,9 @@ func TestSubscriber(t *testing.T) {
 
 			r.Len(imgs, 1)
 			r.Equal(string(imgcollectorconfig.ModeRemote), imgs[0].Mode)
+			r.Empty(imgs[0].NodeName)
+			r.Equal("http://trivy.trivy-system:4954", imgs[0].TrivyServerAddr)
+			r.Equal("trivy-token", imgs[0].TrivyServerToken)
 			return true
 		})
 	})
@@ -503,7 +651,7 @@ func TestSubscriber(t *testing.T) {
 		img.owners = map[string]*imageOwner{
 			"r1": {},
 		}
-		delta.images[img.key] = img
+		delta.images.set(img)
 
 		firstCtx, firstCancel := context.WithTimeout(ctx, 50*time.Millisecond)
 		defer firstCancel()
@@ -540,7 +688,7 @@ func TestSubscriber(t *testing.T) {
 		img.owners = map[string]*imageOwner{
 			"r1": {},
 		}
-		delta.images[img.key] = img
+		delta.images.set(img)
 
 		secondCtx, secondCancel := context.WithTimeout(ctx, 50*time.Millisecond)
 		defer secondCancel()
@@ -548,7 +696,9 @@ func TestSubscriber(t *testing.T) {
 		err = sub.scheduleScans(secondCtx)
 		r.NoError(err)
 		r.Len(scanner.imgs, 1)
-		r.True(delta.images[img.key].scanned)
+		scannedImg, found := delta.images.get(img.key)
+		r.True(found)
+		r.True(scannedImg.scanned)
 	})
 
 	t.Run("send changed resource owners", func(t *testing.T) {
@@ -574,7 +724,7 @@ func TestSubscriber(t *testing.T) {
 		img.owners = map[string]*imageOwner{
 			"r1": {},
 		}
-		delta.images[img.key] = img
+		delta.images.set(img)
 
 		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
 		defer cancel()
@@ -600,6 +750,62 @@ func TestSubscriber(t *testing.T) {
 		})
 	})
 
+	t.Run("coalesce rapid owner changes into single status update", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &mockCastaiClient{}
+		sub := newTestController(log, config.ImageScan{
+			StatusCoalesceWindow: time.Minute,
+		})
+		sub.client = client
+		sub.fullSnapshotSent = true
+		now := time.Now().UTC()
+		sub.timeGetter = func() time.Time {
+			return now
+		}
+
+		node := createNode("n1")
+		sub.delta.upsert(node)
+		createPod := func() *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID: types.UID(uuid.New().String()),
+				},
+				Spec: corev1.PodSpec{
+					NodeName:   node.Name,
+					Containers: []corev1.Container{{Name: "app", Image: "app:v1"}},
+				},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: "app@sha256:1"}},
+				},
+			}
+		}
+
+		// Simulate rolling redeploys where pods are replaced multiple times.
+		pod1 := createPod()
+		sub.delta.upsert(pod1)
+		r.NoError(sub.updateImageStatuses(ctx))
+		pod2 := createPod()
+		sub.delta.upsert(pod2)
+		sub.delta.delete(pod1)
+		r.NoError(sub.updateImageStatuses(ctx))
+		pod3 := createPod()
+		sub.delta.upsert(pod3)
+		sub.delta.delete(pod2)
+		r.NoError(sub.updateImageStatuses(ctx))
+		r.Empty(client.getImagesResourcesChanges())
+
+		// Changes are sent once coalesce window passes.
+		now = now.Add(2 * time.Minute)
+		r.NoError(sub.updateImageStatuses(ctx))
+		r.NoError(sub.updateImageStatuses(ctx))
+		changes := client.getImagesResourcesChanges()
+		r.Len(changes, 1)
+		r.Len(changes[0].Images, 1)
+		r.Equal([]string{string(pod3.UID)}, changes[0].Images[0].ResourcesChange.ResourceIDs)
+	})
+
 	t.Run("sync scanned images from remote state", func(t *testing.T) {
 		r := require.New(t)
 
@@ -647,7 +853,7 @@ func TestSubscriber(t *testing.T) {
 		img1.owners = map[string]*imageOwner{
 			"r1": {},
 		}
-		delta.images[img1.key] = img1
+		delta.images.set(img1)
 
 		img2 := newImage()
 		img2.name = "img2"
@@ -657,7 +863,7 @@ func TestSubscriber(t *testing.T) {
 		img2.owners = map[string]*imageOwner{
 			"r2": {},
 		}
-		delta.images[img2.key] = img2
+		delta.images.set(img2)
 
 		errc := make(chan error, 1)
 		go func() {
@@ -679,107 +885,588 @@ func TestSubscriber(t *testing.T) {
 			return true
 		})
 	})
-}
 
-func TestController_findBestNodeAndMode(t *testing.T) {
-	log := logrus.New()
-	log.SetLevel(logrus.DebugLevel)
+	t.Run("sync remote state in batches", func(t *testing.T) {
+		r := require.New(t)
 
-	t.Run("fallbacks when img had error", func(t *testing.T) {
-		cfg := config.ImageScan{
-			Mode:          string(imgcollectorconfig.ModeHostFS),
-			CPURequest:    "1",
-			MemoryRequest: "100Mi",
+		client := &mockCastaiClient{
+			syncState: &castai.SyncStateResponse{
+				Images: &castai.ImagesSyncState{
+					ScannedImages: []castai.ScannedImage{{ID: "img0", Architecture: "amd64"}},
+				},
+			},
+		}
+		sub := newTestController(log, config.ImageScan{
+			SyncStateBatchSize:   2,
+			SyncStateConcurrency: 2,
+		})
+		sub.client = client
+		for i := 0; i < 5; i++ {
+			img := newImage()
+			img.id = fmt.Sprintf("img%d", i)
+			img.name = img.id
+			img.architecture = "amd64"
+			img.key = img.id + "amd64" + img.name
+			sub.delta.images.set(img)
 		}
 
-		resMem := resource.MustParse("500Mi")
-		resCpu := resource.MustParse("2")
-
-		lessResMem := resource.MustParse("400Mi")
-		lessResCpu := resource.MustParse("1")
+		sub.syncFromRemoteState(ctx)
 
-		controller := newTestController(log, cfg)
-		controller.delta.nodes = map[string]*node{
-			"node1": {
-				name:           "node1",
-				architecture:   defaultImageArch,
-				os:             defaultImageOs,
-				allocatableMem: resMem.AsDec(),
-				allocatableCPU: resCpu.AsDec(),
-				castaiManaged:  true,
-			},
-			"node2": {
-				name:           "node2",
-				architecture:   defaultImageArch,
-				os:             defaultImageOs,
-				allocatableMem: lessResMem.AsDec(),
-				allocatableCPU: lessResCpu.AsDec(),
-				castaiManaged:  true,
-			},
+		filters := client.getSyncStateFilters()
+		r.Len(filters, 3)
+		r.ElementsMatch([]int{2, 2, 1}, lo.Map(filters, func(f *castai.SyncStateFilter, _ int) int { return len(f.ImagesIds) }))
+		r.ElementsMatch([]string{"img0", "img1", "img2", "img3", "img4"}, lo.FlatMap(filters, func(f *castai.SyncStateFilter, _ int) []string { return f.ImagesIds }))
+		for _, img := range sub.delta.getImages() {
+			r.False(img.lastRemoteSyncAt.IsZero())
 		}
+		img0, _ := sub.delta.images.get("img0amd64img0")
+		r.True(img0.scanned)
 
-		img := &image{
-			key: "img1amd64img",
-			nodes: map[string]*imageNode{
-				"node1": {},
-				"node2": {},
-			},
-			lastScanErr: errImageScanLayerNotFound,
+		// Images are requested in a single call below batch size.
+		client = &mockCastaiClient{}
+		sub.client = client
+		sub.cfg.SyncStateBatchSize = 10
+		sub.timeGetter = func() time.Time {
+			return time.Now().UTC().Add(time.Hour)
 		}
+		sub.syncFromRemoteState(ctx)
+		r.Len(client.getSyncStateFilters(), 1)
+	})
 
+	t.Run("sync remote state after configured interval", func(t *testing.T) {
 		r := require.New(t)
-		node, mode, err := controller.findBestNodeAndMode(img)
-		r.NoError(err)
-		r.Equal(string(imgcollectorconfig.ModeRemote), mode)
-		r.Equal("node1", node)
-	})
 
-	t.Run("fallbacks when no cast ai managed nodes", func(t *testing.T) {
-		cfg := config.ImageScan{
-			Mode:          string(imgcollectorconfig.ModeHostFS),
-			CPURequest:    "1",
-			MemoryRequest: "100Mi",
+		client := &mockCastaiClient{
+			syncState: &castai.SyncStateResponse{Images: &castai.ImagesSyncState{}},
 		}
+		sub := newTestController(log, config.ImageScan{
+			SyncStateInterval: 30 * time.Minute,
+		})
+		sub.client = client
+		now := time.Now().UTC()
+		sub.timeGetter = func() time.Time { return now }
+		img := newImage()
+		img.id = "img"
+		img.name = "img"
+		img.architecture = "amd64"
+		img.key = "imgamd64img"
+		sub.delta.images.set(img)
 
-		resMem := resource.MustParse("500Mi")
-		resCpu := resource.MustParse("2")
+		sub.syncFromRemoteState(ctx)
+		r.Len(client.getSyncStateFilters(), 1)
 
-		lessResMem := resource.MustParse("400Mi")
-		lessResCpu := resource.MustParse("1")
+		// Default 10 minutes interval is overridden by config.
+		now = now.Add(20 * time.Minute)
+		sub.syncFromRemoteState(ctx)
+		r.Len(client.getSyncStateFilters(), 1)
 
-		controller := newTestController(log, cfg)
-		controller.delta.nodes = map[string]*node{
-			"node1": {
-				name:           "node1",
-				architecture:   defaultImageArch,
-				os:             defaultImageOs,
-				allocatableMem: resMem.AsDec(),
-				allocatableCPU: resCpu.AsDec(),
-				castaiManaged:  false,
-			},
-			"node2": {
-				name:           "node2",
-				architecture:   defaultImageArch,
-				os:             defaultImageOs,
-				allocatableMem: lessResMem.AsDec(),
-				allocatableCPU: lessResCpu.AsDec(),
-				castaiManaged:  false,
-			},
-		}
+		now = now.Add(11 * time.Minute)
+		sub.syncFromRemoteState(ctx)
+		r.Len(client.getSyncStateFilters(), 2)
+	})
 
-		img := &image{
-			key: "img1amd64img",
-			nodes: map[string]*imageNode{
-				"node1": {},
-				"node2": {},
+	t.Run("report max severity of workload images", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &mockCastaiClient{
+			syncState: &castai.SyncStateResponse{
+				Images: &castai.ImagesSyncState{
+					ScannedImages: []castai.ScannedImage{
+						{ID: "nginx", Architecture: "amd64", Severity: castai.SeverityMedium},
+						{ID: "sidecar", Architecture: "amd64", Severity: castai.SeverityCritical},
+						{ID: "redis", Architecture: "amd64", Severity: castai.SeverityLow},
+					},
+				},
 			},
 		}
+		sub := newTestController(log, config.ImageScan{})
+		sub.client = client
+		addImage := func(id string, owners ...string) {
+			img := newImage()
+			img.id = id
+			img.name = id
+			img.architecture = "amd64"
+			img.key = id + "amd64" + id
+			for _, owner := range owners {
+				img.owners[owner] = &imageOwner{}
+			}
+			sub.delta.images.set(img)
+		}
+		addImage("nginx", "web")
+		addImage("sidecar", "web", "db")
+		addImage("redis", "cache")
+		// Not scanned images are not included in rollup.
+		addImage("postgres", "db", "batch")
+
+		sub.syncFromRemoteState(ctx)
+		r.NoError(sub.updateImageStatuses(ctx))
+
+		changes := client.getImagesResourcesChanges()
+		r.Len(changes, 1)
+		r.Equal([]castai.WorkloadSeverity{
+			{ResourceID: "cache", Severity: castai.SeverityLow, ImageIDs: []string{"redis"}},
+			{ResourceID: "db", Severity: castai.SeverityCritical, ImageIDs: []string{"sidecar"}},
+			{ResourceID: "web", Severity: castai.SeverityCritical, ImageIDs: []string{"nginx", "sidecar"}},
+		}, changes[0].Workloads)
+	})
 
+	t.Run("sync severity of scanned images only if remote supports it", func(t *testing.T) {
 		r := require.New(t)
-		node, mode, err := controller.findBestNodeAndMode(img)
-		r.NoError(err)
+
+		client := &mockCastaiClient{
+			syncState: &castai.SyncStateResponse{
+				Images: &castai.ImagesSyncState{},
+			},
+		}
+		sub := newTestController(log, config.ImageScan{})
+		sub.client = client
+		now := time.Now().UTC()
+		sub.timeGetter = func() time.Time { return now }
+		img := newImage()
+		img.id = "img"
+		img.name = "img"
+		img.architecture = "amd64"
+		img.key = "imgamd64img"
+		img.scanned = true
+		sub.delta.images.set(img)
+		pending := newImage()
+		pending.id = "pending"
+		pending.name = "pending"
+		pending.architecture = "amd64"
+		pending.key = "pendingamd64pending"
+		sub.delta.images.set(pending)
+
+		sub.syncFromRemoteState(ctx)
+		r.Equal([]string{"pending"}, client.getSyncStateFilters()[0].ImagesIds)
+
+		// Remote supports severity once it returns severity of any scanned image.
+		client.syncState.Images.ScannedImages = []castai.ScannedImage{
+			{ID: "other", Architecture: "amd64", Severity: castai.SeverityHigh},
+		}
+		now = now.Add(11 * time.Minute)
+		sub.syncFromRemoteState(ctx)
+		r.Equal([]string{"pending"}, client.getSyncStateFilters()[1].ImagesIds)
+
+		now = now.Add(11 * time.Minute)
+		sub.syncFromRemoteState(ctx)
+		r.ElementsMatch([]string{"img", "pending"}, client.getSyncStateFilters()[2].ImagesIds)
+	})
+
+	t.Run("process deltas while image scan is running", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg := config.ImageScan{
+			ScanInterval:       1 * time.Millisecond,
+			ScanTimeout:        time.Minute,
+			MaxConcurrentScans: 5,
+			CPURequest:         "500m",
+			CPULimit:           "2",
+			MemoryRequest:      "100Mi",
+			MemoryLimit:        "2Gi",
+		}
+
+		scanner := &blockingImageScanner{
+			started: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		sub := newTestController(log, cfg)
+		sub.imageScanner = scanner
+		sub.initialScansDelay = 1 * time.Millisecond
+
+		node1 := createNode("n1")
+		node2 := createNode("n2")
+		sub.OnAdd(node1)
+		sub.OnAdd(node2)
+		sub.OnAdd(newTestPod("nginx", "nginx:1.23", node1.Name))
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- sub.Run(ctx)
+		}()
+
+		select {
+		case <-scanner.started:
+		case err := <-errc:
+			t.Fatal(err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for image scan")
+		}
+
+		// Scan is blocked, new deltas should still be applied.
+		for i := 0; i < 100; i++ {
+			sub.OnUpdate(newTestPod("redis", "redis:7", node2.Name))
+		}
+		assertLoop(errc, func() bool {
+			sub.delta.mu.Lock()
+			defer sub.delta.mu.Unlock()
+			return sub.delta.images.len() == 2
+		})
+
+		close(scanner.release)
+		assertLoop(errc, func() bool {
+			sub.delta.mu.Lock()
+			defer sub.delta.mu.Unlock()
+			for _, img := range sub.delta.getImages() {
+				if !img.scanned {
+					return false
+				}
+			}
+			return true
+		})
+		r.GreaterOrEqual(scanner.getScansCount(), 2)
+	})
+
+	t.Run("apply deltas of the same object in order with concurrent workers", func(t *testing.T) {
+		r := require.New(t)
+
+		sub := newTestController(log, config.ImageScan{DeltaWorkers: 4})
+		r.Len(sub.delta.queues, 4)
+		sub.handleDelta(kube.EventAdd, createNode("n1"))
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var wg sync.WaitGroup
+		sub.startDeltaConsumers(ctx, &wg)
+
+		// Pods are added and deleted repeatedly, even pods end up running while odd pods end up deleted.
+		const podsCount = 50
+		var expectedImages []string
+		for step := 0; step < 10; step++ {
+			for i := 0; i < podsCount; i++ {
+				pod := newTestPod(fmt.Sprintf("app%d", i), fmt.Sprintf("app%d:v1", i), "n1")
+				if step%2 == i%2 {
+					sub.OnDelete(pod)
+				} else {
+					sub.OnAdd(pod)
+				}
+				if step == 9 && i%2 == 0 {
+					expectedImages = append(expectedImages, fmt.Sprintf("app%d:v1", i))
+				}
+			}
+		}
+
+		r.Eventually(func() bool {
+			for _, queue := range sub.delta.queues {
+				if len(queue) > 0 {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+		wg.Wait()
+
+		usedImages := lo.Filter(sub.delta.getImages(), func(img *image, _ int) bool { return img.hasPods() })
+		r.ElementsMatch(expectedImages, lo.Map(usedImages, func(img *image, _ int) string { return img.name }))
+	})
+
+	t.Run("warm up delta before first scan", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg := config.ImageScan{
+			ScanInterval:       1 * time.Millisecond,
+			ScanTimeout:        time.Minute,
+			MaxConcurrentScans: 5,
+			CPURequest:         "500m",
+			CPULimit:           "2",
+			MemoryRequest:      "100Mi",
+			MemoryLimit:        "2Gi",
+		}
+
+		node1 := createNode("n1")
+		node2 := createNode("n2")
+		client := &mockCastaiClient{}
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		sub := newTestController(log, cfg)
+		sub.client = client
+		sub.imageScanner = scanner
+		sub.initialScansDelay = 0
+		// Objects are only in informers cache, no events are received.
+		sub.kubeController = &mockKubeController{
+			objects: map[reflect.Type][]kube.Object{
+				reflect.TypeOf(&corev1.Pod{}): {
+					newTestPod("nginx", "nginx:1.23", node1.Name),
+					newTestPod("redis", "redis:7", node2.Name),
+				},
+				reflect.TypeOf(&corev1.Node{}): {node1, node2},
+			},
+		}
+		sub.delta.kubeController = sub.kubeController
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- sub.Run(ctx)
+		}()
+
+		assertLoop(errc, func() bool {
+			changes := client.getImagesResourcesChanges()
+			if len(changes) == 0 {
+				return false
+			}
+			// First full snapshot contains all images.
+			r.Len(changes[0].Images, 2)
+			return true
+		})
+	})
+
+	t.Run("consume informer events while delta is warming up", func(t *testing.T) {
+		r := require.New(t)
+
+		sub := newTestController(log, config.ImageScan{ScanInterval: time.Hour})
+		sub.initialScansDelay = time.Hour
+		listBlock := make(chan struct{})
+		defer close(listBlock)
+		sub.kubeController = &mockKubeController{listBlock: listBlock}
+		sub.delta.kubeController = sub.kubeController
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			_ = sub.Run(ctx)
+		}()
+
+		// More events than queue capacity are enqueued while warm up is blocked.
+		enqueued := make(chan struct{})
+		go func() {
+			defer close(enqueued)
+			node := createNode("n1")
+			for i := 0; i < 2000; i++ {
+				sub.OnUpdate(node)
+			}
+		}()
+		select {
+		case <-enqueued:
+		case <-time.After(5 * time.Second):
+			r.Fail("informer events blocked by delta warm up")
+		}
+	})
+
+	t.Run("back off scan interval while idle", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg := config.ImageScan{
+			ScanInterval:        time.Second,
+			MaxIdleScanInterval: 5 * time.Second,
+			ScanTimeout:         time.Minute,
+			MaxConcurrentScans:  5,
+			CPURequest:          "500m",
+			CPULimit:            "2",
+			MemoryRequest:       "100Mi",
+			MemoryLimit:         "2Gi",
+		}
+
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(nil)
+		sub := newTestController(log, cfg)
+		sub.imageScanner = scanner
+
+		// Interval grows while no images are pending.
+		for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second} {
+			r.NoError(sub.scheduleScans(ctx))
+			r.Equal(expected, sub.scanInterval)
+		}
+
+		node := createNode("n1")
+		sub.handleDelta(kube.EventAdd, node)
+		sub.handleDelta(kube.EventAdd, newTestPod("nginx", "nginx:1.23", node.Name))
+		select {
+		case <-sub.delta.newImages:
+		default:
+			t.Fatal("expected new image signal")
+		}
+
+		// Interval is reset once new image is pending.
+		r.NoError(sub.scheduleScans(ctx))
+		r.Equal(cfg.ScanInterval, sub.scanInterval)
+		r.Len(scanner.getScanImageParams(), 1)
+
+		r.NoError(sub.scheduleScans(ctx))
+		r.Equal(2*time.Second, sub.scanInterval)
+	})
+}
+
+func newTestPod(name, imageName, nodeName string) *corev1.Pod {
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       types.UID(name),
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+			Containers: []corev1.Container{
+				{
+					Name:  name,
+					Image: imageName,
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: name, ImageID: imageName + "@sha256", ContainerID: "containerd://sha256"},
+			},
+		},
+	}
+}
+
+func TestImageScanCoverage(t *testing.T) {
+	r := require.New(t)
+	delta := newTestDelta()
+
+	addImage := func(id string, scanned bool, failures int, owners ...string) {
+		img := newImage()
+		img.id = id
+		img.key = id
+		img.scanned = scanned
+		img.failures = failures
+		for _, owner := range owners {
+			img.owners[owner] = &imageOwner{}
+		}
+		delta.images.set(img)
+	}
+	r.Equal(float64(1), imageScanCoverage(delta.getImages()))
+
+	addImage("scanned1", true, 0, "r1")
+	addImage("scanned2", true, 0)
+	addImage("pending", false, 0, "r2")
+	addImage("failed", false, 2, "r3")
+	// Unused not scanned image is not counted.
+	addImage("unused", false, 0)
+
+	r.Equal(0.5, imageScanCoverage(delta.getImages()))
+}
+
+func TestController_findBestNodeAndMode(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	t.Run("fallbacks when img had error", func(t *testing.T) {
+		cfg := config.ImageScan{
+			Mode:          string(imgcollectorconfig.ModeHostFS),
+			CPURequest:    "1",
+			MemoryRequest: "100Mi",
+		}
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+
+		lessResMem := resource.MustParse("400Mi")
+		lessResCpu := resource.MustParse("1")
+
+		controller := newTestController(log, cfg)
+		controller.delta.nodes = map[string]*node{
+			"node1": {
+				name:           "node1",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: resMem.AsDec(),
+				allocatableCPU: resCpu.AsDec(),
+				castaiManaged:  true,
+			},
+			"node2": {
+				name:           "node2",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: lessResMem.AsDec(),
+				allocatableCPU: lessResCpu.AsDec(),
+				castaiManaged:  true,
+			},
+		}
+
+		img := &image{
+			key: "img1amd64img",
+			nodes: map[string]*imageNode{
+				"node1": {},
+				"node2": {},
+			},
+			lastScanErr: errImageScanLayerNotFound,
+		}
+
+		r := require.New(t)
+		node, mode, err := controller.findBestNodeAndMode(img)
+		r.NoError(err)
 		r.Equal(string(imgcollectorconfig.ModeRemote), mode)
 		r.Equal("node1", node)
+		r.Equal(scanModeFallbackLayerNotFound, img.scanModeFallback)
+	})
+
+	t.Run("re-enables hostfs after cooldown", func(t *testing.T) {
+		r := require.New(t)
+		controller := newTestController(log, config.ImageScan{
+			Mode:                  string(imgcollectorconfig.ModeHostFS),
+			HostFSDisableCooldown: time.Hour,
+		})
+
+		img := newImage()
+		img.key = "img1amd64img"
+		img.name = "nginx:1.23"
+		controller.delta.images.set(img)
+		controller.delta.setImageScanError(img, errImageScanLayerNotFound, controller.timeGetter())
+		r.Equal(string(imgcollectorconfig.ModeRemote), controller.preferredScanMode(img))
+
+		now := time.Now().UTC()
+		controller.timeGetter = func() time.Time {
+			return now.Add(time.Hour + time.Minute)
+		}
+		r.Equal(string(imgcollectorconfig.ModeHostFS), controller.preferredScanMode(img))
+	})
+
+	t.Run("fallbacks when no cast ai managed nodes", func(t *testing.T) {
+		cfg := config.ImageScan{
+			Mode:          string(imgcollectorconfig.ModeHostFS),
+			CPURequest:    "1",
+			MemoryRequest: "100Mi",
+		}
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+
+		lessResMem := resource.MustParse("400Mi")
+		lessResCpu := resource.MustParse("1")
+
+		controller := newTestController(log, cfg)
+		controller.delta.nodes = map[string]*node{
+			"node1": {
+				name:           "node1",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: resMem.AsDec(),
+				allocatableCPU: resCpu.AsDec(),
+				castaiManaged:  false,
+			},
+			"node2": {
+				name:           "node2",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: lessResMem.AsDec(),
+				allocatableCPU: lessResCpu.AsDec(),
+				castaiManaged:  false,
+			},
+		}
+
+		img := &image{
+			key: "img1amd64img",
+			nodes: map[string]*imageNode{
+				"node1": {},
+				"node2": {},
+			},
+		}
+
+		r := require.New(t)
+		node, mode, err := controller.findBestNodeAndMode(img)
+		r.NoError(err)
+		r.Equal(string(imgcollectorconfig.ModeRemote), mode)
+		r.Equal("node1", node)
+		r.Equal(scanModeFallbackNoManagedNodes, img.scanModeFallback)
 	})
 
 	t.Run("fallbacks when no resources on cast ai managed nodes", func(t *testing.T) {
@@ -827,6 +1514,7 @@ func TestController_findBestNodeAndMode(t *testing.T) {
 		r.NoError(err)
 		r.Equal(string(imgcollectorconfig.ModeRemote), mode)
 		r.Equal("node1", node)
+		r.Equal(scanModeFallbackNoCandidates, img.scanModeFallback)
 	})
 
 	t.Run("picks correct node", func(t *testing.T) {
@@ -875,6 +1563,258 @@ func TestController_findBestNodeAndMode(t *testing.T) {
 		r.NoError(err)
 		r.Equal(string(imgcollectorconfig.ModeHostFS), mode)
 		r.Equal("node1", node)
+		r.Empty(img.scanModeFallback)
+	})
+
+	t.Run("fallbacks when scan node pool node misses image", func(t *testing.T) {
+		r := require.New(t)
+		cfg := config.ImageScan{
+			Mode:          string(imgcollectorconfig.ModeHostFS),
+			CPURequest:    "1",
+			MemoryRequest: "100Mi",
+			NodePool: config.ImageScanNodePool{
+				NodeSelector: map[string]string{"pool": "scan"},
+			},
+		}
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+
+		controller := newTestController(log, cfg)
+		controller.delta.nodes = map[string]*node{
+			"node1": {
+				name:           "node1",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: resMem.AsDec(),
+				allocatableCPU: resCpu.AsDec(),
+				castaiManaged:  true,
+				labels:         map[string]string{"pool": "scan"},
+			},
+			"node2": {
+				name:           "node2",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: resMem.AsDec(),
+				allocatableCPU: resCpu.AsDec(),
+				castaiManaged:  true,
+			},
+		}
+
+		img := &image{
+			key: "img1amd64img",
+			nodes: map[string]*imageNode{
+				"node2": {},
+			},
+		}
+
+		node, mode, err := controller.findBestNodeAndMode(img)
+		r.NoError(err)
+		r.Equal(string(imgcollectorconfig.ModeRemote), mode)
+		r.Equal("node1", node)
+		r.Equal(scanModeFallbackPoolMissesImage, img.scanModeFallback)
+	})
+
+	t.Run("uses registry scan mode override", func(t *testing.T) {
+		cfg := config.ImageScan{
+			Mode:          string(imgcollectorconfig.ModeRemote),
+			CPURequest:    "1",
+			MemoryRequest: "100Mi",
+			RegistryModes: map[string]string{
+				"registry.local:5000": string(imgcollectorconfig.ModeHostFS),
+			},
+		}
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+
+		controller := newTestController(log, cfg)
+		controller.delta.nodes = map[string]*node{
+			"node1": {
+				name:           "node1",
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: resMem.AsDec(),
+				allocatableCPU: resCpu.AsDec(),
+				castaiManaged:  true,
+			},
+		}
+
+		r := require.New(t)
+		_, mode, err := controller.findBestNodeAndMode(&image{
+			name:  "registry.local:5000/team/app:v1",
+			nodes: map[string]*imageNode{"node1": {}},
+		})
+		r.NoError(err)
+		r.Equal(string(imgcollectorconfig.ModeHostFS), mode)
+
+		// Images from other registries use global mode.
+		_, mode, err = controller.findBestNodeAndMode(&image{
+			name:  "nginx:1.25",
+			nodes: map[string]*imageNode{"node1": {}},
+		})
+		r.NoError(err)
+		r.Equal(string(imgcollectorconfig.ModeRemote), mode)
+	})
+
+	t.Run("record events for failed image scan", func(t *testing.T) {
+		r := require.New(t)
+
+		cfg := config.ImageScan{
+			ScanTimeout:   time.Minute,
+			CPURequest:    "500m",
+			MemoryRequest: "100Mi",
+		}
+
+		scanner := &mockImageScanner{}
+		scanner.On("ScanImage", mock.Anything, mock.Anything).Return(errors.New("failed"))
+		recorder := record.NewFakeRecorder(10)
+		sub := newTestController(log, cfg)
+		sub.imageScanner = scanner
+		sub.eventRecorder = recorder
+
+		img := newImage()
+		img.name = "img"
+		img.id = "img1"
+		img.key = "img1amd64img"
+		img.architecture = defaultImageArch
+		img.nodes = map[string]*imageNode{
+			"node1": {},
+		}
+		img.owners = map[string]*imageOwner{
+			"r1": {pod: &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "app-1"}},
+		}
+		sub.delta.images.set(img)
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+		sub.delta.nodes["node1"] = &node{
+			name:           "node1",
+			allocatableMem: resMem.AsDec(),
+			allocatableCPU: resCpu.AsDec(),
+			pods:           map[types.UID]*pod{},
+			architecture:   defaultImageArch,
+			os:             defaultImageOs,
+		}
+
+		r.NoError(sub.scanImages(context.Background(), []*image{img}))
+		r.Len(recorder.Events, 2)
+		r.Equal("Normal ImageScanScheduled Image img scan scheduled", <-recorder.Events)
+		r.Equal("Warning ImageScanFailed Image img scan failed: failed", <-recorder.Events)
+	})
+
+	t.Run("limits remote and hostfs scans independently", func(t *testing.T) {
+		cfg := config.ImageScan{
+			Mode:                     string(imgcollectorconfig.ModeHostFS),
+			CPURequest:               "1",
+			MemoryRequest:            "100Mi",
+			MaxConcurrentScans:       2,
+			MaxConcurrentRemoteScans: 3,
+			RegistryModes: map[string]string{
+				"gcr.io": string(imgcollectorconfig.ModeRemote),
+			},
+		}
+
+		resMem := resource.MustParse("500Mi")
+		resCpu := resource.MustParse("2")
+
+		controller := newTestController(log, cfg)
+		controller.delta.nodes = map[string]*node{}
+		for _, name := range []string{"node1", "node2"} {
+			controller.delta.nodes[name] = &node{
+				name:           name,
+				architecture:   defaultImageArch,
+				os:             defaultImageOs,
+				allocatableMem: resMem.AsDec(),
+				allocatableCPU: resCpu.AsDec(),
+				castaiManaged:  true,
+			}
+		}
+
+		var pending []*image
+		for i := 0; i < 5; i++ {
+			pending = append(pending,
+				&image{name: fmt.Sprintf("nginx:1.%d", i), nodes: map[string]*imageNode{"node1": {}}},
+				&image{name: fmt.Sprintf("gcr.io/team/app:v%d", i), nodes: map[string]*imageNode{"node1": {}}},
+			)
+		}
+
+		r := require.New(t)
+		selected := controller.selectImagesForScan(pending)
+		modes := lo.CountValuesBy(selected, func(img *image) string {
+			return controller.preferredScanMode(img)
+		})
+		r.Equal(map[string]int{
+			string(imgcollectorconfig.ModeHostFS): 2,
+			string(imgcollectorconfig.ModeRemote): 3,
+		}, modes)
+
+		// All scans share common limit if separate remote limit is not set.
+		controller.cfg.MaxConcurrentRemoteScans = 0
+		r.Len(controller.selectImagesForScan(pending), 2)
+	})
+
+	t.Run("limit concurrent scans per registry", func(t *testing.T) {
+		r := require.New(t)
+		controller := newTestController(log, config.ImageScan{
+			MaxConcurrentScans:            5,
+			PerRegistryMaxConcurrentScans: 2,
+		})
+		controller.delta.nodes = map[string]*node{"node1": {name: "node1"}, "node2": {name: "node2"}}
+
+		var pending []*image
+		for i := 0; i < 5; i++ {
+			pending = append(pending, &image{name: fmt.Sprintf("registry.local/team/app%d:v1", i)})
+		}
+		pending = append(pending,
+			&image{name: "nginx:1.25"},
+			&image{name: "gcr.io/team/app:v1"},
+			&image{name: "quay.io/team/app:v1"},
+		)
+
+		selected := controller.selectImagesForScan(pending)
+		r.Len(selected, 5)
+		r.Equal(map[string]int{
+			"registry.local": 2,
+			"docker.io":      1,
+			"gcr.io":         1,
+			"quay.io":        1,
+		}, lo.CountValuesBy(selected, func(img *image) string {
+			return imageRegistry(img.name)
+		}))
+	})
+
+	t.Run("sample configured fraction of images", func(t *testing.T) {
+		r := require.New(t)
+		controller := newTestController(log, config.ImageScan{
+			Sampling: config.ImageScanSampling{Percent: 30},
+		})
+
+		// Image with index i is used by i+1 workloads, so images with higher index have higher priority.
+		for i := 0; i < 10; i++ {
+			img := newImage()
+			img.key = fmt.Sprintf("img%d", i)
+			img.name = fmt.Sprintf("nginx:1.%d", i)
+			for j := 0; j <= i; j++ {
+				img.owners[fmt.Sprintf("owner%d", j)] = &imageOwner{}
+			}
+			img.scanned = i == 9
+			controller.delta.images.set(img)
+		}
+		// Images without owners are not scanned.
+		unused := newImage()
+		unused.key = "unused"
+		controller.delta.images.set(unused)
+
+		sampled := sampleImages(controller.cfg.Sampling, controller.delta.getImages())
+		r.ElementsMatch([]string{"img7", "img8", "img9"}, lo.Keys(sampled))
+
+		pending := controller.findPendingImages()
+		r.ElementsMatch([]string{"img7", "img8"}, lo.Map(pending, func(v *image, _ int) string { return v.key }))
+
+		// Max images limits sample further.
+		controller.cfg.Sampling.MaxImages = 1
+		r.Empty(controller.findPendingImages())
 	})
 }
 
@@ -882,7 +1822,7 @@ func newTestController(log logrus.FieldLogger, cfg config.ImageScan) *Controller
 	scanner := &mockImageScanner{}
 	client := &mockCastaiClient{}
 	podOwnerGetter := &mockKubeController{}
-	return NewController(log, cfg, scanner, client, 21, podOwnerGetter)
+	return NewController(log, cfg, scanner, client, 21, podOwnerGetter, &record.FakeRecorder{}, nil)
 }
 
 type mockImageScanner struct {
@@ -904,7 +1844,42 @@ func (m *mockImageScanner) getScanImageParams() []ScanImageParams {
 	return m.imgs
 }
 
+// blockingImageScanner blocks all scans until release is closed.
+type blockingImageScanner struct {
+	started chan struct{}
+	release chan struct{}
+	scans   atomic.Int32
+}
+
+func (m *blockingImageScanner) ScanImage(ctx context.Context, cfg ScanImageParams) error {
+	m.scans.Add(1)
+	select {
+	case m.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *blockingImageScanner) getScansCount() int {
+	return int(m.scans.Load())
+}
+
 type mockKubeController struct {
+	objects map[reflect.Type][]kube.Object
+	// listBlock blocks listing objects until it is closed.
+	listBlock chan struct{}
+}
+
+func (m *mockKubeController) ListObjects(typ reflect.Type) ([]kube.Object, error) {
+	if m.listBlock != nil {
+		<-m.listBlock
+	}
+	return m.objects[typ], nil
 }
 
 func (m *mockKubeController) GetKvisorImageDetails() (kube.KvisorImageDetails, bool) {
@@ -924,8 +1899,9 @@ type mockCastaiClient struct {
 
 	imagesResourcesChanges []*castai.UpdateImagesStatusRequest
 
-	syncState      *castai.SyncStateResponse
-	syncStateCalls int
+	syncState        *castai.SyncStateResponse
+	syncStateCalls   int
+	syncStateFilters []*castai.SyncStateFilter
 }
 
 func (m *mockCastaiClient) UpdateImageStatus(ctx context.Context, report *castai.UpdateImagesStatusRequest) error {
@@ -939,6 +1915,7 @@ func (m *mockCastaiClient) GetSyncState(ctx context.Context, filter *castai.Sync
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.syncStateCalls++
+	m.syncStateFilters = append(m.syncStateFilters, filter)
 	if m.syncState != nil {
 		return m.syncState, nil
 	}
@@ -952,6 +1929,12 @@ func (m *mockCastaiClient) SendImageMetadata(ctx context.Context, meta *castai.I
 	return nil
 }
 
+func (m *mockCastaiClient) getSyncStateFilters() []*castai.SyncStateFilter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.syncStateFilters
+}
+
 func (m *mockCastaiClient) getSentMetas() []*castai.ImageMetadata {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -2,18 +2,31 @@ package imagescan
 
 import (
 	"errors"
+	"hash/fnv"
+	"math"
+	"path"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
 	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/inf.v0"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
 	"github.com/castai/kvisor/kube"
 )
 
@@ -24,30 +37,55 @@ var (
 const defaultImageOs = "linux"
 const defaultImageArch = "amd64"
 
+// Optional pod annotations which CI pipelines can set on workloads to link images to their source.
+const (
+	annotationBuildRepository = "kvisor.cast.ai/build-repository"
+	annotationBuildCommit     = "kvisor.cast.ai/build-commit"
+	annotationBuildURL        = "kvisor.cast.ai/build-url"
+)
+
 type kubeController interface {
 	GetPodOwnerID(pod *corev1.Pod) string
 	GetKvisorImageDetails() (kube.KvisorImageDetails, bool)
+	ListObjects(typ reflect.Type) ([]kube.Object, error)
 }
 
 func newImage() *image {
 	return &image{
-		owners:  map[string]*imageOwner{},
-		nodes:   map[string]*imageNode{},
-		scanned: false,
-		retryBackoff: wait.Backoff{
-			Duration: time.Second * 60,
-			Factor:   3,
-			Steps:    8,
-		},
+		owners:       map[string]*imageOwner{},
+		nodes:        map[string]*imageNode{},
+		scanned:      false,
+		retryBackoff: newRetryBackoff(),
+	}
+}
+
+func newRetryBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: time.Second * 60,
+		Factor:   3,
+		// Steps only limit backoff growth. Once cap is reached image is retried every cap interval.
+		Steps: math.MaxInt32,
+		Cap:   6 * time.Hour,
+		// Jitter spreads retries of images which failed at the same time, eg. during registry outage.
+		Jitter: 0.2,
 	}
 }
 
-func newDeltaState(kubeController kubeController) *deltaState {
+func newDeltaState(kubeController kubeController, nodeSelector map[string]string) *deltaState {
 	return &deltaState{
+		log:            logrus.New(),
 		kubeController: kubeController,
-		queue:          make(chan deltaQueueItem, 1000),
-		images:         map[string]*image{},
+		nodeSelector:   labels.SelectorFromSet(nodeSelector),
+		queues:         newDeltaQueues(1),
+		newImages:      make(chan struct{}, 1),
+		images:         newMemoryImageStore(),
 		nodes:          make(map[string]*node),
+		pullErrors:     make(map[imagePullErrorKey]*imagePullError),
+		pendingPods:    make(map[string]map[types.UID]*corev1.Pod),
+		defaultPlatform: platform{
+			architecture: defaultImageArch,
+			os:           defaultImageOs,
+		},
 	}
 }
 
@@ -57,16 +95,78 @@ type deltaQueueItem struct {
 }
 
 type deltaState struct {
+	log            logrus.FieldLogger
 	kubeController kubeController
 
-	// queue is informers received k8s objects but not yet applied to delta.
-	// This allows to have lock free access to delta state during image scan.
-	queue chan deltaQueueItem
+	// mu guards images and nodes. Deltas are applied on a separate goroutine while images are scanned.
+	mu sync.Mutex
+
+	// queues are informers received k8s objects but not yet applied to delta, sharded by object UID.
+	// Each queue is drained by a dedicated goroutine so informers are never blocked by image scans,
+	// while events of the same object are still applied in order.
+	queues []chan deltaQueueItem
+
+	// newImages is signaled when image not seen before is added, so idle scan cadence is reset.
+	newImages chan struct{}
 
 	// images holds current cluster images state. image struct contains associated nodes and owners.
-	images map[string]*image
+	images imageStore
 
 	nodes map[string]*node
+
+	// pendingPods holds running pods by node name until node object is received.
+	pendingPods map[string]map[types.UID]*corev1.Pod
+
+	// pullErrors holds images which pods failed to pull. Such images never get ImageID, so they are tracked separately.
+	pullErrors map[imagePullErrorKey]*imagePullError
+
+	// nodeSelector limits nodes which can be picked for image scan jobs.
+	nodeSelector labels.Selector
+
+	// nodeSelectionStrategy is one of config.NodeSelection* strategies. Least loaded node is picked by default.
+	nodeSelectionStrategy string
+	// lastSelectedNode is used by round-robin strategy to continue from the next node.
+	lastSelectedNode string
+
+	// ownerLabels and ownerAnnotations are pod metadata keys reported with image owners.
+	ownerLabels      []string
+	ownerAnnotations []string
+
+	// hostFSDisableCooldown is how long image is scanned only in remote mode after hostfs scan failed with missing layers.
+	// Config defaults it to 1h, zero cooldown re-enables hostfs scans immediately.
+	hostFSDisableCooldown time.Duration
+
+	// skipCrashLoopPods disables adding images from pods which are not in running phase due to crash looping containers.
+	skipCrashLoopPods bool
+
+	// excludedImages are image name patterns which are not added to delta, eg. pause containers.
+	excludedImages []string
+
+	// excludedNamespaces and includedNamespaces are namespace patterns which limit pods that images are added to delta.
+	// Pods in all namespaces are included if includedNamespaces is empty.
+	excludedNamespaces []string
+	includedNamespaces []string
+
+	// defaultPlatform is used for images of pods which node architecture is not known and images scanned
+	// without pods, eg. configured always scan images.
+	defaultPlatform platform
+}
+
+func newDeltaQueues(workers int) []chan deltaQueueItem {
+	queues := make([]chan deltaQueueItem, workers)
+	for i := range queues {
+		queues[i] = make(chan deltaQueueItem, 1000)
+	}
+	return queues
+}
+
+func (d *deltaState) enqueue(event kube.Event, o kube.Object) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(o.GetUID()))
+	d.queues[h.Sum32()%uint32(len(d.queues))] <- deltaQueueItem{
+		event: event,
+		obj:   o,
+	}
 }
 
 func (d *deltaState) upsert(o kube.Object) {
@@ -75,6 +175,17 @@ func (d *deltaState) upsert(o kube.Object) {
 		d.handlePodUpdate(v)
 	case *corev1.Node:
 		d.updateNodeUsage(v)
+	case *appsv1.Deployment:
+		d.upsertTemplateImages(v, v.Spec.Template, v.Spec.Replicas != nil && *v.Spec.Replicas == 0)
+	case *appsv1.StatefulSet:
+		d.upsertTemplateImages(v, v.Spec.Template, v.Spec.Replicas != nil && *v.Spec.Replicas == 0)
+	case *appsv1.DaemonSet:
+		d.upsertTemplateImages(v, v.Spec.Template, v.Status.DesiredNumberScheduled == 0)
+	case *batchv1.CronJob:
+		// Job pods are short-lived, so CronJob images are always added from template.
+		d.upsertTemplateImages(v, v.Spec.JobTemplate.Spec.Template, true)
+	case *batchv1beta1.CronJob:
+		d.upsertTemplateImages(v, v.Spec.JobTemplate.Spec.Template, true)
 	}
 }
 
@@ -84,6 +195,8 @@ func (d *deltaState) delete(o kube.Object) {
 		d.handlePodDelete(v)
 	case *corev1.Node:
 		d.handleNodeDelete(v)
+	case *appsv1.Deployment, *appsv1.StatefulSet, *appsv1.DaemonSet, *batchv1.CronJob, *batchv1beta1.CronJob:
+		d.releaseTemplateImages(string(v.GetUID()), nil)
 	}
 }
 
@@ -91,12 +204,40 @@ func (d *deltaState) handlePodUpdate(v *corev1.Pod) {
 	if v.Status.Phase == corev1.PodSucceeded {
 		d.handlePodDelete(v)
 	}
-	if v.Status.Phase == corev1.PodRunning {
+	if v.Status.Phase == corev1.PodRunning || (!d.skipCrashLoopPods && isPodCrashLooping(v)) {
 		d.upsertImages(v)
+	} else {
+		d.deletePendingPod(v)
 	}
+	d.updateImagePullErrors(v)
 	d.updateNodesUsageFromPod(v)
 }
 
+// podController returns controller reference of pod, or reference to pod itself if it's not managed by controller.
+func podController(pod *corev1.Pod) *metav1.OwnerReference {
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		return ref
+	}
+	return &metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// isPodCrashLooping returns true if any of pod containers is restarting in CrashLoopBackOff.
+// Pod phase may not be running in such case, eg. while init container is crash looping, but image is already pulled.
+func isPodCrashLooping(v *corev1.Pod) bool {
+	statuses := append(append([]corev1.ContainerStatus{}, v.Status.ContainerStatuses...), v.Status.InitContainerStatuses...)
+	for _, cs := range statuses {
+		if cs.ImageID != "" && cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *deltaState) updateNodeUsage(v *corev1.Node) {
 	n, ok := d.nodes[v.GetName()]
 	if !ok {
@@ -113,6 +254,73 @@ func (d *deltaState) updateNodeUsage(v *corev1.Node) {
 	}
 	n.allocatableMem = v.Status.Allocatable.Memory().AsDec()
 	n.allocatableCPU = v.Status.Allocatable.Cpu().AsDec()
+	n.unschedulable = isNodeUnschedulable(v)
+	n.notReady = isNodeNotReady(v)
+	n.spot = isSpotNode(v)
+	n.labels = v.GetLabels()
+	if arch := v.Status.NodeInfo.Architecture; arch != "" {
+		n.architecture = arch
+	}
+	if os := v.Status.NodeInfo.OperatingSystem; os != "" {
+		n.os = os
+	}
+
+	if pods, found := d.pendingPods[n.name]; found {
+		delete(d.pendingPods, n.name)
+		for _, pod := range pods {
+			d.upsertImages(pod)
+		}
+	}
+}
+
+// spotNodeLabels are labels set by cloud providers and autoscalers on spot or preemptible nodes.
+var spotNodeLabels = map[string]string{
+	"scheduling.cast.ai/spot":               "true",
+	"cloud.google.com/gke-spot":             "true",
+	"cloud.google.com/gke-preemptible":      "true",
+	"eks.amazonaws.com/capacityType":        "SPOT",
+	"karpenter.sh/capacity-type":            "spot",
+	"kubernetes.azure.com/scalesetpriority": "spot",
+}
+
+func isSpotNode(v *corev1.Node) bool {
+	for key, value := range spotNodeLabels {
+		if v.Labels[key] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// drainTaints are taints which are set on nodes that are being drained or removed.
+var drainTaints = []string{
+	corev1.TaintNodeUnschedulable,
+	"ToBeDeletedByClusterAutoscaler",
+	"DeletionCandidateOfClusterAutoscaler",
+	"karpenter.sh/disruption",
+}
+
+func isNodeUnschedulable(v *corev1.Node) bool {
+	if v.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range v.Spec.Taints {
+		if lo.Contains(drainTaints, taint.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNodeNotReady returns true if node reports Ready condition other than true. Nodes without
+// Ready condition are treated as ready.
+func isNodeNotReady(v *corev1.Node) bool {
+	for _, cond := range v.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status != corev1.ConditionTrue
+		}
+	}
+	return false
 }
 
 func (d *deltaState) updateNodesUsageFromPod(v *corev1.Pod) {
@@ -143,7 +351,17 @@ func (d *deltaState) updateNodesUsageFromPod(v *corev1.Pod) {
 }
 
 func (d *deltaState) upsertImages(pod *corev1.Pod) {
+	if d.isNamespaceExcluded(pod.Namespace) {
+		return
+	}
+	// Architecture is part of image cache key, so pod images are added only once pod node is received.
 	if _, found := d.nodes[pod.Spec.NodeName]; !found {
+		pods, found := d.pendingPods[pod.Spec.NodeName]
+		if !found {
+			pods = make(map[types.UID]*corev1.Pod)
+			d.pendingPods[pod.Spec.NodeName] = pods
+		}
+		pods[pod.UID] = pod
 		return
 	}
 	now := time.Now().UTC()
@@ -155,6 +373,7 @@ func (d *deltaState) upsertImages(pod *corev1.Pod) {
 	podID := string(pod.UID)
 	// Get the resource id of Deployment, ReplicaSet, StatefulSet, Job, CronJob.
 	ownerResourceID := d.kubeController.GetPodOwnerID(pod)
+	buildMetadata := getBuildMetadata(pod)
 
 	for _, cont := range containers {
 		cs, found := lo.Find(containerStatuses, func(v corev1.ContainerStatus) bool {
@@ -170,31 +389,71 @@ func (d *deltaState) upsertImages(pod *corev1.Pod) {
 			continue
 		}
 
+		ref := parseImageReference(cont.Image)
+		if imageMatchesPatterns(ref, d.excludedImages) {
+			continue
+		}
+
 		nodeName := pod.Spec.NodeName
-		platform := d.getPodPlatform(pod)
-		key := cs.ImageID + platform.architecture + cont.Image
-		img, found := d.images[key]
+		platform, platformKnown := d.getPodPlatform(pod)
+		ref = ref.withImageID(cs.ImageID)
+		key := d.images.cacheKey(cs.ImageID, platform.architecture, ref.name)
+		img, found := d.images.get(key)
 		if !found {
 			img = newImage()
-			img.name = cont.Image
+			img.name = ref.name
 			img.key = key
 			img.architecture = platform.architecture
 			img.os = platform.os
+			if !platformKnown {
+				d.log.Warnf("architecture of node %q is not known, adding image %s for %s", nodeName, img.name, platform.architecture)
+			}
+			d.deleteTemplateImages(img.name)
+			d.replaceAdmissionImages(img)
+			d.notifyNewImage()
+		}
+		if !img.hasPod(nodeName, podID) {
+			// Mutable tag could be re-pushed with new digest. New digest is stored as new image which
+			// is pending for scan, pod references are moved from previous digest.
+			d.releaseMutatedTagImages(img, cs.ImageID, podID, ownerResourceID, nodeName, now)
 		}
+		img.scanName = ref.scanName
 		img.id = cs.ImageID
 		img.containerRuntime = getContainerRuntime(cs.ContainerID)
+		if buildMetadata != nil {
+			img.buildMetadata = buildMetadata
+		}
+		img.lastSeenAt = now
 
 		// Upsert image owners.
-		if owner, found := img.owners[ownerResourceID]; found {
+		owner, found := img.owners[ownerResourceID]
+		if found {
 			owner.podIDs[podID] = struct{}{}
 		} else {
-			img.owners[ownerResourceID] = &imageOwner{
+			owner = &imageOwner{
 				podIDs: map[string]struct{}{
 					podID: {},
 				},
 			}
-			img.ownerChangedAt = now
+			img.owners[ownerResourceID] = owner
+			img.markOwnerChanged(now)
+		}
+		owner.namespace = pod.Namespace
+		owner.pod = &corev1.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			UID:        pod.UID,
 		}
+		owner.controller = podController(pod)
+		owner.containerName = cont.Name
+		// Owner metadata is taken from pods as pod template labels and annotations are usually inherited from owner.
+		owner.labels = lo.PickByKeys(pod.Labels, d.ownerLabels)
+		owner.annotations = lo.PickByKeys(pod.Annotations, d.ownerAnnotations)
+		owner.pullSecrets = lo.Map(pod.Spec.ImagePullSecrets, func(item corev1.LocalObjectReference, index int) types.NamespacedName {
+			return types.NamespacedName{Namespace: pod.Namespace, Name: item.Name}
+		})
 
 		// Upsert image nodes.
 		if imgNode, found := img.nodes[nodeName]; found {
@@ -206,17 +465,125 @@ func (d *deltaState) upsertImages(pod *corev1.Pod) {
 				},
 			}
 		}
-		d.images[key] = img
+		d.images.set(img)
+	}
+}
+
+// imagePullErrorReasons are container waiting reasons set by kubelet when image can't be pulled.
+var imagePullErrorReasons = []string{"ImagePullBackOff", "ErrImagePull"}
+
+func (d *deltaState) updateImagePullErrors(pod *corev1.Pod) {
+	podID := string(pod.UID)
+	if d.isNamespaceExcluded(pod.Namespace) {
+		d.deletePodImagePullErrors(podID)
+		return
+	}
+	platform, platformKnown := d.getPodPlatform(pod)
+	containers := pod.Spec.Containers
+	containers = append(containers, pod.Spec.InitContainers...)
+	containerStatuses := pod.Status.ContainerStatuses
+	containerStatuses = append(containerStatuses, pod.Status.InitContainerStatuses...)
+
+	for _, cont := range containers {
+		if cont.Image == "" {
+			continue
+		}
+		cs, found := lo.Find(containerStatuses, func(v corev1.ContainerStatus) bool {
+			return v.Name == cont.Name
+		})
+		if !found {
+			continue
+		}
+
+		name := cont.Image
+		key := imagePullErrorKey{architecture: platform.architecture, name: name}
+		if cs.State.Waiting == nil || !lo.Contains(imagePullErrorReasons, cs.State.Waiting.Reason) {
+			// Image was pulled or pod is not yet trying to pull it.
+			if pullErr, found := d.pullErrors[key]; found {
+				pullErr.removePod(podID)
+				if len(pullErr.pods) == 0 {
+					delete(d.pullErrors, key)
+				}
+			}
+			continue
+		}
+
+		pullErr, found := d.pullErrors[key]
+		if !found {
+			if !platformKnown {
+				d.log.Warnf("architecture of node %q is not known, reporting image %s pull error for %s", pod.Spec.NodeName, name, platform.architecture)
+			}
+			pullErr = &imagePullError{
+				name:         name,
+				architecture: platform.architecture,
+				pods:         map[string]imagePullErrorPod{},
+			}
+			d.pullErrors[key] = pullErr
+		}
+		if pullErr.reason != cs.State.Waiting.Reason || pullErr.message != cs.State.Waiting.Message {
+			pullErr.reason = cs.State.Waiting.Reason
+			pullErr.message = cs.State.Waiting.Message
+			pullErr.reported = false
+		}
+		if _, found := pullErr.pods[podID]; !found {
+			pullErr.pods[podID] = imagePullErrorPod{
+				ownerID:   d.kubeController.GetPodOwnerID(pod),
+				namespace: pod.Namespace,
+			}
+			pullErr.reported = false
+		}
+	}
+}
+
+func (d *deltaState) getImagePullErrors() []*imagePullError {
+	return lo.Values(d.pullErrors)
+}
+
+func (d *deltaState) deletePodImagePullErrors(podID string) {
+	for key, pullErr := range d.pullErrors {
+		pullErr.removePod(podID)
+		if len(pullErr.pods) == 0 {
+			delete(d.pullErrors, key)
+		}
+	}
+}
+
+// releaseMutatedTagImages removes pod references from images with the same name but different digest.
+func (d *deltaState) releaseMutatedTagImages(img *image, imageID, podID, ownerResourceID, nodeName string, now time.Time) {
+	for _, prev := range d.images.listByName(img.name) {
+		if prev.architecture != img.architecture || prev.id == imageID {
+			continue
+		}
+
+		if n, found := prev.nodes[nodeName]; found {
+			delete(n.podIDs, podID)
+			if len(n.podIDs) == 0 {
+				delete(prev.nodes, nodeName)
+			}
+		}
+		if owner, found := prev.owners[ownerResourceID]; found {
+			delete(owner.podIDs, podID)
+			if len(owner.podIDs) == 0 {
+				delete(prev.owners, ownerResourceID)
+				prev.markOwnerChanged(now)
+			}
+		}
+
+		if prev.isUnused() {
+			d.images.delete(prev.key)
+		}
 	}
 }
 
 func (d *deltaState) handlePodDelete(pod *corev1.Pod) {
 	now := time.Now().UTC()
-	for imgKey, img := range d.images {
-		if img.architecture != d.getPodPlatform(pod).architecture {
+	d.deletePodImagePullErrors(string(pod.UID))
+	d.deletePendingPod(pod)
+	for _, img := range d.images.list() {
+		if img.templateImage {
+			// Template images are owned by workloads, not by their pods.
 			continue
 		}
-
 		podID := string(pod.UID)
 		if n, found := img.nodes[pod.Spec.NodeName]; found {
 			delete(n.podIDs, podID)
@@ -227,12 +594,12 @@ func (d *deltaState) handlePodDelete(pod *corev1.Pod) {
 			delete(owner.podIDs, podID)
 			if len(owner.podIDs) == 0 {
 				delete(img.owners, ownerResourceID)
-				img.ownerChangedAt = now
+				img.markOwnerChanged(now)
 			}
 		}
 
-		if len(img.nodes) == 0 && len(img.owners) == 0 {
-			delete(d.images, imgKey)
+		if img.isUnused() {
+			d.images.delete(img.key)
 		}
 	}
 
@@ -242,39 +609,304 @@ func (d *deltaState) handlePodDelete(pod *corev1.Pod) {
 	}
 }
 
+func (d *deltaState) isNamespaceExcluded(namespace string) bool {
+	if len(d.includedNamespaces) > 0 && !namespaceMatchesPatterns(namespace, d.includedNamespaces) {
+		return true
+	}
+	return namespaceMatchesPatterns(namespace, d.excludedNamespaces)
+}
+
+func namespaceMatchesPatterns(namespace string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// setExcludedNamespaces updates excluded namespaces and removes already added pods of newly excluded namespaces.
+// Number of removed images is returned.
+func (d *deltaState) setExcludedNamespaces(patterns []string) int {
+	if reflect.DeepEqual(d.excludedNamespaces, patterns) {
+		return 0
+	}
+	d.excludedNamespaces = patterns
+
+	// Pods waiting for their node and pull errors are purged too, so they are not added or reported later.
+	for nodeName, pods := range d.pendingPods {
+		for uid, pod := range pods {
+			if d.isNamespaceExcluded(pod.Namespace) {
+				delete(pods, uid)
+			}
+		}
+		if len(pods) == 0 {
+			delete(d.pendingPods, nodeName)
+		}
+	}
+	for key, pullErr := range d.pullErrors {
+		for podID, pod := range pullErr.pods {
+			if d.isNamespaceExcluded(pod.namespace) {
+				pullErr.removePod(podID)
+			}
+		}
+		if len(pullErr.pods) == 0 {
+			delete(d.pullErrors, key)
+		}
+	}
+
+	now := time.Now().UTC()
+	var removed int
+	for _, img := range d.images.list() {
+		for ownerResourceID, owner := range img.owners {
+			if !d.isNamespaceExcluded(owner.namespace) {
+				continue
+			}
+			for nodeName, n := range img.nodes {
+				for podID := range owner.podIDs {
+					delete(n.podIDs, podID)
+				}
+				if len(n.podIDs) == 0 {
+					delete(img.nodes, nodeName)
+				}
+			}
+			delete(img.owners, ownerResourceID)
+			img.markOwnerChanged(now)
+		}
+		if img.isUnused() {
+			d.images.delete(img.key)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (d *deltaState) deletePendingPod(pod *corev1.Pod) {
+	if pods, found := d.pendingPods[pod.Spec.NodeName]; found {
+		delete(pods, pod.UID)
+		if len(pods) == 0 {
+			delete(d.pendingPods, pod.Spec.NodeName)
+		}
+	}
+}
+
 func (d *deltaState) handleNodeDelete(node *corev1.Node) {
 	delete(d.nodes, node.GetName())
+	delete(d.pendingPods, node.GetName())
 
-	for imgKey, img := range d.images {
+	for _, img := range d.images.list() {
 		delete(img.nodes, node.Name)
 
 		if img.isUnused() {
-			delete(d.images, imgKey)
+			d.images.delete(img.key)
+		}
+	}
+}
+
+// sweepStaleImages removes images which are not used by any pod and were last seen before given time.
+// Such images can be left in state if pod delete events were missed.
+func (d *deltaState) sweepStaleImages(seenBefore time.Time) int {
+	var swept int
+	for _, img := range d.images.list() {
+		if len(img.owners) > 0 || img.hasPods() || img.alwaysScan || !img.lastSeenAt.Before(seenBefore) {
+			continue
+		}
+		d.images.delete(img.key)
+		swept++
+	}
+	return swept
+}
+
+// addAlwaysScanImages adds configured images which are scanned without running pods.
+// Such images are not present on nodes, so only their name is known and they are scanned in remote mode.
+func (d *deltaState) addAlwaysScanImages(names []string) {
+	now := time.Now().UTC()
+	for _, name := range names {
+		ref := parseImageReference(name)
+		key := d.images.cacheKey(ref.scanName, d.defaultPlatform.architecture, ref.name)
+		if _, found := d.images.get(key); found {
+			continue
+		}
+		img := newImage()
+		img.key = key
+		img.id = ref.scanName
+		img.name = ref.name
+		img.scanName = ref.scanName
+		img.architecture = d.defaultPlatform.architecture
+		img.os = d.defaultPlatform.os
+		img.alwaysScan = true
+		img.lastSeenAt = now
+		d.images.set(img)
+	}
+}
+
+// upsertTemplateImages adds images from workload pod template. Images are added only if workload may have
+// no running pods, eg. CronJob or Deployment scaled to zero. Such images are scanned in remote mode.
+func (d *deltaState) upsertTemplateImages(o kube.Object, template corev1.PodTemplateSpec, noPods bool) {
+	ownerResourceID := string(o.GetUID())
+	if !noPods || d.isNamespaceExcluded(o.GetNamespace()) {
+		d.releaseTemplateImages(ownerResourceID, nil)
+		return
+	}
+
+	now := time.Now().UTC()
+	containers := template.Spec.Containers
+	containers = append(containers, template.Spec.InitContainers...)
+	keys := make(map[string]struct{}, len(containers))
+	for _, cont := range containers {
+		if cont.Image == "" {
+			continue
+		}
+		ref := parseImageReference(cont.Image)
+		if imageMatchesPatterns(ref, d.excludedImages) || d.isImageUsedByPods(ref.name) {
+			continue
+		}
+
+		key := d.images.cacheKey(ref.scanName, d.defaultPlatform.architecture, ref.name)
+		img, found := d.images.get(key)
+		if !found {
+			img = newImage()
+			img.key = key
+			img.id = ref.scanName
+			img.name = ref.name
+			img.scanName = ref.scanName
+			img.architecture = d.defaultPlatform.architecture
+			img.os = d.defaultPlatform.os
+			img.templateImage = true
+			d.notifyNewImage()
+		}
+		img.lastSeenAt = now
+
+		owner, found := img.owners[ownerResourceID]
+		if !found {
+			owner = &imageOwner{
+				podIDs: map[string]struct{}{},
+			}
+			img.owners[ownerResourceID] = owner
+			img.markOwnerChanged(now)
+		}
+		owner.namespace = o.GetNamespace()
+		owner.labels = lo.PickByKeys(template.Labels, d.ownerLabels)
+		owner.annotations = lo.PickByKeys(template.Annotations, d.ownerAnnotations)
+		owner.pullSecrets = lo.Map(template.Spec.ImagePullSecrets, func(item corev1.LocalObjectReference, index int) types.NamespacedName {
+			return types.NamespacedName{Namespace: o.GetNamespace(), Name: item.Name}
+		})
+		keys[key] = struct{}{}
+		d.images.set(img)
+	}
+	d.releaseTemplateImages(ownerResourceID, keys)
+}
+
+// releaseTemplateImages removes workload from owners of its template images which keys are not kept.
+func (d *deltaState) releaseTemplateImages(ownerResourceID string, keep map[string]struct{}) {
+	now := time.Now().UTC()
+	for _, img := range d.images.list() {
+		if !img.templateImage {
+			continue
+		}
+		if _, found := keep[img.key]; found {
+			continue
+		}
+		if _, found := img.owners[ownerResourceID]; !found {
+			continue
+		}
+		delete(img.owners, ownerResourceID)
+		img.markOwnerChanged(now)
+		if img.isUnused() {
+			d.images.delete(img.key)
+		}
+	}
+}
+
+// deleteTemplateImages removes template images with given name once the image is used by running pods.
+func (d *deltaState) deleteTemplateImages(name string) {
+	for _, img := range d.images.listByName(name) {
+		if img.templateImage {
+			d.images.delete(img.key)
 		}
 	}
 }
 
+// setAdmissionImageScanned stores image scanned before its pod was admitted, so it's not scanned again.
+func (d *deltaState) setAdmissionImageScanned(ref imageReference, severity string, now time.Time) {
+	key := d.images.cacheKey(ref.scanName, d.defaultPlatform.architecture, ref.name)
+	img, found := d.images.get(key)
+	if !found {
+		img = newImage()
+		img.key = key
+		img.id = ref.scanName
+		img.name = ref.name
+		img.scanName = ref.scanName
+		img.architecture = d.defaultPlatform.architecture
+		img.os = d.defaultPlatform.os
+		img.admissionScan = true
+	}
+	img.markScanned(now)
+	img.lastScannedAt = now
+	img.lastSeenAt = now
+	if severity != "" {
+		img.severity = severity
+	}
+	d.images.set(img)
+}
+
+// replaceAdmissionImages removes images scanned on pod admission once the image is used by running pods.
+// Scan state is moved to the running pod image, so it's not scanned again.
+func (d *deltaState) replaceAdmissionImages(img *image) {
+	for _, admitted := range d.images.listByName(img.name) {
+		if !admitted.admissionScan || admitted.architecture != img.architecture {
+			continue
+		}
+		if admitted.scanned {
+			img.markScanned(admitted.scannedAt)
+			img.lastScannedAt = admitted.lastScannedAt
+			img.severity = admitted.severity
+			img.result = admitted.result
+		}
+		d.images.delete(admitted.key)
+	}
+}
+
+func (d *deltaState) isImageUsedByPods(name string) bool {
+	for _, img := range d.images.listByName(name) {
+		if !img.templateImage && img.hasPods() {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *deltaState) notifyNewImage() {
+	select {
+	case d.newImages <- struct{}{}:
+	default:
+	}
+}
+
 func (d *deltaState) getImages() []*image {
-	return lo.Values(d.images)
+	return d.images.list()
 }
 
 func (d *deltaState) updateImage(i *image, change func(*image)) {
-	img := d.images[i.key]
-	if img != nil {
+	img, found := d.images.get(i.key)
+	if found {
 		change(img)
 	}
 }
 
-func (d *deltaState) setImageScanError(i *image, err error) {
-	img := d.images[i.key]
-	if img == nil {
+func (d *deltaState) setImageScanError(i *image, err error, now time.Time) {
+	img, found := d.images.get(i.key)
+	if !found {
 		return
 	}
 
 	img.failures++
 	img.lastScanErr = err
+	if classifyScanError(err) == scanErrorLayerNotFound {
+		img.hostFSDisabledUntil = now.Add(d.hostFSDisableCooldown)
+	}
 
-	img.nextScan = time.Now().UTC().Add(img.retryBackoff.Step())
+	img.nextScan = now.Add(img.retryBackoff.Step())
 }
 
 func (d *deltaState) filterCastAIManagedNodes(nodes []string) []string {
@@ -290,13 +922,26 @@ func (d *deltaState) filterCastAIManagedNodes(nodes []string) []string {
 }
 
 func (d *deltaState) findBestNode(nodeNames []string, requiredMemory *inf.Dec, requiredCPU *inf.Dec) (string, error) {
+	return d.findNode(nodeNames, d.nodeSelector, requiredMemory, requiredCPU)
+}
+
+// findPoolNode picks node from dedicated scan node pool ignoring configured node selector.
+func (d *deltaState) findPoolNode(nodeNames []string, poolSelector map[string]string, requiredMemory *inf.Dec, requiredCPU *inf.Dec) (string, error) {
+	return d.findNode(nodeNames, labels.SelectorFromSet(poolSelector), requiredMemory, requiredCPU)
+}
+
+func (d *deltaState) findNode(nodeNames []string, selector labels.Selector, requiredMemory *inf.Dec, requiredCPU *inf.Dec) (string, error) {
 	if len(d.nodes) == 0 {
 		return "", errNoCandidates
 	}
 
 	var candidates []*node
 	for _, nodeName := range nodeNames {
-		if n, found := d.nodes[nodeName]; found && n.availableMemory().Cmp(requiredMemory) >= 0 && n.availableCPU().Cmp(requiredCPU) >= 0 {
+		n, found := d.nodes[nodeName]
+		if !found || n.unschedulable || n.notReady || !selector.Matches(labels.Set(n.labels)) {
+			continue
+		}
+		if n.availableMemory().Cmp(requiredMemory) >= 0 && n.availableCPU().Cmp(requiredCPU) >= 0 {
 			candidates = append(candidates, n)
 		}
 	}
@@ -305,9 +950,46 @@ func (d *deltaState) findBestNode(nodeNames []string, requiredMemory *inf.Dec, r
 		return "", errNoCandidates
 	}
 
-	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].availableCPU().Cmp(candidates[j].allocatableCPU) > 0
-	})
+	// Spot nodes can be preempted in the middle of the scan, prefer them only if there are no other nodes.
+	if onDemand := lo.Filter(candidates, func(n *node, _ int) bool { return !n.spot }); len(onDemand) > 0 {
+		candidates = onDemand
+	}
+
+	switch d.nodeSelectionStrategy {
+	case config.NodeSelectionMostLoaded:
+		sort.Slice(candidates, func(i, j int) bool {
+			if cmp := candidates[i].availableCPU().Cmp(candidates[j].availableCPU()); cmp != 0 {
+				return cmp < 0
+			}
+			return candidates[i].name < candidates[j].name
+		})
+	case config.NodeSelectionRoundRobin:
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].name < candidates[j].name
+		})
+		next := candidates[0]
+		for _, n := range candidates {
+			if n.name > d.lastSelectedNode {
+				next = n
+				break
+			}
+		}
+		d.lastSelectedNode = next.name
+		return next.name, nil
+	default:
+		// Node with the most headroom for both CPU and memory is picked, so scan job is not scheduled
+		// on CPU-rich node which is short on memory.
+		headroom := make(map[string]float64, len(candidates))
+		for _, n := range candidates {
+			headroom[n.name] = n.scanHeadroom(requiredMemory, requiredCPU)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if hi, hj := headroom[candidates[i].name], headroom[candidates[j].name]; hi != hj {
+				return hi > hj
+			}
+			return candidates[i].name < candidates[j].name
+		})
+	}
 
 	return candidates[0].name, nil
 }
@@ -316,12 +998,225 @@ func (d *deltaState) nodeCount() int {
 	return len(d.nodes)
 }
 
-func (d *deltaState) setImageScanned(scannedImg castai.ScannedImage) {
-	for _, img := range d.images {
+func (d *deltaState) setImageScanned(scannedImg castai.ScannedImage, now time.Time) {
+	for _, img := range d.images.list() {
 		if img.id == scannedImg.ID && img.architecture == scannedImg.Architecture {
-			img.scanned = true
+			if img.forceRescan {
+				// Remote state is ignored for expired scans until image is scanned again.
+				continue
+			}
+			if !img.scanned {
+				img.markScanned(now)
+			}
+			if scannedImg.Severity != "" && scannedImg.Severity != img.severity {
+				img.severity = scannedImg.Severity
+				// Severity change is reported with image owners so workload rollups are updated.
+				img.markOwnerChanged(now)
+			}
+		}
+	}
+}
+
+// resolvedVulnerabilities returns previous vulnerabilities which are not present in current ones.
+func resolvedVulnerabilities(previous, current []castai.ImageVulnerability) []castai.ImageVulnerability {
+	key := func(v castai.ImageVulnerability) string {
+		return v.ID + "/" + v.PkgName
+	}
+	currentKeys := lo.SliceToMap(current, func(v castai.ImageVulnerability) (string, struct{}) {
+		return key(v), struct{}{}
+	})
+	resolved := lo.UniqBy(lo.Filter(previous, func(v castai.ImageVulnerability, _ int) bool {
+		_, found := currentKeys[key(v)]
+		return !found
+	}), key)
+	sort.Slice(resolved, func(i, j int) bool {
+		return key(resolved[i]) < key(resolved[j])
+	})
+	return resolved
+}
+
+// vulnerabilityReports returns reports of workload containers using images which vulnerabilities were matched
+// by external trivy server.
+func (d *deltaState) vulnerabilityReports() []vulnerabilityReport {
+	images := lo.Filter(d.images.list(), func(img *image, _ int) bool {
+		return img.result.vulnerabilitiesMatched
+	})
+	// Images are sorted so the same image is reported if container image is used on nodes with different architectures.
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].key < images[j].key
+	})
+
+	var res []vulnerabilityReport
+	for _, img := range images {
+		_, digest, _ := strings.Cut(img.scanImageName(), "@")
+		for _, owner := range img.owners {
+			if owner.controller == nil {
+				continue
+			}
+			res = append(res, vulnerabilityReport{
+				owner:           *owner.controller,
+				namespace:       owner.namespace,
+				container:       owner.containerName,
+				imageName:       img.name,
+				imageDigest:     digest,
+				vulnerabilities: img.result.vulnerabilities,
+			})
 		}
 	}
+	return res
+}
+
+// imageScanResult is part of scan result sent to remote which is kept to be diffed with the next scan result.
+type imageScanResult struct {
+	findings []castai.ImageFinding
+	// vulnerabilities are vulnerabilities matched by external trivy server.
+	vulnerabilities []castai.ImageVulnerability
+	// vulnerabilitiesMatched is set if scan job matched vulnerabilities with external trivy server. Image has no
+	// vulnerabilities if they were matched and the list is empty.
+	vulnerabilitiesMatched bool
+}
+
+// imageRescan is scan result of image which is being sent to remote. The result is stored before sending,
+// so it's reverted if sending fails.
+type imageRescan struct {
+	imageID      string
+	architecture string
+	result       imageScanResult
+	// previous is the previous scan result.
+	previous imageScanResult
+	// resolvedFindings are findings of the previous scan result which are no longer present.
+	resolvedFindings []castai.ImageFinding
+	// resolvedVulnerabilities are vulnerabilities of the previous scan result which are no longer present.
+	resolvedVulnerabilities []castai.ImageVulnerability
+}
+
+// setImageRescan stores scan result and returns findings and vulnerabilities of the previous result which are no
+// longer present. Vulnerabilities are diffed only if both results were matched by external trivy server, previous
+// result is not known after agent restart.
+func (d *deltaState) setImageRescan(imageID, architecture string, result imageScanResult) imageRescan {
+	current := make(map[string]struct{}, len(result.findings))
+	for _, f := range result.findings {
+		current[f.ID] = struct{}{}
+	}
+
+	rescan := imageRescan{
+		imageID:      imageID,
+		architecture: architecture,
+		result:       result,
+	}
+	var previousFound bool
+	resolved := make(map[string]castai.ImageFinding)
+	for _, img := range d.images.list() {
+		if img.id != imageID || img.architecture != architecture {
+			continue
+		}
+		if !previousFound {
+			rescan.previous = img.result
+			previousFound = true
+		}
+		for _, f := range img.result.findings {
+			if _, found := current[f.ID]; !found {
+				resolved[f.ID] = f
+			}
+		}
+		img.result = result
+	}
+
+	if len(resolved) > 0 {
+		rescan.resolvedFindings = lo.Values(resolved)
+		sort.Slice(rescan.resolvedFindings, func(i, j int) bool {
+			return rescan.resolvedFindings[i].ID < rescan.resolvedFindings[j].ID
+		})
+	}
+	if rescan.previous.vulnerabilitiesMatched && result.vulnerabilitiesMatched {
+		rescan.resolvedVulnerabilities = resolvedVulnerabilities(rescan.previous.vulnerabilities, result.vulnerabilities)
+	}
+	return rescan
+}
+
+// revertImageRescan restores the previous scan result if rescan was not sent. Images updated by another scan
+// result in the meantime are not changed.
+func (d *deltaState) revertImageRescan(rescan imageRescan) {
+	for _, img := range d.images.list() {
+		if img.id != rescan.imageID || img.architecture != rescan.architecture || !reflect.DeepEqual(img.result, rescan.result) {
+			continue
+		}
+		img.result = rescan.previous
+	}
+}
+
+// workloadSeverities returns the highest severity across scanned images of each given workload.
+// Workloads without any image with known severity are skipped.
+func (d *deltaState) workloadSeverities(resourceIDs []string) []castai.WorkloadSeverity {
+	var res []castai.WorkloadSeverity
+	for _, id := range lo.Uniq(resourceIDs) {
+		rollup := castai.WorkloadSeverity{ResourceID: id}
+		for _, img := range d.images.listByOwner(id) {
+			if !img.scanned || img.severity == "" {
+				continue
+			}
+			rollup.Severity = castai.MaxSeverity(rollup.Severity, img.severity)
+			rollup.ImageIDs = append(rollup.ImageIDs, img.id)
+		}
+		if len(rollup.ImageIDs) == 0 {
+			continue
+		}
+		rollup.ImageIDs = lo.Uniq(rollup.ImageIDs)
+		sort.Strings(rollup.ImageIDs)
+		res = append(res, rollup)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ResourceID < res[j].ResourceID
+	})
+	return res
+}
+
+// imagesOnNotReadyNodes returns not scanned images which are present only on NotReady nodes
+// together with names of these nodes. Such images can't be scanned in hostfs mode until nodes recover.
+func (d *deltaState) imagesOnNotReadyNodes() ([]*image, []string) {
+	var images []*image
+	notReadyNodes := map[string]struct{}{}
+	for _, img := range d.images.list() {
+		if img.scanned || len(img.owners) == 0 || !d.isImageOnNotReadyNodesOnly(img) {
+			continue
+		}
+		images = append(images, img)
+		for nodeName := range img.nodes {
+			notReadyNodes[nodeName] = struct{}{}
+		}
+	}
+	nodeNames := lo.Keys(notReadyNodes)
+	sort.Strings(nodeNames)
+	return images, nodeNames
+}
+
+func (d *deltaState) isImageOnNotReadyNodesOnly(img *image) bool {
+	if len(img.nodes) == 0 {
+		return false
+	}
+	for nodeName := range img.nodes {
+		n, found := d.nodes[nodeName]
+		if !found || !n.notReady {
+			return false
+		}
+	}
+	return true
+}
+
+// rependExpiredScans marks images scanned before given time as pending so they are rescanned
+// even if remote state reports them as scanned.
+func (d *deltaState) rependExpiredScans(scannedBefore time.Time) int {
+	var repended int
+	for _, img := range d.images.list() {
+		if !img.scanned || !img.scannedAt.Before(scannedBefore) {
+			continue
+		}
+		img.scanned = false
+		img.forceRescan = true
+		img.nextScan = time.Time{}
+		repended++
+	}
+	return repended
 }
 
 type platform struct {
@@ -329,18 +1224,31 @@ type platform struct {
 	os           string
 }
 
-func (d *deltaState) getPodPlatform(pod *corev1.Pod) platform {
+// getPodPlatform returns platform of pod node. False is returned if node architecture is not known yet
+// and default architecture is used instead.
+func (d *deltaState) getPodPlatform(pod *corev1.Pod) (platform, bool) {
+	p := d.defaultPlatform
 	n, ok := d.nodes[pod.Spec.NodeName]
-	if ok && n.architecture != "" && n.os != "" {
-		return platform{
-			architecture: n.architecture,
-			os:           n.os,
-		}
+	if !ok || n.architecture == "" {
+		return p, false
 	}
-	return platform{
-		architecture: defaultImageArch,
-		os:           defaultImageOs,
+	p.architecture = n.architecture
+	if n.os != "" {
+		p.os = n.os
 	}
+	return p, true
+}
+
+func getBuildMetadata(pod *corev1.Pod) *castai.BuildMetadata {
+	md := castai.BuildMetadata{
+		Repository: pod.Annotations[annotationBuildRepository],
+		Commit:     pod.Annotations[annotationBuildCommit],
+		BuildURL:   pod.Annotations[annotationBuildURL],
+	}
+	if md == (castai.BuildMetadata{}) {
+		return nil
+	}
+	return &md
 }
 
 func getContainerRuntime(containerID string) imgcollectorconfig.Runtime {
@@ -372,6 +1280,10 @@ type node struct {
 	allocatableCPU *inf.Dec
 	pods           map[types.UID]*pod
 	castaiManaged  bool // true if managed by CAST AI
+	unschedulable  bool // true if node is cordoned or being drained
+	notReady       bool // true if node Ready condition is not true
+	spot           bool // true if node is spot or preemptible
+	labels         map[string]string
 }
 
 func (n *node) availableMemory() *inf.Dec {
@@ -385,6 +1297,21 @@ func (n *node) availableMemory() *inf.Dec {
 	return &result
 }
 
+// scanHeadroom returns how many times scan job with given requests fits into the scarcer of node's
+// available CPU and memory.
+func (n *node) scanHeadroom(requiredMemory, requiredCPU *inf.Dec) float64 {
+	return math.Min(resourceHeadroom(n.availableCPU(), requiredCPU), resourceHeadroom(n.availableMemory(), requiredMemory))
+}
+
+func resourceHeadroom(available, required *inf.Dec) float64 {
+	a, _ := strconv.ParseFloat(available.String(), 64)
+	r, _ := strconv.ParseFloat(required.String(), 64)
+	if r <= 0 {
+		return math.MaxFloat64
+	}
+	return a / r
+}
+
 func (n *node) availableCPU() *inf.Dec {
 	var result inf.Dec
 	result.Add(&result, n.allocatableCPU)
@@ -419,7 +1346,21 @@ type imageNode struct {
 }
 
 type imageOwner struct {
-	podIDs map[string]struct{}
+	podIDs    map[string]struct{}
+	namespace string
+	// pod is the latest owner pod. It is used as involved object for image scan events.
+	pod *corev1.ObjectReference
+
+	labels      map[string]string
+	annotations map[string]string
+	// pullSecrets are image pull secrets of the latest owner pod. Pod spec already includes pull secrets
+	// of pod service account as they are added by service account admission.
+	pullSecrets []types.NamespacedName
+	// controller is controller of the latest owner pod, or the pod itself if it has no controller. It owns exported
+	// vulnerability reports. Not set for owners of template images.
+	controller *metav1.OwnerReference
+	// containerName is name of the latest owner pod container using image.
+	containerName string
 }
 
 type image struct {
@@ -441,26 +1382,179 @@ type image struct {
 	// while on container spec you will see user defined image name which may not be fully qualified, eg: grafana/grafana:latest
 	name string
 
+	// scanName is image reference used for scanning. It is pinned to digest of running image when known.
+	scanName string
+
 	architecture     string
 	os               string
 	containerRuntime imgcollectorconfig.Runtime
+	buildMetadata    *castai.BuildMetadata
 
 	// owners map key points to higher level k8s resource for that image. (Image Affected resource in CAST AI console).
 	// Example: In most cases Pod will be managed by deployment, so owner id will point to Deployment's uuid.
 	owners map[string]*imageOwner
 	nodes  map[string]*imageNode
 
-	scanned      bool
-	lastScanErr  error
-	failures     int          // Used for sorting. We want to scan non-failed images first.
-	retryBackoff wait.Backoff // Retry state for failed images.
-	nextScan     time.Time    // Set based on retry backoff.
-
+	scanned       bool
+	scannedAt     time.Time // Time when image was marked as scanned locally or from remote state.
+	forceRescan   bool      // Set when scan is older than max scan age. Remote scanned state is ignored until rescan.
+	lastScannedAt time.Time // Time of the last successful local scan.
+	lastScanErr   error
+	failures      int          // Used for sorting. We want to scan non-failed images first.
+	retryBackoff  wait.Backoff // Retry state for failed images.
+	nextScan      time.Time    // Set based on retry backoff.
+	// alwaysScan is set for configured images which are scanned even if they are not used by any pod.
+	alwaysScan bool
+	// templateImage is set for images added from pod templates of workloads without running pods, eg. CronJobs.
+	// Owners of such images are workloads. Image is replaced once it's used by running pod.
+	templateImage bool
+	// admissionScan is set for images of pods which are scanned before pods are admitted. Such images have no owners
+	// and are replaced once used by running pods.
+	admissionScan bool
+	// hostFSDisabledUntil is set when hostfs scan failed due to missing layers. Image is scanned remotely until then.
+	hostFSDisabledUntil time.Time
+	// scanModeFallback is reason why the last scan fell back to remote mode. Empty if configured mode was used.
+	scanModeFallback scanModeFallback
+	// severity is the highest vulnerability severity of scanned image reported by remote state.
+	severity string
+	// result is the last scan result sent to remote. Used to report resolved findings on rescan and to export
+	// vulnerability reports.
+	result imageScanResult
+
+	lastSeenAt         time.Time // Time when image was last referenced by running pod.
 	lastRemoteSyncAt   time.Time // Time then image state was synced from remote.
 	ownerChangedAt     time.Time // Time when new image owner was added
 	resourcesUpdatedAt time.Time // Time when image was synced with backend
+	// ownerChangesSince is time of the first owner change which is not yet synced with backend.
+	ownerChangesSince time.Time
+}
+
+type imagePullErrorKey struct {
+	architecture string
+	name         string
+}
+
+// imagePullError is image which pods failed to pull. It is reported separately from scan failures.
+type imagePullError struct {
+	name         string
+	architecture string
+	reason       string
+	message      string
+
+	// pods are pods which failed to pull image by pod id.
+	pods map[string]imagePullErrorPod
+
+	reported bool // true if current state was sent to backend
+}
+
+type imagePullErrorPod struct {
+	ownerID   string
+	namespace string
+}
+
+func (e *imagePullError) removePod(podID string) {
+	delete(e.pods, podID)
+}
+
+func (e *imagePullError) ownerIDs() []string {
+	return lo.Uniq(lo.MapToSlice(e.pods, func(_ string, pod imagePullErrorPod) string {
+		return pod.ownerID
+	}))
+}
+
+// pullSecrets returns deduplicated image pull secrets of all image owners.
+func (img *image) pullSecrets() []types.NamespacedName {
+	var res []types.NamespacedName
+	for _, owner := range img.owners {
+		res = append(res, owner.pullSecrets...)
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	res = lo.Uniq(res)
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].String() < res[j].String()
+	})
+	return res
+}
+
+func (img *image) markOwnerChanged(now time.Time) {
+	if !img.hasUnsyncedOwnerChanges() {
+		img.ownerChangesSince = now
+	}
+	img.ownerChangedAt = now
+}
+
+func (img *image) hasUnsyncedOwnerChanges() bool {
+	return img.ownerChangedAt.After(img.resourcesUpdatedAt)
+}
+
+// ownersMetadata returns owners with collected labels or annotations.
+func (img *image) ownersMetadata() []castai.ImageOwner {
+	var res []castai.ImageOwner
+	for id, owner := range img.owners {
+		if len(owner.labels) == 0 && len(owner.annotations) == 0 {
+			continue
+		}
+		res = append(res, castai.ImageOwner{
+			ResourceID:  id,
+			Labels:      owner.labels,
+			Annotations: owner.annotations,
+		})
+	}
+	return res
+}
+
+func (img *image) ownerPods() []*corev1.ObjectReference {
+	var res []*corev1.ObjectReference
+	for _, owner := range img.owners {
+		if owner.pod != nil {
+			res = append(res, owner.pod)
+		}
+	}
+	return res
+}
+
+// resetRetryBackoff clears retry state after successful scan so image which fails again later is retried
+// starting with the initial backoff.
+func (img *image) resetRetryBackoff() {
+	img.failures = 0
+	img.retryBackoff = newRetryBackoff()
+	img.nextScan = time.Time{}
+}
+
+func (img *image) markScanned(now time.Time) {
+	img.scanned = true
+	img.scannedAt = now
+	img.forceRescan = false
+}
+
+// scanImageName returns reference used to pull image during scan.
+func (img *image) scanImageName() string {
+	if img.scanName != "" {
+		return img.scanName
+	}
+	return img.name
+}
+
+func (img *image) hasPod(nodeName, podID string) bool {
+	n, found := img.nodes[nodeName]
+	if !found {
+		return false
+	}
+	_, found = n.podIDs[podID]
+	return found
+}
+
+func (img *image) hasPods() bool {
+	for _, n := range img.nodes {
+		if len(n.podIDs) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (img *image) isUnused() bool {
-	return len(img.nodes) == 0 && len(img.owners) == 0
+	return len(img.nodes) == 0 && len(img.owners) == 0 && !img.alwaysScan
 }
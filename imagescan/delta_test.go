@@ -1,14 +1,24 @@
 package imagescan
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
 )
 
 func TestDelta(t *testing.T) {
@@ -81,25 +91,28 @@ func TestDelta(t *testing.T) {
 		delta.upsert(pod1)
 		delta.upsert(pod2)
 		delta.upsert(pod3)
-		r.Len(delta.images, 2)
-		img1 := delta.images["img1amd64nginx1"]
+		r.Equal(2, delta.images.len())
+		img1, found := delta.images.get("img1amd64nginx1")
+		r.True(found)
 		r.Len(img1.nodes, 2)
 		r.Equal("nginx1", img1.name)
 		r.Equal("img1", img1.id)
 		r.Len(img1.owners, 2)
 		r.Len(img1.nodes["node1"].podIDs, 1)
-		r.Len(delta.images["img2amd64nginx2"].nodes, 1)
+		img2, found := delta.images.get("img2amd64nginx2")
+		r.True(found)
+		r.Len(img2.nodes, 1)
 
 		// Delete single pod. It should be removed only from image nodes list.
 		delta.delete(pod1)
-		r.Len(delta.images, 2)
+		r.Equal(2, delta.images.len())
 		r.Len(img1.nodes, 2)
 		r.Empty(img1.nodes["node1"].podIDs)
 
 		// Delete one more pod for the same image. Image should be removed.
 		delta.delete(pod3)
-		r.Len(delta.images, 2)
-		r.Len(delta.images["img2amd64nginx2"].nodes, 1)
+		r.Equal(2, delta.images.len())
+		r.Len(img2.nodes, 1)
 	})
 
 	t.Run("find best node for image scan", func(t *testing.T) {
@@ -155,7 +168,7 @@ func TestDelta(t *testing.T) {
 		memQty = resource.MustParse("500Mi")
 		nodeName, err = delta.findBestNode([]string{"node2", "node1"}, memQty.AsDec(), cpuQty.AsDec())
 		r.NoError(err)
-		r.Equal("node2", nodeName)
+		r.Equal("node1", nodeName)
 
 		delta.upsert(&corev1.Node{
 			TypeMeta: metav1.TypeMeta{
@@ -168,7 +181,7 @@ func TestDelta(t *testing.T) {
 			Status: corev1.NodeStatus{
 				Allocatable: corev1.ResourceList{
 					corev1.ResourceCPU:    resource.MustParse("2"),
-					corev1.ResourceMemory: resource.MustParse("500Mi"),
+					corev1.ResourceMemory: resource.MustParse("4Gi"),
 				},
 			},
 		})
@@ -212,7 +225,41 @@ func TestDelta(t *testing.T) {
 
 		nodeName, err = delta.findBestNode([]string{"node3", "node2", "node1"}, memQty.AsDec(), cpuQty.AsDec())
 		r.NoError(err)
-		r.Equal("node2", nodeName)
+		r.Equal("node1", nodeName)
+	})
+
+	t.Run("balance best node by available cpu and memory", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		createNode := func(name, cpu, mem string) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse(mem),
+					},
+				},
+			}
+		}
+		delta.upsert(createNode("cpu-rich", "16", "1100Mi"))
+		delta.upsert(createNode("balanced", "2", "8Gi"))
+
+		cpuQty := resource.MustParse("100m")
+		memQty := resource.MustParse("1Gi")
+		nodeName, err := delta.findBestNode([]string{"cpu-rich", "balanced"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("balanced", nodeName)
+
+		// CPU becomes the scarcer resource for CPU heavy scan jobs.
+		cpuQty = resource.MustParse("1")
+		memQty = resource.MustParse("100Mi")
+		nodeName, err = delta.findBestNode([]string{"cpu-rich", "balanced"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("cpu-rich", nodeName)
 	})
 
 	t.Run("returns error when no best node find", func(t *testing.T) {
@@ -398,13 +445,13 @@ func TestDelta(t *testing.T) {
 		}
 
 		delta.upsert(pod)
-		img, found := delta.images["testidamd64test"]
+		img, found := delta.images.get("testidamd64test")
 		r.True(found)
 		r.Len(img.owners, 1)
 		r.Len(img.nodes, 1)
 
 		delta.delete(pod)
-		img, found = delta.images["testidamd64test"]
+		img, found = delta.images.get("testidamd64test")
 		r.True(found)
 		r.Empty(img.owners)
 
@@ -412,8 +459,1012 @@ func TestDelta(t *testing.T) {
 		_, found = delta.nodes["node1"]
 		r.False(found)
 	})
+
+	t.Run("scans image referenced by tag using digest from container status", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		const imageID = "docker.io/library/nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+
+		delta.upsert(&corev1.Node{
+			TypeMeta:   metav1.TypeMeta{Kind: "Node", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		})
+		delta.upsert(&corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{UID: "123"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.25"}},
+				NodeName:   "node1",
+			},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "nginx", ImageID: imageID}},
+			},
+		})
+
+		img, found := delta.images.get(imageID + "amd64nginx:1.25")
+		r.True(found)
+		r.Equal("nginx:1.25", img.name)
+		r.Equal("nginx@sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31", img.scanImageName())
+	})
+
+	t.Run("skips cordoned and draining nodes when finding best node", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		createNode := func(name string, unschedulable bool, taints []corev1.Taint) *corev1.Node {
+			return &corev1.Node{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Node",
+					APIVersion: "v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+				Spec: corev1.NodeSpec{
+					Unschedulable: unschedulable,
+					Taints:        taints,
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("2"),
+						corev1.ResourceMemory: resource.MustParse("4Gi"),
+					},
+				},
+			}
+		}
+
+		cordoned := createNode("node1", true, nil)
+		delta.upsert(cordoned)
+		delta.upsert(createNode("node2", false, []corev1.Taint{
+			{Key: "ToBeDeletedByClusterAutoscaler", Effect: corev1.TaintEffectNoSchedule},
+		}))
+
+		cpuQty := resource.MustParse("100m")
+		memQty := resource.MustParse("100Mi")
+		_, err := delta.findBestNode([]string{"node1", "node2"}, memQty.AsDec(), cpuQty.AsDec())
+		r.ErrorIs(err, errNoCandidates)
+
+		// Uncordon node.
+		cordoned.Spec.Unschedulable = false
+		delta.upsert(cordoned)
+		nodeName, err := delta.findBestNode([]string{"node1", "node2"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("node1", nodeName)
+	})
+
+	t.Run("flag images stuck behind not ready nodes", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		createNode := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("2"),
+						corev1.ResourceMemory: resource.MustParse("4Gi"),
+					},
+					Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+				},
+			}
+		}
+		notReadyNode := createNode("node1", corev1.ConditionFalse)
+		delta.upsert(notReadyNode)
+		delta.upsert(createNode("node2", corev1.ConditionTrue))
+		delta.upsert(newTestPod("pod1", "stuck:1.0", "node1"))
+		delta.upsert(newTestPod("pod2", "shared:1.0", "node1"))
+		delta.upsert(newTestPod("pod3", "shared:1.0", "node2"))
+
+		images, nodeNames := delta.imagesOnNotReadyNodes()
+		r.Len(images, 1)
+		r.Equal("stuck:1.0", images[0].name)
+		r.Equal([]string{"node1"}, nodeNames)
+
+		cpuQty := resource.MustParse("100m")
+		memQty := resource.MustParse("100Mi")
+		_, err := delta.findBestNode([]string{"node1"}, memQty.AsDec(), cpuQty.AsDec())
+		r.ErrorIs(err, errNoCandidates)
+
+		// Node recovers.
+		notReadyNode.Status.Conditions[0].Status = corev1.ConditionTrue
+		delta.upsert(notReadyNode)
+		images, nodeNames = delta.imagesOnNotReadyNodes()
+		r.Empty(images)
+		r.Empty(nodeNames)
+		nodeName, err := delta.findBestNode([]string{"node1"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("node1", nodeName)
+	})
+
+	t.Run("filter best node candidates by node selector", func(t *testing.T) {
+		r := require.New(t)
+		delta := newDeltaState(&mockKubeController{}, map[string]string{"scan.cast.ai/allowed": "true"})
+
+		createNode := func(name string, labels map[string]string) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: labels,
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("2"),
+						corev1.ResourceMemory: resource.MustParse("4Gi"),
+					},
+				},
+			}
+		}
+
+		delta.upsert(createNode("node1", nil))
+		delta.upsert(createNode("node2", map[string]string{"scan.cast.ai/allowed": "false"}))
+		delta.upsert(createNode("node3", map[string]string{"scan.cast.ai/allowed": "true", "gpu": "true"}))
+
+		cpuQty := resource.MustParse("100m")
+		memQty := resource.MustParse("100Mi")
+		nodeName, err := delta.findBestNode([]string{"node1", "node2", "node3"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("node3", nodeName)
+
+		_, err = delta.findBestNode([]string{"node1", "node2"}, memQty.AsDec(), cpuQty.AsDec())
+		r.ErrorIs(err, errNoCandidates)
+	})
+
+	t.Run("deprioritize spot nodes", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		createNode := func(name, cpu string, labels map[string]string) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: labels,
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse("4Gi"),
+					},
+				},
+			}
+		}
+
+		delta.upsert(createNode("spot1", "8", map[string]string{"scheduling.cast.ai/spot": "true"}))
+		delta.upsert(createNode("spot2", "8", map[string]string{"eks.amazonaws.com/capacityType": "SPOT"}))
+		delta.upsert(createNode("ondemand", "2", nil))
+
+		cpuQty := resource.MustParse("1")
+		memQty := resource.MustParse("100Mi")
+
+		// On-demand node is picked even though spot nodes have more resources.
+		nodeName, err := delta.findBestNode([]string{"spot1", "spot2", "ondemand"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("ondemand", nodeName)
+
+		// Spot nodes are used if on-demand nodes have no capacity.
+		cpuQty = resource.MustParse("4")
+		nodeName, err = delta.findBestNode([]string{"spot1", "spot2", "ondemand"}, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Contains([]string{"spot1", "spot2"}, nodeName)
+	})
+
+	t.Run("pin scan node to dedicated node pool", func(t *testing.T) {
+		r := require.New(t)
+		delta := newDeltaState(&mockKubeController{}, map[string]string{"scan.cast.ai/allowed": "true"})
+		poolSelector := map[string]string{"scan.cast.ai/pool": "scanners"}
+
+		createNode := func(name, cpu string, labels map[string]string) *corev1.Node {
+			return &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: labels,
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse("4Gi"),
+					},
+				},
+			}
+		}
+
+		delta.upsert(createNode("node1", "4", map[string]string{"scan.cast.ai/allowed": "true"}))
+		delta.upsert(createNode("pool1", "1", map[string]string{"scan.cast.ai/pool": "scanners"}))
+
+		cpuQty := resource.MustParse("500m")
+		memQty := resource.MustParse("100Mi")
+		nodeNames := []string{"node1", "pool1"}
+
+		// Pool node is picked even though best fit would pick node with more resources.
+		nodeName, err := delta.findPoolNode(nodeNames, poolSelector, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("pool1", nodeName)
+
+		// Pool has no capacity.
+		cpuQty = resource.MustParse("2")
+		_, err = delta.findPoolNode(nodeNames, poolSelector, memQty.AsDec(), cpuQty.AsDec())
+		r.ErrorIs(err, errNoCandidates)
+
+		nodeName, err = delta.findBestNode(nodeNames, memQty.AsDec(), cpuQty.AsDec())
+		r.NoError(err)
+		r.Equal("node1", nodeName)
+	})
+
+	t.Run("attach build metadata from pod annotations", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		createPod := func(annotations map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID:         types.UID(uuid.New().String()),
+					Annotations: annotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "app:v1"}},
+					NodeName:   "node1",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "app", ImageID: "appid"},
+					},
+				},
+			}
+		}
+
+		delta.upsert(createPod(nil))
+		img, found := delta.images.get("appidamd64app:v1")
+		r.True(found)
+		r.Nil(img.buildMetadata)
+
+		delta.upsert(createPod(map[string]string{
+			"kvisor.cast.ai/build-repository": "https://github.com/castai/app",
+			"kvisor.cast.ai/build-commit":     "8889dc92d6c6",
+			"kvisor.cast.ai/build-url":        "https://ci.example.com/builds/1",
+		}))
+		r.Equal(&castai.BuildMetadata{
+			Repository: "https://github.com/castai/app",
+			Commit:     "8889dc92d6c6",
+			BuildURL:   "https://ci.example.com/builds/1",
+		}, img.buildMetadata)
+
+		// Pods without annotations do not reset known build metadata.
+		delta.upsert(createPod(nil))
+		r.NotNil(img.buildMetadata)
+	})
+
+	t.Run("detect image pull errors", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				UID: types.UID(uuid.New().String()),
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: "private/app:v1"}},
+				NodeName:   "node1",
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "app",
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{
+								Reason:  "ImagePullBackOff",
+								Message: "Back-off pulling image \"private/app:v1\"",
+							},
+						},
+					},
+				},
+			},
+		}
+
+		delta.upsert(pod)
+		// Image which can't be pulled is not added as scan candidate.
+		r.Equal(0, delta.images.len())
+		pullErrors := delta.getImagePullErrors()
+		r.Len(pullErrors, 1)
+		r.Equal("private/app:v1", pullErrors[0].name)
+		r.Equal(defaultImageArch, pullErrors[0].architecture)
+		r.Equal("ImagePullBackOff", pullErrors[0].reason)
+		r.Equal([]string{string(pod.UID)}, pullErrors[0].ownerIDs())
+		r.False(pullErrors[0].reported)
+
+		// Once image is pulled pull error is removed.
+		pod = pod.DeepCopy()
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+		pod.Status.ContainerStatuses[0].ImageID = "appid"
+		delta.upsert(pod)
+		r.Empty(delta.getImagePullErrors())
+		r.Equal(1, delta.images.len())
+	})
+
+	t.Run("skip image pull errors of excluded namespaces", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		delta.excludedNamespaces = []string{"vendor-*"}
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		newPod := func(namespace string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID:       types.UID(uuid.New().String()),
+					Namespace: namespace,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "private/app:v1"}},
+					NodeName:   "node1",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "app",
+							State: corev1.ContainerState{
+								Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"},
+							},
+						},
+					},
+				},
+			}
+		}
+
+		delta.upsert(newPod("vendor-a"))
+		r.Empty(delta.getImagePullErrors())
+
+		pod := newPod("default")
+		delta.upsert(pod)
+		pullErrors := delta.getImagePullErrors()
+		r.Len(pullErrors, 1)
+		r.Equal([]string{string(pod.UID)}, pullErrors[0].ownerIDs())
+	})
+
+	t.Run("add images from crash looping pods", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				UID: types.UID(uuid.New().String()),
+			},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "migrate", Image: "app/migrate:v1"}},
+				Containers:     []corev1.Container{{Name: "app", Image: "app/app:v1"}},
+				NodeName:       "node1",
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name:    "migrate",
+						ImageID: "migrateid",
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+						},
+					},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "app",
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"},
+						},
+					},
+				},
+			},
+		}
+
+		delta.upsert(pod)
+		// Only crash looping image is pulled, app image is added once it has image id.
+		r.Equal(1, delta.images.len())
+		img := delta.images.list()[0]
+		r.Equal("app/migrate:v1", img.name)
+		r.Equal("migrateid", img.id)
+
+		skipDelta := newTestDelta()
+		skipDelta.skipCrashLoopPods = true
+		skipDelta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+		skipDelta.upsert(pod)
+		r.Equal(0, skipDelta.images.len())
+	})
+
+	t.Run("exclude infra images", func(t *testing.T) {
+		r := require.New(t)
+
+		createPod := func(images ...string) *corev1.Pod {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID: types.UID(uuid.New().String()),
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "node1",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+			for i, img := range images {
+				name := fmt.Sprintf("c%d", i)
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: name, Image: img})
+				pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{Name: name, ImageID: img + "id"})
+			}
+			return pod
+		}
+		pod := createPod(
+			"registry.k8s.io/pause:3.9",
+			"602401143452.dkr.ecr.us-west-2.amazonaws.com/eks/pause:3.5",
+			"docker.io/calico/cni:v3.26.1",
+			"registry.local/infra/proxy:v1",
+			"nginx:1.25",
+		)
+
+		delta := newTestController(logrus.New(), config.ImageScan{
+			ExcludedImages: []string{"infra/*"},
+		}).delta
+		delta.upsert(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		delta.upsert(pod)
+		r.Equal([]string{"nginx:1.25"}, lo.Map(delta.images.list(), func(img *image, _ int) string { return img.name }))
+
+		// Infra images are scanned if default exclusion is disabled.
+		delta = newTestController(logrus.New(), config.ImageScan{ScanInfraImages: true}).delta
+		delta.upsert(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		delta.upsert(pod)
+		r.Equal(5, delta.images.len())
+	})
+
+	t.Run("exclude namespaces", func(t *testing.T) {
+		r := require.New(t)
+
+		createPod := func(namespace, img string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID:       types.UID(uuid.New().String()),
+					Namespace: namespace,
+				},
+				Spec: corev1.PodSpec{
+					NodeName:   "node1",
+					Containers: []corev1.Container{{Name: "app", Image: img}},
+				},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: img + "id"}},
+				},
+			}
+		}
+		imageNames := func(delta *deltaState) []string {
+			return lo.Map(delta.images.list(), func(img *image, _ int) string { return img.name })
+		}
+
+		delta := newTestController(logrus.New(), config.ImageScan{
+			ExcludedNamespaces: []string{"vendor-*"},
+			IncludedNamespaces: []string{"vendor-*", "team-*"},
+		}).delta
+		delta.upsert(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		delta.upsert(createPod("vendor-a", "vendor:v1"))
+		delta.upsert(createPod("default", "default:v1"))
+		delta.upsert(createPod("team-a", "team-a:v1"))
+		delta.upsert(createPod("team-b", "team-b:v1"))
+		r.ElementsMatch([]string{"team-a:v1", "team-b:v1"}, imageNames(delta))
+
+		// Images of newly excluded namespaces are removed.
+		r.Equal(1, delta.setExcludedNamespaces([]string{"vendor-*", "team-b"}))
+		r.ElementsMatch([]string{"team-a:v1"}, imageNames(delta))
+		r.Equal(0, delta.setExcludedNamespaces([]string{"vendor-*", "team-b"}))
+	})
+
+	t.Run("purge pending pods and pull errors of newly excluded namespaces", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		delta.upsert(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+
+		newPod := func(namespace, nodeName string, phase corev1.PodPhase, status corev1.ContainerStatus) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID:       types.UID(uuid.New().String()),
+					Namespace: namespace,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: namespace + "/app:v1"}},
+					NodeName:   nodeName,
+				},
+				Status: corev1.PodStatus{
+					Phase:             phase,
+					ContainerStatuses: []corev1.ContainerStatus{status},
+				},
+			}
+		}
+		pullFailed := corev1.ContainerStatus{
+			Name:  "app",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}},
+		}
+		running := corev1.ContainerStatus{Name: "app", ImageID: "appid"}
+		delta.upsert(newPod("team-a", "node1", corev1.PodPending, pullFailed))
+		delta.upsert(newPod("team-b", "node1", corev1.PodPending, pullFailed))
+		delta.upsert(newPod("team-a", "node2", corev1.PodRunning, running))
+		delta.upsert(newPod("team-b", "node2", corev1.PodRunning, running))
+		r.Len(delta.getImagePullErrors(), 2)
+		r.Len(delta.pendingPods["node2"], 2)
+
+		delta.setExcludedNamespaces([]string{"team-b"})
+		pullErrors := delta.getImagePullErrors()
+		r.Len(pullErrors, 1)
+		r.Equal("team-a/app:v1", pullErrors[0].name)
+		r.Len(delta.pendingPods["node2"], 1)
+
+		// Pending pods of excluded namespaces are not added once node is received.
+		delta.upsert(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}})
+		r.Empty(delta.pendingPods)
+		r.ElementsMatch([]string{"team-a/app:v1"}, lo.Map(delta.images.list(), func(img *image, _ int) string { return img.name }))
+	})
+
+	t.Run("add images from workload templates without running pods", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		template := func(img string) corev1.PodTemplateSpec {
+			return corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: img}},
+				},
+			}
+		}
+		cronJob := &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{UID: "cronjob", Namespace: "default"},
+			Spec: batchv1.CronJobSpec{
+				JobTemplate: batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{Template: template("backup:1.0")},
+				},
+			},
+		}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{UID: "deployment", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: lo.ToPtr(int32(0)),
+				Template: template("nginx:1.23"),
+			},
+		}
+		delta.upsert(cronJob)
+		delta.upsert(deployment)
+
+		backupImg, found := delta.images.get("backup:1.0amd64backup:1.0")
+		r.True(found)
+		r.True(backupImg.templateImage)
+		r.Equal("backup:1.0", backupImg.id)
+		r.Equal([]string{"cronjob"}, lo.Keys(backupImg.owners))
+		r.True(isImagePending(backupImg, time.Now(), 0))
+		nginxImg, found := delta.images.get("nginx:1.23amd64nginx:1.23")
+		r.True(found)
+		r.Equal([]string{"deployment"}, lo.Keys(nginxImg.owners))
+
+		// Scaled up deployment image is replaced by image of running pod.
+		deployment.Spec.Replicas = lo.ToPtr(int32(1))
+		delta.upsert(deployment)
+		delta.upsert(newTestPod("pod1", "nginx:1.23", "node1"))
+		_, found = delta.images.get("nginx:1.23amd64nginx:1.23")
+		r.False(found)
+		_, found = delta.images.get("nginx:1.23@sha256amd64nginx:1.23")
+		r.True(found)
+
+		// Template image is not added while image is used by running pods.
+		deployment.Spec.Replicas = lo.ToPtr(int32(0))
+		delta.upsert(deployment)
+		_, found = delta.images.get("nginx:1.23amd64nginx:1.23")
+		r.False(found)
+
+		// Template image is removed with its workload.
+		delta.delete(cronJob)
+		_, found = delta.images.get("backup:1.0amd64backup:1.0")
+		r.False(found)
+	})
+
+	t.Run("defer pod images until node is received", func(t *testing.T) {
+		r := require.New(t)
+
+		delta := newTestDelta()
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				UID: types.UID(uuid.New().String()),
+			},
+			Spec: corev1.PodSpec{
+				NodeName:   "arm-node",
+				Containers: []corev1.Container{{Name: "app", Image: "nginx:1.25"}},
+			},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: "nginxid"}},
+			},
+		}
+		delta.upsert(pod)
+		r.Equal(0, delta.images.len())
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "arm-node"},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{Architecture: "arm64", OperatingSystem: "linux"},
+			},
+		})
+		images := delta.images.list()
+		r.Len(images, 1)
+		r.Equal("arm64", images[0].architecture)
+		r.Empty(delta.pendingPods)
+
+		// Pending pod is dropped once it is deleted before its node is received.
+		pod.Spec.NodeName = "other-node"
+		delta.upsert(pod)
+		r.Len(delta.pendingPods["other-node"], 1)
+		delta.delete(pod)
+		r.Empty(delta.pendingPods)
+	})
+
+	t.Run("use default platform when node architecture is unknown", func(t *testing.T) {
+		r := require.New(t)
+
+		delta := newTestDelta()
+		delta.defaultPlatform = platform{architecture: "arm64", os: "linux"}
+		delta.upsert(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		delta.upsert(newTestPod("pod1", "nginx:1.25", "node1"))
+
+		img, found := delta.images.get("nginx:1.25@sha256arm64nginx:1.25")
+		r.True(found)
+		r.Equal("arm64", img.architecture)
+		r.Equal("linux", img.os)
+	})
+
+	t.Run("detect image tag mutation", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		createPod := func(uid, imageID string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID: types.UID(uid),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+					NodeName:   "node1",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "app", ImageID: imageID},
+					},
+				},
+			}
+		}
+
+		delta.upsert(createPod("pod1", "app@sha256:1"))
+		delta.upsert(createPod("pod2", "app@sha256:1"))
+		oldImg, found := delta.images.get("app@sha256:1amd64app:latest")
+		r.True(found)
+		oldImg.scanned = true
+
+		// Tag is re-pushed and pod restarts with new digest.
+		delta.upsert(createPod("pod1", "app@sha256:2"))
+		r.Equal(2, delta.images.len())
+		newImg, found := delta.images.get("app@sha256:2amd64app:latest")
+		r.True(found)
+		r.False(newImg.scanned)
+		r.True(isImagePending(newImg, time.Now().UTC(), 0))
+		r.Len(oldImg.owners, 1)
+		r.Contains(oldImg.owners, "pod2")
+
+		// Once all pods use new digest previous image is removed.
+		delta.upsert(createPod("pod2", "app@sha256:2"))
+		r.Equal(1, delta.images.len())
+		_, found = delta.images.get("app@sha256:1amd64app:latest")
+		r.False(found)
+		r.Len(newImg.owners, 2)
+	})
+
+	t.Run("sweep stale images", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		createPod := func(uid, image string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					UID: types.UID(uid),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: image}},
+					NodeName:   "node1",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{Name: "app", ImageID: image + "id"},
+					},
+				},
+			}
+		}
+
+		stalePod := createPod("pod1", "stale")
+		delta.upsert(stalePod)
+		delta.upsert(createPod("pod2", "used"))
+		delta.delete(stalePod)
+		staleImg, found := delta.images.get("staleidamd64stale")
+		r.True(found)
+		r.Empty(staleImg.owners)
+
+		// Image is kept until retention period passes.
+		r.Equal(0, delta.sweepStaleImages(time.Now().UTC().Add(-time.Hour)))
+		r.Equal(2, delta.images.len())
+
+		r.Equal(1, delta.sweepStaleImages(time.Now().UTC().Add(time.Hour)))
+		r.Equal(1, delta.images.len())
+		_, found = delta.images.get("staleidamd64stale")
+		r.False(found)
+		_, found = delta.images.get("usedidamd64used")
+		r.True(found)
+	})
+
+	t.Run("retry failed images with capped backoff", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+
+		img := newImage()
+		img.key = "img"
+		delta.images.set(img)
+
+		maxDelay := time.Duration(float64(img.retryBackoff.Cap) * (1 + img.retryBackoff.Jitter))
+		for i := 0; i < 20; i++ {
+			before := time.Now().UTC()
+			delta.setImageScanError(img, errors.New("registry unavailable"), time.Now().UTC())
+			r.True(img.nextScan.After(before.Add(time.Minute)), i)
+			r.LessOrEqual(img.nextScan.Sub(before), maxDelay+time.Second, i)
+		}
+		// Image is still retried at capped interval after many failures.
+		r.Greater(img.nextScan.Sub(time.Now().UTC()), img.retryBackoff.Cap-time.Second)
+	})
+
+	t.Run("reset retry backoff after successful scan", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		img := newImage()
+		img.key = "img"
+		delta.images.set(img)
+
+		for i := 0; i < 5; i++ {
+			delta.setImageScanError(img, errors.New("registry unavailable"), time.Now().UTC())
+		}
+		r.Equal(5, img.failures)
+		r.Greater(img.nextScan.Sub(time.Now().UTC()), time.Hour)
+
+		delta.updateImage(img, func(i *image) {
+			i.markScanned(time.Now().UTC())
+			i.resetRetryBackoff()
+		})
+		r.Zero(img.failures)
+		r.True(img.nextScan.IsZero())
+
+		// Next failure is retried with initial backoff.
+		before := time.Now().UTC()
+		delta.setImageScanError(img, errors.New("registry unavailable"), time.Now().UTC())
+		initialDelay := time.Duration(float64(newRetryBackoff().Duration) * (1 + img.retryBackoff.Jitter))
+		r.LessOrEqual(img.nextScan.Sub(before), initialDelay+time.Second)
+	})
+
+	t.Run("repend images with expired scans", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		now := time.Now().UTC()
+
+		addScannedImage := func(id string, scannedAt time.Time) *image {
+			img := newImage()
+			img.id = id
+			img.key = id
+			img.architecture = defaultImageArch
+			img.owners["owner1"] = &imageOwner{}
+			img.markScanned(scannedAt)
+			delta.images.set(img)
+			return img
+		}
+		oldImg := addScannedImage("old", now.Add(-48*time.Hour))
+		freshImg := addScannedImage("fresh", now.Add(-time.Hour))
+
+		r.Equal(1, delta.rependExpiredScans(now.Add(-24*time.Hour)))
+		r.False(oldImg.scanned)
+		r.True(oldImg.forceRescan)
+		r.True(isImagePending(oldImg, now, 0))
+		r.True(freshImg.scanned)
+
+		// Remote scanned state does not override forced rescan.
+		delta.setImageScanned(castai.ScannedImage{ID: "old", Architecture: defaultImageArch}, now)
+		r.False(oldImg.scanned)
+
+		oldImg.markScanned(now)
+		r.False(oldImg.forceRescan)
+		r.Equal(0, delta.rependExpiredScans(now.Add(-24*time.Hour)))
+	})
+
+	t.Run("rescan images after rescan interval", func(t *testing.T) {
+		r := require.New(t)
+		now := time.Now().UTC()
+		rescanInterval := 24 * time.Hour
+
+		newScannedImage := func() *image {
+			img := newImage()
+			img.owners["owner1"] = &imageOwner{}
+			return img
+		}
+
+		localImg := newScannedImage()
+		localImg.markScanned(now.Add(-time.Hour))
+		localImg.lastScannedAt = now.Add(-time.Hour)
+		r.False(isImagePending(localImg, now, rescanInterval))
+		r.True(isImagePending(localImg, now.Add(rescanInterval), rescanInterval))
+		r.False(isImagePending(localImg, now.Add(rescanInterval), 0))
+
+		// Image scanned recently is skipped even if it's not marked as scanned.
+		localImg.scanned = false
+		r.False(isImagePending(localImg, now, rescanInterval))
+
+		remoteImg := newScannedImage()
+		remoteImg.markScanned(now.Add(-48 * time.Hour))
+		r.True(isImagePending(remoteImg, now, rescanInterval))
+
+		r.True(isImagePending(newScannedImage(), now, rescanInterval))
+	})
+
+	t.Run("capture configured owner labels and annotations", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		delta.ownerLabels = []string{"app.kubernetes.io/name", "team"}
+		delta.ownerAnnotations = []string{"owner"}
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		pod := newTestPod("pod1", "nginx:1.23", "node1")
+		pod.Labels = map[string]string{"app.kubernetes.io/name": "web", "team": "platform", "pod-template-hash": "abc"}
+		pod.Annotations = map[string]string{"owner": "alice", "kubectl.kubernetes.io/restartedAt": "now"}
+		delta.upsert(pod)
+
+		img, found := delta.images.get("nginx:1.23@sha256amd64nginx:1.23")
+		r.True(found)
+		r.Equal([]castai.ImageOwner{
+			{
+				ResourceID:  "pod1",
+				Labels:      map[string]string{"app.kubernetes.io/name": "web", "team": "platform"},
+				Annotations: map[string]string{"owner": "alice"},
+			},
+		}, img.ownersMetadata())
+	})
+
+	t.Run("collect image pull secrets of image owners", func(t *testing.T) {
+		r := require.New(t)
+		delta := newTestDelta()
+		delta.upsert(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node1",
+			},
+		})
+
+		pod1 := newTestPod("pod1", "private/app:1.0", "node1")
+		pod1.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}, {Name: "mirror"}}
+		pod2 := newTestPod("pod2", "private/app:1.0", "node1")
+		pod2.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+		pod3 := newTestPod("pod3", "private/app:1.0", "node1")
+		pod3.Namespace = "team"
+		pod3.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+		delta.upsert(pod1)
+		delta.upsert(pod2)
+		delta.upsert(pod3)
+
+		img, found := delta.images.get("private/app:1.0@sha256amd64private/app:1.0")
+		r.True(found)
+		r.Len(img.owners, 3)
+		r.Equal([]types.NamespacedName{
+			{Namespace: "default", Name: "mirror"},
+			{Namespace: "default", Name: "registry"},
+			{Namespace: "team", Name: "registry"},
+		}, img.pullSecrets())
+
+		delta.delete(pod1)
+		delta.delete(pod2)
+		r.Equal([]types.NamespacedName{{Namespace: "team", Name: "registry"}}, img.pullSecrets())
+	})
+
+	t.Run("select node by configured strategy", func(t *testing.T) {
+		newNodes := func() map[string]*node {
+			nodes := map[string]*node{}
+			for name, cpu := range map[string]string{"node1": "1", "node2": "4", "node3": "2"} {
+				cpuQty := resource.MustParse(cpu)
+				memQty := resource.MustParse("4Gi")
+				nodes[name] = &node{
+					name:           name,
+					architecture:   defaultImageArch,
+					os:             defaultImageOs,
+					allocatableCPU: cpuQty.AsDec(),
+					allocatableMem: memQty.AsDec(),
+				}
+			}
+			return nodes
+		}
+		nodeNames := []string{"node1", "node2", "node3"}
+		cpuQty := resource.MustParse("500m")
+		memQty := resource.MustParse("100Mi")
+
+		tests := []struct {
+			strategy      string
+			expectedNodes []string
+		}{
+			{strategy: config.NodeSelectionLeastLoaded, expectedNodes: []string{"node2", "node2"}},
+			{strategy: config.NodeSelectionMostLoaded, expectedNodes: []string{"node1", "node1"}},
+			{strategy: config.NodeSelectionRoundRobin, expectedNodes: []string{"node1", "node2", "node3", "node1"}},
+		}
+
+		for _, test := range tests {
+			t.Run(test.strategy, func(t *testing.T) {
+				r := require.New(t)
+				delta := newTestDelta()
+				delta.nodeSelectionStrategy = test.strategy
+				delta.nodes = newNodes()
+
+				var selected []string
+				for range test.expectedNodes {
+					nodeName, err := delta.findBestNode(nodeNames, memQty.AsDec(), cpuQty.AsDec())
+					r.NoError(err)
+					selected = append(selected, nodeName)
+				}
+				r.Equal(test.expectedNodes, selected)
+			})
+		}
+	})
 }
 
 func newTestDelta() *deltaState {
-	return newDeltaState(&mockKubeController{})
+	return newDeltaState(&mockKubeController{}, nil)
 }
@@ -1,9 +1,16 @@
 package imagescan
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"regexp"
 	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/castai/kvisor/castai"
+	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
 )
 
 const (
@@ -15,8 +22,72 @@ var (
 
 	errImageScanLayerNotFound = errors.New("image layer not found")
 	errPrivateImage           = errors.New("private image")
+	// Private image errors are distinguished by registry error code as each needs different remediation.
+	errPrivateImageUnauthorized = fmt.Errorf("%w: registry authentication required", errPrivateImage)
+	errPrivateImageNotFound     = fmt.Errorf("%w: image manifest not found", errPrivateImage)
+	errPrivateImageDenied       = fmt.Errorf("%w: registry access denied", errPrivateImage)
+	errPrivateImageUnreachable  = fmt.Errorf("%w: registry connection refused", errPrivateImage)
+	errScanJobOOMKilled         = errors.New("scan job pod was OOMKilled, consider increasing scan job memory limit")
+	errScanJobEvicted           = errors.New("scan job pod was evicted")
+	errScanTimeout              = errors.New("image scan timed out")
+	errTrivyServerUnreachable   = errors.New("trivy server unreachable")
 )
 
+// jobErrors maps error codes written by scan job to termination message to scan errors.
+var jobErrors = map[imgcollectorconfig.ErrorCode]error{
+	imgcollectorconfig.ErrorCodeUnauthorized:           errPrivateImageUnauthorized,
+	imgcollectorconfig.ErrorCodeManifestUnknown:        errPrivateImageNotFound,
+	imgcollectorconfig.ErrorCodeDenied:                 errPrivateImageDenied,
+	imgcollectorconfig.ErrorCodeConnectionRefused:      errPrivateImageUnreachable,
+	imgcollectorconfig.ErrorCodeLayerNotFound:          errImageScanLayerNotFound,
+	imgcollectorconfig.ErrorCodeTimeout:                errScanTimeout,
+	imgcollectorconfig.ErrorCodeTrivyServerUnreachable: errTrivyServerUnreachable,
+}
+
+// scanErrorKind is class of image scan error which decides how image is scanned next time.
+type scanErrorKind int
+
+const (
+	scanErrorUnknown scanErrorKind = iota
+	scanErrorPrivate
+	scanErrorLayerNotFound
+	// scanErrorTimeout is scan job which didn't finish in time, either killed by job deadline or by scan context.
+	scanErrorTimeout
+	// scanErrorTrivyServer is failure to reach external trivy server. It's not related to image, so neither private
+	// image nor hostfs fallbacks apply.
+	scanErrorTrivyServer
+)
+
+func classifyScanError(err error) scanErrorKind {
+	switch {
+	case errors.Is(err, errPrivateImage):
+		return scanErrorPrivate
+	case errors.Is(err, errImageScanLayerNotFound):
+		return scanErrorLayerNotFound
+	case errors.Is(err, errTrivyServerUnreachable):
+		return scanErrorTrivyServer
+	case errors.Is(err, errScanTimeout), errors.Is(err, context.DeadlineExceeded):
+		return scanErrorTimeout
+	default:
+		return scanErrorUnknown
+	}
+}
+
+// scanJobEventsError attaches warning events of scan job and its pod to scan error. Events are kept when error
+// is parsed from job logs as scheduling failures never produce any job logs.
+type scanJobEventsError struct {
+	err    error
+	events []string
+}
+
+func (e *scanJobEventsError) Error() string {
+	return fmt.Sprintf("%v, events: %s", e.err, strings.Join(e.events, "; "))
+}
+
+func (e *scanJobEventsError) Unwrap() error {
+	return e.err
+}
+
 type Log struct {
 	Timestamp string
 	Level     string
@@ -24,17 +95,28 @@ type Log struct {
 	Component string
 }
 
-func isPrivateImageError(rawErr error) bool {
-	errStr := strings.ToLower(rawErr.Error())
+// privateImageErrors maps registry error codes to private image errors.
+// Error codes from https://github.com/google/go-containerregistry/blob/190ad0e4d556f199a07951d55124f8a394ebccd9/pkg/v1/remote/transport/error.go#L115
+// Connection refused error can happen for localhost image.
+var privateImageErrors = []struct {
+	code string
+	err  error
+}{
+	{code: "unauthorized", err: errPrivateImageUnauthorized},
+	{code: "manifest_unknown", err: errPrivateImageNotFound},
+	{code: "denied", err: errPrivateImageDenied},
+	{code: "connection refused", err: errPrivateImageUnreachable},
+}
 
-	// Error codes from https://github.com/google/go-containerregistry/blob/190ad0e4d556f199a07951d55124f8a394ebccd9/pkg/v1/remote/transport/error.go#L115
-	// Connection refused error can happen for localhost image.
-	for _, errPart := range []string{"unauthorized", "manifest_unknown", "denied", "connection refused"} {
-		if strings.Contains(errStr, errPart) {
-			return true
+// privateImageError returns private image error matching registry error code in job logs or nil if image is not private.
+func privateImageError(rawErr error) error {
+	errStr := strings.ToLower(rawErr.Error())
+	for _, v := range privateImageErrors {
+		if strings.Contains(errStr, v.code) {
+			return v.err
 		}
 	}
-	return false
+	return nil
 }
 
 func isHostFSError(rawErr error) bool {
@@ -42,8 +124,27 @@ func isHostFSError(rawErr error) bool {
 }
 
 func parseErrorFromLog(rawErr error) error {
-	if isPrivateImageError(rawErr) {
-		return errPrivateImage
+	if eventsErr, ok := rawErr.(*scanJobEventsError); ok {
+		return &scanJobEventsError{err: parseErrorFromLog(eventsErr.err), events: eventsErr.events}
+	}
+	if errors.Is(rawErr, errScanJobOOMKilled) {
+		return errScanJobOOMKilled
+	}
+	if errors.Is(rawErr, errScanJobEvicted) {
+		return errScanJobEvicted
+	}
+	// Errors classified by scan job are returned as is. Job logs are parsed only for jobs which didn't classify error.
+	for _, jobErr := range jobErrors {
+		if errors.Is(rawErr, jobErr) {
+			return rawErr
+		}
+	}
+	if errors.Is(rawErr, context.DeadlineExceeded) {
+		return rawErr
+	}
+	// Jobs can fail without error code, eg. with older collector image, so logs are still matched as fallback.
+	if err := privateImageError(rawErr); err != nil {
+		return err
 	}
 	if isHostFSError(rawErr) {
 		return errImageScanLayerNotFound
@@ -61,6 +162,80 @@ func parseErrorFromLog(rawErr error) error {
 	return rawErr
 }
 
+// classifyJobPodFailure returns specific error if scan job pod was killed by kubernetes or scan job classified
+// its failure in container termination message.
+func classifyJobPodFailure(pod *corev1.Pod) error {
+	if pod.Status.Reason == "Evicted" {
+		return errScanJobEvicted
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			return errScanJobOOMKilled
+		}
+	}
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil {
+			if err, found := jobErrors[imgcollectorconfig.ErrorCode(strings.TrimSpace(terminated.Message))]; found {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// imageScanErrorStatus returns image status reported for failed scan.
+func imageScanErrorStatus(err error) castai.ImageScanStatus {
+	switch {
+	case errors.Is(err, errScanJobOOMKilled):
+		return castai.ImageScanStatusOOMKilled
+	case errors.Is(err, errScanJobEvicted):
+		return castai.ImageScanStatusEvicted
+	default:
+		return castai.ImageScanStatusError
+	}
+}
+
+// privateImageReason returns reason why image is private. Empty reason is returned for other errors.
+func privateImageReason(err error) castai.PrivateImageReason {
+	switch {
+	case errors.Is(err, errPrivateImageUnauthorized):
+		return castai.PrivateImageReasonUnauthorized
+	case errors.Is(err, errPrivateImageNotFound):
+		return castai.PrivateImageReasonNotFound
+	case errors.Is(err, errPrivateImageDenied):
+		return castai.PrivateImageReasonDenied
+	case errors.Is(err, errPrivateImageUnreachable):
+		return castai.PrivateImageReasonUnreachable
+	default:
+		return ""
+	}
+}
+
+// imageScanErrorRemediation returns hint how to fix known scan errors. Empty hint is returned for unknown errors.
+func imageScanErrorRemediation(err error) string {
+	switch {
+	case errors.Is(err, errPrivateImageNotFound):
+		return "Image manifest was not found in registry. Check that image name and tag or digest are correct."
+	case errors.Is(err, errPrivateImageDenied):
+		return "Registry credentials have no access to the image. Grant pull access to the image repository for credentials of image pull secret (imageScan.pullSecret)."
+	case errors.Is(err, errPrivateImage):
+		return "Image registry requires authentication. Add image pull secret with registry credentials (imageScan.pullSecret) or enable hostfs scan mode to read image from the node."
+	case errors.Is(err, errImageScanLayerNotFound):
+		return "Image layers are not available on the node, image is scanned remotely. Allow access to image registry from the cluster."
+	case errors.Is(err, errScanJobOOMKilled):
+		return "Increase image scan job memory limit (imageScan.memoryLimit)."
+	case errors.Is(err, errScanTimeout):
+		return "Increase image scan timeout (imageScan.scanTimeout) or configure dedicated scan node pool (imageScan.nodePool)."
+	case errors.Is(err, errScanJobEvicted):
+		return "Scan job was evicted because of node pressure. Configure dedicated scan node pool (imageScan.nodePool) or increase scan job resource requests."
+	case errors.Is(err, errTrivyServerUnreachable):
+		return "Scan job can't reach trivy server. Check that trivy server address (imageScan.trivyServerAddr) is correct and the server is reachable from the cluster."
+	default:
+		return ""
+	}
+}
+
 func parseLogrusLog(logMessage string) []Log {
 	var logs []Log
 	lines := strings.Split(logMessage, "\n")
@@ -1,49 +1,71 @@
 package imagescan
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/castai/kvisor/castai"
+	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
 )
 
-func TestIsPrivateImageErr(t *testing.T) {
+func TestPrivateImageError(t *testing.T) {
 	tests := []struct {
-		name            string
-		err             error
-		expectedPrivate bool
+		name           string
+		err            error
+		expectedErr    error
+		expectedReason castai.PrivateImageReason
 	}{
-		{name: "unauthorized upper case", err: errors.New("can't get image: UNAUTHORIZED image"), expectedPrivate: true},
-		{name: "unauthorized pascal case", err: errors.New("can't get image: Unauthorized image"), expectedPrivate: true},
-		{name: "manifest_unknown", err: errors.New("can't get image: MANIFEST_UNKNOWN image"), expectedPrivate: true},
-		{name: "denied", err: errors.New("can't get image: DENIED image"), expectedPrivate: true},
-		{name: "connection refused", err: errors.New("can't get image: connection refused image"), expectedPrivate: true},
-		{name: "context canceled", err: errors.New("can't get image: context canceled"), expectedPrivate: false},
+		{name: "unauthorized", err: fmt.Errorf("wait for completion: %w", errPrivateImageUnauthorized), expectedErr: errPrivateImageUnauthorized, expectedReason: castai.PrivateImageReasonUnauthorized},
+		{name: "manifest unknown", err: fmt.Errorf("wait for completion: %w", errPrivateImageNotFound), expectedErr: errPrivateImageNotFound, expectedReason: castai.PrivateImageReasonNotFound},
+		{name: "denied", err: fmt.Errorf("wait for completion: %w", errPrivateImageDenied), expectedErr: errPrivateImageDenied, expectedReason: castai.PrivateImageReasonDenied},
+		{name: "connection refused", err: fmt.Errorf("wait for completion: %w", errPrivateImageUnreachable), expectedErr: errPrivateImageUnreachable, expectedReason: castai.PrivateImageReasonUnreachable},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := require.New(t)
-			r.Equal(test.expectedPrivate, isPrivateImageError(test.err))
+			err := parseErrorFromLog(test.err)
+			r.ErrorIs(err, test.expectedErr)
+			r.ErrorIs(err, errPrivateImage)
+			r.Equal(test.expectedReason, privateImageReason(err))
 		})
 	}
+
+	t.Run("not private image", func(t *testing.T) {
+		r := require.New(t)
+		r.Empty(privateImageReason(parseErrorFromLog(errors.New("context canceled"))))
+	})
+
+	t.Run("registry error text without job error code", func(t *testing.T) {
+		r := require.New(t)
+		err := parseErrorFromLog(errors.New("can't get image: UNAUTHORIZED: authentication required"))
+		r.ErrorIs(err, errPrivateImageUnauthorized)
+		r.Equal(castai.PrivateImageReasonUnauthorized, privateImageReason(err))
+	})
 }
 
 func TestParseErrorFromLog(t *testing.T) {
-	t.Run("PrivateImageError", func(t *testing.T) {
-		rawErr := errors.New(`time="2023-11-03T12:34:56Z" level=error msg="unauthorized: authentication required" component=image-scan`)
-		result := parseErrorFromLog(rawErr)
-		if !errors.Is(result, errPrivateImage) {
-			t.Errorf("Expected %v, but got %v", errPrivateImage, result)
-		}
+	t.Run("PrivateImageErrorWithoutErrorCode", func(t *testing.T) {
+		r := require.New(t)
+		rawErr := errors.New(`scan job failed: time="2023-11-03T12:34:56Z" level=fatal msg="GET https://registry/v2/: DENIED: requested access to the resource is denied" component=image-scan`)
+		r.ErrorIs(parseErrorFromLog(rawErr), errPrivateImageDenied)
 	})
 
-	t.Run("HostFSError", func(t *testing.T) {
-		rawErr := errors.New(`time="2023-11-03T12:34:56Z" level=error msg="no such file or directory" component=image-scan`)
-		result := parseErrorFromLog(rawErr)
-		if !errors.Is(result, errImageScanLayerNotFound) {
-			t.Errorf("Expected %v, but got %v", errImageScanLayerNotFound, result)
-		}
+	t.Run("HostFSErrorWithoutErrorCode", func(t *testing.T) {
+		r := require.New(t)
+		rawErr := errors.New(`scan job failed: time="2023-11-03T12:34:56Z" level=error msg="failed to get the layer: no such file or directory" component=image-scan`)
+		r.ErrorIs(parseErrorFromLog(rawErr), errImageScanLayerNotFound)
+	})
+
+	t.Run("ContextDeadline", func(t *testing.T) {
+		r := require.New(t)
+		rawErr := fmt.Errorf("wait for completion: %w", context.DeadlineExceeded)
+		r.Equal(scanErrorTimeout, classifyScanError(parseErrorFromLog(rawErr)))
 	})
 
 	t.Run("LogsWithErrors", func(t *testing.T) {
@@ -70,3 +92,143 @@ func TestParseErrorFromLog(t *testing.T) {
 		require.EqualError(t, expectedErr, result.Error())
 	})
 }
+
+func TestClassifyJobPodFailure(t *testing.T) {
+	t.Run("oom killed container", func(t *testing.T) {
+		r := require.New(t)
+
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "collector",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								Reason:   "OOMKilled",
+								ExitCode: 137,
+							},
+						},
+					},
+				},
+			},
+		}
+
+		err := classifyJobPodFailure(pod)
+		r.ErrorIs(err, errScanJobOOMKilled)
+		r.ErrorIs(parseErrorFromLog(fmt.Errorf("wait for completion: %w", err)), errScanJobOOMKilled)
+		r.Equal(castai.ImageScanStatusOOMKilled, imageScanErrorStatus(err))
+	})
+
+	t.Run("evicted pod", func(t *testing.T) {
+		r := require.New(t)
+
+		err := classifyJobPodFailure(&corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase:  corev1.PodFailed,
+				Reason: "Evicted",
+			},
+		})
+		r.ErrorIs(err, errScanJobEvicted)
+		r.Equal(castai.ImageScanStatusEvicted, imageScanErrorStatus(err))
+	})
+
+	t.Run("error code in termination message", func(t *testing.T) {
+		r := require.New(t)
+
+		tests := map[imgcollectorconfig.ErrorCode]error{
+			imgcollectorconfig.ErrorCodeUnauthorized:           errPrivateImageUnauthorized,
+			imgcollectorconfig.ErrorCodeManifestUnknown:        errPrivateImageNotFound,
+			imgcollectorconfig.ErrorCodeDenied:                 errPrivateImageDenied,
+			imgcollectorconfig.ErrorCodeConnectionRefused:      errPrivateImageUnreachable,
+			imgcollectorconfig.ErrorCodeLayerNotFound:          errImageScanLayerNotFound,
+			imgcollectorconfig.ErrorCodeTimeout:                errScanTimeout,
+			imgcollectorconfig.ErrorCodeTrivyServerUnreachable: errTrivyServerUnreachable,
+		}
+		for code, expectedErr := range tests {
+			err := classifyJobPodFailure(&corev1.Pod{
+				Status: corev1.PodStatus{
+					Phase: corev1.PodFailed,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1, Message: string(code)},
+							},
+						},
+					},
+				},
+			})
+			r.ErrorIs(err, expectedErr, code)
+			r.ErrorIs(parseErrorFromLog(fmt.Errorf("wait for completion: %w", err)), expectedErr, code)
+		}
+	})
+
+	t.Run("failed container", func(t *testing.T) {
+		r := require.New(t)
+
+		err := classifyJobPodFailure(&corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+						},
+					},
+				},
+			},
+		})
+		r.NoError(err)
+		r.Equal(castai.ImageScanStatusError, imageScanErrorStatus(errors.New("scan job failed")))
+	})
+}
+
+func TestImageScanErrorRemediation(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		contains string
+	}{
+		{name: "private image", err: errPrivateImageUnauthorized, contains: "pull secret"},
+		{name: "image not found", err: errPrivateImageNotFound, contains: "image name"},
+		{name: "access denied", err: errPrivateImageDenied, contains: "Grant pull access"},
+		{name: "layer not found", err: errImageScanLayerNotFound, contains: "registry"},
+		{name: "timeout", err: fmt.Errorf("wait for completion: %w", errScanTimeout), contains: "scan timeout"},
+		{name: "oom killed", err: errScanJobOOMKilled, contains: "memory limit"},
+		{name: "evicted", err: errScanJobEvicted, contains: "node pool"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Contains(imageScanErrorRemediation(test.err), test.contains)
+		})
+	}
+
+	t.Run("unknown error", func(t *testing.T) {
+		r := require.New(t)
+		r.Empty(imageScanErrorRemediation(errors.New("ups")))
+	})
+}
+
+func TestClassifyScanError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected scanErrorKind
+	}{
+		{name: "private image", err: errPrivateImageDenied, expected: scanErrorPrivate},
+		{name: "layer not found", err: fmt.Errorf("scan failed: %w", errImageScanLayerNotFound), expected: scanErrorLayerNotFound},
+		{name: "trivy server unreachable", err: fmt.Errorf("wait for completion: %w", errTrivyServerUnreachable), expected: scanErrorTrivyServer},
+		{name: "scan job deadline", err: fmt.Errorf("wait for completion: %w", errScanTimeout), expected: scanErrorTimeout},
+		{name: "scan context deadline", err: fmt.Errorf("wait for completion: %w", context.DeadlineExceeded), expected: scanErrorTimeout},
+		{name: "unknown", err: errors.New("ups"), expected: scanErrorUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(test.expected, classifyScanError(test.err))
+		})
+	}
+}
@@ -31,6 +31,13 @@ type HTTPHandler struct {
 
 // HandleImageMetadata receives image metadata from scan job and sends it to CAST AI platform.
 func (h *HTTPHandler) HandleImageMetadata(w http.ResponseWriter, r *http.Request) {
+	if !h.ctrl.IsReady() {
+		// Scan job retries sending results on retryable statuses.
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		h.log.Error(err)
@@ -43,15 +50,88 @@ func (h *HTTPHandler) HandleImageMetadata(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	h.ctrl.delta.mu.Lock()
+	result := imageScanResult{
+		findings:        md.Findings,
+		vulnerabilities: md.Vulnerabilities,
+		// Scan job matches vulnerabilities with external trivy server or with trivy database if reports are enabled.
+		vulnerabilitiesMatched: h.ctrl.cfg.TrivyServerAddr != "" || h.ctrl.cfg.VulnerabilityReports,
+	}
+	rescan := h.ctrl.delta.setImageRescan(md.ImageID, md.Architecture, result)
+	h.ctrl.delta.mu.Unlock()
+	md.ResolvedFindings = rescan.resolvedFindings
+	md.ResolvedVulnerabilities = rescan.resolvedVulnerabilities
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := h.client.SendImageMetadata(ctx, &md); err != nil {
 		h.log.Errorf("sending image report: %v", err)
+		// Failed reports are retried by scan job, so they must resolve the same findings.
+		h.ctrl.delta.mu.Lock()
+		h.ctrl.delta.revertImageRescan(rescan)
+		h.ctrl.delta.mu.Unlock()
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+// ImageState is image scan state returned by debug state handler.
+type ImageState struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Architecture string    `json:"architecture"`
+	Scanned      bool      `json:"scanned"`
+	Failures     int       `json:"failures"`
+	LastScanErr  string    `json:"lastScanErr,omitempty"`
+	NextScan     time.Time `json:"nextScan"`
+	Owners       int       `json:"owners"`
+	Nodes        int       `json:"nodes"`
+	// ScanModeFallback is reason why the last scan fell back to remote mode.
+	ScanModeFallback string `json:"scanModeFallback,omitempty"`
+	// NodesNotReady is set when image is not scanned and all nodes with the image are not ready.
+	NodesNotReady bool `json:"nodesNotReady,omitempty"`
+}
+
+// HandleDebugGetImagesState returns current scan state of all tracked images as JSON.
+func (h *HTTPHandler) HandleDebugGetImagesState(w http.ResponseWriter, r *http.Request) {
+	// Copy state while holding the lock and encode response after it is released
+	// so slow clients don't block delta updates.
+	h.ctrl.delta.mu.Lock()
+	images := lo.Map(h.ctrl.delta.images.list(), func(item *image, index int) ImageState {
+		errStr := ""
+		if item.lastScanErr != nil {
+			errStr = item.lastScanErr.Error()
+		}
+		return ImageState{
+			ID:               item.id,
+			Name:             item.name,
+			Architecture:     item.architecture,
+			Scanned:          item.scanned,
+			Failures:         item.failures,
+			LastScanErr:      errStr,
+			NextScan:         item.nextScan,
+			Owners:           len(item.owners),
+			Nodes:            len(item.nodes),
+			ScanModeFallback: string(item.scanModeFallback),
+			NodesNotReady:    !item.scanned && h.ctrl.delta.isImageOnNotReadyNodesOnly(item),
+		}
+	})
+	h.ctrl.delta.mu.Unlock()
+
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Name != images[j].Name {
+			return images[i].Name < images[j].Name
+		}
+		return images[i].Architecture < images[j].Architecture
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(images); err != nil {
+		h.log.Errorf("debug get images state: %v", err)
+	}
+}
+
 func (h *HTTPHandler) HandleDebugGetImages(w http.ResponseWriter, r *http.Request) {
 	type Image struct {
 		Key     string
@@ -70,10 +150,13 @@ func (h *HTTPHandler) HandleDebugGetImages(w http.ResponseWriter, r *http.Reques
 		Images      []Image
 	}
 
+	// Copy state while holding the lock and render response after it is released
+	// so slow clients don't block delta updates.
+	h.ctrl.delta.mu.Lock()
 	model := Model{
 		NodesCount:  len(h.ctrl.delta.nodes),
-		ImagesCount: len(h.ctrl.delta.images),
-		Images: lo.Map(lo.Values(h.ctrl.delta.images), func(item *image, index int) Image {
+		ImagesCount: h.ctrl.delta.images.len(),
+		Images: lo.Map(h.ctrl.delta.images.list(), func(item *image, index int) Image {
 			var pods int
 			for _, owner := range item.owners {
 				pods += len(owner.podIDs)
@@ -98,6 +181,8 @@ func (h *HTTPHandler) HandleDebugGetImages(w http.ResponseWriter, r *http.Reques
 			}
 		}),
 	}
+	h.ctrl.delta.mu.Unlock()
+
 	sort.Slice(model.Images, func(i, j int) bool {
 		return model.Images[i].Name < model.Images[j].Name
 	})
@@ -192,8 +277,10 @@ func (h *HTTPHandler) HandleDebugGetImage(w http.ResponseWriter, r *http.Request
 	}
 
 	key := r.URL.Query().Get("key")
-	item, found := h.ctrl.delta.images[key]
+	h.ctrl.delta.mu.Lock()
+	item, found := h.ctrl.delta.images.get(key)
 	if !found {
+		h.ctrl.delta.mu.Unlock()
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = w.Write([]byte("image not found, key=" + key))
 		return
@@ -215,6 +302,7 @@ func (h *HTTPHandler) HandleDebugGetImage(w http.ResponseWriter, r *http.Request
 	for nodeName := range item.nodes {
 		model.Nodes = append(model.Nodes, Node{Name: nodeName})
 	}
+	h.ctrl.delta.mu.Unlock()
 
 	tmpl := template.Must(template.New("html").Parse(`
 	<h1>Image Details</h1>
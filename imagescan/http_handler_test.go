@@ -0,0 +1,222 @@
+package imagescan
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	json "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	t.Run("accept image metadata only when controller is ready", func(t *testing.T) {
+		r := require.New(t)
+		log := logrus.New()
+		mockctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(mockctrl)
+		ctrl := newTestController(log, config.ImageScan{})
+		handler := NewHttpHandlers(log, client, ctrl)
+
+		send := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/v1/image-scan/report", bytes.NewBufferString(`{"imageName":"nginx"}`))
+			rec := httptest.NewRecorder()
+			handler.HandleImageMetadata(rec, req)
+			return rec
+		}
+
+		rec := send()
+		r.Equal(http.StatusServiceUnavailable, rec.Code)
+		r.Equal("5", rec.Header().Get("Retry-After"))
+
+		ctrl.ready.Store(true)
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{ImageName: "nginx"}).Return(nil)
+		rec = send()
+		r.Equal(http.StatusOK, rec.Code)
+	})
+
+	t.Run("report resolved vulnerabilities when image is rescanned", func(t *testing.T) {
+		r := require.New(t)
+		log := logrus.New()
+		mockctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(mockctrl)
+		ctrl := newTestController(log, config.ImageScan{TrivyServerAddr: "http://trivy:4954"})
+		ctrl.ready.Store(true)
+		handler := NewHttpHandlers(log, client, ctrl)
+
+		img := newImage()
+		img.key = "nginx@sha256amd64"
+		img.id = "nginx@sha256"
+		img.architecture = "amd64"
+		ctrl.delta.images.set(img)
+
+		send := func(vulnerabilities ...castai.ImageVulnerability) *httptest.ResponseRecorder {
+			body, err := json.Marshal(castai.ImageMetadata{ImageID: "nginx@sha256", Architecture: "amd64", Vulnerabilities: vulnerabilities})
+			r.NoError(err)
+			req := httptest.NewRequest(http.MethodPost, "/v1/image-scan/report", bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+			handler.HandleImageMetadata(rec, req)
+			return rec
+		}
+
+		openssl := castai.ImageVulnerability{ID: "CVE-2023-1", PkgName: "openssl", Severity: castai.SeverityCritical}
+		zlib := castai.ImageVulnerability{ID: "CVE-2023-2", PkgName: "zlib", Severity: castai.SeverityLow}
+
+		// Remote state is not read, vulnerabilities are diffed with the previous result sent by agent.
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{
+			ImageID:         "nginx@sha256",
+			Architecture:    "amd64",
+			Vulnerabilities: []castai.ImageVulnerability{openssl, zlib},
+		}).Return(nil)
+		r.Equal(http.StatusOK, send(openssl, zlib).Code)
+
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{
+			ImageID:                 "nginx@sha256",
+			Architecture:            "amd64",
+			Vulnerabilities:         []castai.ImageVulnerability{zlib},
+			ResolvedVulnerabilities: []castai.ImageVulnerability{openssl},
+		}).Return(nil)
+		r.Equal(http.StatusOK, send(zlib).Code)
+
+		// Resolution is reported once.
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{
+			ImageID:         "nginx@sha256",
+			Architecture:    "amd64",
+			Vulnerabilities: []castai.ImageVulnerability{zlib},
+		}).Return(nil)
+		r.Equal(http.StatusOK, send(zlib).Code)
+	})
+
+	t.Run("do not resolve vulnerabilities without previous matched result", func(t *testing.T) {
+		r := require.New(t)
+		log := logrus.New()
+		mockctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(mockctrl)
+		ctrl := newTestController(log, config.ImageScan{TrivyServerAddr: "http://trivy:4954"})
+		ctrl.ready.Store(true)
+		handler := NewHttpHandlers(log, client, ctrl)
+
+		// Image was scanned before agent restart, previous result is not known.
+		img := newImage()
+		img.key = "nginx@sha256amd64"
+		img.id = "nginx@sha256"
+		img.architecture = "amd64"
+		img.scanned = true
+		ctrl.delta.images.set(img)
+
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{
+			ImageID:      "nginx@sha256",
+			Architecture: "amd64",
+		}).Return(nil)
+		req := httptest.NewRequest(http.MethodPost, "/v1/image-scan/report", bytes.NewBufferString(`{"imageID":"nginx@sha256","architecture":"amd64"}`))
+		rec := httptest.NewRecorder()
+		handler.HandleImageMetadata(rec, req)
+		r.Equal(http.StatusOK, rec.Code)
+	})
+
+	t.Run("report resolved findings when image is rescanned", func(t *testing.T) {
+		r := require.New(t)
+		log := logrus.New()
+		mockctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(mockctrl)
+		ctrl := newTestController(log, config.ImageScan{})
+		ctrl.ready.Store(true)
+		handler := NewHttpHandlers(log, client, ctrl)
+
+		img := newImage()
+		img.key = "nginx@sha256amd64"
+		img.id = "nginx@sha256"
+		img.architecture = "amd64"
+		ctrl.delta.images.set(img)
+
+		send := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/v1/image-scan/report", bytes.NewBufferString(body))
+			rec := httptest.NewRecorder()
+			handler.HandleImageMetadata(rec, req)
+			return rec
+		}
+
+		runsAsRoot := castai.ImageFinding{ID: castai.ImageFindingRunsAsRoot, Message: "runs as root"}
+		schemaV1 := castai.ImageFinding{ID: castai.ImageFindingManifestSchema1, Message: "schema v1"}
+
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{
+			ImageID:      "nginx@sha256",
+			Architecture: "amd64",
+			Findings:     []castai.ImageFinding{runsAsRoot, schemaV1},
+		}).Return(nil)
+		rec := send(`{"imageID":"nginx@sha256","architecture":"amd64","findings":[{"id":"image-runs-as-root","message":"runs as root"},{"id":"image-manifest-schema-v1","message":"schema v1"}]}`)
+		r.Equal(http.StatusOK, rec.Code)
+
+		// Failed report keeps previous findings so resolutions are sent on retry.
+		expected := &castai.ImageMetadata{
+			ImageID:          "nginx@sha256",
+			Architecture:     "amd64",
+			Findings:         []castai.ImageFinding{schemaV1},
+			ResolvedFindings: []castai.ImageFinding{runsAsRoot},
+		}
+		client.EXPECT().SendImageMetadata(gomock.Any(), expected).Return(errors.New("ups"))
+		client.EXPECT().SendImageMetadata(gomock.Any(), expected).Return(nil)
+		rescan := `{"imageID":"nginx@sha256","architecture":"amd64","findings":[{"id":"image-manifest-schema-v1","message":"schema v1"}]}`
+		rec = send(rescan)
+		r.Equal(http.StatusInternalServerError, rec.Code)
+		rec = send(rescan)
+		r.Equal(http.StatusOK, rec.Code)
+
+		client.EXPECT().SendImageMetadata(gomock.Any(), &castai.ImageMetadata{
+			ImageID:      "nginx@sha256",
+			Architecture: "amd64",
+			Findings:     []castai.ImageFinding{schemaV1},
+		}).Return(nil)
+		rec = send(rescan)
+		r.Equal(http.StatusOK, rec.Code)
+	})
+
+	t.Run("return images scan state", func(t *testing.T) {
+		r := require.New(t)
+		log := logrus.New()
+		ctrl := newTestController(log, config.ImageScan{})
+		handler := NewHttpHandlers(log, nil, ctrl)
+
+		nextScan := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		img := newImage()
+		img.key = "nginx@sha256amd64"
+		img.id = "nginx@sha256"
+		img.name = "nginx"
+		img.architecture = "amd64"
+		img.failures = 2
+		img.lastScanErr = errors.New("ups")
+		img.nextScan = nextScan
+		img.owners["r1"] = &imageOwner{}
+		img.nodes["node1"] = &imageNode{}
+		ctrl.delta.images.set(img)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/image-scan/state", nil)
+		rec := httptest.NewRecorder()
+		handler.HandleDebugGetImagesState(rec, req)
+		r.Equal(http.StatusOK, rec.Code)
+
+		var res []ImageState
+		r.NoError(json.Unmarshal(rec.Body.Bytes(), &res))
+		r.Equal([]ImageState{
+			{
+				ID:           "nginx@sha256",
+				Name:         "nginx",
+				Architecture: "amd64",
+				Failures:     2,
+				LastScanErr:  "ups",
+				NextScan:     nextScan,
+				Owners:       1,
+				Nodes:        1,
+			},
+		}, res)
+	})
+}
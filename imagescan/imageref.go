@@ -0,0 +1,91 @@
+package imagescan
+
+import (
+	"path"
+	"strings"
+)
+
+// imageReference contains container spec image reference and reference used for scanning.
+type imageReference struct {
+	// name is reference as defined in container spec. It's reported as image name and is part of image cache key.
+	name string
+	// scanName is reference pinned to digest when digest is known, so the exact image is scanned.
+	scanName string
+}
+
+func parseImageReference(ref string) imageReference {
+	name, digest, found := strings.Cut(ref, "@")
+	if !found || digest == "" {
+		return imageReference{
+			name:     ref,
+			scanName: ref,
+		}
+	}
+
+	return imageReference{
+		name:     ref,
+		scanName: trimImageTag(name) + "@" + digest,
+	}
+}
+
+// withImageID pins scan name to digest of running image. Container status image ID contains repository digest,
+// eg. docker.io/library/nginx@sha256:..., even if container spec references image by tag. Scan name is not changed
+// if image ID has no repository digest, eg. for images built on the node.
+func (r imageReference) withImageID(imageID string) imageReference {
+	_, digest, found := strings.Cut(strings.TrimPrefix(imageID, "docker-pullable://"), "@")
+	if algorithm, hash, ok := strings.Cut(digest, ":"); !found || !ok || algorithm == "" || hash == "" {
+		return r
+	}
+	name, _, _ := strings.Cut(r.name, "@")
+	r.scanName = trimImageTag(name) + "@" + digest
+	return r
+}
+
+const defaultRegistry = "docker.io"
+
+// imageRegistry returns registry host of image reference. Images without registry host are pulled from Docker Hub.
+func imageRegistry(ref string) string {
+	host, _, found := strings.Cut(ref, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return defaultRegistry
+	}
+	return host
+}
+
+// trimImageTag removes tag from image name. Registry port is kept as tag can be only after the last path component.
+func trimImageTag(name string) string {
+	lastPathIdx := strings.LastIndex(name, "/")
+	if tagIdx := strings.LastIndex(name, ":"); tagIdx > lastPathIdx {
+		return name[:tagIdx]
+	}
+	return name
+}
+
+// infraImages are patterns of known infra images which are excluded from scans by default.
+var infraImages = []string{
+	"pause",
+	"pause-*",
+	"calico/cni",
+	"calico/pod2daemon-flexvol",
+	"amazon-k8s-cni-init",
+	"flannel-cni-plugin",
+	"cilium/startup-script",
+}
+
+// imageMatchesPatterns returns true if image name without tag and digest matches any of patterns. Pattern is matched
+// against the same number of trailing path components, eg. calico/cni matches docker.io/calico/cni:v3.26.
+func imageMatchesPatterns(ref imageReference, patterns []string) bool {
+	name, _, _ := strings.Cut(ref.name, "@")
+	name = trimImageTag(name)
+	components := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		n := strings.Count(pattern, "/") + 1
+		if n > len(components) {
+			continue
+		}
+		if matched, _ := path.Match(pattern, strings.Join(components[len(components)-n:], "/")); matched {
+			return true
+		}
+	}
+	return false
+}
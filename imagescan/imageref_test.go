@@ -0,0 +1,137 @@
+package imagescan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageReference(t *testing.T) {
+	const digest = "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected imageReference
+	}{
+		{
+			name: "tagged",
+			ref:  "nginx:1.25",
+			expected: imageReference{
+				name:     "nginx:1.25",
+				scanName: "nginx:1.25",
+			},
+		},
+		{
+			name: "digested",
+			ref:  "docker.io/library/nginx@" + digest,
+			expected: imageReference{
+				name:     "docker.io/library/nginx@" + digest,
+				scanName: "docker.io/library/nginx@" + digest,
+			},
+		},
+		{
+			name: "tagged and digested",
+			ref:  "nginx:1.25@" + digest,
+			expected: imageReference{
+				name:     "nginx:1.25@" + digest,
+				scanName: "nginx@" + digest,
+			},
+		},
+		{
+			name: "tagged and digested with registry port",
+			ref:  "registry.local:5000/team/app:v1@" + digest,
+			expected: imageReference{
+				name:     "registry.local:5000/team/app:v1@" + digest,
+				scanName: "registry.local:5000/team/app@" + digest,
+			},
+		},
+		{
+			name: "registry port without tag",
+			ref:  "registry.local:5000/team/app",
+			expected: imageReference{
+				name:     "registry.local:5000/team/app",
+				scanName: "registry.local:5000/team/app",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(test.expected, parseImageReference(test.ref))
+		})
+	}
+}
+
+func TestImageReferenceWithImageID(t *testing.T) {
+	const digest = "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+
+	tests := []struct {
+		name             string
+		ref              string
+		imageID          string
+		expectedScanName string
+	}{
+		{
+			name:             "containerd image id",
+			ref:              "nginx:1.25",
+			imageID:          "docker.io/library/nginx@" + digest,
+			expectedScanName: "nginx@" + digest,
+		},
+		{
+			name:             "docker image id",
+			ref:              "registry.local:5000/team/app:v1",
+			imageID:          "docker-pullable://registry.local:5000/team/app@" + digest,
+			expectedScanName: "registry.local:5000/team/app@" + digest,
+		},
+		{
+			name:             "digest from image id replaces spec digest",
+			ref:              "nginx:1.25@sha256:1111111111111111111111111111111111111111111111111111111111111111",
+			imageID:          "docker.io/library/nginx@" + digest,
+			expectedScanName: "nginx@" + digest,
+		},
+		{
+			name:             "invalid image id digest",
+			ref:              "app:dev",
+			imageID:          "app@sha256",
+			expectedScanName: "app:dev",
+		},
+		{
+			name:             "image id without repository digest",
+			ref:              "app:dev",
+			imageID:          digest,
+			expectedScanName: "app:dev",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := require.New(t)
+			ref := parseImageReference(test.ref).withImageID(test.imageID)
+			r.Equal(test.ref, ref.name)
+			r.Equal(test.expectedScanName, ref.scanName)
+		})
+	}
+}
+
+func TestImageRegistry(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{ref: "nginx:1.25", expected: "docker.io"},
+		{ref: "grafana/grafana:latest", expected: "docker.io"},
+		{ref: "docker.io/library/nginx", expected: "docker.io"},
+		{ref: "gcr.io/project/app:v1", expected: "gcr.io"},
+		{ref: "registry.local:5000/team/app", expected: "registry.local:5000"},
+		{ref: "localhost/app", expected: "localhost"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			r := require.New(t)
+			r.Equal(test.expected, imageRegistry(test.ref))
+		})
+	}
+}
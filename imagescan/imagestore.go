@@ -0,0 +1,113 @@
+package imagescan
+
+import "github.com/samber/lo"
+
+// imageStore holds images tracked by delta state. It allows to replace in-memory state
+// with persistent or size capped storage.
+type imageStore interface {
+	// cacheKey returns key under which image with given id, architecture and name is stored.
+	cacheKey(imageID, architecture, name string) string
+	get(key string) (*image, bool)
+	// set stores image under its key.
+	set(img *image)
+	delete(key string)
+	// list returns a snapshot of stored images. Store can be modified while iterating over it.
+	list() []*image
+	// listByName returns a snapshot of stored images with given container spec image name.
+	listByName(name string) []*image
+	// listByOwner returns a snapshot of stored images owned by given resource.
+	listByOwner(ownerResourceID string) []*image
+	len() int
+}
+
+func newMemoryImageStore() *memoryImageStore {
+	return &memoryImageStore{
+		images:      make(map[string]*image),
+		byName:      imageIndex{},
+		byOwner:     imageIndex{},
+		ownersByKey: make(map[string][]string),
+	}
+}
+
+// memoryImageStore keeps images in memory. It is not thread safe as delta state is accessed from a single goroutine.
+type memoryImageStore struct {
+	images map[string]*image
+	// byName indexes images by name, so images of pod containers can be found without iterating over all images.
+	byName imageIndex
+	// byOwner indexes images by owner resource ID. Owners are indexed when image is set, so owners removed
+	// later are filtered out when listed.
+	byOwner imageIndex
+	// ownersByKey holds owners indexed for image key, so index is cleaned up once image is set again or deleted.
+	ownersByKey map[string][]string
+}
+
+func (s *memoryImageStore) cacheKey(imageID, architecture, name string) string {
+	return imageID + architecture + name
+}
+
+func (s *memoryImageStore) get(key string) (*image, bool) {
+	img, found := s.images[key]
+	return img, found
+}
+
+func (s *memoryImageStore) set(img *image) {
+	s.delete(img.key)
+	s.images[img.key] = img
+	s.byName.add(img.name, img)
+	owners := lo.Keys(img.owners)
+	for _, owner := range owners {
+		s.byOwner.add(owner, img)
+	}
+	s.ownersByKey[img.key] = owners
+}
+
+func (s *memoryImageStore) delete(key string) {
+	img, found := s.images[key]
+	if !found {
+		return
+	}
+	delete(s.images, key)
+	s.byName.remove(img.name, key)
+	for _, owner := range s.ownersByKey[key] {
+		s.byOwner.remove(owner, key)
+	}
+	delete(s.ownersByKey, key)
+}
+
+func (s *memoryImageStore) list() []*image {
+	return lo.Values(s.images)
+}
+
+func (s *memoryImageStore) listByName(name string) []*image {
+	return lo.Values(s.byName[name])
+}
+
+func (s *memoryImageStore) listByOwner(ownerResourceID string) []*image {
+	return lo.Filter(lo.Values(s.byOwner[ownerResourceID]), func(img *image, _ int) bool {
+		_, found := img.owners[ownerResourceID]
+		return found
+	})
+}
+
+func (s *memoryImageStore) len() int {
+	return len(s.images)
+}
+
+// imageIndex holds images by index value and image key.
+type imageIndex map[string]map[string]*image
+
+func (idx imageIndex) add(value string, img *image) {
+	images, found := idx[value]
+	if !found {
+		images = make(map[string]*image)
+		idx[value] = images
+	}
+	images[img.key] = img
+}
+
+func (idx imageIndex) remove(value, key string) {
+	delete(idx[value], key)
+	if len(idx[value]) == 0 {
+		delete(idx, value)
+	}
+}
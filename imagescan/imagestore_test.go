@@ -0,0 +1,151 @@
+package imagescan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryImageStore(t *testing.T) {
+	testImageStoreConformance(t, func() imageStore {
+		return newMemoryImageStore()
+	})
+}
+
+// testImageStoreConformance contains behaviour which every imageStore implementation must follow.
+func testImageStoreConformance(t *testing.T, newStore func() imageStore) {
+	newTestImage := func(store imageStore, id, arch, name string) *image {
+		img := newImage()
+		img.id = id
+		img.architecture = arch
+		img.name = name
+		img.key = store.cacheKey(id, arch, name)
+		return img
+	}
+
+	t.Run("get missing image", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		_, found := store.get("missing")
+		r.False(found)
+		r.Equal(0, store.len())
+		r.Empty(store.list())
+	})
+
+	t.Run("set and get image", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		img := newTestImage(store, "id1", "amd64", "nginx")
+		store.set(img)
+
+		got, found := store.get(img.key)
+		r.True(found)
+		r.Equal(img, got)
+		r.Equal(1, store.len())
+	})
+
+	t.Run("overwrite image with the same key", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		store.set(newTestImage(store, "id1", "amd64", "nginx"))
+		img := newTestImage(store, "id1", "amd64", "nginx")
+		img.scanned = true
+		store.set(img)
+
+		got, found := store.get(img.key)
+		r.True(found)
+		r.True(got.scanned)
+		r.Equal(1, store.len())
+	})
+
+	t.Run("delete image", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		img := newTestImage(store, "id1", "amd64", "nginx")
+		store.set(img)
+		store.delete(img.key)
+		// Deleting missing image is noop.
+		store.delete(img.key)
+
+		_, found := store.get(img.key)
+		r.False(found)
+		r.Equal(0, store.len())
+	})
+
+	t.Run("cache key distinguishes image id, architecture and name", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		keys := map[string]struct{}{
+			store.cacheKey("id1", "amd64", "nginx"):   {},
+			store.cacheKey("id2", "amd64", "nginx"):   {},
+			store.cacheKey("id1", "arm64", "nginx"):   {},
+			store.cacheKey("id1", "amd64", "nginx:1"): {},
+		}
+		r.Len(keys, 4)
+		r.Equal(store.cacheKey("id1", "amd64", "nginx"), store.cacheKey("id1", "amd64", "nginx"))
+	})
+
+	t.Run("list images by name", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		nginx := newTestImage(store, "id1", "amd64", "nginx")
+		store.set(nginx)
+		store.set(newTestImage(store, "id1", "arm64", "nginx"))
+		store.set(newTestImage(store, "id2", "amd64", "redis"))
+
+		r.Len(store.listByName("nginx"), 2)
+		r.Empty(store.listByName("postgres"))
+
+		store.delete(nginx.key)
+		r.Len(store.listByName("nginx"), 1)
+		r.Equal("arm64", store.listByName("nginx")[0].architecture)
+	})
+
+	t.Run("list images by owner", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		nginx := newTestImage(store, "id1", "amd64", "nginx")
+		nginx.owners["web"] = &imageOwner{}
+		store.set(nginx)
+		sidecar := newTestImage(store, "id2", "amd64", "sidecar")
+		sidecar.owners["web"] = &imageOwner{}
+		sidecar.owners["db"] = &imageOwner{}
+		store.set(sidecar)
+
+		r.Len(store.listByOwner("web"), 2)
+		r.Len(store.listByOwner("db"), 1)
+
+		// Removed owners are not listed even before image is set again.
+		delete(sidecar.owners, "web")
+		r.Equal([]*image{nginx}, store.listByOwner("web"))
+
+		store.delete(sidecar.key)
+		r.Empty(store.listByOwner("db"))
+	})
+
+	t.Run("modify store while iterating over list", func(t *testing.T) {
+		r := require.New(t)
+		store := newStore()
+
+		store.set(newTestImage(store, "id1", "amd64", "nginx"))
+		store.set(newTestImage(store, "id2", "amd64", "redis"))
+		store.set(newTestImage(store, "id3", "arm64", "redis"))
+
+		images := store.list()
+		r.Len(images, 3)
+		for _, img := range images {
+			if img.architecture == "amd64" {
+				store.delete(img.key)
+			}
+		}
+		r.Equal(1, store.len())
+		r.Equal("id3", store.list()[0].id)
+	})
+}
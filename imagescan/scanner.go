@@ -7,28 +7,39 @@ import (
 	"fmt"
 	"hash/fnv"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
+	json "github.com/json-iterator/go"
 	"github.com/samber/lo"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	batchv1typed "k8s.io/client-go/kubernetes/typed/batch/v1"
 
+	"github.com/castai/kvisor/castai"
 	imgcollectorconfig "github.com/castai/kvisor/cmd/kvisor/imgcollector/config"
 	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/joblimiter"
 	"github.com/castai/kvisor/kube"
 	"github.com/castai/kvisor/log"
 )
 
 const (
 	nonRootUserID = int64(65532)
+	// maxJobWarningEvents limits scan job warning events reported with scan error.
+	maxJobWarningEvents = 3
+	// trivyServerTokenSecretKey is job secret key of trivy server token.
+	trivyServerTokenSecretKey = "trivy-server-token"
 )
 
 var (
@@ -39,12 +50,13 @@ type imageScanner interface {
 	ScanImage(ctx context.Context, cfg ScanImageParams) (err error)
 }
 
-func NewImageScanner(client kubernetes.Interface, cfg config.Config) *Scanner {
+func NewImageScanner(client kubernetes.Interface, cfg config.Config, jobLimiter *joblimiter.Limiter) *Scanner {
 	return &Scanner{
 		podLogProvider:   log.NewPodLogReader(client),
 		client:           client,
 		jobCheckInterval: 5 * time.Second,
 		cfg:              cfg,
+		jobLimiter:       jobLimiter,
 	}
 }
 
@@ -53,6 +65,8 @@ type Scanner struct {
 	client           kubernetes.Interface
 	cfg              config.Config
 	jobCheckInterval time.Duration
+	// jobLimiter is budget of jobs shared with other job types.
+	jobLimiter *joblimiter.Limiter
 }
 
 type ScanImageParams struct {
@@ -68,6 +82,20 @@ type ScanImageParams struct {
 	Architecture                string
 	Os                          string
 	CollectorImageDetails       kube.KvisorImageDetails
+	BuildMetadata               *castai.BuildMetadata
+	// TrivyDBRepository and TrivyDBClaimName override trivy database source, eg. in air-gapped clusters.
+	TrivyDBRepository string
+	TrivyDBClaimName  string
+	// TrivyServerAddr is address of external trivy server. Scan job is not pinned to node and trivy database
+	// source is ignored if set.
+	TrivyServerAddr string
+	// TrivyServerToken is token of external trivy server. Optional.
+	TrivyServerToken string
+	// MatchVulnerabilities makes scan job match vulnerabilities with trivy database if external trivy server is
+	// not used. Trivy server always matches vulnerabilities.
+	MatchVulnerabilities bool
+	// PullSecrets are image pull secrets of workloads using the image. Used only for remote scans.
+	PullSecrets []types.NamespacedName
 }
 
 func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr error) {
@@ -77,13 +105,16 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 	if params.ImageName == "" {
 		return errors.New("image name is required")
 	}
-	if params.ContainerRuntime == "" {
+	// Images scanned without running pods, eg. configured always scan images, have unknown container
+	// runtime and no owners. Such images are scanned remotely, so runtime and owners are optional.
+	remote := imgcollectorconfig.Mode(params.Mode) == imgcollectorconfig.ModeRemote
+	if params.ContainerRuntime == "" && !remote {
 		return errors.New("container runtime is required")
 	}
-	if len(params.ResourceIDs) == 0 {
+	if len(params.ResourceIDs) == 0 && !remote {
 		return errors.New("resource ids are required")
 	}
-	if params.NodeName == "" {
+	if params.NodeName == "" && params.TrivyServerAddr == "" {
 		return errors.New("node name is required")
 	}
 	if s.cfg.PodNamespace == "" {
@@ -92,20 +123,19 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 
 	jobName := genJobName(params.ImageName)
 	vols := volumesAndMounts{}
-	mode := imgcollectorconfig.Mode(params.Mode)
+	mode := scanMode(params)
 	containerRuntime := params.ContainerRuntime
+	// Runtime paths differ between distributions, eg. k3s. Host paths are mounted to default paths in scan job container.
+	runtimePaths := s.cfg.ImageScan.Runtime
 
 	switch containerRuntime {
 	case "docker":
-		if mode == "" {
-			mode = imgcollectorconfig.ModeDaemon
-		}
 		if mode == imgcollectorconfig.ModeDaemon {
 			vols.volumes = append(vols.volumes, corev1.Volume{
 				Name: "docker-sock",
 				VolumeSource: corev1.VolumeSource{
 					HostPath: &corev1.HostPathVolumeSource{
-						Path: "/var/run/docker.sock",
+						Path: lo.Ternary(runtimePaths.DockerSocketPath != "", runtimePaths.DockerSocketPath, imgcollectorconfig.DockerSocketPath),
 						Type: lo.ToPtr(corev1.HostPathSocket),
 					},
 				},
@@ -113,19 +143,16 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 			vols.mounts = append(vols.mounts, corev1.VolumeMount{
 				Name:      "docker-sock",
 				ReadOnly:  true,
-				MountPath: "/var/run/docker.sock",
+				MountPath: imgcollectorconfig.DockerSocketPath,
 			})
 		}
 	case "containerd":
-		if mode == "" {
-			mode = imgcollectorconfig.ModeHostFS
-		}
 		if mode == imgcollectorconfig.ModeHostFS {
 			vols.volumes = append(vols.volumes, corev1.Volume{
 				Name: "containerd-content",
 				VolumeSource: corev1.VolumeSource{
 					HostPath: &corev1.HostPathVolumeSource{
-						Path: imgcollectorconfig.ContainerdContentDir,
+						Path: lo.Ternary(runtimePaths.ContainerdContentDir != "", runtimePaths.ContainerdContentDir, imgcollectorconfig.ContainerdContentDir),
 						Type: lo.ToPtr(corev1.HostPathDirectory),
 					},
 				},
@@ -140,7 +167,7 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 				Name: "containerd-sock",
 				VolumeSource: corev1.VolumeSource{
 					HostPath: &corev1.HostPathVolumeSource{
-						Path: "/run/containerd/containerd.sock",
+						Path: lo.Ternary(runtimePaths.ContainerdSocketPath != "", runtimePaths.ContainerdSocketPath, imgcollectorconfig.ContainerdSocketPath),
 						Type: lo.ToPtr(corev1.HostPathSocket),
 					},
 				},
@@ -148,24 +175,42 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 			vols.mounts = append(vols.mounts, corev1.VolumeMount{
 				Name:      "containerd-sock",
 				ReadOnly:  true,
-				MountPath: "/run/containerd/containerd.sock",
+				MountPath: imgcollectorconfig.ContainerdSocketPath,
 			})
 		}
-		if s.cfg.ImageScan.PullSecret != "" {
-			vols.volumes = append(vols.volumes, corev1.Volume{
-				Name: "pull-secret",
-				VolumeSource: corev1.VolumeSource{
-					Secret: &corev1.SecretVolumeSource{
-						SecretName: s.cfg.ImageScan.PullSecret,
-					},
-				},
-			})
-			vols.mounts = append(vols.mounts, corev1.VolumeMount{
-				Name:      "pull-secret",
-				ReadOnly:  true,
-				MountPath: imgcollectorconfig.SecretMountPath,
-			})
+	}
+
+	// Job secret is owned by scan job and holds credentials which must not be visible in job spec.
+	// Secret name is unique per job, so leftover secret of previous job with the same name is never reused.
+	jobSecretName := fmt.Sprintf("%s-%s", jobName, utilrand.String(5))
+	var jobSecret *corev1.Secret
+
+	pullSecret := s.cfg.ImageScan.PullSecret
+	if mode == imgcollectorconfig.ModeRemote && s.cfg.ImageScan.WorkloadPullSecrets && len(params.PullSecrets) > 0 {
+		// Workload secrets can't be mounted from other namespaces, so they are merged to job secret.
+		secret, err := s.newWorkloadPullSecret(ctx, jobSecretName, params.PullSecrets)
+		if err != nil {
+			return fmt.Errorf("reading workload pull secrets: %w", err)
 		}
+		if secret != nil {
+			jobSecret = secret
+			pullSecret = secret.Name
+		}
+	}
+	if pullSecret != "" {
+		vols.volumes = append(vols.volumes, corev1.Volume{
+			Name: "pull-secret",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: pullSecret,
+				},
+			},
+		})
+		vols.mounts = append(vols.mounts, corev1.VolumeMount{
+			Name:      "pull-secret",
+			ReadOnly:  true,
+			MountPath: imgcollectorconfig.SecretMountPath,
+		})
 	}
 
 	envVars := []corev1.EnvVar{
@@ -213,15 +258,94 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 			Name:  "COLLECTOR_IMAGE_OS",
 			Value: params.Os,
 		},
+		{
+			// Node is resolved from job pod as scheduler may place job on another node if node name is not pinned.
+			Name: "COLLECTOR_NODE_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		},
 	}
 
-	if s.cfg.ImageScan.PullSecret != "" {
+	if pullSecret != "" {
 		envVars = append(envVars, corev1.EnvVar{
 			Name:  "COLLECTOR_PULL_SECRET",
-			Value: s.cfg.ImageScan.PullSecret,
+			Value: pullSecret,
 		})
 	}
 
+	if md := params.BuildMetadata; md != nil {
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "COLLECTOR_BUILD_REPOSITORY", Value: md.Repository},
+			corev1.EnvVar{Name: "COLLECTOR_BUILD_COMMIT", Value: md.Commit},
+			corev1.EnvVar{Name: "COLLECTOR_BUILD_URL", Value: md.BuildURL},
+		)
+	}
+
+	if params.TrivyServerAddr != "" {
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "COLLECTOR_TRIVY_SERVER_ADDR", Value: params.TrivyServerAddr},
+			corev1.EnvVar{Name: "TRIVY_SKIP_DB_UPDATE", Value: "true"},
+		)
+		if params.TrivyServerToken != "" {
+			if jobSecret == nil {
+				jobSecret = &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      jobSecretName,
+						Namespace: s.cfg.PodNamespace,
+					},
+					Type: corev1.SecretTypeOpaque,
+					Data: map[string][]byte{},
+				}
+			}
+			jobSecret.Data[trivyServerTokenSecretKey] = []byte(params.TrivyServerToken)
+			envVars = append(envVars, corev1.EnvVar{
+				Name: "COLLECTOR_TRIVY_SERVER_TOKEN",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: jobSecret.Name},
+						Key:                  trivyServerTokenSecretKey,
+					},
+				},
+			})
+		}
+	}
+
+	if params.MatchVulnerabilities && params.TrivyServerAddr == "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "COLLECTOR_MATCH_VULNERABILITIES",
+			Value: "true",
+		})
+	}
+
+	// Trivy database source is passed with standard trivy environment variables.
+	if params.TrivyDBRepository != "" && params.TrivyServerAddr == "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "TRIVY_DB_REPOSITORY",
+			Value: params.TrivyDBRepository,
+		})
+	}
+	if params.TrivyDBClaimName != "" && params.TrivyServerAddr == "" {
+		vols.volumes = append(vols.volumes, corev1.Volume{
+			Name: "trivy-db",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: params.TrivyDBClaimName,
+					ReadOnly:  true,
+				},
+			},
+		})
+		vols.mounts = append(vols.mounts, corev1.VolumeMount{
+			Name:      "trivy-db",
+			ReadOnly:  true,
+			MountPath: imgcollectorconfig.TrivyCacheDir,
+		})
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "TRIVY_CACHE_DIR", Value: imgcollectorconfig.TrivyCacheDir},
+			corev1.EnvVar{Name: "TRIVY_SKIP_DB_UPDATE", Value: "true"},
+		)
+	}
+
 	podAnnotations := map[string]string{}
 	if s.cfg.ImageScan.ProfileEnabled {
 		if s.cfg.ImageScan.PhlareEnabled {
@@ -240,6 +364,12 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 			Operator: corev1.TolerationOpExists,
 		},
 	}
+	if taintKey := s.cfg.ImageScan.NodePool.TaintKey; taintKey != "" {
+		tolerations = append(tolerations, corev1.Toleration{
+			Key:      taintKey,
+			Operator: corev1.TolerationOpExists,
+		})
+	}
 
 	jobSpec := scanJobSpec(
 		s.cfg.PodNamespace,
@@ -283,12 +413,38 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 		return nil
 	}
 
+	if err := s.jobLimiter.Acquire(ctx); err != nil {
+		return fmt.Errorf("waiting for job budget: %w", err)
+	}
+	defer s.jobLimiter.Release()
+
 	// Create new job and wait for completion.
-	_, err = jobs.Create(ctx, jobSpec, metav1.CreateOptions{})
+	job, err := jobs.Create(ctx, jobSpec, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("creating job: %w", err)
 	}
 
+	if jobSecret != nil {
+		// Secret is created after job so it's garbage collected together with job. Job pod waits for the secret.
+		jobSecret.OwnerReferences = []metav1.OwnerReference{
+			{
+				APIVersion: "batch/v1",
+				Kind:       "Job",
+				Name:       job.Name,
+				UID:        job.UID,
+			},
+		}
+		if _, err := s.client.CoreV1().Secrets(s.cfg.PodNamespace).Create(ctx, jobSecret, metav1.CreateOptions{}); err != nil {
+			// Job pod would wait for the secret forever.
+			if err := jobs.Delete(ctx, job.Name, metav1.DeleteOptions{
+				PropagationPolicy: lo.ToPtr(metav1.DeletePropagationBackground),
+			}); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("deleting job without job secret: %w", err)
+			}
+			return fmt.Errorf("creating job secret: %w", err)
+		}
+	}
+
 	if params.WaitForCompletion {
 		if err := s.waitForCompletion(ctx, jobs, jobName); err != nil {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -296,14 +452,97 @@ func (s *Scanner) ScanImage(ctx context.Context, params ScanImageParams) (rerr e
 			jobPod, _ := s.getJobPod(ctx, jobName)
 			if jobPod != nil {
 				conds := getPodConditionsString(jobPod.Status.Conditions)
-				return fmt.Errorf("wait for completion, pod_conditions=%s: %w", conds, err)
+				err = fmt.Errorf("wait for completion, pod_conditions=%s: %w", conds, err)
+			} else {
+				err = fmt.Errorf("wait for completion: %w", err)
 			}
-			return fmt.Errorf("wait for completion: %w", err)
+			if events := s.getJobWarningEvents(ctx, jobName, jobPod); len(events) > 0 {
+				return &scanJobEventsError{err: err, events: events}
+			}
+			return err
 		}
 	}
 	return nil
 }
 
+// newWorkloadPullSecret merges registry credentials of workload image pull secrets to a single secret in scan job namespace.
+// Secrets are read only from allowed namespaces. Nil is returned if none of the secrets contain registry credentials.
+func (s *Scanner) newWorkloadPullSecret(ctx context.Context, name string, refs []types.NamespacedName) (*corev1.Secret, error) {
+	auths := map[string]json.RawMessage{}
+	addAuths := func(registryAuths map[string]json.RawMessage) {
+		for registry, auth := range registryAuths {
+			// Secrets are sorted, so the first secret wins if registry credentials are duplicated.
+			if _, found := auths[registry]; !found {
+				auths[registry] = auth
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		if !lo.Contains(s.cfg.ImageScan.WorkloadPullSecretsNamespaces, ref.Namespace) {
+			continue
+		}
+		secret, err := s.client.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			// Pods can reference secrets which don't exist.
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if data, found := secret.Data[corev1.DockerConfigJsonKey]; found {
+			var cfg struct {
+				Auths map[string]json.RawMessage `json:"auths"`
+			}
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return nil, fmt.Errorf("parsing secret %s: %w", ref, err)
+			}
+			addAuths(cfg.Auths)
+		}
+		// Legacy format contains only registry credentials.
+		if data, found := secret.Data[corev1.DockerConfigKey]; found {
+			var registryAuths map[string]json.RawMessage
+			if err := json.Unmarshal(data, &registryAuths); err != nil {
+				return nil, fmt.Errorf("parsing secret %s: %w", ref, err)
+			}
+			addAuths(registryAuths)
+		}
+	}
+	if len(auths) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(map[string]any{"auths": auths})
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.cfg.PodNamespace,
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: data,
+		},
+	}, nil
+}
+
+// scanMode returns mode of scan job. If mode is not configured it's picked by container runtime.
+func scanMode(params ScanImageParams) imgcollectorconfig.Mode {
+	mode := imgcollectorconfig.Mode(params.Mode)
+	if mode != "" {
+		return mode
+	}
+	switch params.ContainerRuntime {
+	case "docker":
+		return imgcollectorconfig.ModeDaemon
+	case "containerd":
+		return imgcollectorconfig.ModeHostFS
+	}
+	return mode
+}
+
 func getPodConditionsString(conditions []corev1.PodCondition) string {
 	var condStrings []string
 	for _, condition := range conditions {
@@ -332,14 +571,21 @@ func (s *Scanner) waitForCompletion(ctx context.Context, jobs batchv1typed.JobIn
 		if done {
 			return true, nil
 		}
-		failed := lo.ContainsBy(job.Status.Conditions, func(v batchv1.JobCondition) bool {
+		failedCond, failed := lo.Find(job.Status.Conditions, func(v batchv1.JobCondition) bool {
 			return v.Status == corev1.ConditionTrue && v.Type == batchv1.JobFailed
 		})
 		if failed {
+			// Job pod is killed when job active deadline is exceeded, so its logs don't contain the reason.
+			if failedCond.Reason == "DeadlineExceeded" {
+				return true, errScanTimeout
+			}
 			jobPod, err := s.getJobPod(ctx, jobName)
 			if err != nil {
 				return true, err
 			}
+			if err := classifyJobPodFailure(jobPod); err != nil {
+				return true, err
+			}
 			logsStream, err := s.podLogProvider.GetLogReader(ctx, s.cfg.PodNamespace, jobPod.Name)
 			if err != nil {
 				return true, fmt.Errorf("creating logs stream for failed job: %w", err)
@@ -369,6 +615,49 @@ func (s *Scanner) getJobPod(ctx context.Context, jobName string) (*corev1.Pod, e
 	return &jobPods.Items[0], nil
 }
 
+// getJobWarningEvents returns the latest warning events of scan job and its pod, eg. FailedScheduling.
+func (s *Scanner) getJobWarningEvents(ctx context.Context, jobName string, jobPod *corev1.Pod) []string {
+	names := []string{jobName}
+	if jobPod != nil {
+		names = append(names, jobPod.Name)
+	}
+
+	var events []corev1.Event
+	for _, name := range names {
+		list, err := s.client.CoreV1().Events(s.cfg.PodNamespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("involvedObject.name", name).String(),
+		})
+		if err != nil {
+			continue
+		}
+		for _, e := range list.Items {
+			if e.Type == corev1.EventTypeWarning && e.InvolvedObject.Name == name {
+				events = append(events, e)
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	if len(events) > maxJobWarningEvents {
+		events = events[len(events)-maxJobWarningEvents:]
+	}
+	return lo.Map(events, func(e corev1.Event, _ int) string {
+		return fmt.Sprintf("%s %s: %s", e.InvolvedObject.Kind, e.Reason, e.Message)
+	})
+}
+
+func eventTime(e corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
 type volumesAndMounts struct {
 	volumes []corev1.Volume
 	mounts  []corev1.VolumeMount
@@ -474,6 +763,11 @@ func scanJobSpec(
 		},
 	}
 
+	if nodeName == "" {
+		// Any linux node can run scan job, eg. when scanning with external trivy server.
+		job.Spec.Template.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = nil
+	}
+
 	if cfg.CPULimit != "" {
 		cpuLimit := resource.MustParse(cfg.CPULimit)
 		if job.Spec.Template.Spec.Containers[0].Resources.Limits == nil {
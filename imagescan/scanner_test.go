@@ -2,6 +2,7 @@ package imagescan
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -13,9 +14,13 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
 	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/joblimiter"
 	"github.com/castai/kvisor/kube"
 )
 
@@ -48,7 +53,7 @@ func TestScanner(t *testing.T) {
 				Mode:               "",
 				ServiceAccountName: "sa",
 			},
-		})
+		}, nil)
 		scanner.jobCheckInterval = 1 * time.Microsecond
 
 		err := scanner.ScanImage(ctx, ScanImageParams{
@@ -188,6 +193,12 @@ func TestScanner(t *testing.T) {
 										Name:  "COLLECTOR_IMAGE_OS",
 										Value: "linux",
 									},
+									{
+										Name: "COLLECTOR_NODE_NAME",
+										ValueFrom: &corev1.EnvVarSource{
+											FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+										},
+									},
 									{
 										Name:  "COLLECTOR_PPROF_ADDR",
 										Value: ":6060",
@@ -267,7 +278,7 @@ func TestScanner(t *testing.T) {
 				MemoryRequest: "100Mi",
 				MemoryLimit:   "2Gi",
 			},
-		})
+		}, nil)
 		scanner.jobCheckInterval = 1 * time.Microsecond
 
 		err := scanner.ScanImage(ctx, ScanImageParams{
@@ -288,6 +299,368 @@ func TestScanner(t *testing.T) {
 		r.True(apierrors.IsNotFound(err))
 	})
 
+	t.Run("scan image without owners remotely", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		client := fake.NewSimpleClientset()
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:    "500m",
+				CPULimit:      "2",
+				MemoryRequest: "100Mi",
+				MemoryLimit:   "2Gi",
+			},
+		}, nil)
+
+		params := ScanImageParams{
+			ImageName: "ghcr.io/team/base:1.0",
+			ImageID:   "ghcr.io/team/base:1.0",
+			Mode:      "remote",
+			NodeName:  "n1",
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		}
+		r.NoError(scanner.ScanImage(ctx, params))
+
+		params.Mode = "hostfs"
+		r.ErrorContains(scanner.ScanImage(ctx, params), "container runtime is required")
+	})
+
+	t.Run("wait for shared job budget before creating job", func(t *testing.T) {
+		r := require.New(t)
+
+		client := fake.NewSimpleClientset()
+		limiter := joblimiter.New(1)
+		// Budget is taken by other job type, eg. kube-bench.
+		r.NoError(limiter.Acquire(context.Background()))
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:    "500m",
+				CPULimit:      "2",
+				MemoryRequest: "100Mi",
+				MemoryLimit:   "2Gi",
+			},
+		}, limiter)
+
+		params := ScanImageParams{
+			ImageName: "ghcr.io/team/base:1.0",
+			ImageID:   "ghcr.io/team/base:1.0",
+			Mode:      "remote",
+			NodeName:  "n1",
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		r.ErrorIs(scanner.ScanImage(ctx, params), context.DeadlineExceeded)
+		jobs, err := client.BatchV1().Jobs(ns).List(context.Background(), metav1.ListOptions{})
+		r.NoError(err)
+		r.Empty(jobs.Items)
+
+		limiter.Release()
+		r.NoError(scanner.ScanImage(context.Background(), params))
+		r.Equal(0, limiter.Running())
+	})
+
+	t.Run("pass custom trivy db source to scan job matching vulnerabilities", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		client := fake.NewSimpleClientset()
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:    "500m",
+				CPULimit:      "2",
+				MemoryRequest: "100Mi",
+				MemoryLimit:   "2Gi",
+			},
+		}, nil)
+
+		r.NoError(scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:            "test-image",
+			ImageID:              "test-image@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			ContainerRuntime:     "containerd",
+			Mode:                 "remote",
+			NodeName:             "n1",
+			ResourceIDs:          []string{"p1"},
+			TrivyDBRepository:    "registry.local/aquasecurity/trivy-db",
+			TrivyDBClaimName:     "trivy-db",
+			MatchVulnerabilities: true,
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		}))
+
+		jobs, err := client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+		r.NoError(err)
+		r.Len(jobs.Items, 1)
+		podSpec := jobs.Items[0].Spec.Template.Spec
+		r.Contains(podSpec.Volumes, corev1.Volume{
+			Name: "trivy-db",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: "trivy-db",
+					ReadOnly:  true,
+				},
+			},
+		})
+		container := podSpec.Containers[0]
+		r.Contains(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "trivy-db",
+			ReadOnly:  true,
+			MountPath: "/trivy-cache",
+		})
+		r.Contains(container.Env, corev1.EnvVar{Name: "TRIVY_DB_REPOSITORY", Value: "registry.local/aquasecurity/trivy-db"})
+		r.Contains(container.Env, corev1.EnvVar{Name: "TRIVY_CACHE_DIR", Value: "/trivy-cache"})
+		r.Contains(container.Env, corev1.EnvVar{Name: "TRIVY_SKIP_DB_UPDATE", Value: "true"})
+		r.Contains(container.Env, corev1.EnvVar{Name: "COLLECTOR_MATCH_VULNERABILITIES", Value: "true"})
+	})
+
+	t.Run("scan with trivy server without node pinning", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		client := fake.NewSimpleClientset()
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:    "500m",
+				CPULimit:      "2",
+				MemoryRequest: "100Mi",
+				MemoryLimit:   "2Gi",
+			},
+		}, nil)
+
+		r.NoError(scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:            "test-image",
+			ImageID:              "test-image@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			Mode:                 "remote",
+			TrivyDBRepository:    "registry.local/aquasecurity/trivy-db",
+			TrivyDBClaimName:     "trivy-db",
+			TrivyServerAddr:      "http://trivy.trivy-system:4954",
+			TrivyServerToken:     "trivy-token",
+			MatchVulnerabilities: true,
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		}))
+
+		jobs, err := client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+		r.NoError(err)
+		r.Len(jobs.Items, 1)
+		podSpec := jobs.Items[0].Spec.Template.Spec
+		r.Nil(podSpec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+		r.NotNil(podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+		r.Empty(podSpec.Volumes)
+		container := podSpec.Containers[0]
+		r.Contains(container.Env, corev1.EnvVar{Name: "COLLECTOR_TRIVY_SERVER_ADDR", Value: "http://trivy.trivy-system:4954"})
+		tokenEnv, found := lo.Find(container.Env, func(env corev1.EnvVar) bool {
+			return env.Name == "COLLECTOR_TRIVY_SERVER_TOKEN"
+		})
+		r.True(found)
+		r.Empty(tokenEnv.Value)
+		r.Equal(trivyServerTokenSecretKey, tokenEnv.ValueFrom.SecretKeyRef.Key)
+		secret, err := client.CoreV1().Secrets(ns).Get(ctx, tokenEnv.ValueFrom.SecretKeyRef.Name, metav1.GetOptions{})
+		r.NoError(err)
+		r.Equal("trivy-token", string(secret.Data[trivyServerTokenSecretKey]))
+		r.Equal(jobs.Items[0].Name, secret.OwnerReferences[0].Name)
+		r.Contains(container.Env, corev1.EnvVar{Name: "TRIVY_SKIP_DB_UPDATE", Value: "true"})
+		r.NotContains(container.Env, corev1.EnvVar{Name: "TRIVY_DB_REPOSITORY", Value: "registry.local/aquasecurity/trivy-db"})
+		r.NotContains(container.Env, corev1.EnvVar{Name: "COLLECTOR_MATCH_VULNERABILITIES", Value: "true"})
+	})
+
+	t.Run("mount custom container runtime paths to hostfs scan job", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		client := fake.NewSimpleClientset()
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:    "500m",
+				CPULimit:      "2",
+				MemoryRequest: "100Mi",
+				MemoryLimit:   "2Gi",
+				Runtime: config.ImageScanRuntime{
+					ContainerdContentDir: "/var/lib/rancher/k3s/agent/containerd/io.containerd.content.v1.content",
+				},
+			},
+		}, nil)
+
+		r.NoError(scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:        "test-image",
+			ImageID:          "test-image@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			ContainerRuntime: "containerd",
+			Mode:             "hostfs",
+			NodeName:         "n1",
+			ResourceIDs:      []string{"p1"},
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		}))
+
+		jobs, err := client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+		r.NoError(err)
+		r.Len(jobs.Items, 1)
+		podSpec := jobs.Items[0].Spec.Template.Spec
+		r.Contains(podSpec.Volumes, corev1.Volume{
+			Name: "containerd-content",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: "/var/lib/rancher/k3s/agent/containerd/io.containerd.content.v1.content",
+					Type: lo.ToPtr(corev1.HostPathDirectory),
+				},
+			},
+		})
+		r.Contains(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "containerd-content",
+			ReadOnly:  true,
+			MountPath: "/var/lib/containerd/io.containerd.content.v1.content",
+		})
+	})
+
+	t.Run("pass workload pull secrets to remote scan job", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		client := fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "team"},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry.local":{"auth":"dGVhbTpwYXNz"}}}`),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "team"},
+				Type:       corev1.SecretTypeDockercfg,
+				Data: map[string][]byte{
+					corev1.DockerConfigKey: []byte(`{"mirror.local":{"auth":"bWlycm9yOnBhc3M="}}`),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "other"},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{"other.local":{"auth":"b3RoZXI6cGFzcw=="}}}`),
+				},
+			},
+		)
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:                    "500m",
+				CPULimit:                      "2",
+				MemoryRequest:                 "100Mi",
+				MemoryLimit:                   "2Gi",
+				WorkloadPullSecrets:           true,
+				WorkloadPullSecretsNamespaces: []string{"team"},
+			},
+		}, nil)
+
+		r.NoError(scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:        "registry.local/app:1.0",
+			ImageID:          "registry.local/app@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			ContainerRuntime: "containerd",
+			Mode:             "remote",
+			NodeName:         "n1",
+			ResourceIDs:      []string{"p1"},
+			PullSecrets: []types.NamespacedName{
+				{Namespace: "team", Name: "mirror"},
+				{Namespace: "team", Name: "missing"},
+				{Namespace: "team", Name: "registry"},
+				{Namespace: "other", Name: "registry"},
+			},
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		}))
+
+		jobs, err := client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+		r.NoError(err)
+		r.Len(jobs.Items, 1)
+		job := jobs.Items[0]
+
+		podSpec := job.Spec.Template.Spec
+		pullSecretVolume, found := lo.Find(podSpec.Volumes, func(v corev1.Volume) bool {
+			return v.Name == "pull-secret"
+		})
+		r.True(found)
+		secretName := pullSecretVolume.Secret.SecretName
+		r.NotEqual(job.Name, secretName)
+		r.Contains(secretName, job.Name)
+
+		secret, err := client.CoreV1().Secrets(ns).Get(ctx, secretName, metav1.GetOptions{})
+		r.NoError(err)
+		r.Equal(corev1.SecretTypeDockerConfigJson, secret.Type)
+		r.JSONEq(`{"auths":{"registry.local":{"auth":"dGVhbTpwYXNz"},"mirror.local":{"auth":"bWlycm9yOnBhc3M="}}}`, string(secret.Data[corev1.DockerConfigJsonKey]))
+		r.Equal("Job", secret.OwnerReferences[0].Kind)
+		r.Equal(job.Name, secret.OwnerReferences[0].Name)
+
+		container := podSpec.Containers[0]
+		r.Contains(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "pull-secret",
+			ReadOnly:  true,
+			MountPath: "/secret",
+		})
+		r.Contains(container.Env, corev1.EnvVar{Name: "COLLECTOR_PULL_SECRET", Value: secretName})
+	})
+
+	t.Run("delete scan job if job secret can't be created", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		client := fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "team"},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry.local":{"auth":"dGVhbTpwYXNz"}}}`),
+				},
+			},
+		)
+		client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", errors.New("denied"))
+		})
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				CPURequest:                    "500m",
+				CPULimit:                      "2",
+				MemoryRequest:                 "100Mi",
+				MemoryLimit:                   "2Gi",
+				WorkloadPullSecrets:           true,
+				WorkloadPullSecretsNamespaces: []string{"team"},
+			},
+		}, nil)
+
+		err := scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:        "registry.local/app:1.0",
+			ImageID:          "registry.local/app@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			ContainerRuntime: "containerd",
+			Mode:             "remote",
+			NodeName:         "n1",
+			ResourceIDs:      []string{"p1"},
+			PullSecrets: []types.NamespacedName{
+				{Namespace: "team", Name: "registry"},
+			},
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		})
+		r.ErrorContains(err, "creating job secret")
+
+		jobs, err := client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+		r.NoError(err)
+		r.Empty(jobs.Items)
+	})
+
 	t.Run("get failed job error with detailed reason", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
@@ -324,7 +697,7 @@ func TestScanner(t *testing.T) {
 			ImageScan: config.ImageScan{
 				Image: config.ImageScanImage{},
 			},
-		})
+		}, nil)
 		scanner.jobCheckInterval = 1 * time.Microsecond
 
 		err := scanner.ScanImage(ctx, ScanImageParams{
@@ -341,4 +714,109 @@ func TestScanner(t *testing.T) {
 		})
 		r.ErrorContains(err, "[type=Ready, status=False, reason=no cpu], [type=PodScheduled, status=False, reason=no cpu]")
 	})
+
+	t.Run("get timeout error for job which exceeded deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		r := require.New(t)
+
+		client := fake.NewSimpleClientset()
+		client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+			job.Status.Conditions = []batchv1.JobCondition{
+				{
+					Type:   batchv1.JobFailed,
+					Status: corev1.ConditionTrue,
+					Reason: "DeadlineExceeded",
+				},
+			}
+			return false, nil, nil
+		})
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+		}, nil)
+		scanner.jobCheckInterval = 1 * time.Microsecond
+
+		err := scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:         "test-image",
+			ImageID:           "test-image@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			ContainerRuntime:  "containerd",
+			Mode:              "hostfs",
+			NodeName:          "n1",
+			ResourceIDs:       []string{"p1"},
+			WaitForCompletion: true,
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		})
+		r.ErrorIs(err, errScanTimeout)
+		r.Equal(scanErrorTimeout, classifyScanError(parseErrorFromLog(err)))
+	})
+
+	t.Run("report scan job warning events with failed job error", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		r := require.New(t)
+
+		jobPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns,
+				Name:      "img-scan",
+				Labels: map[string]string{
+					"job-name": "imgscan-1ba98dcd098ba64e9b2fe4dafc7a5c85",
+				},
+			},
+		}
+		now := time.Now()
+		newEvent := func(name, objectName, eventType, reason, message string, at time.Time) *corev1.Event {
+			return &corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Namespace: ns, Name: name},
+				InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: ns, Name: objectName},
+				Type:           eventType,
+				Reason:         reason,
+				Message:        message,
+				LastTimestamp:  metav1.NewTime(at),
+			}
+		}
+
+		client := fake.NewSimpleClientset(
+			jobPod,
+			newEvent("e1", "img-scan", corev1.EventTypeWarning, "FailedScheduling", "0/3 nodes are available: 3 Insufficient memory.", now.Add(-time.Minute)),
+			newEvent("e2", "img-scan", corev1.EventTypeWarning, "FailedScheduling", "0/3 nodes are available: 3 node(s) had untolerated taint.", now),
+			newEvent("e3", "img-scan", corev1.EventTypeNormal, "Pulled", "Container image pulled", now),
+			newEvent("e4", "other-pod", corev1.EventTypeWarning, "BackOff", "Back-off restarting failed container", now),
+		)
+		scanner := NewImageScanner(client, config.Config{
+			PodNamespace: ns,
+			ImageScan: config.ImageScan{
+				Image: config.ImageScanImage{},
+			},
+		}, nil)
+		scanner.jobCheckInterval = 1 * time.Microsecond
+
+		err := scanner.ScanImage(ctx, ScanImageParams{
+			ImageName:         "test-image",
+			ImageID:           "test-image@sha2566282b5ec0c18cfd723e40ef8b98649a47b9388a479c520719c615acc3b073504",
+			ContainerRuntime:  "containerd",
+			Mode:              "hostfs",
+			NodeName:          "n1",
+			ResourceIDs:       []string{"p1", "p2"},
+			WaitForCompletion: true,
+			CollectorImageDetails: kube.KvisorImageDetails{
+				ImageName: "imgcollector:1.0.0",
+			},
+		})
+		expectedEvents := "events: Pod FailedScheduling: 0/3 nodes are available: 3 Insufficient memory.; " +
+			"Pod FailedScheduling: 0/3 nodes are available: 3 node(s) had untolerated taint."
+		r.ErrorContains(err, expectedEvents)
+		r.ErrorIs(err, context.DeadlineExceeded)
+
+		// Events are kept in error reported to CAST AI.
+		parsedErr := parseErrorFromLog(err)
+		r.ErrorContains(parsedErr, expectedEvents)
+		r.ErrorIs(parsedErr, context.DeadlineExceeded)
+		r.Equal(scanErrorTimeout, classifyScanError(parsedErr))
+	})
 }
@@ -0,0 +1,248 @@
+package imagescan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/castai/kvisor/castai"
+)
+
+// vulnerabilityReportsGVR is trivy-operator VulnerabilityReport resource.
+var vulnerabilityReportsGVR = schema.GroupVersionResource{
+	Group:    "aquasecurity.github.io",
+	Version:  "v1alpha1",
+	Resource: "vulnerabilityreports",
+}
+
+const (
+	labelResourceKind      = "trivy-operator.resource.kind"
+	labelResourceName      = "trivy-operator.resource.name"
+	labelResourceNamespace = "trivy-operator.resource.namespace"
+	labelContainerName     = "trivy-operator.container.name"
+	labelManagedBy         = "app.kubernetes.io/managed-by"
+)
+
+func NewVulnerabilityReportWriter(log logrus.FieldLogger, client dynamic.Interface, discovery discovery.DiscoveryInterface) *VulnerabilityReportWriter {
+	return &VulnerabilityReportWriter{
+		log:       log.WithField("component", "imagescan_vulnerability_reports"),
+		client:    client,
+		discovery: discovery,
+		written:   map[string]uint64{},
+	}
+}
+
+// VulnerabilityReportWriter creates or updates VulnerabilityReport objects of workload containers in the same format
+// as trivy-operator does, so results can be consumed by tools built for trivy-operator. Reports are owned by the
+// pod controller, eg. ReplicaSet, so they are garbage collected together with workloads.
+type VulnerabilityReportWriter struct {
+	log       logrus.FieldLogger
+	client    dynamic.Interface
+	discovery discovery.DiscoveryInterface
+
+	// written holds hash of the last written report by report key, so unchanged reports are not updated.
+	written map[string]uint64
+	// crdMissing is set while VulnerabilityReport CRD is not installed to log it only once.
+	crdMissing bool
+}
+
+// vulnerabilityReport is vulnerabilities of image used by workload container.
+type vulnerabilityReport struct {
+	owner           metav1.OwnerReference
+	namespace       string
+	container       string
+	imageName       string
+	imageDigest     string
+	vulnerabilities []castai.ImageVulnerability
+}
+
+// write creates or updates given reports. Reports are skipped if VulnerabilityReport CRD is not installed.
+func (w *VulnerabilityReportWriter) write(ctx context.Context, reports []vulnerabilityReport, now time.Time) error {
+	available, err := w.crdAvailable()
+	if err != nil {
+		return fmt.Errorf("checking VulnerabilityReport CRD: %w", err)
+	}
+	if !available {
+		if !w.crdMissing {
+			w.log.Warn("VulnerabilityReport CRD is not installed, skipping vulnerability reports")
+			w.crdMissing = true
+		}
+		return nil
+	}
+	w.crdMissing = false
+
+	var errs []error
+	written := make(map[string]uint64, len(reports))
+	for _, report := range reports {
+		obj := report.object()
+		key := obj.GetNamespace() + "/" + obj.GetName()
+		if _, found := written[key]; found {
+			// Image of the same container is reported for multiple architectures.
+			continue
+		}
+		hash, err := objectHash(obj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if prev, found := w.written[key]; found && prev == hash {
+			written[key] = hash
+			continue
+		}
+		if err := unstructured.SetNestedField(obj.Object, now.UTC().Format(time.RFC3339), "report", "updateTimestamp"); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := w.apply(ctx, obj); err != nil {
+			errs = append(errs, fmt.Errorf("writing vulnerability report %s: %w", key, err))
+			continue
+		}
+		written[key] = hash
+	}
+	w.written = written
+	return errors.Join(errs...)
+}
+
+// crdAvailable returns true if VulnerabilityReport resource is served by api server.
+func (w *VulnerabilityReportWriter) crdAvailable() (bool, error) {
+	resources, err := w.discovery.ServerResourcesForGroupVersion(vulnerabilityReportsGVR.GroupVersion().String())
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == vulnerabilityReportsGVR.Resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (w *VulnerabilityReportWriter) apply(ctx context.Context, obj *unstructured.Unstructured) error {
+	client := w.client.Resource(vulnerabilityReportsGVR).Namespace(obj.GetNamespace())
+	existing, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = client.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	_, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// objectHash returns hash of object content without update timestamp. Standard json encoder is used as it sorts map keys.
+func objectHash(obj *unstructured.Unstructured) (uint64, error) {
+	b, err := json.Marshal(obj.Object)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return h.Sum64(), nil
+}
+
+func (r vulnerabilityReport) name() string {
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s", r.owner.Kind, r.owner.Name, r.container))
+	if len(validation.IsDNS1035Label(name)) == 0 {
+		return name
+	}
+	// Name is too long or contains not allowed characters, so it's replaced with hash as trivy-operator does.
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return fmt.Sprintf("%s-%x", strings.ToLower(r.owner.Kind), h.Sum32())
+}
+
+func (r vulnerabilityReport) object() *unstructured.Unstructured {
+	repository, tag := splitImageName(r.imageName)
+	// Unstructured objects support only json compatible types, so counts are int64.
+	counts := map[string]int64{}
+	vulnerabilities := make([]any, 0, len(r.vulnerabilities))
+	for _, v := range r.vulnerabilities {
+		switch v.Severity {
+		case castai.SeverityCritical, castai.SeverityHigh, castai.SeverityMedium, castai.SeverityLow, castai.SeverityNone:
+			counts[v.Severity]++
+		default:
+			counts[castai.SeverityUnknown]++
+		}
+		vulnerabilities = append(vulnerabilities, map[string]any{
+			"vulnerabilityID":  v.ID,
+			"resource":         v.PkgName,
+			"installedVersion": v.InstalledVersion,
+			"fixedVersion":     v.FixedVersion,
+			"severity":         v.Severity,
+			"title":            v.Title,
+			"primaryLink":      v.PrimaryURL,
+		})
+	}
+	report := map[string]any{
+		"scanner": map[string]any{
+			"name":   "kvisor",
+			"vendor": "CAST AI",
+		},
+		"registry": map[string]any{
+			"server": imageRegistry(r.imageName),
+		},
+		"artifact": map[string]any{
+			"repository": repository,
+			"tag":        tag,
+			"digest":     r.imageDigest,
+		},
+		"summary": map[string]any{
+			"criticalCount": counts[castai.SeverityCritical],
+			"highCount":     counts[castai.SeverityHigh],
+			"mediumCount":   counts[castai.SeverityMedium],
+			"lowCount":      counts[castai.SeverityLow],
+			"unknownCount":  counts[castai.SeverityUnknown],
+			"noneCount":     counts[castai.SeverityNone],
+		},
+		"vulnerabilities": vulnerabilities,
+	}
+
+	labels := map[string]string{
+		labelResourceKind:      r.owner.Kind,
+		labelResourceNamespace: r.namespace,
+		labelContainerName:     r.container,
+		labelManagedBy:         "kvisor",
+	}
+	if len(validation.IsValidLabelValue(r.owner.Name)) == 0 {
+		labels[labelResourceName] = r.owner.Name
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]any{"report": report}}
+	obj.SetAPIVersion(vulnerabilityReportsGVR.GroupVersion().String())
+	obj.SetKind("VulnerabilityReport")
+	obj.SetNamespace(r.namespace)
+	obj.SetName(r.name())
+	obj.SetLabels(labels)
+	obj.SetOwnerReferences([]metav1.OwnerReference{r.owner})
+	return obj
+}
+
+// splitImageName returns repository without registry host and tag of image name. Tag is empty for images referenced by digest.
+func splitImageName(name string) (string, string) {
+	name, _, _ = strings.Cut(name, "@")
+	repository := trimImageTag(name)
+	tag := strings.TrimPrefix(strings.TrimPrefix(name, repository), ":")
+	if host, rest, found := strings.Cut(repository, "/"); found && imageRegistry(repository) == host {
+		repository = rest
+	}
+	return repository, tag
+}
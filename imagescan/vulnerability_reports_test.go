@@ -0,0 +1,201 @@
+package imagescan
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	json "github.com/json-iterator/go"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
+)
+
+func TestVulnerabilityReports(t *testing.T) {
+	ctx := context.Background()
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{
+				Architecture:    defaultImageArch,
+				OperatingSystem: defaultImageOs,
+			},
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+		},
+	}
+	replicaSetRef := metav1.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "ReplicaSet",
+		Name:       "nginx-7d9c5b",
+		UID:        "rs-uid",
+		Controller: lo.ToPtr(true),
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "nginx-7d9c5b-x2k4z",
+			Namespace:       "default",
+			UID:             "pod-uid",
+			OwnerReferences: []metav1.OwnerReference{replicaSetRef},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "node1",
+			Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.25"}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:    "nginx",
+				ImageID: "docker.io/library/nginx@sha256:abc",
+			}},
+		},
+	}
+
+	newController := func(crdInstalled bool) (*Controller, *dynamicfake.FakeDynamicClient) {
+		clientset := fake.NewSimpleClientset()
+		if crdInstalled {
+			clientset.Resources = []*metav1.APIResourceList{{
+				GroupVersion: vulnerabilityReportsGVR.GroupVersion().String(),
+				APIResources: []metav1.APIResource{{Name: "vulnerabilityreports", Namespaced: true, Kind: "VulnerabilityReport"}},
+			}}
+		}
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			vulnerabilityReportsGVR: "VulnerabilityReportList",
+		})
+		ctrl := newTestController(log, config.ImageScan{})
+		ctrl.reportWriter = NewVulnerabilityReportWriter(log, dynamicClient, clientset.Discovery())
+		ctrl.delta.upsert(node)
+		ctrl.delta.upsert(pod)
+		return ctrl, dynamicClient
+	}
+
+	// setScanResult stores scan result as it's received from scan job.
+	setScanResult := func(ctrl *Controller, result imageScanResult) {
+		ctrl.delta.mu.Lock()
+		defer ctrl.delta.mu.Unlock()
+		ctrl.delta.setImageRescan("docker.io/library/nginx@sha256:abc", defaultImageArch, result)
+	}
+	matchedResult := imageScanResult{
+		vulnerabilities: []castai.ImageVulnerability{
+			{ID: "CVE-2023-1", PkgName: "openssl", InstalledVersion: "3.0.1", FixedVersion: "3.0.2", Severity: castai.SeverityCritical},
+			{ID: "CVE-2023-2", PkgName: "zlib", InstalledVersion: "1.2.11", Severity: castai.SeverityLow},
+		},
+		vulnerabilitiesMatched: true,
+	}
+
+	t.Run("create report owned by pod controller", func(t *testing.T) {
+		r := require.New(t)
+		ctrl, dynamicClient := newController(true)
+
+		setScanResult(ctrl, matchedResult)
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+
+		report, err := dynamicClient.Resource(vulnerabilityReportsGVR).Namespace("default").Get(ctx, "replicaset-nginx-7d9c5b-nginx", metav1.GetOptions{})
+		r.NoError(err)
+		r.Equal([]metav1.OwnerReference{replicaSetRef}, report.GetOwnerReferences())
+		r.Equal("ReplicaSet", report.GetLabels()[labelResourceKind])
+		r.Equal("nginx-7d9c5b", report.GetLabels()[labelResourceName])
+		r.Equal("nginx", report.GetLabels()[labelContainerName])
+
+		repository, _, _ := unstructured.NestedString(report.Object, "report", "artifact", "repository")
+		r.Equal("nginx", repository)
+		digest, _, _ := unstructured.NestedString(report.Object, "report", "artifact", "digest")
+		r.Equal("sha256:abc", digest)
+		critical, _, _ := unstructured.NestedInt64(report.Object, "report", "summary", "criticalCount")
+		r.Equal(int64(1), critical)
+		low, _, _ := unstructured.NestedInt64(report.Object, "report", "summary", "lowCount")
+		r.Equal(int64(1), low)
+		vulnerabilities, _, _ := unstructured.NestedSlice(report.Object, "report", "vulnerabilities")
+		r.Len(vulnerabilities, 2)
+	})
+
+	t.Run("update report only when vulnerabilities change", func(t *testing.T) {
+		r := require.New(t)
+		ctrl, dynamicClient := newController(true)
+
+		setScanResult(ctrl, matchedResult)
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+		r.Len(lo.Filter(dynamicClient.Actions(), func(a k8stesting.Action, _ int) bool {
+			return a.GetVerb() == "create" || a.GetVerb() == "update"
+		}), 1)
+
+		// Rescan matched no vulnerabilities.
+		setScanResult(ctrl, imageScanResult{vulnerabilitiesMatched: true})
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+
+		report, err := dynamicClient.Resource(vulnerabilityReportsGVR).Namespace("default").Get(ctx, "replicaset-nginx-7d9c5b-nginx", metav1.GetOptions{})
+		r.NoError(err)
+		vulnerabilities, _, _ := unstructured.NestedSlice(report.Object, "report", "vulnerabilities")
+		r.Empty(vulnerabilities)
+	})
+
+	t.Run("create report from scan job result without trivy server", func(t *testing.T) {
+		r := require.New(t)
+		ctrl, dynamicClient := newController(true)
+		// Scan jobs match vulnerabilities with trivy database.
+		ctrl.cfg.VulnerabilityReports = true
+		ctrl.ready.Store(true)
+		client := mock_castai.NewMockClient(gomock.NewController(t))
+		client.EXPECT().SendImageMetadata(gomock.Any(), gomock.Any()).Return(nil)
+		handler := NewHttpHandlers(log, client, ctrl)
+
+		body, err := json.Marshal(castai.ImageMetadata{
+			ImageID:         "docker.io/library/nginx@sha256:abc",
+			Architecture:    defaultImageArch,
+			Vulnerabilities: matchedResult.vulnerabilities,
+		})
+		r.NoError(err)
+		rec := httptest.NewRecorder()
+		handler.HandleImageMetadata(rec, httptest.NewRequest(http.MethodPost, "/v1/image-scan/report", bytes.NewReader(body)))
+		r.Equal(http.StatusOK, rec.Code)
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+
+		report, err := dynamicClient.Resource(vulnerabilityReportsGVR).Namespace("default").Get(ctx, "replicaset-nginx-7d9c5b-nginx", metav1.GetOptions{})
+		r.NoError(err)
+		r.Equal([]metav1.OwnerReference{replicaSetRef}, report.GetOwnerReferences())
+		vulnerabilities, _, _ := unstructured.NestedSlice(report.Object, "report", "vulnerabilities")
+		r.Len(vulnerabilities, 2)
+	})
+
+	t.Run("skip images which vulnerabilities were not matched by scan job", func(t *testing.T) {
+		r := require.New(t)
+		ctrl, dynamicClient := newController(true)
+
+		setScanResult(ctrl, imageScanResult{})
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+		r.Empty(lo.Filter(dynamicClient.Actions(), func(a k8stesting.Action, _ int) bool {
+			return a.GetVerb() == "create" || a.GetVerb() == "update"
+		}))
+	})
+
+	t.Run("skip reports when crd is not installed", func(t *testing.T) {
+		r := require.New(t)
+		ctrl, dynamicClient := newController(false)
+
+		setScanResult(ctrl, matchedResult)
+		r.NoError(ctrl.writeVulnerabilityReports(ctx))
+		r.Empty(dynamicClient.Actions())
+	})
+}
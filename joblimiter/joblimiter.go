@@ -0,0 +1,49 @@
+package joblimiter
+
+import (
+	"context"
+)
+
+// New returns limiter of kubernetes jobs running at the same time. Jobs are not limited if limit is zero.
+func New(limit int) *Limiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &Limiter{
+		slots: make(chan struct{}, limit),
+	}
+}
+
+// Limiter is job concurrency budget shared by all job types, eg. image scan and kube-bench jobs, so together
+// they do not overwhelm the cluster. Nil limiter does not limit jobs.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// Acquire blocks until job can be created or context is done. Release must be called once job finishes.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case l.slots <- struct{}{}:
+		return nil
+	}
+}
+
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// Running returns number of jobs holding the budget.
+func (l *Limiter) Running() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
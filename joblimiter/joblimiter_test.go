@@ -0,0 +1,71 @@
+package joblimiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("limit jobs of all types combined", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		limiter := New(3)
+
+		var running, maxRunning atomic.Int32
+		runJob := func() {
+			r.NoError(limiter.Acquire(ctx))
+			defer limiter.Release()
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		// Each job type has its own limit, which together exceed the combined limit.
+		var wg sync.WaitGroup
+		for _, typeLimit := range []int{3, 2} {
+			for i := 0; i < typeLimit; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						runJob()
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		r.Equal(int32(3), maxRunning.Load())
+		r.Equal(0, limiter.Running())
+	})
+
+	t.Run("stop waiting once context is done", func(t *testing.T) {
+		r := require.New(t)
+		limiter := New(1)
+		r.NoError(limiter.Acquire(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		r.ErrorIs(limiter.Acquire(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("do not limit jobs if limit is not set", func(t *testing.T) {
+		r := require.New(t)
+		limiter := New(0)
+		for i := 0; i < 10; i++ {
+			r.NoError(limiter.Acquire(context.Background()))
+		}
+		limiter.Release()
+	})
+}
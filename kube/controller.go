@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"runtime/debug"
 	"sync"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
@@ -22,16 +24,28 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 
+	"github.com/castai/kvisor/metrics"
 	"github.com/castai/kvisor/version"
 )
 
+const (
+	kvisorDeploymentName = "castai-kvisor"
+	// kvisorDeploymentFetchTTL limits how often kvisor deployment is read from api server while it's not cached
+	// by informer. Both fetched deployment and failed fetch are remembered for this long.
+	kvisorDeploymentFetchTTL = time.Minute
+)
+
 func NewController(
 	log logrus.FieldLogger,
 	f informers.SharedInformerFactory,
+	client kubernetes.Interface,
 	k8sVersion version.Version,
 	kvisorNamespace string,
+	informerSyncTimeout time.Duration,
+	subscriberRestartBackoff time.Duration,
 ) *Controller {
 	typeInformerMap := map[reflect.Type]cache.SharedInformer{
 		reflect.TypeOf(&corev1.Node{}):                f.Core().V1().Nodes().Informer(),
@@ -49,6 +63,7 @@ func NewController(
 		reflect.TypeOf(&networkingv1.NetworkPolicy{}): f.Networking().V1().NetworkPolicies().Informer(),
 		reflect.TypeOf(&networkingv1.Ingress{}):       f.Networking().V1().Ingresses().Informer(),
 		reflect.TypeOf(&corev1.Pod{}):                 f.Core().V1().Pods().Informer(),
+		reflect.TypeOf(&corev1.ServiceAccount{}):      f.Core().V1().ServiceAccounts().Informer(),
 	}
 
 	if k8sVersion.MinorInt >= 21 {
@@ -57,16 +72,25 @@ func NewController(
 		typeInformerMap[reflect.TypeOf(&batchv1beta1.CronJob{})] = f.Batch().V1beta1().CronJobs().Informer()
 	}
 
+	if subscriberRestartBackoff == 0 {
+		subscriberRestartBackoff = time.Second
+	}
+
 	c := &Controller{
-		log:                  log,
-		k8sVersion:           k8sVersion,
-		informerFactory:      f,
-		informers:            typeInformerMap,
-		podsBuffSyncInterval: 5 * time.Second,
-		kvisorNamespace:      kvisorNamespace,
-		replicaSets:          make(map[types.UID]*appsv1.ReplicaSet),
-		deployments:          make(map[types.UID]*appsv1.Deployment),
-		jobs:                 make(map[types.UID]*batchv1.Job),
+		log:                      log,
+		k8sVersion:               k8sVersion,
+		informerFactory:          f,
+		client:                   client,
+		informers:                typeInformerMap,
+		podsBuffSyncInterval:     5 * time.Second,
+		updatesBuffInterval:      1 * time.Second,
+		kvisorNamespace:          kvisorNamespace,
+		informerSyncTimeout:      informerSyncTimeout,
+		subscriberRestartBackoff: subscriberRestartBackoff,
+		replicaSets:              make(map[types.UID]*appsv1.ReplicaSet),
+		deployments:              make(map[types.UID]*appsv1.Deployment),
+		jobs:                     make(map[types.UID]*batchv1.Job),
+		replicaSetOwners:         newOwnerCache(),
 	}
 	return c
 }
@@ -75,16 +99,30 @@ type Controller struct {
 	log             logrus.FieldLogger
 	k8sVersion      version.Version
 	informerFactory informers.SharedInformerFactory
+	client          kubernetes.Interface
 	informers       map[reflect.Type]cache.SharedInformer
 	subscribers     []ObjectSubscriber
 
 	podsBuffSyncInterval time.Duration
-	kvisorNamespace      string
+	// updatesBuffInterval is a window during which multiple updates of the same object are coalesced.
+	updatesBuffInterval time.Duration
+	kvisorNamespace     string
+	// informerSyncTimeout limits how long subscriber waits for each informer sync. Disabled if zero.
+	informerSyncTimeout time.Duration
+	// subscriberRestartBackoff is initial delay before subscriber which panicked is restarted.
+	subscriberRestartBackoff time.Duration
 
 	deltasMu    sync.RWMutex
 	replicaSets map[types.UID]*appsv1.ReplicaSet
 	deployments map[types.UID]*appsv1.Deployment
 	jobs        map[types.UID]*batchv1.Job
+	// replicaSetOwners memoizes owners resolved by matching deployment selectors.
+	replicaSetOwners *ownerCache
+
+	kvisorDeploymentMu sync.Mutex
+	// kvisorDeploymentSpec is kvisor deployment fetched from api server. Nil if the last fetch failed.
+	kvisorDeploymentSpec      *appsv1.DeploymentSpec
+	kvisorDeploymentFetchedAt time.Time
 }
 
 func (c *Controller) AddSubscribers(subs ...ObjectSubscriber) {
@@ -99,20 +137,29 @@ func (c *Controller) Start(ctx context.Context) error {
 	// Start manager.
 	errGroup, ctx := errgroup.WithContext(ctx)
 
+	// Register handlers in parallel. Handler registration waits for informer locks which is slow with many informers.
+	var registerGroup errgroup.Group
 	for typ, informer := range c.informers {
-		if err := informer.SetTransform(c.transformFunc); err != nil {
-			return err
-		}
-		if _, err := informer.AddEventHandler(c.eventsHandler(ctx, typ)); err != nil {
-			return err
-		}
+		typ, informer := typ, informer
+		registerGroup.Go(func() error {
+			if err := informer.SetTransform(c.transformFunc); err != nil {
+				return err
+			}
+			if _, err := informer.AddEventHandler(c.eventsHandler(ctx, typ)); err != nil {
+				return err
+			}
+			return nil
+		})
+	}
+	if err := registerGroup.Wait(); err != nil {
+		return err
 	}
 	c.informerFactory.Start(ctx.Done())
 
 	for _, subscriber := range c.subscribers {
 		func(ctx context.Context, subscriber ObjectSubscriber) {
 			errGroup.Go(func() error {
-				err := c.runSubscriber(ctx, subscriber)
+				err := c.runSubscriberWithRestarts(ctx, subscriber)
 				if errors.Is(err, context.Canceled) {
 					return nil
 				}
@@ -147,13 +194,20 @@ func (c *Controller) GetPodOwnerID(pod *corev1.Pod) string {
 			}
 		}
 
+		if owner, found := c.replicaSetOwners.get(ref.UID); found {
+			return string(owner)
+		}
+
 		// Slow path. Find deployment by matching selectors.
 		// In this Deployment could be managed by some crd like ArgoRollouts.
+		// Pods of the same ReplicaSet share labels, so result is memoized per ReplicaSet.
 		if owner, found := findOwnerFromDeployments(c.deployments, pod); found {
+			c.replicaSetOwners.set(ref.UID, owner)
 			return string(owner)
 		}
 
 		if found {
+			c.replicaSetOwners.set(ref.UID, rs.UID)
 			return string(rs.UID)
 		}
 	case "Job":
@@ -182,7 +236,6 @@ type KvisorImageDetails struct {
 func (c *Controller) GetKvisorImageDetails() (KvisorImageDetails, bool) {
 	spec, found := c.getKvisorDeploymentSpec()
 	if !found {
-		c.log.Warn("kvisor deployment not found")
 		return KvisorImageDetails{}, false
 	}
 	var imageName string
@@ -202,37 +255,145 @@ func (c *Controller) GetKvisorImageDetails() (KvisorImageDetails, bool) {
 	}, true
 }
 
+// ListObjects returns objects of given type from informer cache.
+// It allows subscribers to build their initial state without waiting for informer events.
+func (c *Controller) ListObjects(typ reflect.Type) ([]Object, error) {
+	informer, ok := c.informers[typ]
+	if !ok {
+		return nil, fmt.Errorf("no informer for type %v", typ)
+	}
+	items := informer.GetStore().List()
+	objects := make([]Object, 0, len(items))
+	for _, item := range items {
+		if obj, ok := item.(Object); ok {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
 func (c *Controller) getKvisorDeploymentSpec() (appsv1.DeploymentSpec, bool) {
+	if spec, found := c.getCachedKvisorDeploymentSpec(); found {
+		return spec, true
+	}
+
+	// Deployments informer may not be synced yet during startup. Read deployment directly from api server,
+	// but at most once per fetch TTL so that callers retrying on miss don't flood api server and logs.
+	c.kvisorDeploymentMu.Lock()
+	defer c.kvisorDeploymentMu.Unlock()
+
+	if !c.kvisorDeploymentFetchedAt.IsZero() && time.Since(c.kvisorDeploymentFetchedAt) < kvisorDeploymentFetchTTL {
+		if c.kvisorDeploymentSpec == nil {
+			return appsv1.DeploymentSpec{}, false
+		}
+		return *c.kvisorDeploymentSpec, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.kvisorDeploymentFetchedAt = time.Now()
+	deployment, err := c.client.AppsV1().Deployments(c.kvisorNamespace).Get(ctx, kvisorDeploymentName, metav1.GetOptions{})
+	if err != nil {
+		c.kvisorDeploymentSpec = nil
+		c.log.Warnf("getting kvisor deployment: %v", err)
+		return appsv1.DeploymentSpec{}, false
+	}
+	c.kvisorDeploymentSpec = &deployment.Spec
+	return deployment.Spec, true
+}
+
+func (c *Controller) getCachedKvisorDeploymentSpec() (appsv1.DeploymentSpec, bool) {
 	c.deltasMu.RLock()
 	defer c.deltasMu.RUnlock()
 
 	for _, deployment := range c.deployments {
-		if deployment.Namespace == c.kvisorNamespace && deployment.Name == "castai-kvisor" {
+		if deployment.Namespace == c.kvisorNamespace && deployment.Name == kvisorDeploymentName {
 			return deployment.Spec, true
 		}
 	}
 	return appsv1.DeploymentSpec{}, false
 }
 
+// maxSubscriberRestartBackoff limits delay between restarts of subscriber which keeps panicking. Backoff is reset
+// if subscriber was running longer than that.
+const maxSubscriberRestartBackoff = 5 * time.Minute
+
+// runSubscriberWithRestarts runs subscriber and restarts it with backoff if it panics, so a single crashing
+// subscriber does not stop the agent.
+func (c *Controller) runSubscriberWithRestarts(ctx context.Context, subscriber ObjectSubscriber) error {
+	backoff := c.subscriberRestartBackoff
+	for {
+		start := time.Now()
+		panicked, err := c.runSubscriberRecovered(ctx, subscriber)
+		if !panicked {
+			return err
+		}
+		if time.Since(start) > maxSubscriberRestartBackoff {
+			backoff = c.subscriberRestartBackoff
+		}
+
+		c.log.Warnf("restarting subscriber %T in %v", subscriber, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxSubscriberRestartBackoff)
+	}
+}
+
+func (c *Controller) runSubscriberRecovered(ctx context.Context, subscriber ObjectSubscriber) (panicked bool, rerr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.log.Errorf("subscriber %T panicked: %v\n%s", subscriber, r, debug.Stack())
+			metrics.IncSubscriberPanics(fmt.Sprintf("%T", subscriber))
+			panicked = true
+		}
+	}()
+	return false, c.runSubscriber(ctx, subscriber)
+}
+
 func (c *Controller) runSubscriber(ctx context.Context, subscriber ObjectSubscriber) error {
 	requiredInformerTypes := subscriber.RequiredInformers()
-	syncs := make([]cache.InformerSynced, 0, len(requiredInformerTypes))
+	informers := make(map[reflect.Type]cache.SharedInformer, len(requiredInformerTypes))
 
 	for _, typ := range requiredInformerTypes {
 		informer, ok := c.informers[typ]
 		if !ok {
 			return fmt.Errorf("no informer for type %v", typ)
 		}
-		syncs = append(syncs, informer.HasSynced)
+		informers[typ] = informer
 	}
 
-	if len(syncs) > 0 && !cache.WaitForCacheSync(ctx.Done(), syncs...) {
-		return fmt.Errorf("failed to wait for cache sync")
+	for typ, informer := range informers {
+		if err := c.waitForInformerSync(ctx, typ, informer); err != nil {
+			return err
+		}
 	}
 
 	return subscriber.Run(ctx)
 }
 
+// waitForInformerSync waits until informer is synced. If sync timeout is configured, slow informer is logged
+// and skipped so it does not block subscriber start.
+func (c *Controller) waitForInformerSync(ctx context.Context, typ reflect.Type, informer cache.SharedInformer) error {
+	syncCtx := ctx
+	if c.informerSyncTimeout > 0 {
+		var cancel context.CancelFunc
+		syncCtx, cancel = context.WithTimeout(ctx, c.informerSyncTimeout)
+		defer cancel()
+	}
+
+	if cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("failed to wait for cache sync: %w", ctx.Err())
+	}
+	c.log.Warnf("informer for type %v is not synced after %v, continuing without waiting", typ, c.informerSyncTimeout)
+	return nil
+}
+
 func (c *Controller) transformFunc(i any) (any, error) {
 	obj := i.(Object)
 	// Add missing metadata which is removed by k8s.
@@ -253,6 +414,7 @@ func (c *Controller) eventsHandler(ctx context.Context, typ reflect.Type) cache.
 	})
 	subs := lo.Map(subscribers, func(sub ObjectSubscriber, i int) subChannel {
 		return subChannel{
+			log:     c.log,
 			handler: sub,
 			events:  make(chan event, 10),
 		}
@@ -264,23 +426,32 @@ func (c *Controller) eventsHandler(ctx context.Context, typ reflect.Type) cache.
 		go func() {
 			// podsEventsBuff is used to delay pods events. In some places like image scan we need to find
 			// pod owners. With buffer we give time for replica sets and jobs objects to sync.
-			var podsEventsBuff []event
+			podsEventsBuff := newEventsBuffer()
 			podsBuffSyncTicker := time.NewTicker(c.podsBuffSyncInterval)
 			defer podsBuffSyncTicker.Stop()
 
+			// eventsBuff coalesces updates of other objects. On api server restarts informers resync
+			// and send update events for every object which should not overwhelm subscribers.
+			eventsBuff := newEventsBuffer()
+			updatesBuffTicker := time.NewTicker(c.updatesBuffInterval)
+			defer updatesBuffTicker.Stop()
+
 			for {
 				select {
 				case ev := <-sub.events:
 					if ev.obj.GetObjectKind().GroupVersionKind().Kind == "Pod" {
-						podsEventsBuff = append(podsEventsBuff, ev)
+						podsEventsBuff.add(ev)
 						continue
 					}
-					sub.handleEvent(ev)
-				case <-podsBuffSyncTicker.C:
-					for _, ev := range podsEventsBuff {
-						sub.handleEvent(ev)
+					eventsBuff.add(ev)
+					// Only updates are delayed. Flushing keeps events order for the same object.
+					if ev.eventType != eventTypeUpdate {
+						sub.handleEvents(eventsBuff.flush())
 					}
-					podsEventsBuff = []event{}
+				case <-updatesBuffTicker.C:
+					sub.handleEvents(eventsBuff.flush())
+				case <-podsBuffSyncTicker.C:
+					sub.handleEvents(podsEventsBuff.flush())
 				case <-ctx.Done():
 					return
 				}
@@ -342,7 +513,12 @@ func (c *Controller) handleDeltaUpsert(obj Object) {
 	switch v := obj.(type) {
 	case *appsv1.ReplicaSet:
 		c.replicaSets[v.UID] = v
+		c.replicaSetOwners.delete(v.UID)
 	case *appsv1.Deployment:
+		// Any memoized owner can change if deployment selector is added or changed.
+		if prev, found := c.deployments[v.UID]; !found || !equality.Semantic.DeepEqual(prev.Spec.Selector, v.Spec.Selector) {
+			c.replicaSetOwners.reset()
+		}
 		c.deployments[v.UID] = v
 	case *batchv1.Job:
 		c.jobs[v.UID] = v
@@ -356,8 +532,10 @@ func (c *Controller) handleDeltaDelete(obj Object) {
 	switch v := obj.(type) {
 	case *appsv1.ReplicaSet:
 		delete(c.replicaSets, v.UID)
+		c.replicaSetOwners.delete(v.UID)
 	case *appsv1.Deployment:
 		delete(c.deployments, v.UID)
+		c.replicaSetOwners.reset()
 	case *batchv1.Job:
 		delete(c.jobs, v.UID)
 	}
@@ -377,11 +555,27 @@ type event struct {
 }
 
 type subChannel struct {
+	log     logrus.FieldLogger
 	handler ResourceEventHandler
 	events  chan event
 }
 
+func (c *subChannel) handleEvents(events []event) {
+	for _, ev := range events {
+		c.handleEvent(ev)
+	}
+}
+
 func (c *subChannel) handleEvent(ev event) {
+	// Panic while handling single malformed object should not crash the agent, the event is skipped instead.
+	defer func() {
+		if r := recover(); r != nil {
+			c.log.Errorf("subscriber %T panicked handling %s event of %s %s/%s: %v\n%s", c.handler, ev.eventType,
+				ev.obj.GetObjectKind().GroupVersionKind().Kind, ev.obj.GetNamespace(), ev.obj.GetName(), r, debug.Stack())
+			metrics.IncSubscriberPanics(fmt.Sprintf("%T", c.handler))
+		}
+	}()
+
 	switch ev.eventType {
 	case eventTypeAdd:
 		c.handler.OnAdd(ev.obj)
@@ -392,6 +586,52 @@ func (c *subChannel) handleEvent(ev event) {
 	}
 }
 
+type objectKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func newEventsBuffer() *eventsBuffer {
+	return &eventsBuffer{
+		updates: make(map[objectKey]int),
+	}
+}
+
+// eventsBuffer keeps events order while coalescing multiple updates of the same object into the latest one.
+type eventsBuffer struct {
+	events []event
+	// updates contains index of the last buffered update event for each object.
+	updates map[objectKey]int
+}
+
+func (b *eventsBuffer) add(ev event) {
+	key := objectKey{
+		kind:      ev.obj.GetObjectKind().GroupVersionKind().Kind,
+		namespace: ev.obj.GetNamespace(),
+		name:      ev.obj.GetName(),
+	}
+	if ev.eventType != eventTypeUpdate {
+		// Updates after add or delete should not be merged with updates before it.
+		delete(b.updates, key)
+		b.events = append(b.events, ev)
+		return
+	}
+	if i, found := b.updates[key]; found {
+		b.events[i] = ev
+		return
+	}
+	b.updates[key] = len(b.events)
+	b.events = append(b.events, ev)
+}
+
+func (b *eventsBuffer) flush() []event {
+	events := b.events
+	b.events = nil
+	b.updates = make(map[objectKey]int)
+	return events
+}
+
 // addObjectMeta adds missing metadata since kubernetes client removes object kind and api version information.
 func addObjectMeta(o Object) {
 	appsV1 := "apps/v1"
@@ -421,6 +661,9 @@ func addObjectMeta(o Object) {
 	case *corev1.Pod:
 		o.Kind = "Pod"
 		o.APIVersion = v1
+	case *corev1.ServiceAccount:
+		o.Kind = "ServiceAccount"
+		o.APIVersion = v1
 	case *rbacv1.ClusterRoleBinding:
 		o.Kind = "ClusterRoleBinding"
 		o.APIVersion = "rbac.authorization.k8s.io/v1"
@@ -478,3 +721,41 @@ func findOwnerFromDeployments(items map[types.UID]*appsv1.Deployment, pod *corev
 	}
 	return "", false
 }
+
+func newOwnerCache() *ownerCache {
+	return &ownerCache{
+		owners: make(map[types.UID]types.UID),
+	}
+}
+
+// ownerCache maps object UID to its resolved owner UID. It is safe for concurrent use since
+// owners are resolved under deltas read lock.
+type ownerCache struct {
+	mu     sync.Mutex
+	owners map[types.UID]types.UID
+}
+
+func (c *ownerCache) get(uid types.UID) (types.UID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	owner, found := c.owners[uid]
+	return owner, found
+}
+
+func (c *ownerCache) set(uid, owner types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.owners[uid] = owner
+}
+
+func (c *ownerCache) delete(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.owners, uid)
+}
+
+func (c *ownerCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.owners = make(map[types.UID]types.UID)
+}
@@ -3,11 +3,14 @@ package kube
 import (
 	"context"
 	"reflect"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
@@ -17,6 +20,8 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/castai/kvisor/version"
 )
@@ -70,7 +75,7 @@ func TestController(t *testing.T) {
 			newTestSubscriber(log.WithField("sub", "sub1")),
 			newTestSubscriber(log.WithField("sub", "sub2")),
 		}
-		ctrl := NewController(log, informersFactory, version.Version{MinorInt: 22}, "castai-agent")
+		ctrl := NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 0)
 		ctrl.AddSubscribers(testSubs...)
 		ctrl.podsBuffSyncInterval = 1 * time.Millisecond
 
@@ -247,7 +252,7 @@ func TestController(t *testing.T) {
 		informersFactory := informers.NewSharedInformerFactory(clientset, 0)
 
 		testSub := newTestSubscriber(log.WithField("sub", "sub1"))
-		ctrl := NewController(log, informersFactory, version.Version{MinorInt: 22}, "castai-agent")
+		ctrl := NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 0)
 		ctrl.podsBuffSyncInterval = 10 * time.Millisecond
 		ctrl.AddSubscribers(testSub)
 
@@ -276,6 +281,162 @@ func TestController(t *testing.T) {
 		r.Equal(string(ds.UID), ctrl.GetPodOwnerID(p9))
 		r.Equal(string(dep.UID), ctrl.GetPodOwnerID(p10))
 	})
+
+	t.Run("get kvisor image details from api when cache is not synced", func(t *testing.T) {
+		r := require.New(t)
+
+		clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "castai-kvisor",
+				Namespace: "castai-agent",
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "kvisor",
+								Image: "ghcr.io/castai/kvisor/kvisor:v1",
+							},
+						},
+						ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pull-secret"}},
+					},
+				},
+			},
+		})
+		informersFactory := informers.NewSharedInformerFactory(clientset, 0)
+		// Controller is not started so deployments cache is empty.
+		ctrl := NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 0)
+
+		details, found := ctrl.GetKvisorImageDetails()
+		r.True(found)
+		r.Equal(KvisorImageDetails{
+			ImageName:        "ghcr.io/castai/kvisor/kvisor:v1",
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pull-secret"}},
+		}, details)
+
+		_, found = NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "other", 0, 0).GetKvisorImageDetails()
+		r.False(found)
+	})
+
+	t.Run("fetch kvisor deployment from api at most once per ttl", func(t *testing.T) {
+		r := require.New(t)
+
+		clientset := fake.NewSimpleClientset()
+		informersFactory := informers.NewSharedInformerFactory(clientset, 0)
+		ctrl := NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 0)
+
+		countGets := func() int {
+			return len(lo.Filter(clientset.Actions(), func(action k8stesting.Action, _ int) bool {
+				return action.GetVerb() == "get" && action.GetResource().Resource == "deployments"
+			}))
+		}
+
+		for i := 0; i < 3; i++ {
+			_, found := ctrl.GetKvisorImageDetails()
+			r.False(found)
+		}
+		r.Equal(1, countGets())
+
+		// Fetch is retried after ttl.
+		ctrl.kvisorDeploymentFetchedAt = time.Now().Add(-kvisorDeploymentFetchTTL)
+		_, err := clientset.AppsV1().Deployments("castai-agent").Create(context.Background(), &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "castai-kvisor",
+				Namespace: "castai-agent",
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "kvisor", Image: "ghcr.io/castai/kvisor/kvisor:v1"}},
+					},
+				},
+			},
+		}, metav1.CreateOptions{})
+		r.NoError(err)
+		for i := 0; i < 3; i++ {
+			details, found := ctrl.GetKvisorImageDetails()
+			r.True(found)
+			r.Equal("ghcr.io/castai/kvisor/kvisor:v1", details.ImageName)
+		}
+		r.Equal(2, countGets())
+	})
+
+	t.Run("start subscribers while slow informer is syncing", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		informersFactory := informers.NewSharedInformerFactory(clientset, 0)
+		ctrl := NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "castai-agent", time.Second, 0)
+		podType := reflect.TypeOf(&corev1.Pod{})
+		ctrl.informers[podType] = &notSyncedInformer{SharedInformer: ctrl.informers[podType]}
+
+		fastSub := newStartSubscriber(reflect.TypeOf(&corev1.Namespace{}))
+		slowSub := newStartSubscriber(reflect.TypeOf(&corev1.Namespace{}), podType)
+		ctrl.AddSubscribers(fastSub, slowSub)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			_ = ctrl.Start(ctx)
+		}()
+
+		select {
+		case <-fastSub.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for subscriber start")
+		}
+		select {
+		case <-slowSub.started:
+			t.Fatal("subscriber started before informer sync timeout")
+		case <-time.After(300 * time.Millisecond):
+		}
+
+		// Subscriber is started without waiting for slow informer after sync timeout.
+		select {
+		case <-slowSub.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for subscriber start after sync timeout")
+		}
+	})
+
+	t.Run("recover and restart panicking subscriber", func(t *testing.T) {
+		r := require.New(t)
+		clientset := fake.NewSimpleClientset(&corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "default", UID: "default"},
+		})
+		informersFactory := informers.NewSharedInformerFactory(clientset, 0)
+		ctrl := NewController(log, informersFactory, clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 10*time.Millisecond)
+
+		panickingSub := &panickingSubscriber{started: make(chan struct{}, 3)}
+		healthySub := newStartSubscriber(reflect.TypeOf(&corev1.Namespace{}))
+		ctrl.AddSubscribers(panickingSub, healthySub)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		errc := make(chan error, 1)
+		go func() {
+			errc <- ctrl.Start(ctx)
+		}()
+
+		// Subscriber is restarted after each panic while other subscribers keep running.
+		for i := 0; i < 3; i++ {
+			select {
+			case <-panickingSub.started:
+			case err := <-errc:
+				t.Fatalf("controller stopped: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for subscriber restart")
+			}
+		}
+		<-healthySub.started
+		// Panic on object event is recovered too.
+		r.Eventually(func() bool {
+			return panickingSub.addCalls.Load() > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		r.NoError(<-errc)
+	})
 }
 
 func newTestSubscriber(log logrus.FieldLogger) *testSubscriber {
@@ -287,6 +448,68 @@ func newTestSubscriber(log logrus.FieldLogger) *testSubscriber {
 	}
 }
 
+// notSyncedInformer simulates informer which initial list takes long time.
+type notSyncedInformer struct {
+	cache.SharedInformer
+}
+
+func (i *notSyncedInformer) HasSynced() bool {
+	return false
+}
+
+func newStartSubscriber(types ...reflect.Type) *startSubscriber {
+	return &startSubscriber{
+		types:   types,
+		started: make(chan struct{}),
+	}
+}
+
+// startSubscriber signals when it is started.
+type startSubscriber struct {
+	types   []reflect.Type
+	started chan struct{}
+}
+
+func (s *startSubscriber) OnAdd(obj Object)    {}
+func (s *startSubscriber) OnUpdate(obj Object) {}
+func (s *startSubscriber) OnDelete(obj Object) {}
+
+func (s *startSubscriber) Run(ctx context.Context) error {
+	close(s.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *startSubscriber) RequiredInformers() []reflect.Type {
+	return s.types
+}
+
+// panickingSubscriber panics on every run and every added object.
+type panickingSubscriber struct {
+	started  chan struct{}
+	addCalls atomic.Int32
+}
+
+func (s *panickingSubscriber) OnAdd(obj Object) {
+	s.addCalls.Add(1)
+	panic("malformed object")
+}
+
+func (s *panickingSubscriber) OnUpdate(obj Object) {}
+func (s *panickingSubscriber) OnDelete(obj Object) {}
+
+func (s *panickingSubscriber) Run(ctx context.Context) error {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	panic("subscriber crashed")
+}
+
+func (s *panickingSubscriber) RequiredInformers() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf(&corev1.Namespace{})}
+}
+
 type testSubscriber struct {
 	log         logrus.FieldLogger
 	mu          sync.Mutex
@@ -367,3 +590,130 @@ func (t *testSubscriber) RequiredInformers() []reflect.Type {
 		reflect.TypeOf(&batchv1.Job{}),
 	}
 }
+
+func TestEventsBuffer(t *testing.T) {
+	r := require.New(t)
+
+	newDeployment := func(name, rev string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			TypeMeta: metav1.TypeMeta{Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				ResourceVersion: rev,
+			},
+		}
+	}
+
+	buf := newEventsBuffer()
+	buf.add(event{eventType: eventTypeAdd, obj: newDeployment("d1", "1")})
+	for i := 2; i <= 10; i++ {
+		buf.add(event{eventType: eventTypeUpdate, obj: newDeployment("d1", strconv.Itoa(i))})
+	}
+	buf.add(event{eventType: eventTypeUpdate, obj: newDeployment("d2", "1")})
+	buf.add(event{eventType: eventTypeDelete, obj: newDeployment("d1", "11")})
+	buf.add(event{eventType: eventTypeUpdate, obj: newDeployment("d2", "2")})
+
+	events := buf.flush()
+	r.Len(events, 4)
+	r.Equal(eventTypeAdd, events[0].eventType)
+	r.Equal(eventTypeUpdate, events[1].eventType)
+	r.Equal("10", events[1].obj.GetResourceVersion())
+	r.Equal(eventTypeUpdate, events[2].eventType)
+	r.Equal("d2", events[2].obj.GetName())
+	r.Equal("2", events[2].obj.GetResourceVersion())
+	r.Equal(eventTypeDelete, events[3].eventType)
+
+	r.Empty(buf.flush())
+}
+
+func newTestDeployment(name string, selector map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:  types.UID(uuid.New().String()),
+			Name: name,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+		},
+	}
+}
+
+func TestPodOwnerCache(t *testing.T) {
+	r := require.New(t)
+	clientset := fake.NewSimpleClientset()
+	ctrl := NewController(logrus.New(), informers.NewSharedInformerFactory(clientset, 0), clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 0)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             types.UID(uuid.New().String()),
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{{UID: "rs1", Kind: "ReplicaSet"}},
+		},
+	}
+
+	dep1 := newTestDeployment("d1", map[string]string{"app": "web"})
+	ctrl.handleDeltaUpsert(dep1)
+	r.Equal(string(dep1.UID), ctrl.GetPodOwnerID(pod))
+	owner, found := ctrl.replicaSetOwners.get("rs1")
+	r.True(found)
+	r.Equal(dep1.UID, owner)
+
+	// Status updates keep memoized owners.
+	dep1Updated := dep1.DeepCopy()
+	dep1Updated.Status.Replicas = 2
+	ctrl.handleDeltaUpsert(dep1Updated)
+	_, found = ctrl.replicaSetOwners.get("rs1")
+	r.True(found)
+
+	// Selector change invalidates memoized owners.
+	dep1Updated = dep1.DeepCopy()
+	dep1Updated.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}
+	ctrl.handleDeltaUpsert(dep1Updated)
+	r.Equal(string(pod.UID), ctrl.GetPodOwnerID(pod))
+
+	dep2 := newTestDeployment("d2", map[string]string{"app": "web"})
+	ctrl.handleDeltaUpsert(dep2)
+	r.Equal(string(dep2.UID), ctrl.GetPodOwnerID(pod))
+
+	ctrl.handleDeltaDelete(dep2)
+	r.Equal(string(pod.UID), ctrl.GetPodOwnerID(pod))
+}
+
+func BenchmarkGetPodOwnerID(b *testing.B) {
+	clientset := fake.NewSimpleClientset()
+	ctrl := NewController(logrus.New(), informers.NewSharedInformerFactory(clientset, 0), clientset, version.Version{MinorInt: 22}, "castai-agent", 0, 0)
+	for i := 0; i < 1000; i++ {
+		ctrl.handleDeltaUpsert(newTestDeployment("d"+strconv.Itoa(i), map[string]string{"app": "app" + strconv.Itoa(i)}))
+	}
+	// ReplicaSet managed by custom resource is resolved by matching deployment selectors.
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             types.UID(uuid.New().String()),
+			OwnerReferences: []metav1.OwnerReference{{UID: "rollout", Kind: "Rollout"}},
+		},
+	}
+	ctrl.handleDeltaUpsert(rs)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             types.UID(uuid.New().String()),
+			Labels:          map[string]string{"app": "rollout"},
+			OwnerReferences: []metav1.OwnerReference{{UID: rs.UID, Kind: "ReplicaSet"}},
+		},
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctrl.replicaSetOwners.reset()
+			ctrl.GetPodOwnerID(pod)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctrl.GetPodOwnerID(pod)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package kube
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const eventsComponent = "castai-kvisor"
+
+// NewEventRecorder returns recorder which publishes events to kubernetes event stream until ctx is done.
+// Events are dropped if recording is disabled.
+func NewEventRecorder(ctx context.Context, client kubernetes.Interface, enabled bool) record.EventRecorder {
+	if !enabled {
+		return noopEventRecorder{}
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-ctx.Done()
+		broadcaster.Shutdown()
+	}()
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventsComponent})
+}
+
+type noopEventRecorder struct{}
+
+func (noopEventRecorder) Event(runtime.Object, string, string, string) {}
+
+func (noopEventRecorder) Eventf(runtime.Object, string, string, string, ...interface{}) {}
+
+func (noopEventRecorder) AnnotatedEventf(runtime.Object, map[string]string, string, string, string, ...interface{}) {
+}
@@ -0,0 +1,82 @@
+package deprecatedapi
+
+import (
+	json "github.com/json-iterator/go"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/kube"
+)
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+type deprecation struct {
+	// deprecatedInMinor is first kubernetes minor version which deprecates the api version.
+	deprecatedInMinor int
+	// removedInMinor is first kubernetes minor version which no longer serves the api version.
+	removedInMinor int
+}
+
+// deprecations contains deprecated api versions of kinds watched by the analyzer.
+var deprecations = map[schema.GroupVersionKind]deprecation{
+	{Group: "extensions", Version: "v1beta1", Kind: "Deployment"}:                        {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "extensions", Version: "v1beta1", Kind: "DaemonSet"}:                         {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "extensions", Version: "v1beta1", Kind: "ReplicaSet"}:                        {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "extensions", Version: "v1beta1", Kind: "NetworkPolicy"}:                     {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}:                           {deprecatedInMinor: 14, removedInMinor: 22},
+	{Group: "apps", Version: "v1beta1", Kind: "Deployment"}:                              {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "apps", Version: "v1beta1", Kind: "StatefulSet"}:                             {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "apps", Version: "v1beta2", Kind: "Deployment"}:                              {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "apps", Version: "v1beta2", Kind: "DaemonSet"}:                               {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "apps", Version: "v1beta2", Kind: "ReplicaSet"}:                              {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "apps", Version: "v1beta2", Kind: "StatefulSet"}:                             {deprecatedInMinor: 9, removedInMinor: 16},
+	{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}:                    {deprecatedInMinor: 19, removedInMinor: 22},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "ClusterRole"}:        {deprecatedInMinor: 17, removedInMinor: 22},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "ClusterRoleBinding"}: {deprecatedInMinor: 17, removedInMinor: 22},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "Role"}:               {deprecatedInMinor: 17, removedInMinor: 22},
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "RoleBinding"}:        {deprecatedInMinor: 17, removedInMinor: 22},
+	{Group: "batch", Version: "v1beta1", Kind: "CronJob"}:                                {deprecatedInMinor: 21, removedInMinor: 25},
+}
+
+// analyze checks whether object was applied using api version deprecated in given cluster version.
+// Informers always return objects in served api version, so last applied manifest is checked too.
+func analyze(o kube.Object, k8sVersionMinor int) castai.LinterCheck {
+	check := castai.LinterCheck{
+		ResourceID: string(o.GetUID()),
+		Passed:     new(castai.LinterRuleSet),
+		Failed:     new(castai.LinterRuleSet),
+	}
+
+	gvks := []schema.GroupVersionKind{o.GetObjectKind().GroupVersionKind()}
+	if gvk, ok := lastAppliedGroupVersionKind(o); ok {
+		gvks = append(gvks, gvk)
+	}
+	for _, gvk := range gvks {
+		if d, found := deprecations[gvk]; found && k8sVersionMinor >= d.deprecatedInMinor {
+			check.Failed.Add(castai.DeprecatedAPIVersion)
+			return check
+		}
+	}
+	check.Passed.Add(castai.DeprecatedAPIVersion)
+	return check
+}
+
+func lastAppliedGroupVersionKind(o kube.Object) (schema.GroupVersionKind, bool) {
+	lastApplied, found := o.GetAnnotations()[lastAppliedConfigAnnotation]
+	if !found {
+		return schema.GroupVersionKind{}, false
+	}
+
+	var manifest struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+	if err := json.Unmarshal([]byte(lastApplied), &manifest); err != nil || manifest.APIVersion == "" {
+		return schema.GroupVersionKind{}, false
+	}
+	gv, err := schema.ParseGroupVersion(manifest.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, false
+	}
+	return gv.WithKind(manifest.Kind), true
+}
@@ -0,0 +1,89 @@
+package deprecatedapi
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/kube"
+	"github.com/castai/kvisor/linters"
+)
+
+type castaiClient interface {
+	SendLinterChecks(ctx context.Context, checks []castai.LinterCheck) error
+}
+
+func NewController(log logrus.FieldLogger, cfg config.DeprecatedAPI, client castaiClient, k8sVersionMinor int) *Controller {
+	log = log.WithField("component", "deprecated_api_analyzer")
+	return &Controller{
+		log:             log,
+		cfg:             cfg,
+		k8sVersionMinor: k8sVersionMinor,
+		reporter:        linters.NewChecksReporter(log, "deprecated api analyzer", client, cfg.ScanInterval),
+	}
+}
+
+// Controller reports objects using api versions deprecated in the cluster version as linter checks.
+type Controller struct {
+	log             logrus.FieldLogger
+	cfg             config.DeprecatedAPI
+	k8sVersionMinor int
+
+	reporter *linters.ChecksReporter
+}
+
+func (c *Controller) RequiredInformers() []reflect.Type {
+	informers := []reflect.Type{
+		reflect.TypeOf(&appsv1.Deployment{}),
+		reflect.TypeOf(&appsv1.DaemonSet{}),
+		reflect.TypeOf(&appsv1.StatefulSet{}),
+		reflect.TypeOf(&appsv1.ReplicaSet{}),
+		reflect.TypeOf(&networkingv1.NetworkPolicy{}),
+		reflect.TypeOf(&networkingv1.Ingress{}),
+		reflect.TypeOf(&rbacv1.ClusterRoleBinding{}),
+		reflect.TypeOf(&rbacv1.RoleBinding{}),
+		reflect.TypeOf(&rbacv1.ClusterRole{}),
+		reflect.TypeOf(&rbacv1.Role{}),
+	}
+	if c.k8sVersionMinor >= 21 {
+		informers = append(informers, reflect.TypeOf(&batchv1.CronJob{}))
+	} else {
+		informers = append(informers, reflect.TypeOf(&batchv1beta1.CronJob{}))
+	}
+	return informers
+}
+
+func (c *Controller) Run(ctx context.Context) error {
+	return c.reporter.Run(ctx)
+}
+
+func (c *Controller) OnAdd(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnUpdate(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnDelete(obj kube.Object) {
+	c.reporter.Delete(obj.GetUID())
+}
+
+func (c *Controller) upsert(obj kube.Object) {
+	// Replica sets managed by deployments are applied through their owners.
+	if rs, ok := obj.(*appsv1.ReplicaSet); ok && len(rs.OwnerReferences) > 0 {
+		return
+	}
+
+	check := analyze(obj, c.k8sVersionMinor)
+
+	c.reporter.Set(obj.GetUID(), check)
+}
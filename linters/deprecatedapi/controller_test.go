@@ -0,0 +1,90 @@
+package deprecatedapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
+)
+
+func TestController(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	newIngress := func(lastApplied string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Ingress",
+				APIVersion: "networking.k8s.io/v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "ingress",
+				UID:  "ingress",
+				Annotations: map[string]string{
+					lastAppliedConfigAnnotation: lastApplied,
+				},
+			},
+		}
+	}
+
+	t.Run("flag deprecated api version usage", func(t *testing.T) {
+		r := require.New(t)
+		mockctrl := gomock.NewController(t)
+		castaiClient := mock_castai.NewMockClient(mockctrl)
+		ctrl := NewController(log, config.DeprecatedAPI{}, castaiClient, 20)
+
+		ctrl.OnAdd(newIngress(`{"apiVersion":"networking.k8s.io/v1beta1","kind":"Ingress"}`))
+
+		var sent []castai.LinterCheck
+		castaiClient.EXPECT().SendLinterChecks(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, checks []castai.LinterCheck) error {
+			sent = checks
+			return nil
+		})
+		r.NoError(ctrl.reporter.Send(context.Background(), ctrl.reporter.Flush()))
+
+		r.Len(sent, 1)
+		r.Equal("ingress", sent[0].ResourceID)
+		r.Equal([]string{"deprecated-api-version"}, sent[0].Failed.Rules())
+		r.Empty(sent[0].Passed.Rules())
+	})
+
+	t.Run("pass api version not yet deprecated in cluster version", func(t *testing.T) {
+		r := require.New(t)
+
+		check := analyze(newIngress(`{"apiVersion":"networking.k8s.io/v1beta1","kind":"Ingress"}`), 18)
+		r.Equal([]string{"deprecated-api-version"}, check.Passed.Rules())
+		r.Empty(check.Failed.Rules())
+	})
+
+	t.Run("pass served api version", func(t *testing.T) {
+		r := require.New(t)
+
+		check := analyze(newIngress(`{"apiVersion":"networking.k8s.io/v1","kind":"Ingress"}`), 27)
+		r.Empty(check.Failed.Rules())
+
+		check = analyze(newIngress(`not json`), 27)
+		r.Empty(check.Failed.Rules())
+	})
+
+	t.Run("skip replica sets managed by deployments", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := NewController(log, config.DeprecatedAPI{}, nil, 27)
+
+		ctrl.OnAdd(&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				UID:             "rs",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment"}},
+			},
+		})
+		r.Empty(ctrl.reporter.Flush())
+	})
+}
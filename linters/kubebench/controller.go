@@ -18,24 +18,30 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/joblimiter"
 	"github.com/castai/kvisor/kube"
 	"github.com/castai/kvisor/linters/kubebench/spec"
 	"github.com/castai/kvisor/log"
 	"github.com/castai/kvisor/metrics"
+	"github.com/castai/kvisor/version"
 )
 
 const (
-	nodeScanTimeout   = 5 * time.Minute
-	labelJobName      = "job-name"
-	maxConcurrentJobs = 1
+	nodeScanTimeout = 5 * time.Minute
+	labelJobName    = "job-name"
+	// minK8sVersionMinor is the oldest kubernetes minor version supported by kube-bench benchmarks. It's the oldest
+	// version in version_mapping of kube-bench cfg/config.yaml, see https://github.com/aquasecurity/kube-bench/blob/main/cfg/config.yaml.
+	minK8sVersionMinor = 15
 )
 
 type kubeController interface {
@@ -53,6 +59,9 @@ func NewController(
 	logsReader log.PodLogProvider,
 	kubeController kubeController,
 	scannedNodes []string,
+	eventRecorder record.EventRecorder,
+	jobLimiter *joblimiter.Limiter,
+	k8sVersionMinor int,
 ) *Controller {
 	nodeCache, _ := lru.New(1000)
 	for _, node := range scannedNodes {
@@ -69,10 +78,14 @@ func NewController(
 		castClient:                    castClient,
 		logsProvider:                  logsReader,
 		kubeController:                kubeController,
+		eventRecorder:                 eventRecorder,
 		scanInterval:                  scanInterval,
 		scannedNodes:                  nodeCache,
 		finishedJobDeleteWaitDuration: 10 * time.Second,
 		kubeBenchReportsCache:         map[uint64]*castai.KubeBenchReport{},
+		jobLimiter:                    jobLimiter,
+		k8sVersionMinor:               k8sVersionMinor,
+		reportSem:                     semaphore.NewWeighted(int64(max(cfg.MaxConcurrentReports, 1))),
 	}
 }
 
@@ -86,6 +99,7 @@ type Controller struct {
 	provider                      string
 	logsProvider                  log.PodLogProvider
 	kubeController                kubeController
+	eventRecorder                 record.EventRecorder
 	scanInterval                  time.Duration
 	finishedJobDeleteWaitDuration time.Duration
 	scannedNodes                  *lru.Cache
@@ -93,6 +107,13 @@ type Controller struct {
 	// This allows to reduce number of jobs since we near identical reports.
 	kubeBenchReportsCache   map[uint64]*castai.KubeBenchReport
 	kubeBenchReportsCacheMu sync.Mutex
+	notApplicableLogged     bool
+	// k8sVersionMinor is detected cluster kubernetes minor version, zero if unknown.
+	k8sVersionMinor int
+	// jobLimiter is budget of jobs shared with other job types.
+	jobLimiter *joblimiter.Limiter
+	// reportSem bounds reports which are parsed and uploaded in parallel.
+	reportSem *semaphore.Weighted
 }
 
 func (s *Controller) OnAdd(obj kube.Object) {
@@ -134,6 +155,10 @@ func (s *Controller) Run(ctx context.Context) error {
 }
 
 func (s *Controller) process(ctx context.Context) (rerr error) {
+	if !s.isK8sVersionSupported() {
+		return nil
+	}
+
 	nodes := s.findNodesForScan()
 	if len(nodes) == 0 {
 		return nil
@@ -152,9 +177,11 @@ func (s *Controller) process(ctx context.Context) (rerr error) {
 			err := s.lintNode(ctx, job.node)
 			if err != nil {
 				s.log.WithField("node", job.node.Name).Errorf("kube-bench: %v", err)
+				s.eventRecorder.Eventf(job.node, corev1.EventTypeWarning, "KubeBenchFailed", "kube-bench failed: %v", err)
 				job.setFailed()
 				return
 			}
+			s.eventRecorder.Event(job.node, corev1.EventTypeNormal, "KubeBenchCompleted", "kube-bench report sent")
 			s.delta.delete(job.node)
 		}()
 	}
@@ -163,20 +190,46 @@ func (s *Controller) process(ctx context.Context) (rerr error) {
 	return nil
 }
 
+func (s *Controller) isK8sVersionSupported() bool {
+	if version.AtLeastMinor(s.k8sVersionMinor, minK8sVersionMinor) {
+		return true
+	}
+	if !s.notApplicableLogged {
+		s.log.Infof("skipping kube-bench, not applicable for kubernetes 1.%d, minimal supported version is 1.%d", s.k8sVersionMinor, minK8sVersionMinor)
+		s.notApplicableLogged = true
+	}
+	return false
+}
+
+// findNodesForScan returns nodes which need kube-bench job up to max concurrent jobs and all nodes which reuse
+// report of similar node. Reports are independent per node so they can be parsed and uploaded in any order.
 func (s *Controller) findNodesForScan() []*nodeJob {
 	nodes := s.delta.peek()
 	var res []*nodeJob
+	var jobs int
 	for _, nodeJob := range nodes {
-		if nodeJob.ready() && len(nodeJob.node.Spec.Taints) == 0 {
-			res = append(res, nodeJob)
-			if len(res) == maxConcurrentJobs {
-				break
+		if !nodeJob.ready() || len(nodeJob.node.Spec.Taints) > 0 {
+			continue
+		}
+		if _, found := s.findScannedReport(nodeJob.node); !found {
+			if jobs == s.maxConcurrentJobs() {
+				continue
 			}
+			jobs++
 		}
+		res = append(res, nodeJob)
 	}
 	return res
 }
 
+// maxConcurrentJobs returns number of kube-bench jobs created at once.
+func (s *Controller) maxConcurrentJobs() int {
+	if s.cfg.MaxConcurrentJobs < 1 {
+		return 1
+	}
+	return s.cfg.MaxConcurrentJobs
+}
+
 func (s *Controller) RequiredInformers() []reflect.Type {
 	return []reflect.Type{reflect.TypeOf(&corev1.Node{})}
 }
@@ -198,8 +251,7 @@ func (s *Controller) lintNode(ctx context.Context, node *corev1.Node) (rerr erro
 				ResourceID: uuid.MustParse(string(node.UID)),
 			},
 		}
-		err := s.castClient.SendCISReport(ctx, report)
-		if err != nil {
+		if err := s.sendReport(ctx, report); err != nil {
 			return err
 		}
 
@@ -227,17 +279,16 @@ func (s *Controller) lintNode(ctx context.Context, node *corev1.Node) (rerr erro
 		}
 	}
 
+	if err := s.jobLimiter.Acquire(ctx); err != nil {
+		return fmt.Errorf("waiting for job budget: %w", err)
+	}
+	defer s.jobLimiter.Release()
+
 	kubeBenchPod, err := s.createKubebenchJob(ctx, node, jobName)
 	if err != nil {
 		return err
 	}
-	report, err := s.getReportFromLogs(ctx, node, kubeBenchPod.Name)
-	if err != nil {
-		return fmt.Errorf("reading kube-bench report from pod logs: %w", err)
-	}
-	s.addReportToCache(node, report)
-	err = s.castClient.SendCISReport(ctx, report)
-	if err != nil {
+	if err := s.processJobReport(ctx, node, kubeBenchPod.Name); err != nil {
 		return err
 	}
 
@@ -265,6 +316,30 @@ func (s *Controller) lintNode(ctx context.Context, node *corev1.Node) (rerr erro
 	return nil
 }
 
+// processJobReport parses report from finished job pod logs and uploads it within report processing limit.
+func (s *Controller) processJobReport(ctx context.Context, node *corev1.Node, kubeBenchPodName string) error {
+	if err := s.reportSem.Acquire(ctx, 1); err != nil {
+		return fmt.Errorf("waiting for report processing: %w", err)
+	}
+	defer s.reportSem.Release(1)
+
+	report, err := s.getReportFromLogs(ctx, node, kubeBenchPodName)
+	if err != nil {
+		return fmt.Errorf("reading kube-bench report from pod logs: %w", err)
+	}
+	s.addReportToCache(node, report)
+	return s.castClient.SendCISReport(ctx, report)
+}
+
+// sendReport uploads report within report processing limit.
+func (s *Controller) sendReport(ctx context.Context, report *castai.KubeBenchReport) error {
+	if err := s.reportSem.Acquire(ctx, 1); err != nil {
+		return fmt.Errorf("waiting for report processing: %w", err)
+	}
+	defer s.reportSem.Release(1)
+	return s.castClient.SendCISReport(ctx, report)
+}
+
 func (s *Controller) findScannedReport(n *corev1.Node) (*castai.KubeBenchReport, bool) {
 	s.kubeBenchReportsCacheMu.Lock()
 	defer s.kubeBenchReportsCacheMu.Unlock()
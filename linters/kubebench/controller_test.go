@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 
 	mock_castai "github.com/castai/kvisor/castai/mock"
 )
@@ -53,6 +55,9 @@ func TestSubscriber(t *testing.T) {
 			logProvider,
 			kubeCtrl,
 			nil,
+			&record.FakeRecorder{},
+			nil,
+			28,
 		)
 		ctrl.finishedJobDeleteWaitDuration = 0
 
@@ -132,6 +137,9 @@ func TestSubscriber(t *testing.T) {
 			logProvider,
 			kubeCtrl,
 			nil,
+			&record.FakeRecorder{},
+			nil,
+			0,
 		)
 		nodeID := types.UID(uuid.NewString())
 		ctrl.scannedNodes.Add(string(nodeID), struct{}{})
@@ -190,6 +198,9 @@ func TestSubscriber(t *testing.T) {
 			logProvider,
 			kubeCtrl,
 			nil,
+			&record.FakeRecorder{},
+			nil,
+			0,
 		)
 		nodeID := types.UID(uuid.NewString())
 		node := &corev1.Node{
@@ -225,6 +236,192 @@ func TestSubscriber(t *testing.T) {
 		r.ErrorIs(err, context.DeadlineExceeded)
 		r.NotContainsf(logOutput.String(), "error", "logs containers error")
 	})
+
+	t.Run("skip kube-bench on not supported cluster version", func(t *testing.T) {
+		mockctrl := gomock.NewController(t)
+		r := require.New(t)
+		ctx := context.Background()
+		clientset := fake.NewSimpleClientset()
+		mockCast := mock_castai.NewMockClient(mockctrl)
+
+		log := logrus.New()
+		log.SetLevel(logrus.DebugLevel)
+		logProvider := newMockLogProvider(readReport())
+		kubeCtrl := &mockKubeController{}
+
+		castaiNamespace := "castai-sec"
+		ctrl := NewController(
+			log,
+			clientset,
+			config.KubeBench{},
+			castaiNamespace,
+			"gke",
+			5*time.Millisecond,
+			mockCast,
+			logProvider,
+			kubeCtrl,
+			nil,
+			&record.FakeRecorder{},
+			nil,
+			12,
+		)
+		node := &corev1.Node{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Node",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test_node",
+				UID:  types.UID(uuid.NewString()),
+			},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{
+					{
+						Type:   corev1.NodeReady,
+						Status: corev1.ConditionTrue,
+					},
+				},
+			},
+		}
+		ctrl.OnAdd(node)
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		err := ctrl.Run(ctx)
+		r.ErrorIs(err, context.DeadlineExceeded)
+		jobs, err := clientset.BatchV1().Jobs(castaiNamespace).List(context.Background(), metav1.ListOptions{})
+		r.NoError(err)
+		r.Empty(jobs.Items)
+	})
+
+	t.Run("upload reports of multiple nodes concurrently", func(t *testing.T) {
+		mockctrl := gomock.NewController(t)
+		r := require.New(t)
+		ctx := context.Background()
+		clientset := fake.NewSimpleClientset()
+		mockCast := mock_castai.NewMockClient(mockctrl)
+
+		log := logrus.New()
+		log.SetLevel(logrus.DebugLevel)
+		logProvider := newMockLogProvider(readReport())
+		kubeCtrl := &mockKubeController{}
+
+		castaiNamespace := "castai-sec"
+		ctrl := NewController(
+			log,
+			clientset,
+			config.KubeBench{MaxConcurrentJobs: 1, MaxConcurrentReports: 3},
+			castaiNamespace,
+			"gke",
+			5*time.Millisecond,
+			mockCast,
+			logProvider,
+			kubeCtrl,
+			nil,
+			&record.FakeRecorder{},
+			nil,
+			0,
+		)
+		ctrl.finishedJobDeleteWaitDuration = 0
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		var nodes []*corev1.Node
+		for _, name := range []string{"node1", "node2", "node3"} {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+					UID:  types.UID(uuid.NewString()),
+				},
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:   corev1.NodeReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+				},
+			}
+			nodes = append(nodes, node)
+			ctrl.OnAdd(node)
+		}
+		// Nodes are similar, so report of already benchmarked node is reused without jobs.
+		ctrl.addReportToCache(nodes[0], &castai.KubeBenchReport{})
+
+		// Each report is sent only after all nodes reached upload, so serial processing would time out.
+		var sending sync.WaitGroup
+		sending.Add(len(nodes))
+		allSending := make(chan struct{})
+		go func() {
+			sending.Wait()
+			close(allSending)
+		}()
+		mockCast.EXPECT().SendCISReport(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, report *castai.KubeBenchReport) error {
+			sending.Done()
+			select {
+			case <-allSending:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}).Times(len(nodes))
+
+		r.NoError(ctrl.process(ctx))
+		for _, node := range nodes {
+			_, scanned := ctrl.scannedNodes.Get(string(node.UID))
+			r.True(scanned, node.Name)
+		}
+		r.Empty(ctrl.delta.peek())
+		jobs, err := clientset.BatchV1().Jobs(castaiNamespace).List(ctx, metav1.ListOptions{})
+		r.NoError(err)
+		r.Empty(jobs.Items)
+	})
+
+	t.Run("limit nodes benchmarked with jobs at once", func(t *testing.T) {
+		r := require.New(t)
+
+		ctrl := NewController(
+			logrus.New(),
+			fake.NewSimpleClientset(),
+			config.KubeBench{MaxConcurrentJobs: 2},
+			"castai-sec",
+			"gke",
+			5*time.Millisecond,
+			nil,
+			nil,
+			&mockKubeController{},
+			nil,
+			&record.FakeRecorder{},
+			nil,
+			0,
+		)
+		var nodes []*corev1.Node
+		for _, name := range []string{"node1", "node2", "node3", "node4"} {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+					UID:  types.UID(uuid.NewString()),
+				},
+				Status: corev1.NodeStatus{
+					// Different OS images make nodes dissimilar, so reports are not reused.
+					NodeInfo: corev1.NodeSystemInfo{OSImage: name},
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:   corev1.NodeReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+				},
+			}
+			nodes = append(nodes, node)
+			ctrl.OnAdd(node)
+		}
+		r.Len(ctrl.findNodesForScan(), 2)
+
+		ctrl.addReportToCache(nodes[0], &castai.KubeBenchReport{})
+		r.Len(ctrl.findNodesForScan(), 3)
+	})
 }
 
 func TestNodeGroupKey(t *testing.T) {
@@ -26,20 +26,22 @@ import (
 
 func NewController(log logrus.FieldLogger, cfg config.Linter, client castai.Client, linter *Linter) *Controller {
 	return &Controller{
-		log:    log,
-		cfg:    cfg,
-		client: client,
-		linter: linter,
-		delta:  newDeltaState(),
+		log:                log,
+		cfg:                cfg,
+		client:             client,
+		linter:             linter,
+		delta:              newDeltaState(),
+		excludedNamespaces: lo.SliceToMap(cfg.ExcludedNamespaces, func(ns string) (string, struct{}) { return ns, struct{}{} }),
 	}
 }
 
 type Controller struct {
-	log    logrus.FieldLogger
-	cfg    config.Linter
-	client castai.Client
-	linter *Linter
-	delta  *deltaState
+	log                logrus.FieldLogger
+	cfg                config.Linter
+	client             castai.Client
+	linter             *Linter
+	delta              *deltaState
+	excludedNamespaces map[string]struct{}
 }
 
 func (s *Controller) RequiredInformers() []reflect.Type {
@@ -93,6 +95,10 @@ func (s *Controller) OnDelete(obj kube.Object) {
 }
 
 func (s *Controller) modifyDelta(event kube.Event, o kube.Object) {
+	if s.isExcludedNamespace(o) {
+		return
+	}
+
 	switch o := o.(type) {
 	case *corev1.Pod:
 		// Do not process not static pods.
@@ -130,17 +136,39 @@ func (s *Controller) lintObjects(ctx context.Context, objects []kube.Object) (re
 		return fmt.Errorf("kubelinter failed: %w", err)
 	}
 
+	batches, err := castai.SplitLinterChecks(checks, s.cfg.MaxPayloadSize)
+	if err != nil {
+		return fmt.Errorf("splitting kubelinter checks: %w", err)
+	}
+	for _, batch := range batches {
+		if err := s.sendChecks(ctx, batch); err != nil {
+			return err
+		}
+	}
+
+	s.log.Infof("kubelinter finished, checks: %d", len(checks))
+	return nil
+}
+
+func (s *Controller) sendChecks(ctx context.Context, checks []castai.LinterCheck) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
 	if err := s.client.SendLinterChecks(ctx, checks); err != nil {
 		return fmt.Errorf("can not send kubelinter checks: %w", err)
 	}
-
-	s.log.Infof("kubelinter finished, checks: %d", len(checks))
 	return nil
 }
 
+func (s *Controller) isExcludedNamespace(o kube.Object) bool {
+	ns := o.GetNamespace()
+	if _, ok := o.(*corev1.Namespace); ok {
+		ns = o.GetName()
+	}
+	_, found := s.excludedNamespaces[ns]
+	return found
+}
+
 func isStandalonePod(pod *corev1.Pod) bool {
 	if pod.Spec.NodeName == "" {
 		return false
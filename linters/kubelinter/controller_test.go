@@ -8,11 +8,14 @@ import (
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	casttypes "github.com/castai/kvisor/castai"
 	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
 	"github.com/castai/kvisor/kube"
 )
 
@@ -52,4 +55,40 @@ func TestSubscriber(t *testing.T) {
 		ctx := context.Background()
 		r.NoError(ctrl.lintObjects(ctx, objects))
 	})
+
+	t.Run("skips objects in managed namespaces by default", func(t *testing.T) {
+		r := require.New(t)
+
+		ctrl := NewController(log, config.Linter{ExcludedNamespaces: config.DefaultLinterExcludedNamespaces}, nil, nil)
+
+		newDeployment := func(namespace string) *appsv1.Deployment {
+			return &appsv1.Deployment{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Deployment",
+					APIVersion: "apps/v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "app",
+					Namespace: namespace,
+					UID:       types.UID(namespace),
+				},
+			}
+		}
+		ctrl.OnAdd(newDeployment("kube-system"))
+		ctrl.OnAdd(newDeployment("default"))
+		ctrl.OnAdd(&corev1.Namespace{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Namespace",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kube-system",
+				UID:  "kube-system-ns",
+			},
+		})
+
+		objects := ctrl.delta.flush()
+		r.Len(objects, 1)
+		r.Equal("default", objects[0].GetNamespace())
+	})
 }
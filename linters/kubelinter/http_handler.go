@@ -0,0 +1,28 @@
+package kubelinter
+
+import (
+	"net/http"
+
+	json "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+func NewHTTPHandler(log logrus.FieldLogger, linter *Linter) *HTTPHandler {
+	return &HTTPHandler{
+		log:    log.WithField("component", "linter_http_handler"),
+		linter: linter,
+	}
+}
+
+type HTTPHandler struct {
+	log    logrus.FieldLogger
+	linter *Linter
+}
+
+// HandleDebugGetRules returns names of active linter rules as JSON.
+func (h *HTTPHandler) HandleDebugGetRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.linter.Rules()); err != nil {
+		h.log.Errorf("debug get linter rules: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package kubelinter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	t.Run("list active rules", func(t *testing.T) {
+		r := require.New(t)
+
+		linter, err := New([]string{"privileged-container", "host-network", "latest-tag"})
+		r.NoError(err)
+		handler := NewHTTPHandler(logrus.New(), linter)
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/linter-rules", nil)
+		rec := httptest.NewRecorder()
+		handler.HandleDebugGetRules(rec, req)
+		r.Equal(http.StatusOK, rec.Code)
+
+		var res []string
+		r.NoError(json.Unmarshal(rec.Body.Bytes(), &res))
+		r.Equal([]string{"host-network", "latest-tag", "privileged-container"}, res)
+	})
+}
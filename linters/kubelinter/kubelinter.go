@@ -2,6 +2,7 @@ package kubelinter
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/samber/lo"
 	"golang.stackrox.io/kube-linter/pkg/builtinchecks"
@@ -142,6 +143,13 @@ type Linter struct {
 	instantiatedChecks []*instantiatedcheck.InstantiatedCheck
 }
 
+// Rules returns sorted names of rules checked by linter.
+func (l *Linter) Rules() []string {
+	rules := lo.Keys(l.rules)
+	sort.Strings(rules)
+	return rules
+}
+
 func (l *Linter) RunWithRules(objects []lintcontext.Object, rules []string) ([]casttypes.LinterCheck, error) {
 	return l.run(objects, lo.SliceToMap(rules, func(item string) (string, struct{}) {
 		return item, struct{}{}
@@ -163,20 +171,37 @@ func (l *Linter) run(objects []lintcontext.Object, rules map[string]struct{}) ([
 	for _, check := range res.Reports {
 		obj := check.Object.K8sObject
 
-		if _, ok := resources[obj.GetUID()]; !ok {
-			resources[obj.GetUID()] = casttypes.LinterCheck{
+		res, ok := resources[obj.GetUID()]
+		if !ok {
+			gvk := obj.GetObjectKind().GroupVersionKind()
+			res = casttypes.LinterCheck{
 				ResourceID: string(obj.GetUID()),
-				Failed:     new(casttypes.LinterRuleSet),
-				Passed:     new(casttypes.LinterRuleSet),
+				Resource: &casttypes.Resource{
+					ObjectMeta: casttypes.ObjectMeta{
+						Namespace: obj.GetNamespace(),
+						Name:      obj.GetName(),
+					},
+					ObjectType: casttypes.ObjectType{
+						APIVersion: gvk.GroupVersion().String(),
+						Kind:       gvk.Kind,
+					},
+				},
+				Failed: new(casttypes.LinterRuleSet),
+				Passed: new(casttypes.LinterRuleSet),
 			}
 		}
 
 		if check.Diagnostic.Message != "" {
-			resources[obj.GetUID()].Failed.Add(casttypes.LinterRuleMap[check.Check])
+			res.Failed.Add(casttypes.LinterRuleMap[check.Check])
+			res.Findings = append(res.Findings, casttypes.LinterFinding{
+				Rule:     check.Check,
+				Severity: casttypes.LinterRuleSeverity(check.Check),
+				Message:  check.Diagnostic.Message,
+			})
 		} else {
-			resources[obj.GetUID()].Passed.Add(casttypes.LinterRuleMap[check.Check])
+			res.Passed.Add(casttypes.LinterRuleMap[check.Check])
 		}
-
+		resources[obj.GetUID()] = res
 	}
 
 	return lo.Values(resources), nil
@@ -6,6 +6,7 @@ import (
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/require"
 	"golang.stackrox.io/kube-linter/pkg/lintcontext"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -93,4 +94,55 @@ func TestLinter(t *testing.T) {
 		r.NoError(err)
 		r.Contains(checks[0].Failed.Rules(), "additional-capabilities")
 	})
+
+	t.Run("checks for missing probes with workload context", func(t *testing.T) {
+		r := require.New(t)
+
+		linter, err := New(lo.Keys(casttypes.LinterRuleMap))
+		r.NoError(err)
+
+		checks, err := linter.Run([]lintcontext.Object{{
+			K8sObject: &appsv1.Deployment{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Deployment",
+					APIVersion: "apps/v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "app",
+					Namespace: "team-a",
+					UID:       "app-uid",
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "test",
+									Image: "test-image",
+								},
+							},
+						},
+					},
+				},
+			},
+		}})
+		r.NoError(err)
+		r.Len(checks, 1)
+		check := checks[0]
+		r.Equal("app-uid", check.ResourceID)
+		r.Equal(&casttypes.Resource{
+			ObjectMeta: casttypes.ObjectMeta{Namespace: "team-a", Name: "app"},
+			ObjectType: casttypes.ObjectType{APIVersion: "apps/v1", Kind: "Deployment"},
+		}, check.Resource)
+		r.Contains(check.Failed.Rules(), "no-liveness-probe")
+		r.Contains(check.Failed.Rules(), "no-readiness-probe")
+
+		findings := lo.SliceToMap(check.Findings, func(f casttypes.LinterFinding) (string, casttypes.LinterFinding) {
+			return f.Rule, f
+		})
+		r.Equal(casttypes.LinterSeverityMedium, findings["no-liveness-probe"].Severity)
+		r.Contains(findings["no-liveness-probe"].Message, "liveness probe")
+		r.Equal(casttypes.LinterSeverityLow, findings["no-readiness-probe"].Severity)
+		r.Contains(findings["no-readiness-probe"].Message, "readiness probe")
+	})
 }
@@ -0,0 +1,110 @@
+package networkpolicy
+
+import (
+	"github.com/samber/lo"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+
+	"github.com/castai/kvisor/castai"
+)
+
+func newCheck(uid string) castai.LinterCheck {
+	return castai.LinterCheck{
+		ResourceID: uid,
+		Passed:     new(castai.LinterRuleSet),
+		Failed:     new(castai.LinterRuleSet),
+	}
+}
+
+func addRule(check castai.LinterCheck, rule castai.LinterRule, failed bool) {
+	if failed {
+		check.Failed.Add(rule)
+	} else {
+		check.Passed.Add(rule)
+	}
+}
+
+// analyzeNamespace flags namespace running pods without any network policy, so all traffic to them is allowed.
+// False is returned until namespace object is known.
+func analyzeNamespace(state *namespaceState) (castai.LinterCheck, bool) {
+	if state.ns == nil {
+		return castai.LinterCheck{}, false
+	}
+	check := newCheck(string(state.ns.UID))
+	addRule(check, castai.NamespaceNoNetworkPolicy, len(state.pods) > 0 && len(state.policies) == 0)
+	return check, true
+}
+
+// analyzePolicy checks network policy against other policies in the same namespace. Policy is duplicate if other
+// policy has the same spec. Policy conflicts if it denies all traffic in a direction while other policy selecting
+// the same pods allows all traffic in that direction, since allow rules of network policies are additive.
+func analyzePolicy(policy *networkingv1.NetworkPolicy, state *namespaceState) castai.LinterCheck {
+	var duplicate, conflict bool
+	for uid, other := range state.policies {
+		if uid == policy.UID {
+			continue
+		}
+		if apiequality.Semantic.DeepEqual(policy.Spec, other.Spec) {
+			duplicate = true
+			continue
+		}
+		if !overlaps(policy, other) {
+			continue
+		}
+		for _, policyType := range []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress} {
+			if deniesAll(policy, policyType) && allowsAll(other, policyType) {
+				conflict = true
+			}
+		}
+	}
+
+	check := newCheck(string(policy.UID))
+	addRule(check, castai.NetworkPolicyDuplicate, duplicate)
+	addRule(check, castai.NetworkPolicyConflict, conflict)
+	return check
+}
+
+// overlaps returns true if other policy selects all pods of the policy.
+func overlaps(policy, other *networkingv1.NetworkPolicy) bool {
+	if len(other.Spec.PodSelector.MatchLabels) == 0 && len(other.Spec.PodSelector.MatchExpressions) == 0 {
+		return true
+	}
+	return apiequality.Semantic.DeepEqual(policy.Spec.PodSelector, other.Spec.PodSelector)
+}
+
+// policyTypes returns policy types in effect. If types are not set, ingress is always in effect and egress only
+// if policy has egress rules.
+func policyTypes(policy *networkingv1.NetworkPolicy) []networkingv1.PolicyType {
+	if len(policy.Spec.PolicyTypes) > 0 {
+		return policy.Spec.PolicyTypes
+	}
+	types := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if len(policy.Spec.Egress) > 0 {
+		types = append(types, networkingv1.PolicyTypeEgress)
+	}
+	return types
+}
+
+func deniesAll(policy *networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if !lo.Contains(policyTypes(policy), policyType) {
+		return false
+	}
+	if policyType == networkingv1.PolicyTypeIngress {
+		return len(policy.Spec.Ingress) == 0
+	}
+	return len(policy.Spec.Egress) == 0
+}
+
+func allowsAll(policy *networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if !lo.Contains(policyTypes(policy), policyType) {
+		return false
+	}
+	if policyType == networkingv1.PolicyTypeIngress {
+		return lo.ContainsBy(policy.Spec.Ingress, func(rule networkingv1.NetworkPolicyIngressRule) bool {
+			return len(rule.From) == 0 && len(rule.Ports) == 0
+		})
+	}
+	return lo.ContainsBy(policy.Spec.Egress, func(rule networkingv1.NetworkPolicyEgressRule) bool {
+		return len(rule.To) == 0 && len(rule.Ports) == 0
+	})
+}
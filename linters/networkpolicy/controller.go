@@ -0,0 +1,120 @@
+package networkpolicy
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/kube"
+	"github.com/castai/kvisor/linters"
+)
+
+type castaiClient interface {
+	SendLinterChecks(ctx context.Context, checks []castai.LinterCheck) error
+}
+
+func NewController(log logrus.FieldLogger, cfg config.NetworkPolicy, client castaiClient) *Controller {
+	log = log.WithField("component", "network_policy_analyzer")
+	return &Controller{
+		log:      log,
+		cfg:      cfg,
+		reporter: linters.NewChecksReporter(log, "network policy analyzer", client, cfg.ScanInterval),
+		index:    newIndex(),
+	}
+}
+
+// Controller analyzes namespaces without network policies and duplicate or conflicting network policies and
+// sends findings as linter checks.
+type Controller struct {
+	log      logrus.FieldLogger
+	cfg      config.NetworkPolicy
+	reporter *linters.ChecksReporter
+
+	mu    sync.Mutex
+	index *index
+}
+
+func (c *Controller) RequiredInformers() []reflect.Type {
+	return []reflect.Type{
+		reflect.TypeOf(&corev1.Namespace{}),
+		reflect.TypeOf(&corev1.Pod{}),
+		reflect.TypeOf(&networkingv1.NetworkPolicy{}),
+	}
+}
+
+func (c *Controller) Run(ctx context.Context) error {
+	return c.reporter.Run(ctx)
+}
+
+func (c *Controller) OnAdd(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnUpdate(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnDelete(obj kube.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch v := obj.(type) {
+	case *corev1.Namespace:
+		c.reporter.Delete(v.UID)
+		delete(c.index.namespaces, v.Name)
+	case *corev1.Pod:
+		if c.index.deletePod(v) {
+			c.analyzeNamespace(v.Namespace)
+		}
+	case *networkingv1.NetworkPolicy:
+		c.reporter.Delete(v.UID)
+		state, found := c.index.namespaces[v.Namespace]
+		if !found {
+			return
+		}
+		delete(state.policies, v.UID)
+		c.analyzeNamespace(v.Namespace)
+		c.analyzePolicies(v.Namespace)
+	}
+}
+
+func (c *Controller) upsert(obj kube.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch v := obj.(type) {
+	case *corev1.Namespace:
+		c.index.namespace(v.Name).ns = v
+		c.analyzeNamespace(v.Name)
+	case *corev1.Pod:
+		// Namespace is analyzed again only once it starts or stops running pods.
+		if c.index.upsertPod(v) {
+			c.analyzeNamespace(v.Namespace)
+		}
+	case *networkingv1.NetworkPolicy:
+		c.index.namespace(v.Namespace).policies[v.UID] = v
+		c.analyzeNamespace(v.Namespace)
+		// Other policies in namespace may become duplicate or conflicting.
+		c.analyzePolicies(v.Namespace)
+	}
+}
+
+func (c *Controller) analyzeNamespace(name string) {
+	if check, ok := analyzeNamespace(c.index.namespace(name)); ok {
+		c.reporter.Set(types.UID(check.ResourceID), check)
+	}
+}
+
+func (c *Controller) analyzePolicies(namespace string) {
+	state := c.index.namespace(namespace)
+	for uid, policy := range state.policies {
+		c.reporter.Set(uid, analyzePolicy(policy, state))
+	}
+}
@@ -0,0 +1,132 @@
+package networkpolicy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
+)
+
+func TestController(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", UID: "ns"}}
+	newPod := func(uid string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "default", UID: types.UID(uid)},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	newPolicy := func(uid string, spec networkingv1.NetworkPolicySpec) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: uid, Namespace: "default", UID: types.UID(uid)},
+			Spec:       spec,
+		}
+	}
+	findCheck := func(checks []castai.LinterCheck, uid string) castai.LinterCheck {
+		check, found := lo.Find(checks, func(check castai.LinterCheck) bool { return check.ResourceID == uid })
+		require.True(t, found, uid)
+		return check
+	}
+
+	t.Run("flag namespace with pods but no network policy", func(t *testing.T) {
+		r := require.New(t)
+		mockctrl := gomock.NewController(t)
+		castaiClient := mock_castai.NewMockClient(mockctrl)
+		ctrl := NewController(log, config.NetworkPolicy{}, castaiClient)
+
+		ctrl.OnAdd(namespace)
+		ctrl.OnAdd(newPod("app"))
+
+		var sent []castai.LinterCheck
+		castaiClient.EXPECT().SendLinterChecks(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, checks []castai.LinterCheck) error {
+			sent = checks
+			return nil
+		})
+		r.NoError(ctrl.reporter.Send(context.Background(), ctrl.reporter.Flush()))
+
+		r.Len(sent, 1)
+		r.Equal("ns", sent[0].ResourceID)
+		r.Equal([]string{"namespace-no-network-policy"}, sent[0].Failed.Rules())
+
+		// Namespace passes once network policy is added.
+		ctrl.OnAdd(newPolicy("deny-all", networkingv1.NetworkPolicySpec{}))
+		checks := ctrl.reporter.Flush()
+		r.Len(checks, 2)
+		r.True(findCheck(checks, "ns").Passed.Has(castai.NamespaceNoNetworkPolicy))
+
+		// Namespace is not analyzed again for every new pod.
+		ctrl.OnAdd(newPod("app2"))
+		r.Empty(ctrl.reporter.Flush())
+	})
+
+	t.Run("pass namespace without pods", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := NewController(log, config.NetworkPolicy{}, nil)
+
+		ctrl.OnAdd(newPod("app"))
+		r.Empty(ctrl.reporter.Flush())
+		ctrl.OnAdd(namespace)
+		r.True(ctrl.reporter.Flush()[0].Failed.Has(castai.NamespaceNoNetworkPolicy))
+
+		ctrl.OnDelete(newPod("app"))
+		checks := ctrl.reporter.Flush()
+		r.Len(checks, 1)
+		r.True(checks[0].Passed.Has(castai.NamespaceNoNetworkPolicy))
+	})
+
+	t.Run("flag duplicate network policies", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := NewController(log, config.NetworkPolicy{}, nil)
+
+		spec := networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+		}
+		ctrl.OnAdd(newPolicy("a", spec))
+		ctrl.OnAdd(newPolicy("b", spec))
+		checks := ctrl.reporter.Flush()
+		r.Len(checks, 2)
+		r.ElementsMatch([]string{"network-policy-duplicate"}, findCheck(checks, "a").Failed.Rules())
+		r.ElementsMatch([]string{"network-policy-duplicate"}, findCheck(checks, "b").Failed.Rules())
+
+		// Remaining policy is not duplicate anymore.
+		ctrl.OnDelete(newPolicy("b", spec))
+		checks = ctrl.reporter.Flush()
+		r.Len(checks, 1)
+		r.Empty(findCheck(checks, "a").Failed.Rules())
+	})
+
+	t.Run("flag deny all policy overridden by allow all policy", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := NewController(log, config.NetworkPolicy{}, nil)
+
+		ctrl.OnAdd(newPolicy("deny-all", networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		}))
+		ctrl.OnAdd(newPolicy("allow-all-egress", networkingv1.NetworkPolicySpec{
+			Egress: []networkingv1.NetworkPolicyEgressRule{{}},
+		}))
+		ctrl.OnAdd(newPolicy("allow-web-ingress", networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{}},
+		}))
+		checks := ctrl.reporter.Flush()
+		r.Len(checks, 3)
+		r.ElementsMatch([]string{"network-policy-conflict"}, findCheck(checks, "deny-all").Failed.Rules())
+		r.Empty(findCheck(checks, "allow-all-egress").Failed.Rules())
+		r.Empty(findCheck(checks, "allow-web-ingress").Failed.Rules())
+	})
+}
@@ -0,0 +1,63 @@
+package networkpolicy
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newIndex() *index {
+	return &index{
+		namespaces: make(map[string]*namespaceState),
+	}
+}
+
+// index keeps namespaces with their running pods and network policies.
+type index struct {
+	namespaces map[string]*namespaceState
+}
+
+type namespaceState struct {
+	// ns is nil until namespace object is received.
+	ns       *corev1.Namespace
+	pods     map[types.UID]struct{}
+	policies map[types.UID]*networkingv1.NetworkPolicy
+}
+
+func (i *index) namespace(name string) *namespaceState {
+	state, found := i.namespaces[name]
+	if !found {
+		state = &namespaceState{
+			pods:     make(map[types.UID]struct{}),
+			policies: make(map[types.UID]*networkingv1.NetworkPolicy),
+		}
+		i.namespaces[name] = state
+	}
+	return state
+}
+
+// upsertPod stores running pod and returns true if namespace started or stopped having pods.
+func (i *index) upsertPod(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return i.deletePod(pod)
+	}
+	state := i.namespace(pod.Namespace)
+	if _, found := state.pods[pod.UID]; found {
+		return false
+	}
+	state.pods[pod.UID] = struct{}{}
+	return len(state.pods) == 1
+}
+
+// deletePod removes pod and returns true if namespace has no pods anymore.
+func (i *index) deletePod(pod *corev1.Pod) bool {
+	state, found := i.namespaces[pod.Namespace]
+	if !found {
+		return false
+	}
+	if _, found := state.pods[pod.UID]; !found {
+		return false
+	}
+	delete(state.pods, pod.UID)
+	return len(state.pods) == 0
+}
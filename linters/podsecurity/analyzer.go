@@ -0,0 +1,103 @@
+package podsecurity
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/kube"
+)
+
+// analyze evaluates workload pod spec for the highest risk configurations. False is returned for not supported objects.
+func analyze(o kube.Object) (castai.LinterCheck, bool) {
+	spec, ok := podSpec(o)
+	if !ok {
+		return castai.LinterCheck{}, false
+	}
+
+	check := castai.LinterCheck{
+		ResourceID: string(o.GetUID()),
+		Passed:     new(castai.LinterRuleSet),
+		Failed:     new(castai.LinterRuleSet),
+	}
+	add := func(rule castai.LinterRule, failed bool) {
+		if failed {
+			check.Failed.Add(rule)
+		} else {
+			check.Passed.Add(rule)
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	add(castai.PodPrivileged, hasPrivilegedContainer(containers))
+	add(castai.PodHostNamespaces, spec.HostPID || spec.HostNetwork || spec.HostIPC)
+	add(castai.PodHostPathMount, hasHostPathVolume(spec.Volumes))
+	add(castai.PodAddedCapabilities, hasAddedCapabilities(containers))
+	add(castai.PodPlaintextSecretEnv, len(findPlaintextSecrets(containers)) > 0)
+
+	return check, true
+}
+
+func podSpec(o kube.Object) (*corev1.PodSpec, bool) {
+	switch v := o.(type) {
+	case *corev1.Pod:
+		// Pods managed by workloads are analyzed through their owners.
+		if !isStandalonePod(v) {
+			return nil, false
+		}
+		return &v.Spec, true
+	case *appsv1.Deployment:
+		return &v.Spec.Template.Spec, true
+	case *appsv1.DaemonSet:
+		return &v.Spec.Template.Spec, true
+	case *appsv1.StatefulSet:
+		return &v.Spec.Template.Spec, true
+	case *batchv1.Job:
+		// Jobs created by cronjobs are analyzed through cronjob.
+		if len(v.OwnerReferences) > 0 {
+			return nil, false
+		}
+		return &v.Spec.Template.Spec, true
+	case *batchv1.CronJob:
+		return &v.Spec.JobTemplate.Spec.Template.Spec, true
+	}
+	return nil, false
+}
+
+func isStandalonePod(pod *corev1.Pod) bool {
+	if len(pod.OwnerReferences) == 0 {
+		return true
+	}
+	// Static pod.
+	return pod.Spec.NodeName != "" && strings.HasSuffix(pod.Name, pod.Spec.NodeName)
+}
+
+func hasPrivilegedContainer(containers []corev1.Container) bool {
+	for _, c := range containers {
+		if c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+			return true
+		}
+	}
+	return false
+}
+
+func hasHostPathVolume(volumes []corev1.Volume) bool {
+	for _, v := range volumes {
+		if v.HostPath != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAddedCapabilities(containers []corev1.Container) bool {
+	for _, c := range containers {
+		if c.SecurityContext != nil && c.SecurityContext.Capabilities != nil && len(c.SecurityContext.Capabilities.Add) > 0 {
+			return true
+		}
+	}
+	return false
+}
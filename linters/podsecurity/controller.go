@@ -0,0 +1,124 @@
+package podsecurity
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/kube"
+	"github.com/castai/kvisor/linters"
+)
+
+type castaiClient interface {
+	SendLinterChecks(ctx context.Context, checks []castai.LinterCheck) error
+}
+
+type Config struct {
+	ScanInterval time.Duration
+}
+
+func NewController(log logrus.FieldLogger, cfg Config, client castaiClient, k8sVersionMinor int) *Controller {
+	log = log.WithField("component", "pod_security_analyzer")
+	if cfg.ScanInterval == 0 {
+		cfg.ScanInterval = 30 * time.Second
+	}
+	return &Controller{
+		log:             log,
+		cfg:             cfg,
+		k8sVersionMinor: k8sVersionMinor,
+		reporter:        linters.NewChecksReporter(log, "pod security analyzer", client, cfg.ScanInterval),
+		loggedSecrets:   map[types.UID]int64{},
+	}
+}
+
+// Controller analyzes workloads for privileged and host access configurations and sends findings as linter checks.
+type Controller struct {
+	log             logrus.FieldLogger
+	cfg             Config
+	k8sVersionMinor int
+
+	reporter *linters.ChecksReporter
+
+	loggedSecretsMu sync.Mutex
+	// loggedSecrets holds generation of objects for which plaintext secrets were already logged.
+	loggedSecrets map[types.UID]int64
+}
+
+func (c *Controller) RequiredInformers() []reflect.Type {
+	informers := []reflect.Type{
+		reflect.TypeOf(&corev1.Pod{}),
+		reflect.TypeOf(&appsv1.Deployment{}),
+		reflect.TypeOf(&appsv1.DaemonSet{}),
+		reflect.TypeOf(&appsv1.StatefulSet{}),
+		reflect.TypeOf(&batchv1.Job{}),
+	}
+	// Analyzer is always enabled, so batch/v1 cronjobs are watched only on clusters supporting them.
+	if c.k8sVersionMinor >= 21 {
+		informers = append(informers, reflect.TypeOf(&batchv1.CronJob{}))
+	}
+	return informers
+}
+
+func (c *Controller) Run(ctx context.Context) error {
+	return c.reporter.Run(ctx)
+}
+
+func (c *Controller) OnAdd(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnUpdate(obj kube.Object) {
+	// Pod spec is immutable for analyzed fields, skip frequent status updates.
+	if _, ok := obj.(*corev1.Pod); ok {
+		return
+	}
+	c.upsert(obj)
+}
+
+func (c *Controller) OnDelete(obj kube.Object) {
+	c.reporter.Delete(obj.GetUID())
+
+	c.loggedSecretsMu.Lock()
+	delete(c.loggedSecrets, obj.GetUID())
+	c.loggedSecretsMu.Unlock()
+}
+
+func (c *Controller) upsert(obj kube.Object) {
+	check, ok := analyze(obj)
+	if !ok {
+		return
+	}
+	if check.Failed.Has(castai.PodPlaintextSecretEnv) {
+		c.logPlaintextSecrets(obj)
+	}
+
+	c.reporter.Set(obj.GetUID(), check)
+}
+
+// logPlaintextSecrets logs env variables which look like secrets once per object spec generation.
+// Workload status updates don't change generation, so they are not logged again. Values are never logged.
+func (c *Controller) logPlaintextSecrets(obj kube.Object) {
+	c.loggedSecretsMu.Lock()
+	generation, found := c.loggedSecrets[obj.GetUID()]
+	if found && generation == obj.GetGeneration() {
+		c.loggedSecretsMu.Unlock()
+		return
+	}
+	c.loggedSecrets[obj.GetUID()] = obj.GetGeneration()
+	c.loggedSecretsMu.Unlock()
+
+	spec, _ := podSpec(obj)
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, secret := range findPlaintextSecrets(containers) {
+		c.log.Warnf("plaintext secret in env variable, resource=%s/%s, container=%s, env=%s, reason=%s",
+			obj.GetNamespace(), obj.GetName(), secret.container, secret.env, secret.reason)
+	}
+}
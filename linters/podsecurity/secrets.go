@@ -0,0 +1,100 @@
+package podsecurity
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// minSecretLength is min length of value with secret-like name to be reported.
+	minSecretLength = 8
+	// minHighEntropyLength and minEntropy detect random tokens regardless of env variable name.
+	minHighEntropyLength = 32
+	minEntropy           = 4.5
+	// minNamedSecretEntropy filters out placeholders and simple values of env variables with secret-like names.
+	minNamedSecretEntropy = 3.0
+)
+
+// secretNamePattern matches env variable names which usually hold credentials.
+var secretNamePattern = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|api_?key|access_?key|private_?key|credential)`)
+
+// secretValuePatterns match well known credential formats. Patterns are checked in order, so reason is stable.
+var secretValuePatterns = []struct {
+	reason  string
+	pattern *regexp.Regexp
+}{
+	{reason: "aws-access-key", pattern: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{reason: "github-token", pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{reason: "slack-token", pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{reason: "stripe-key", pattern: regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{16,}\b`)},
+	{reason: "private-key", pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// plaintextSecret is env variable with secret-like value. Value itself is never kept, so it can't leak to logs.
+type plaintextSecret struct {
+	container string
+	env       string
+	reason    string
+}
+
+// findPlaintextSecrets returns env variables with literal values which look like credentials.
+// Values referenced from secrets or config maps are not checked.
+func findPlaintextSecrets(containers []corev1.Container) []plaintextSecret {
+	var res []plaintextSecret
+	for _, c := range containers {
+		for _, env := range c.Env {
+			if env.ValueFrom != nil || env.Value == "" {
+				continue
+			}
+			reason, found := secretReason(env.Name, env.Value)
+			if !found {
+				continue
+			}
+			res = append(res, plaintextSecret{
+				container: c.Name,
+				env:       env.Name,
+				reason:    reason,
+			})
+		}
+	}
+	return res
+}
+
+func secretReason(name, value string) (string, bool) {
+	for _, p := range secretValuePatterns {
+		if p.pattern.MatchString(value) {
+			return p.reason, true
+		}
+	}
+	// Values referencing other env variables are expanded by kubelet, eg. $(DB_PASSWORD).
+	if strings.HasPrefix(value, "$(") {
+		return "", false
+	}
+	entropy := shannonEntropy(value)
+	if secretNamePattern.MatchString(name) && len(value) >= minSecretLength && entropy >= minNamedSecretEntropy {
+		return "secret-name", true
+	}
+	if len(value) >= minHighEntropyLength && entropy >= minEntropy {
+		return "high-entropy", true
+	}
+	return "", false
+}
+
+// shannonEntropy returns entropy of value in bits per character.
+func shannonEntropy(value string) float64 {
+	counts := map[rune]int{}
+	var total int
+	for _, r := range value {
+		counts[r]++
+		total++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,93 @@
+package rbac
+
+import (
+	"strings"
+
+	"github.com/samber/lo"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/kube"
+)
+
+const clusterAdminRole = "cluster-admin"
+
+// bootstrapLabel is set on default kubernetes RBAC objects which should not be reported.
+const bootstrapLabel = "kubernetes.io/bootstrapping"
+
+// wideGroups are groups which include all or unauthenticated cluster identities.
+var wideGroups = []string{
+	"system:authenticated",
+	"system:unauthenticated",
+	"system:serviceaccounts",
+}
+
+// analyze evaluates RBAC object and returns check result. False is returned for not supported objects.
+// Bindings are checked against index for referenced roles and service accounts which do not exist.
+func analyze(o kube.Object, idx *index) (castai.LinterCheck, bool) {
+	if _, found := o.GetLabels()[bootstrapLabel]; found {
+		return castai.LinterCheck{}, false
+	}
+
+	check := castai.LinterCheck{
+		ResourceID: string(o.GetUID()),
+		Passed:     new(castai.LinterRuleSet),
+		Failed:     new(castai.LinterRuleSet),
+	}
+	add := func(rule castai.LinterRule, failed bool) {
+		if failed {
+			check.Failed.Add(rule)
+		} else {
+			check.Passed.Add(rule)
+		}
+	}
+
+	switch v := o.(type) {
+	case *rbacv1.ClusterRole:
+		add(castai.RBACWildcardPermissions, hasWildcardRules(v.Rules))
+	case *rbacv1.Role:
+		add(castai.RBACWildcardPermissions, hasWildcardRules(v.Rules))
+	case *rbacv1.ClusterRoleBinding:
+		add(castai.RBACClusterAdminWideSubjects, isClusterAdminRef(v.RoleRef) && hasWideSubjects(v.Subjects))
+		add(castai.RBACOrphanedBinding, idx.isOrphaned(v.Namespace, v.RoleRef, v.Subjects))
+	case *rbacv1.RoleBinding:
+		add(castai.RBACClusterAdminWideSubjects, isClusterAdminRef(v.RoleRef) && hasWideSubjects(v.Subjects))
+		add(castai.RBACOrphanedBinding, idx.isOrphaned(v.Namespace, v.RoleRef, v.Subjects))
+	default:
+		return castai.LinterCheck{}, false
+	}
+
+	return check, true
+}
+
+func hasWildcardRules(rules []rbacv1.PolicyRule) bool {
+	for _, rule := range rules {
+		if lo.Contains(rule.Verbs, rbacv1.VerbAll) || lo.Contains(rule.Resources, rbacv1.ResourceAll) {
+			return true
+		}
+	}
+	return false
+}
+
+func isClusterAdminRef(ref rbacv1.RoleRef) bool {
+	return ref.Kind == "ClusterRole" && ref.Name == clusterAdminRole
+}
+
+// hasWideSubjects returns true if any of subjects is service account or group/user covering many identities.
+func hasWideSubjects(subjects []rbacv1.Subject) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			return true
+		case rbacv1.GroupKind:
+			if lo.Contains(wideGroups, subject.Name) || strings.HasPrefix(subject.Name, "system:serviceaccounts:") {
+				return true
+			}
+		case rbacv1.UserKind:
+			if subject.Name == "system:anonymous" {
+				return true
+			}
+		}
+	}
+	return false
+}
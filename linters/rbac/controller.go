@@ -0,0 +1,85 @@
+package rbac
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/kube"
+	"github.com/castai/kvisor/linters"
+)
+
+type castaiClient interface {
+	SendLinterChecks(ctx context.Context, checks []castai.LinterCheck) error
+}
+
+func NewController(log logrus.FieldLogger, cfg config.RBACAnalyzer, client castaiClient) *Controller {
+	log = log.WithField("component", "rbac_analyzer")
+	return &Controller{
+		log:      log,
+		cfg:      cfg,
+		reporter: linters.NewChecksReporter(log, "rbac analyzer", client, cfg.ScanInterval),
+		index:    newIndex(),
+	}
+}
+
+// Controller analyzes RBAC objects for dangerous permissions and sends findings as linter checks.
+type Controller struct {
+	log      logrus.FieldLogger
+	cfg      config.RBACAnalyzer
+	reporter *linters.ChecksReporter
+
+	mu    sync.Mutex
+	index *index
+}
+
+func (c *Controller) RequiredInformers() []reflect.Type {
+	return []reflect.Type{
+		reflect.TypeOf(&rbacv1.ClusterRoleBinding{}),
+		reflect.TypeOf(&rbacv1.RoleBinding{}),
+		reflect.TypeOf(&rbacv1.ClusterRole{}),
+		reflect.TypeOf(&rbacv1.Role{}),
+		reflect.TypeOf(&corev1.ServiceAccount{}),
+	}
+}
+
+func (c *Controller) Run(ctx context.Context) error {
+	return c.reporter.Run(ctx)
+}
+
+func (c *Controller) OnAdd(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnUpdate(obj kube.Object) {
+	c.upsert(obj)
+}
+
+func (c *Controller) OnDelete(obj kube.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reporter.Delete(obj.GetUID())
+	c.analyze(c.index.delete(obj)...)
+}
+
+func (c *Controller) upsert(obj kube.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Bindings referencing added role or service account may be not orphaned anymore.
+	affected := c.index.upsert(obj)
+	c.analyze(append(affected, obj)...)
+}
+
+func (c *Controller) analyze(objs ...kube.Object) {
+	for _, obj := range objs {
+		if check, ok := analyze(obj, c.index); ok {
+			c.reporter.Set(obj.GetUID(), check)
+		}
+	}
+}
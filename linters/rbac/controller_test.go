@@ -0,0 +1,140 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+	"github.com/castai/kvisor/config"
+)
+
+func TestController(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	clusterAdminBinding := func(uid string, subjects ...rbacv1.Subject) *rbacv1.ClusterRoleBinding {
+		return &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: uid,
+				UID:  types.UID("uid-" + uid),
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     "cluster-admin",
+			},
+			Subjects: subjects,
+		}
+	}
+
+	t.Run("flag cluster-admin binding to service account", func(t *testing.T) {
+		r := require.New(t)
+		mockctrl := gomock.NewController(t)
+		castaiClient := mock_castai.NewMockClient(mockctrl)
+		ctrl := NewController(log, config.RBACAnalyzer{}, castaiClient)
+
+		ctrl.OnAdd(newClusterAdminRole())
+		ctrl.OnAdd(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "app"}})
+		ctrl.OnAdd(clusterAdminBinding("sa", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "app", Namespace: "default"}))
+		ctrl.OnAdd(clusterAdminBinding("masters", rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "system:masters"}))
+
+		var sent []castai.LinterCheck
+		castaiClient.EXPECT().SendLinterChecks(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, checks []castai.LinterCheck) error {
+			sent = checks
+			return nil
+		})
+		r.NoError(ctrl.reporter.Send(context.Background(), ctrl.reporter.Flush()))
+
+		r.Len(sent, 2)
+		checks := map[string]castai.LinterCheck{}
+		for _, check := range sent {
+			checks[check.ResourceID] = check
+		}
+		r.Equal([]string{"rbac-cluster-admin-wide-subjects"}, checks["uid-sa"].Failed.Rules())
+		r.Empty(checks["uid-masters"].Failed.Rules())
+		r.ElementsMatch([]string{"rbac-cluster-admin-wide-subjects", "rbac-orphaned-binding"}, checks["uid-masters"].Passed.Rules())
+		r.Empty(ctrl.reporter.Flush())
+	})
+
+	t.Run("flag wildcard rules", func(t *testing.T) {
+		r := require.New(t)
+
+		check, ok := analyze(&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{UID: "role"},
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"*"}},
+			},
+		}, newIndex())
+		r.True(ok)
+		r.True(check.Failed.Has(castai.RBACWildcardPermissions))
+	})
+
+	t.Run("skip default kubernetes roles", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := NewController(log, config.RBACAnalyzer{}, nil)
+
+		ctrl.OnAdd(newClusterAdminRole())
+		r.Empty(ctrl.reporter.Flush())
+	})
+
+	t.Run("flag binding to missing role", func(t *testing.T) {
+		r := require.New(t)
+		ctrl := NewController(log, config.RBACAnalyzer{}, nil)
+
+		binding := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default", UID: "reader"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "reader"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "jane"}},
+		}
+		ctrl.OnAdd(binding)
+		checks := ctrl.reporter.Flush()
+		r.Len(checks, 1)
+		r.True(checks[0].Failed.Has(castai.RBACOrphanedBinding))
+
+		// Binding is analyzed again once referenced role is created.
+		ctrl.OnAdd(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default", UID: "role"}})
+		checks = ctrl.reporter.Flush()
+		r.Len(checks, 2)
+		bindingCheck, _ := lo.Find(checks, func(check castai.LinterCheck) bool { return check.ResourceID == "reader" })
+		r.True(bindingCheck.Passed.Has(castai.RBACOrphanedBinding))
+
+		ctrl.OnDelete(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "default", UID: "role"}})
+		checks = ctrl.reporter.Flush()
+		r.Len(checks, 1)
+		r.True(checks[0].Failed.Has(castai.RBACOrphanedBinding))
+	})
+
+	t.Run("flag binding to missing service account", func(t *testing.T) {
+		r := require.New(t)
+
+		idx := newIndex()
+		idx.upsert(newClusterAdminRole())
+		check, ok := analyze(clusterAdminBinding("sa", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "removed", Namespace: "default"}), idx)
+		r.True(ok)
+		r.True(check.Failed.Has(castai.RBACOrphanedBinding))
+	})
+}
+
+func newClusterAdminRole() *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cluster-admin",
+			UID:    "cluster-admin",
+			Labels: map[string]string{"kubernetes.io/bootstrapping": "rbac-defaults"},
+		},
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package rbac
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/kube"
+)
+
+// objectRef identifies role or service account by kind, namespace and name. Namespace is empty for cluster roles.
+type objectRef struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func newIndex() *index {
+	return &index{
+		objects:  make(map[objectRef]struct{}),
+		bindings: make(map[types.UID]kube.Object),
+	}
+}
+
+// index keeps existing roles, cluster roles and service accounts and all bindings referencing them.
+type index struct {
+	objects  map[objectRef]struct{}
+	bindings map[types.UID]kube.Object
+}
+
+// upsert stores object in index. For roles and service accounts it returns bindings referencing them, which
+// should be analyzed again.
+func (i *index) upsert(o kube.Object) []kube.Object {
+	switch o.(type) {
+	case *rbacv1.ClusterRoleBinding, *rbacv1.RoleBinding:
+		i.bindings[o.GetUID()] = o
+		return nil
+	}
+
+	ref, ok := refOf(o)
+	if !ok {
+		return nil
+	}
+	if _, found := i.objects[ref]; found {
+		return nil
+	}
+	i.objects[ref] = struct{}{}
+	return i.bindingsReferencing(ref)
+}
+
+// delete removes object from index. For roles and service accounts it returns bindings referencing them, which
+// should be analyzed again.
+func (i *index) delete(o kube.Object) []kube.Object {
+	switch o.(type) {
+	case *rbacv1.ClusterRoleBinding, *rbacv1.RoleBinding:
+		delete(i.bindings, o.GetUID())
+		return nil
+	}
+
+	ref, ok := refOf(o)
+	if !ok {
+		return nil
+	}
+	delete(i.objects, ref)
+	return i.bindingsReferencing(ref)
+}
+
+// isOrphaned returns true if binding references not existing role or service account.
+func (i *index) isOrphaned(namespace string, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject) bool {
+	if !i.exists(roleObjectRef(namespace, roleRef)) {
+		return true
+	}
+	for _, subject := range subjects {
+		if subject.Kind != rbacv1.ServiceAccountKind {
+			continue
+		}
+		if !i.exists(serviceAccountObjectRef(namespace, subject)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *index) exists(ref objectRef) bool {
+	_, found := i.objects[ref]
+	return found
+}
+
+func (i *index) bindingsReferencing(ref objectRef) []kube.Object {
+	var res []kube.Object
+	for _, o := range i.bindings {
+		switch v := o.(type) {
+		case *rbacv1.ClusterRoleBinding:
+			if references(v.Namespace, v.RoleRef, v.Subjects, ref) {
+				res = append(res, o)
+			}
+		case *rbacv1.RoleBinding:
+			if references(v.Namespace, v.RoleRef, v.Subjects, ref) {
+				res = append(res, o)
+			}
+		}
+	}
+	return res
+}
+
+func references(namespace string, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject, ref objectRef) bool {
+	if roleObjectRef(namespace, roleRef) == ref {
+		return true
+	}
+	for _, subject := range subjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && serviceAccountObjectRef(namespace, subject) == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func refOf(o kube.Object) (objectRef, bool) {
+	switch o.(type) {
+	case *rbacv1.ClusterRole:
+		return objectRef{kind: "ClusterRole", name: o.GetName()}, true
+	case *rbacv1.Role:
+		return objectRef{kind: "Role", namespace: o.GetNamespace(), name: o.GetName()}, true
+	case *corev1.ServiceAccount:
+		return objectRef{kind: rbacv1.ServiceAccountKind, namespace: o.GetNamespace(), name: o.GetName()}, true
+	}
+	return objectRef{}, false
+}
+
+// roleObjectRef returns referenced role. Cluster roles are not namespaced even if referenced from role binding.
+func roleObjectRef(bindingNamespace string, roleRef rbacv1.RoleRef) objectRef {
+	if roleRef.Kind == "ClusterRole" {
+		return objectRef{kind: roleRef.Kind, name: roleRef.Name}
+	}
+	return objectRef{kind: roleRef.Kind, namespace: bindingNamespace, name: roleRef.Name}
+}
+
+// serviceAccountObjectRef returns referenced service account. Subject namespace defaults to binding namespace.
+func serviceAccountObjectRef(bindingNamespace string, subject rbacv1.Subject) objectRef {
+	namespace := subject.Namespace
+	if namespace == "" {
+		namespace = bindingNamespace
+	}
+	return objectRef{kind: rbacv1.ServiceAccountKind, namespace: namespace, name: subject.Name}
+}
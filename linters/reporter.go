@@ -0,0 +1,107 @@
+package linters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+)
+
+type castaiClient interface {
+	SendLinterChecks(ctx context.Context, checks []castai.LinterCheck) error
+}
+
+func NewChecksReporter(log logrus.FieldLogger, name string, client castaiClient, interval time.Duration) *ChecksReporter {
+	return &ChecksReporter{
+		log:      log,
+		name:     name,
+		client:   client,
+		interval: interval,
+		checks:   make(map[types.UID]castai.LinterCheck),
+	}
+}
+
+// ChecksReporter collects latest linter check per object and periodically sends changed checks. Checks which
+// could not be sent are sent again with the next batch unless object was analyzed again in the meantime.
+type ChecksReporter struct {
+	log      logrus.FieldLogger
+	name     string
+	client   castaiClient
+	interval time.Duration
+
+	mu     sync.Mutex
+	checks map[types.UID]castai.LinterCheck
+}
+
+func (r *ChecksReporter) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.interval):
+			checks := r.Flush()
+			if len(checks) == 0 {
+				continue
+			}
+			if err := r.Send(ctx, checks); err != nil && !errors.Is(err, context.Canceled) {
+				r.log.Error(err)
+				r.requeue(checks)
+			}
+		}
+	}
+}
+
+// Set replaces pending check of object.
+func (r *ChecksReporter) Set(uid types.UID, check castai.LinterCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[uid] = check
+}
+
+// Delete drops pending check of deleted object.
+func (r *ChecksReporter) Delete(uid types.UID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, uid)
+}
+
+// Flush returns pending checks and resets them.
+func (r *ChecksReporter) Flush() []castai.LinterCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() {
+		r.checks = make(map[types.UID]castai.LinterCheck)
+	}()
+
+	return lo.Values(r.checks)
+}
+
+func (r *ChecksReporter) Send(ctx context.Context, checks []castai.LinterCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	if err := r.client.SendLinterChecks(ctx, checks); err != nil {
+		return fmt.Errorf("can not send %s checks: %w", r.name, err)
+	}
+
+	r.log.Infof("%s finished, checks: %d", r.name, len(checks))
+	return nil
+}
+
+// requeue puts unsent checks back unless object was updated in the meantime.
+func (r *ChecksReporter) requeue(checks []castai.LinterCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, check := range checks {
+		if _, found := r.checks[types.UID(check.ResourceID)]; !found {
+			r.checks[types.UID(check.ResourceID)] = check
+		}
+	}
+}
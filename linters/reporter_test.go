@@ -0,0 +1,79 @@
+package linters
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/castai/kvisor/castai"
+	mock_castai "github.com/castai/kvisor/castai/mock"
+)
+
+func TestChecksReporter(t *testing.T) {
+	log := logrus.New()
+	log.SetLevel(logrus.DebugLevel)
+
+	t.Run("send latest check per object", func(t *testing.T) {
+		r := require.New(t)
+		mockctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(mockctrl)
+		reporter := NewChecksReporter(log, "test analyzer", client, time.Millisecond)
+
+		reporter.Set("o1", castai.LinterCheck{ResourceID: "o1", Failed: ruleSet(castai.PodPrivileged)})
+		reporter.Set("o1", castai.LinterCheck{ResourceID: "o1", Passed: ruleSet(castai.PodPrivileged)})
+		reporter.Set("o2", castai.LinterCheck{ResourceID: "o2"})
+		reporter.Delete("o2")
+
+		var sent []castai.LinterCheck
+		client.EXPECT().SendLinterChecks(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, checks []castai.LinterCheck) error {
+			sent = checks
+			return nil
+		})
+		r.NoError(reporter.Send(context.Background(), reporter.Flush()))
+
+		r.Len(sent, 1)
+		r.True(sent[0].Passed.Has(castai.PodPrivileged))
+		r.Empty(reporter.Flush())
+	})
+
+	t.Run("resend failed checks unless object was analyzed again", func(t *testing.T) {
+		r := require.New(t)
+		mockctrl := gomock.NewController(t)
+		client := mock_castai.NewMockClient(mockctrl)
+		reporter := NewChecksReporter(log, "test analyzer", client, time.Millisecond)
+
+		reporter.Set("o1", castai.LinterCheck{ResourceID: "o1"})
+		reporter.Set("o2", castai.LinterCheck{ResourceID: "o2", Failed: ruleSet(castai.PodPrivileged)})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client.EXPECT().SendLinterChecks(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, checks []castai.LinterCheck) error {
+			// Object is analyzed again while checks are being sent.
+			reporter.Set("o2", castai.LinterCheck{ResourceID: "o2", Passed: ruleSet(castai.PodPrivileged)})
+			cancel()
+			return errors.New("unavailable")
+		})
+		r.NoError(reporter.Run(ctx))
+
+		checks := reporter.Flush()
+		r.Len(checks, 2)
+		for _, check := range checks {
+			if check.ResourceID == "o2" {
+				r.True(check.Passed.Has(castai.PodPrivileged))
+			}
+		}
+	})
+}
+
+func ruleSet(rules ...castai.LinterRule) *castai.LinterRuleSet {
+	set := new(castai.LinterRuleSet)
+	for _, rule := range rules {
+		set.Add(rule)
+	}
+	return set
+}
@@ -25,6 +25,13 @@ const (
 	ScanStatusError ScanStatus = "error"
 )
 
+type BlobsCacheEviction string
+
+const (
+	BlobsCacheEvictionSize    BlobsCacheEviction = "size"
+	BlobsCacheEvictionExpired BlobsCacheEviction = "expired"
+)
+
 type timeSinceFunc func(t time.Time) time.Duration
 
 // Used to override time sensitive properties in tests.
@@ -38,6 +45,11 @@ var (
 		Help: "Counter tracking scans and statuses",
 	}, []string{"scan_type", "scan_status"})
 
+	imageScansTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_image_scans_total",
+		Help: "Counter tracking image scans by scan mode and status",
+	}, []string{"mode", "scan_status"})
+
 	scansDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "castai_security_agent_scans_duration",
 		Help:    "Histogram tracking scan durations in seconds",
@@ -58,15 +70,101 @@ var (
 		Name: "castai_security_agent_pending_images",
 		Help: "Gauge for tracking pending container images count",
 	})
+
+	imageScanCoverage = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "castai_security_agent_image_scan_coverage",
+		Help: "Gauge for tracking fraction of discovered container images which are successfully scanned",
+	})
+
+	imagesSampledCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "castai_security_agent_sampled_images",
+		Help: "Gauge for tracking container images selected for scanning when image scan sampling is enabled",
+	})
+
+	imageScanSampledCoverage = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "castai_security_agent_image_scan_sampled_coverage",
+		Help: "Gauge for tracking fraction of sampled container images which are successfully scanned",
+	})
+
+	imagePullErrorsCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "castai_security_agent_image_pull_errors",
+		Help: "Gauge for tracking container images which pods fail to pull",
+	})
+
+	imagesOnNotReadyNodesCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "castai_security_agent_images_on_not_ready_nodes",
+		Help: "Gauge for tracking not scanned container images which are present only on NotReady nodes",
+	})
+
+	staleImagesSweptTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "castai_security_agent_stale_images_swept_total",
+		Help: "Counter tracking unused container images removed after retention period",
+	})
+
+	policyRuleEvaluationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_policy_rule_evaluations_total",
+		Help: "Counter tracking enforced policy rules evaluated during admission and their outcome",
+	}, []string{"rule", "outcome"})
+
+	deltaOversizedObjectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_delta_oversized_objects_total",
+		Help: "Counter tracking objects sent in delta without payload due to exceeded max object size",
+	}, []string{"kind"})
+
+	subscriberPanicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_subscriber_panics_total",
+		Help: "Counter tracking recovered panics of kubernetes objects subscribers",
+	}, []string{"subscriber"})
+
+	imageScanModeFallbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_image_scan_mode_fallbacks_total",
+		Help: "Counter tracking image scans which fell back to remote mode by fallback reason",
+	}, []string{"reason"})
+
+	blobsCacheSizeBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "castai_security_agent_blobs_cache_size_bytes",
+		Help: "Gauge for tracking total size of image blobs cached for scan jobs",
+	})
+
+	blobsCacheEvictionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_blobs_cache_evictions_total",
+		Help: "Counter tracking image blobs removed from cache by eviction reason",
+	}, []string{"reason"})
+
+	cloudScanCacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "castai_security_agent_cloud_scan_cache_lookups_total",
+		Help: "Counter tracking cloud scans which reused previous report (hit) or queried cloud APIs (miss)",
+	}, []string{"result"})
+
+	initialTelemetryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "castai_security_agent_initial_telemetry_duration",
+		Help:    "Histogram tracking initial telemetry call duration in seconds",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 15, 30},
+	})
 )
 
 func init() {
 	prometheus.MustRegister(
 		scansTotal,
+		imageScansTotal,
 		scansDuration,
 		deltasSentTotal,
 		imagesTotalCount,
 		imagesPendingCount,
+		imageScanCoverage,
+		imagesSampledCount,
+		imageScanSampledCoverage,
+		imagePullErrorsCount,
+		imagesOnNotReadyNodesCount,
+		staleImagesSweptTotal,
+		policyRuleEvaluationsTotal,
+		deltaOversizedObjectsTotal,
+		subscriberPanicsTotal,
+		imageScanModeFallbacksTotal,
+		blobsCacheSizeBytes,
+		blobsCacheEvictionsTotal,
+		cloudScanCacheLookupsTotal,
+		initialTelemetryDuration,
 	)
 }
 
@@ -81,6 +179,11 @@ func IncScansTotal(scanType ScanType, err error) {
 	scansTotal.WithLabelValues(string(scanType), string(scanStatus(err))).Inc()
 }
 
+// IncImageScansTotal counts image scans by chosen scan mode, eg. hostfs or remote.
+func IncImageScansTotal(mode string, err error) {
+	imageScansTotal.WithLabelValues(mode, string(scanStatus(err))).Inc()
+}
+
 func SetTotalImagesCount(v int) {
 	imagesTotalCount.Set(float64(v))
 }
@@ -89,11 +192,88 @@ func SetPendingImagesCount(v int) {
 	imagesPendingCount.Set(float64(v))
 }
 
+func SetImageScanCoverage(v float64) {
+	imageScanCoverage.Set(v)
+}
+
+func SetSampledImagesCount(v int) {
+	imagesSampledCount.Set(float64(v))
+}
+
+func SetImageScanSampledCoverage(v float64) {
+	imageScanSampledCoverage.Set(v)
+}
+
+func SetImagePullErrorsCount(v int) {
+	imagePullErrorsCount.Set(float64(v))
+}
+
+func SetImagesOnNotReadyNodesCount(v int) {
+	imagesOnNotReadyNodesCount.Set(float64(v))
+}
+
+func AddStaleImagesSwept(v int) {
+	staleImagesSweptTotal.Add(float64(v))
+}
+
+func IncPolicyRuleEvaluations(rule string, passed bool) {
+	outcome := "failed"
+	if passed {
+		outcome = "passed"
+	}
+	policyRuleEvaluationsTotal.WithLabelValues(rule, outcome).Inc()
+}
+
+func IncDeltaOversizedObjects(kind string) {
+	deltaOversizedObjectsTotal.WithLabelValues(kind).Inc()
+}
+
+// IncSubscriberPanics counts recovered panics of subscriber, eg. *imagescan.Controller.
+func IncSubscriberPanics(subscriber string) {
+	subscriberPanicsTotal.WithLabelValues(subscriber).Inc()
+}
+
+func IncImageScanModeFallbacks(reason string) {
+	imageScanModeFallbacksTotal.WithLabelValues(reason).Inc()
+}
+
+func SetBlobsCacheSizeBytes(v int64) {
+	blobsCacheSizeBytes.Set(float64(v))
+}
+
+func AddBlobsCacheEvictions(reason BlobsCacheEviction, v int) {
+	blobsCacheEvictionsTotal.WithLabelValues(string(reason)).Add(float64(v))
+}
+
+func IncCloudScanCacheLookups(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cloudScanCacheLookupsTotal.WithLabelValues(result).Inc()
+}
+
 func ObserveScanDuration(scanType ScanType, start time.Time) {
 	dur := timeSinceFn(start)
 	scansDuration.WithLabelValues(string(scanType)).Observe(dur.Seconds())
 }
 
+// ObserveScanDurationWithExemplar observes scan duration with trace id exemplar
+// which allows to link slow scans with their traces. Duration is observed without exemplar if trace id is empty.
+func ObserveScanDurationWithExemplar(scanType ScanType, start time.Time, traceID string) {
+	dur := timeSinceFn(start)
+	observer := scansDuration.WithLabelValues(string(scanType))
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exemplarObserver.ObserveWithExemplar(dur.Seconds(), prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	observer.Observe(dur.Seconds())
+}
+
+func ObserveInitialTelemetryDuration(start time.Time) {
+	initialTelemetryDuration.Observe(timeSinceFn(start).Seconds())
+}
+
 func IncDeltasSentTotal() {
 	deltasSentTotal.Inc()
 }
@@ -2,10 +2,14 @@ package metrics
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -35,6 +39,27 @@ castai_security_agent_scans_total{scan_status="ok",scan_type="cloud"} 2
 	r.NoError(testutil.CollectAndCompare(scansTotal, strings.NewReader(expected)))
 }
 
+func TestImageScansTotalMetric(t *testing.T) {
+	r := require.New(t)
+
+	IncImageScansTotal("hostfs", nil)
+	IncImageScansTotal("hostfs", errors.New("ups"))
+	IncImageScansTotal("remote", nil)
+	IncImageScansTotal("remote", nil)
+
+	problems, err := testutil.CollectAndLint(imageScansTotal)
+	r.NoError(err)
+	r.Empty(problems)
+
+	expected := `# HELP castai_security_agent_image_scans_total Counter tracking image scans by scan mode and status
+# TYPE castai_security_agent_image_scans_total counter
+castai_security_agent_image_scans_total{mode="hostfs",scan_status="error"} 1
+castai_security_agent_image_scans_total{mode="hostfs",scan_status="ok"} 1
+castai_security_agent_image_scans_total{mode="remote",scan_status="ok"} 2
+`
+	r.NoError(testutil.CollectAndCompare(imageScansTotal, strings.NewReader(expected)))
+}
+
 func TestScansDurationMetric(t *testing.T) {
 	r := require.New(t)
 
@@ -66,6 +91,24 @@ castai_security_agent_scans_duration_count{scan_type="linter"} 1
 	r.NoError(testutil.CollectAndCompare(scansDuration, strings.NewReader(expected)))
 }
 
+func TestScansDurationMetricExemplar(t *testing.T) {
+	r := require.New(t)
+	t.Cleanup(scansDuration.Reset)
+
+	ObserveScanDurationWithExemplar(ScanTypeImage, time.Now(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	ObserveScanDurationWithExemplar(ScanTypeKubeBench, time.Now(), "")
+
+	reg := prometheus.NewRegistry()
+	r.NoError(reg.Register(scansDuration))
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(rec, req)
+
+	r.Contains(rec.Body.String(), `castai_security_agent_scans_duration_bucket{scan_type="image",le="0.05"} 1 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`)
+	r.Contains(rec.Body.String(), `castai_security_agent_scans_duration_bucket{scan_type="kube-bench",le="0.05"} 1`+"\n")
+}
+
 func TestDeltaSentTotalMetric(t *testing.T) {
 	r := require.New(t)
 
@@ -106,3 +149,23 @@ castai_security_agent_pending_images 3
 `
 	r.NoError(testutil.CollectAndCompare(imagesPendingCount, strings.NewReader(expected)))
 }
+
+func TestPolicyRuleEvaluationsMetric(t *testing.T) {
+	r := require.New(t)
+
+	IncPolicyRuleEvaluations("latest-tag", true)
+	IncPolicyRuleEvaluations("latest-tag", false)
+	IncPolicyRuleEvaluations("privileged-container", true)
+
+	problems, err := testutil.CollectAndLint(policyRuleEvaluationsTotal)
+	r.NoError(err)
+	r.Empty(problems)
+
+	expected := `# HELP castai_security_agent_policy_rule_evaluations_total Counter tracking enforced policy rules evaluated during admission and their outcome
+# TYPE castai_security_agent_policy_rule_evaluations_total counter
+castai_security_agent_policy_rule_evaluations_total{outcome="failed",rule="latest-tag"} 1
+castai_security_agent_policy_rule_evaluations_total{outcome="passed",rule="latest-tag"} 1
+castai_security_agent_policy_rule_evaluations_total{outcome="passed",rule="privileged-container"} 1
+`
+	r.NoError(testutil.CollectAndCompare(policyRuleEvaluationsTotal, strings.NewReader(expected)))
+}
@@ -0,0 +1,38 @@
+package nodeimages
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/nodereport"
+)
+
+type castaiClient interface {
+	SendNodeImagesInventory(ctx context.Context, report *castai.NodeImagesInventory) error
+}
+
+// NewController returns controller which collects images present on nodes from node status and periodically
+// sends full inventory.
+func NewController(log logrus.FieldLogger, cfg config.NodeImages, client castaiClient) *nodereport.Controller[castai.NodeImages] {
+	return nodereport.NewController(log, "nodeimages", cfg.SendInterval, nodeImages, func(ctx context.Context, nodes []castai.NodeImages) error {
+		return client.SendNodeImagesInventory(ctx, &castai.NodeImagesInventory{Nodes: nodes})
+	})
+}
+
+func nodeImages(node *corev1.Node) castai.NodeImages {
+	return castai.NodeImages{
+		NodeName: node.Name,
+		NodeID:   string(node.UID),
+		Images: lo.Map(node.Status.Images, func(img corev1.ContainerImage, _ int) castai.NodeImage {
+			return castai.NodeImage{
+				Names:     img.Names,
+				SizeBytes: img.SizeBytes,
+			}
+		}),
+	}
+}
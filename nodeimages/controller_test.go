@@ -0,0 +1,84 @@
+package nodeimages
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+)
+
+func TestController(t *testing.T) {
+	createNode := func(name string, images ...corev1.ContainerImage) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				UID:  types.UID(name + "-uid"),
+			},
+			Status: corev1.NodeStatus{
+				Images: images,
+			},
+		}
+	}
+
+	t.Run("send node images inventory", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &mockCastaiClient{}
+		ctrl := NewController(logrus.New(), config.NodeImages{}, client)
+
+		ctrl.OnAdd(createNode("n2", corev1.ContainerImage{Names: []string{"redis:7"}, SizeBytes: 200}))
+		ctrl.OnAdd(createNode("n1", corev1.ContainerImage{Names: []string{"nginx:1.25", "nginx@sha256:abc"}, SizeBytes: 100}))
+		ctrl.OnUpdate(createNode("n1",
+			corev1.ContainerImage{Names: []string{"nginx:1.25", "nginx@sha256:abc"}, SizeBytes: 100},
+			corev1.ContainerImage{Names: []string{"busybox:1"}, SizeBytes: 10},
+		))
+
+		r.NoError(ctrl.Send(context.Background()))
+
+		r.Equal(&castai.NodeImagesInventory{
+			Nodes: []castai.NodeImages{
+				{
+					NodeName: "n1",
+					NodeID:   "n1-uid",
+					Images: []castai.NodeImage{
+						{Names: []string{"nginx:1.25", "nginx@sha256:abc"}, SizeBytes: 100},
+						{Names: []string{"busybox:1"}, SizeBytes: 10},
+					},
+				},
+				{
+					NodeName: "n2",
+					NodeID:   "n2-uid",
+					Images: []castai.NodeImage{
+						{Names: []string{"redis:7"}, SizeBytes: 200},
+					},
+				},
+			},
+		}, client.getReport())
+	})
+}
+
+type mockCastaiClient struct {
+	mu     sync.Mutex
+	report *castai.NodeImagesInventory
+}
+
+func (m *mockCastaiClient) SendNodeImagesInventory(ctx context.Context, report *castai.NodeImagesInventory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report = report
+	return nil
+}
+
+func (m *mockCastaiClient) getReport() *castai.NodeImagesInventory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.report
+}
@@ -0,0 +1,38 @@
+package nodeinventory
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+	"github.com/castai/kvisor/nodereport"
+)
+
+type castaiClient interface {
+	SendNodeInventory(ctx context.Context, report *castai.NodeInventory) error
+}
+
+// NewController returns controller which collects nodes OS, kernel and runtime versions from node status and
+// periodically sends full inventory.
+func NewController(log logrus.FieldLogger, cfg config.NodeInventory, client castaiClient) *nodereport.Controller[castai.NodeInfo] {
+	return nodereport.NewController(log, "nodeinventory", cfg.SendInterval, nodeInfo, func(ctx context.Context, nodes []castai.NodeInfo) error {
+		return client.SendNodeInventory(ctx, &castai.NodeInventory{Nodes: nodes})
+	})
+}
+
+func nodeInfo(node *corev1.Node) castai.NodeInfo {
+	info := node.Status.NodeInfo
+	return castai.NodeInfo{
+		NodeName:                node.Name,
+		NodeID:                  string(node.UID),
+		OSImage:                 info.OSImage,
+		OperatingSystem:         info.OperatingSystem,
+		Architecture:            info.Architecture,
+		KernelVersion:           info.KernelVersion,
+		KubeletVersion:          info.KubeletVersion,
+		ContainerRuntimeVersion: info.ContainerRuntimeVersion,
+	}
+}
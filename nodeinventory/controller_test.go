@@ -0,0 +1,85 @@
+package nodeinventory
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/castai/kvisor/castai"
+	"github.com/castai/kvisor/config"
+)
+
+func TestController(t *testing.T) {
+	createNode := func(name, kernelVersion string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				UID:  types.UID(name + "-uid"),
+			},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{
+					OSImage:                 "Ubuntu 22.04.3 LTS",
+					OperatingSystem:         "linux",
+					Architecture:            "amd64",
+					KernelVersion:           kernelVersion,
+					KubeletVersion:          "v1.28.3",
+					ContainerRuntimeVersion: "containerd://1.7.2",
+				},
+			},
+		}
+	}
+
+	t.Run("send node inventory", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &mockCastaiClient{}
+		ctrl := NewController(logrus.New(), config.NodeInventory{}, client)
+
+		ctrl.OnAdd(createNode("n2", "5.15.0-1051-gke"))
+		ctrl.OnAdd(createNode("n1", "5.15.0-1049-gke"))
+		// Kernel is upgraded.
+		ctrl.OnUpdate(createNode("n1", "5.15.0-1051-gke"))
+
+		r.NoError(ctrl.Send(context.Background()))
+
+		node := func(name string) castai.NodeInfo {
+			return castai.NodeInfo{
+				NodeName:                name,
+				NodeID:                  name + "-uid",
+				OSImage:                 "Ubuntu 22.04.3 LTS",
+				OperatingSystem:         "linux",
+				Architecture:            "amd64",
+				KernelVersion:           "5.15.0-1051-gke",
+				KubeletVersion:          "v1.28.3",
+				ContainerRuntimeVersion: "containerd://1.7.2",
+			}
+		}
+		r.Equal(&castai.NodeInventory{
+			Nodes: []castai.NodeInfo{node("n1"), node("n2")},
+		}, client.getReport())
+	})
+}
+
+type mockCastaiClient struct {
+	mu     sync.Mutex
+	report *castai.NodeInventory
+}
+
+func (m *mockCastaiClient) SendNodeInventory(ctx context.Context, report *castai.NodeInventory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report = report
+	return nil
+}
+
+func (m *mockCastaiClient) getReport() *castai.NodeInventory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.report
+}
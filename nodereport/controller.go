@@ -0,0 +1,111 @@
+package nodereport
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/castai/kvisor/kube"
+)
+
+// CollectFunc returns report of a single node.
+type CollectFunc[T any] func(node *corev1.Node) T
+
+// SendFunc sends reports of all known nodes sorted by node name.
+type SendFunc[T any] func(ctx context.Context, nodes []T) error
+
+func NewController[T any](log logrus.FieldLogger, name string, sendInterval time.Duration, collect CollectFunc[T], send SendFunc[T]) *Controller[T] {
+	return &Controller[T]{
+		log:          log.WithField("component", name),
+		name:         name,
+		sendInterval: sendInterval,
+		collect:      collect,
+		send:         send,
+		nodes:        make(map[string]T),
+	}
+}
+
+// Controller collects reports of nodes from node objects and periodically sends reports of all nodes.
+type Controller[T any] struct {
+	log          logrus.FieldLogger
+	name         string
+	sendInterval time.Duration
+	collect      CollectFunc[T]
+	send         SendFunc[T]
+
+	mu    sync.Mutex
+	nodes map[string]T
+}
+
+func (c *Controller[T]) RequiredInformers() []reflect.Type {
+	return []reflect.Type{
+		reflect.TypeOf(&corev1.Node{}),
+	}
+}
+
+func (c *Controller[T]) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.sendInterval):
+			if err := c.Send(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				c.log.Errorf("sending %s report: %v", c.name, err)
+			}
+		}
+	}
+}
+
+func (c *Controller[T]) OnAdd(obj kube.Object) {
+	c.upsertNode(obj)
+}
+
+func (c *Controller[T]) OnUpdate(obj kube.Object) {
+	c.upsertNode(obj)
+}
+
+func (c *Controller[T]) OnDelete(obj kube.Object) {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.nodes, node.Name)
+}
+
+func (c *Controller[T]) upsertNode(obj kube.Object) {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return
+	}
+
+	report := c.collect(node)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nodes[node.Name] = report
+}
+
+// Send sends reports of all known nodes. Nothing is sent until any node is known.
+func (c *Controller[T]) Send(ctx context.Context) error {
+	c.mu.Lock()
+	names := lo.Keys(c.nodes)
+	sort.Strings(names)
+	nodes := lo.Map(names, func(name string, _ int) T {
+		return c.nodes[name]
+	})
+	c.mu.Unlock()
+
+	if len(nodes) == 0 {
+		return nil
+	}
+	return c.send(ctx, nodes)
+}
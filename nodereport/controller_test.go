@@ -0,0 +1,79 @@
+package nodereport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestController(t *testing.T) {
+	createNode := func(name, kernelVersion string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{KernelVersion: kernelVersion},
+			},
+		}
+	}
+	collect := func(node *corev1.Node) string {
+		return node.Name + "/" + node.Status.NodeInfo.KernelVersion
+	}
+
+	t.Run("send reports of all nodes on interval", func(t *testing.T) {
+		r := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sender := &mockSender{}
+		ctrl := NewController(logrus.New(), "test", 10*time.Millisecond, collect, sender.send)
+
+		ctrl.OnAdd(createNode("n2", "5.15.0-1051-gke"))
+		ctrl.OnAdd(createNode("n1", "5.15.0-1049-gke"))
+		ctrl.OnUpdate(createNode("n1", "5.15.0-1051-gke"))
+		ctrl.OnAdd(createNode("n3", "5.15.0-1049-gke"))
+		ctrl.OnDelete(createNode("n3", "5.15.0-1049-gke"))
+
+		go func() {
+			_ = ctrl.Run(ctx)
+		}()
+
+		r.Eventually(func() bool {
+			return sender.getReport() != nil
+		}, time.Second, 10*time.Millisecond)
+		r.Equal([]string{"n1/5.15.0-1051-gke", "n2/5.15.0-1051-gke"}, sender.getReport())
+	})
+
+	t.Run("skip sending empty report", func(t *testing.T) {
+		r := require.New(t)
+
+		sender := &mockSender{}
+		ctrl := NewController(logrus.New(), "test", time.Minute, collect, sender.send)
+
+		r.NoError(ctrl.Send(context.Background()))
+		r.Nil(sender.getReport())
+	})
+}
+
+type mockSender struct {
+	mu     sync.Mutex
+	report []string
+}
+
+func (m *mockSender) send(ctx context.Context, nodes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report = nodes
+	return nil
+}
+
+func (m *mockSender) getReport() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.report
+}
@@ -16,12 +16,14 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/castai/kvisor/castai"
 	"github.com/castai/kvisor/castai/telemetry"
 	"github.com/castai/kvisor/config"
 	"github.com/castai/kvisor/linters/kubelinter"
+	"github.com/castai/kvisor/metrics"
 )
 
 type Enforcer interface {
@@ -36,9 +38,18 @@ type enforcer struct {
 	bundleRules   []string
 	mutex         sync.RWMutex
 	cfg           *config.PolicyEnforcement
+	eventRecorder record.EventRecorder
+
+	// observeRuleEvaluations is called with enforced rules evaluated for each admission decision.
+	observeRuleEvaluations func(evaluations []ruleEvaluation)
+}
+
+type ruleEvaluation struct {
+	rule   string
+	passed bool
 }
 
-func NewEnforcer(linter *kubelinter.Linter, cfg config.PolicyEnforcement) Enforcer {
+func NewEnforcer(linter *kubelinter.Linter, cfg config.PolicyEnforcement, eventRecorder record.EventRecorder) Enforcer {
 	rules := map[string]struct{}{}
 	for _, bundle := range cfg.Bundles {
 		var ruleMap map[string]castai.LinterRule
@@ -65,9 +76,17 @@ func NewEnforcer(linter *kubelinter.Linter, cfg config.PolicyEnforcement) Enforc
 		objectFilters: []objectFilter{
 			skipObjectsWithOwners,
 		},
-		linter:      linter,
-		bundleRules: lo.Keys(rules),
-		cfg:         &cfg,
+		linter:                 linter,
+		bundleRules:            lo.Keys(rules),
+		cfg:                    &cfg,
+		eventRecorder:          eventRecorder,
+		observeRuleEvaluations: recordRuleEvaluations,
+	}
+}
+
+func recordRuleEvaluations(evaluations []ruleEvaluation) {
+	for _, ev := range evaluations {
+		metrics.IncPolicyRuleEvaluations(ev.rule, ev.passed)
 	}
 }
 
@@ -213,12 +232,21 @@ func (e *enforcer) Handle(ctx context.Context, request admission.Request) admiss
 	}
 
 	rules := checks[0].Failed.Rules()
+	e.observeRuleEvaluations(lo.Map(enforcedRules, func(rule string, _ int) ruleEvaluation {
+		return ruleEvaluation{rule: rule, passed: !lo.Contains(rules, rule)}
+	}))
 	if len(rules) == 0 {
 		return admission.Allowed(fmt.Sprintf("object of kind %q passed all checks", kind))
 	}
 
 	sort.Strings(rules)
-	return admission.Denied(fmt.Sprintf("%s did not pass these checks: %v", kind, rules))
+	msg := fmt.Sprintf("%s did not pass these checks: %v", kind, rules)
+	if object.GetNamespace() == "" {
+		// Namespace is not always set in admitted object manifest.
+		object.SetNamespace(request.Namespace)
+	}
+	e.eventRecorder.Event(object, corev1.EventTypeWarning, "PolicyDenied", msg)
+	return admission.Denied(msg)
 }
 
 func (e *enforcer) rules() []string {
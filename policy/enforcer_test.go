@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/castai/kvisor/castai"
@@ -26,7 +27,7 @@ func TestEnforcer(t *testing.T) {
 	t.Run("denies deployment", func(t *testing.T) {
 		r := require.New(t)
 		ctx := context.Background()
-		e := NewEnforcer(linter, config.PolicyEnforcement{})
+		e := NewEnforcer(linter, config.PolicyEnforcement{}, &record.FakeRecorder{})
 		obs := e.TelemetryObserver()
 		obs(&castai.TelemetryResponse{
 			EnforcedRules: lo.Keys(castai.LinterRuleMap),
@@ -50,7 +51,7 @@ func TestEnforcer(t *testing.T) {
 	t.Run("request with no rules enforced", func(t *testing.T) {
 		r := require.New(t)
 		ctx := context.Background()
-		e := NewEnforcer(linter, config.PolicyEnforcement{})
+		e := NewEnforcer(linter, config.PolicyEnforcement{}, &record.FakeRecorder{})
 		var req admission.Request
 		b, err := os.ReadFile("../testdata/admission/sample-deployment.json")
 		r.NoError(err)
@@ -70,7 +71,7 @@ func TestEnforcer(t *testing.T) {
 	t.Run("allows pod", func(t *testing.T) {
 		r := require.New(t)
 		ctx := context.Background()
-		e := NewEnforcer(linter, config.PolicyEnforcement{})
+		e := NewEnforcer(linter, config.PolicyEnforcement{}, &record.FakeRecorder{})
 		obs := e.TelemetryObserver()
 		obs(&castai.TelemetryResponse{
 			EnforcedRules: []string{"latest-tag"},
@@ -94,7 +95,7 @@ func TestEnforcer(t *testing.T) {
 	t.Run("denies pod with owners", func(t *testing.T) {
 		r := require.New(t)
 		ctx := context.Background()
-		e := NewEnforcer(linter, config.PolicyEnforcement{})
+		e := NewEnforcer(linter, config.PolicyEnforcement{}, &record.FakeRecorder{})
 		obs := e.TelemetryObserver()
 		obs(&castai.TelemetryResponse{
 			EnforcedRules: lo.Keys(castai.LinterRuleMap),
@@ -114,4 +115,28 @@ func TestEnforcer(t *testing.T) {
 			},
 		}, response)
 	})
+
+	t.Run("records evaluated enforced rules", func(t *testing.T) {
+		r := require.New(t)
+		ctx := context.Background()
+		e := NewEnforcer(linter, config.PolicyEnforcement{}, &record.FakeRecorder{}).(*enforcer)
+		var evaluations []ruleEvaluation
+		e.observeRuleEvaluations = func(v []ruleEvaluation) {
+			evaluations = append(evaluations, v...)
+		}
+		obs := e.TelemetryObserver()
+		obs(&castai.TelemetryResponse{
+			EnforcedRules: []string{"latest-tag", "run-as-non-root"},
+		})
+		var req admission.Request
+		b, err := os.ReadFile("../testdata/admission/sample-deployment.json")
+		r.NoError(err)
+		r.NoError(json.Unmarshal(b, &req))
+		response := e.Handle(ctx, req)
+		r.False(response.Allowed)
+		r.ElementsMatch([]ruleEvaluation{
+			{rule: "latest-tag", passed: true},
+			{rule: "run-as-non-root", passed: false},
+		}, evaluations)
+	})
 }
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/castai/kvisor/config"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("no-op when endpoint is not configured", func(t *testing.T) {
+		r := require.New(t)
+
+		shutdown, err := Init(context.Background(), config.Tracing{}, config.SecurityAgentVersion{})
+		r.NoError(err)
+		r.NoError(shutdown(context.Background()))
+
+		ctx, span := Start(context.Background(), "test")
+		End(span, nil)
+		r.False(span.SpanContext().IsValid())
+		r.Empty(TraceID(ctx))
+	})
+
+	t.Run("creates spans", func(t *testing.T) {
+		r := require.New(t)
+		exporter := newTestExporter(t)
+
+		ctx, parent := Start(context.Background(), "parent")
+		_, child := Start(ctx, "child", attribute.String("image", "nginx"))
+		End(child, errors.New("ups"))
+		End(parent, nil)
+
+		spans := exporter.GetSpans()
+		r.Len(spans, 2)
+		r.Equal("child", spans[0].Name)
+		r.Equal(codes.Error, spans[0].Status.Code)
+		r.Contains(spans[0].Attributes, attribute.String("image", "nginx"))
+		r.Equal("parent", spans[1].Name)
+		r.Equal(spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+		r.Equal(spans[1].SpanContext.TraceID().String(), TraceID(ctx))
+	})
+}
+
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
@@ -1,13 +1,27 @@
 package version
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
 	"k8s.io/client-go/kubernetes"
 )
 
+// Fallback is version assumed when server version can't be determined. It's the oldest version
+// which serves all stable APIs used by the agent, eg. batch/v1 CronJobs.
+var Fallback = Version{
+	Full:     "1.21",
+	MinorInt: 21,
+}
+
+// retryInitialInterval is initial delay between server version requests.
+var retryInitialInterval = time.Second
+
 func Get(clientset kubernetes.Interface) (Version, error) {
 	cs, ok := clientset.(*kubernetes.Clientset)
 	if !ok {
@@ -30,6 +44,34 @@ func Get(clientset kubernetes.Interface) (Version, error) {
 	}, nil
 }
 
+// GetWithFallback gets server version retrying failed requests with exponential backoff for up to maxElapsedTime.
+// Fallback version is returned if version can't be determined, so flaky API server doesn't abort agent startup.
+func GetWithFallback(ctx context.Context, log logrus.FieldLogger, clientset kubernetes.Interface, maxElapsedTime time.Duration) Version {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = retryInitialInterval
+	b.MaxElapsedTime = maxElapsedTime
+
+	var v Version
+	err := backoff.RetryNotify(func() error {
+		var err error
+		v, err = Get(clientset)
+		return err
+	}, backoff.WithContext(b, ctx), func(err error, next time.Duration) {
+		log.Warnf("getting kubernetes version, retrying in %s: %v", next, err)
+	})
+	if err != nil {
+		log.Warnf("kubernetes version could not be determined, assuming %s: %v", Fallback.Full, err)
+		return Fallback
+	}
+	return v
+}
+
+// AtLeastMinor returns true if kubernetes minor version is at least minMinor. Zero minor version means that
+// cluster version is unknown, in which case version dependent checks are applied.
+func AtLeastMinor(minor, minMinor int) bool {
+	return minor == 0 || minor >= minMinor
+}
+
 type Version struct {
 	Full     string
 	MinorInt int
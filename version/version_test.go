@@ -1,11 +1,15 @@
 package version
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
@@ -42,3 +46,51 @@ func TestVersion(t *testing.T) {
 	r.Equal("1.21+", got.Full)
 	r.Equal(21, got.MinorInt)
 }
+
+func TestGetWithFallback(t *testing.T) {
+	retryInitialInterval = time.Millisecond
+	log := logrus.New()
+
+	newServer := func(failures int32) (*httptest.Server, *atomic.Int32) {
+		var calls atomic.Int32
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if calls.Add(1) <= failures {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			b, _ := json.Marshal(version.Info{Major: "1", Minor: "27"})
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(b)
+		}))
+		t.Cleanup(s.Close)
+		return s, &calls
+	}
+
+	t.Run("retry failed requests", func(t *testing.T) {
+		r := require.New(t)
+		s, calls := newServer(2)
+		client := kubernetes.NewForConfigOrDie(&rest.Config{Host: s.URL})
+
+		got := GetWithFallback(context.Background(), log, client, time.Second)
+		r.Equal(Version{Full: "1.27", MinorInt: 27}, got)
+		r.Equal(int32(3), calls.Load())
+	})
+
+	t.Run("fallback after retries", func(t *testing.T) {
+		r := require.New(t)
+		s, calls := newServer(1000)
+		client := kubernetes.NewForConfigOrDie(&rest.Config{Host: s.URL})
+
+		got := GetWithFallback(context.Background(), log, client, 50*time.Millisecond)
+		r.Equal(Fallback, got)
+		r.Greater(calls.Load(), int32(1))
+	})
+}
+
+func TestAtLeastMinor(t *testing.T) {
+	r := require.New(t)
+	r.True(AtLeastMinor(0, 15), "unknown version")
+	r.True(AtLeastMinor(15, 15))
+	r.True(AtLeastMinor(28, 15))
+	r.False(AtLeastMinor(12, 15))
+}